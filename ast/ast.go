@@ -3,16 +3,18 @@ package ast
 import (
 	"bytes"
 	"strings"
+	"sync/atomic"
 
 	"github.com/frankie-mur/monkeylang/token"
 )
 
 // Node is an interface that represents a node in the abstract syntax tree (AST).
 // The TokenLiteral method returns the literal representation of the token
-// associated with the node.
+// associated with the node, and Pos the source position where the node starts.
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position
 }
 
 // Statement is an interface that represents a statement in the abstract syntax tree.
@@ -64,6 +66,7 @@ type LetStatement struct {
 // Methods on LetStatement to satisfy the Statement interface.
 func (l *LetStatement) statementNode()       {}
 func (l *LetStatement) TokenLiteral() string { return l.Token.Literal }
+func (l *LetStatement) Pos() token.Position  { return l.Token.Pos }
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
@@ -83,7 +86,10 @@ func (ls *LetStatement) String() string {
 // ReturnStatement represents the return statement in the language.
 // It holds the 'return' token and the expression to be returned.
 type ReturnStatement struct {
-	Token       token.Token // the'return' token
+	Token token.Token // the'return' token
+	// Value is never set by the parser.
+	//
+	// Deprecated: Use ReturnValue.
 	Value       Expression
 	ReturnValue Expression
 }
@@ -91,12 +97,15 @@ type ReturnStatement struct {
 // Methods on ReturnStatement to satisfy the Statement interface.
 func (r *ReturnStatement) statementNode()       {}
 func (r *ReturnStatement) TokenLiteral() string { return r.Token.Literal }
+func (r *ReturnStatement) Pos() token.Position  { return r.Token.Pos }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(rs.TokenLiteral() + " ")
 
-	if rs.Value != nil {
+	if rs.ReturnValue != nil {
+		out.WriteString(rs.ReturnValue.String())
+	} else if rs.Value != nil {
 		out.WriteString(rs.Value.String())
 	}
 
@@ -115,6 +124,7 @@ type ExpressionStatement struct {
 // Methods on ExpressionStatement to satisfy the Statement interface.
 func (e *ExpressionStatement) statementNode()       {}
 func (e *ExpressionStatement) TokenLiteral() string { return e.Token.Literal }
+func (e *ExpressionStatement) Pos() token.Position  { return e.Token.Pos }
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -127,11 +137,20 @@ func (es *ExpressionStatement) String() string {
 type Identifier struct {
 	Token token.Token // the token.IDENT token
 	Value string
+	Slot  *Slot // the local variable named, if package resolver found one
+}
+
+// Slot locates a local variable: Index is its position among the locals
+// of the function Depth functions out from the identifier's own.
+type Slot struct {
+	Depth int
+	Index int
 }
 
 // Methods on Identifier to satisfy the Expression interface.
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos }
 func (i *Identifier) String() string       { return i.Value }
 
 // IntegerLiteral represents an integer literal expression in the AST.
@@ -144,8 +163,20 @@ type IntegerLiteral struct {
 // Methods on IntegerLiteral to satisfy the Expression interface.
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
+// FloatLiteral represents a floating point literal expression, such as 3.14.
+type FloatLiteral struct {
+	Token token.Token // the token.FLOAT token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
 type StringLiteral struct {
 	Token token.Token // the token.STRING token
 	Value string
@@ -154,6 +185,7 @@ type StringLiteral struct {
 // Methods on StringLiteral to satisfy the Expression interface.
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
 // PrefixExpression represents a prefix expression in the abstract syntax tree.
@@ -167,6 +199,7 @@ type PrefixExpression struct {
 // Methods on PrefixExpression to satisfy the Expression interface.
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -190,6 +223,7 @@ type InfixExpression struct {
 // Methods on InfixExpression to satisfy the Expression interface.
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Position  { return ie.Left.Pos() }
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -202,6 +236,48 @@ func (ie *InfixExpression) String() string {
 	return out.String()
 }
 
+// AssignExpression represents the assignment of Value to Name, a variable
+// bound before. Its value is the value assigned. A compound assignment such
+// as x += 1 has the Operator of the infix expression it applies, here +,
+// and assigns the result of x + Value.
+type AssignExpression struct {
+	Token    token.Token // the '=' token, or that of the compound assignment
+	Name     *Identifier
+	Operator string // the infix operator of a compound assignment, else ""
+	Value    Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) Pos() token.Position  { return ae.Name.Pos() }
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Name.String())
+	out.WriteString(" " + ae.Token.Literal + " ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// PostfixExpression represents x++ or x--, which add one to or subtract
+// one from Target, a variable bound before or an element of an array or a
+// hash. Its value is the one Target had before.
+type PostfixExpression struct {
+	Token    token.Token // the '++' or '--' token
+	Target   Expression  // an *Identifier or an *IndexExpression
+	Operator string
+}
+
+func (pe *PostfixExpression) expressionNode()      {}
+func (pe *PostfixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PostfixExpression) Pos() token.Position  { return pe.Target.Pos() }
+func (pe *PostfixExpression) String() string {
+	return "(" + pe.Target.String() + pe.Operator + ")"
+}
+
 // Boolean represents a boolean value in the Monkey programming language.
 // It contains a Token, which is the token that represents the boolean value,
 // and a Value field that holds the actual boolean value.
@@ -213,6 +289,7 @@ type Boolean struct {
 // Methods on Boolean to satisfy the Expression interface.
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.Position  { return b.Token.Pos }
 func (b *Boolean) String() string       { return b.Token.Literal }
 
 // IfExpression represents an if-else expression in the language.
@@ -228,6 +305,7 @@ type IfExpression struct {
 // Methods on IfExpression to satisfy the Expression interface.
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -243,6 +321,60 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// WhileExpression represents a while loop, which evaluates Body for as long
+// as Condition is truthy. Its value is null.
+type WhileExpression struct {
+	Token     token.Token // the 'while' token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (we *WhileExpression) expressionNode()      {}
+func (we *WhileExpression) TokenLiteral() string { return we.Token.Literal }
+func (we *WhileExpression) Pos() token.Position  { return we.Token.Pos }
+func (we *WhileExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while")
+	out.WriteString(we.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(we.Body.String())
+
+	return out.String()
+}
+
+// ForExpression represents a for loop, which evaluates Body once for each
+// element of the collection Iterable evaluates to, binding Value to the
+// element. With a Key, it binds Key to the element's index or hash key and
+// Value to the element. Its value is null.
+type ForExpression struct {
+	Token    token.Token // the 'for' token
+	Key      *Identifier // nil unless the loop binds two variables
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fe *ForExpression) expressionNode()      {}
+func (fe *ForExpression) TokenLiteral() string { return fe.Token.Literal }
+func (fe *ForExpression) Pos() token.Position  { return fe.Token.Pos }
+func (fe *ForExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fe.Key != nil {
+		out.WriteString(fe.Key.String())
+		out.WriteString(", ")
+	}
+	out.WriteString(fe.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fe.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fe.Body.String())
+
+	return out.String()
+}
+
 // BlockStatement represents a block of statements. The block is delimited
 // by a pair of curly braces { }.
 type BlockStatement struct {
@@ -252,6 +384,7 @@ type BlockStatement struct {
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -268,11 +401,15 @@ type FunctionLiteral struct {
 	Token      token.Token   // the 'fn' token
 	Parameters []*Identifier // the function parameters
 	Body       *BlockStatement
+	// Locals names the parameters and the variables the body binds with
+	// let, by slot. It is nil until package resolver resolves the function.
+	Locals []string
 }
 
 // Methods on FunctionLiteral to satisfy the Expression interface.
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
@@ -290,17 +427,55 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+// Doc returns the function's docstring: a string literal that is the first
+// of several statements of its body. The string is still evaluated like
+// any other statement; a body that is only a string returns it instead of
+// documenting the function.
+func (fl *FunctionLiteral) Doc() string {
+	if fl.Body == nil || len(fl.Body.Statements) < 2 {
+		return ""
+	}
+	stmt, ok := fl.Body.Statements[0].(*ExpressionStatement)
+	if !ok || stmt == nil {
+		return ""
+	}
+	if str, ok := stmt.Expression.(*StringLiteral); ok && str != nil {
+		return str.Value
+	}
+	return ""
+}
+
 // CallExpression represents a function call expression in the AST.
 // It contains the function being called, and the arguments passed to it.
 type CallExpression struct {
 	Token     token.Token // the '(' token
 	Function  Expression  // Identifier or FunctionLiteral
 	Arguments []Expression
+	Cache     *Cache // of the function called, if package resolver set one
+
+	// Tail reports whether the call is in tail position: the function
+	// literal making it returns its value directly. The parser sets it.
+	Tail bool
+}
+
+// Cache holds what an evaluator learned evaluating a node, such as the
+// function a call site called, to skip the work when it next evaluates the
+// node. The evaluator decides what a cached value is and when it is still
+// valid. A Cache is safe for concurrent use.
+type Cache struct {
+	v atomic.Value
 }
 
+// Load returns the cached value, or nil if there is none.
+func (c *Cache) Load() interface{} { return c.v.Load() }
+
+// Store caches v. Every value stored must be of the same type.
+func (c *Cache) Store(v interface{}) { c.v.Store(v) }
+
 // // Methods on callExpression to satisfy the Expression interface.
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position  { return ce.Function.Pos() }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -326,6 +501,7 @@ type ArrayLiteral struct {
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 	elements := []string{}
@@ -349,6 +525,7 @@ type IndexExpression struct {
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return ie.Left.Pos() }
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
@@ -361,21 +538,54 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// SliceExpression represents left[low:high], which copies the elements of
+// an array or the bytes of a string from index Low up to but not including
+// index High. Either bound may be left out.
+type SliceExpression struct {
+	Token token.Token // the '[' token
+	Left  Expression
+	Low   Expression // nil if left out
+	High  Expression // nil if left out
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) Pos() token.Position  { return se.Left.Pos() }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Low != nil {
+		out.WriteString(se.Low.String())
+	}
+	out.WriteString(":")
+	if se.High != nil {
+		out.WriteString(se.High.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
 // HashLiteral represents a hash literal expression in the Monkey programming language.
 // It contains the '{' token, a map of key-value pairs, and the '}' token.
 type HashLiteral struct {
 	Token token.Token // the '{' token
 	Pairs map[Expression]Expression
+	Keys  []Expression // the keys of Pairs in source order
 }
 
 func (hl *HashLiteral) expressionNode()      {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 
 	out.WriteString("{")
@@ -385,6 +595,141 @@ func (hl *HashLiteral) String() string {
 	return out.String()
 }
 
+// EnumStatement declares an enum, binding a constructor for each of its
+// variants, or the variant's only value if it has no field list.
+type EnumStatement struct {
+	Token    token.Token // the token.ENUM token
+	Name     *Identifier
+	Variants []*EnumVariant
+}
+
+func (es *EnumStatement) statementNode()       {}
+func (es *EnumStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *EnumStatement) Pos() token.Position  { return es.Token.Pos }
+func (es *EnumStatement) String() string {
+	variants := []string{}
+	for _, v := range es.Variants {
+		variants = append(variants, v.String())
+	}
+	return "enum " + es.Name.String() + " { " + strings.Join(variants, ", ") + " }"
+}
+
+// EnumVariant is a variant of an enum declaration, such as Rect(w, h).
+// Fields is nil for a variant written without parentheses.
+type EnumVariant struct {
+	Name   *Identifier
+	Fields []*Identifier
+}
+
+func (ev *EnumVariant) TokenLiteral() string { return ev.Name.TokenLiteral() }
+func (ev *EnumVariant) Pos() token.Position  { return ev.Name.Pos() }
+func (ev *EnumVariant) String() string {
+	return ev.Name.String() + fieldList(ev.Fields)
+}
+
+// MatchExpression evaluates to the body of the first of its arms whose
+// pattern matches the value of Subject.
+type MatchExpression struct {
+	Token   token.Token // the token.MATCH token
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) Pos() token.Position  { return me.Token.Pos }
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("match (")
+	out.WriteString(me.Subject.String())
+	out.WriteString(") {")
+	for _, arm := range me.Arms {
+		out.WriteString(" ")
+		out.WriteString(arm.String())
+	}
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// SwitchExpression evaluates to the body of the first of its cases whose
+// value equals the value of Subject, or to Default if none does.
+type SwitchExpression struct {
+	Token   token.Token // the token.SWITCH token
+	Subject Expression
+	Cases   []*SwitchCase
+	Default *BlockStatement // nil if there is no default case
+}
+
+func (se *SwitchExpression) expressionNode()      {}
+func (se *SwitchExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SwitchExpression) Pos() token.Position  { return se.Token.Pos }
+func (se *SwitchExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("switch (")
+	out.WriteString(se.Subject.String())
+	out.WriteString(") {")
+	for _, c := range se.Cases {
+		out.WriteString(" ")
+		out.WriteString(c.String())
+	}
+	if se.Default != nil {
+		out.WriteString(" default: ")
+		out.WriteString(se.Default.String())
+	}
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// SwitchCase is a case of a switch expression, such as case 1: { "one" }.
+type SwitchCase struct {
+	Token token.Token // the token.CASE token
+	Value Expression
+	Body  *BlockStatement
+}
+
+func (sc *SwitchCase) TokenLiteral() string { return sc.Token.Literal }
+func (sc *SwitchCase) Pos() token.Position  { return sc.Token.Pos }
+func (sc *SwitchCase) String() string {
+	return "case " + sc.Value.String() + ": " + sc.Body.String()
+}
+
+// MatchArm is an arm of a match expression, such as Rect(w, h) => { w * h }.
+// Pattern names the variant the arm matches, or is _ to match any value.
+// Fields binds the values of the variant's fields; it is nil for a pattern
+// written without parentheses, which matches the variant whatever its
+// fields. An arm is a scope of its own, like a function body.
+type MatchArm struct {
+	Pattern *Identifier
+	Fields  []*Identifier
+	Body    *BlockStatement
+	// Locals names the fields and the variables the body binds with let,
+	// by slot. It is nil until package resolver resolves the arm.
+	Locals []string
+}
+
+func (ma *MatchArm) TokenLiteral() string { return ma.Pattern.TokenLiteral() }
+func (ma *MatchArm) Pos() token.Position  { return ma.Pattern.Pos() }
+func (ma *MatchArm) String() string {
+	return ma.Pattern.String() + fieldList(ma.Fields) + " => " + ma.Body.String()
+}
+
+// fieldList writes the field names of a variant or a pattern in
+// parentheses, or nothing if the fields are nil.
+func fieldList(fields []*Identifier) string {
+	if fields == nil {
+		return ""
+	}
+	names := []string{}
+	for _, f := range fields {
+		names = append(names, f.String())
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
+
 // TokenLiteral returns the token literal of the first statement in the program.
 // If the program has no statements, it returns an empty string.
 func (p *Program) TokenLiteral() string {
@@ -394,3 +739,11 @@ func (p *Program) TokenLiteral() string {
 		return ""
 	}
 }
+
+// Pos returns the position of the first statement in the program.
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/frankie-mur/monkeylang/token"
@@ -35,3 +36,83 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. Got: %q", program.String())
 	}
 }
+
+func TestInspect(t *testing.T) {
+	// let x = -a + b;
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let"},
+				Name:  &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x"}, Value: "x"},
+				Value: &InfixExpression{
+					Token:    token.Token{Type: token.PLUS, Literal: "+"},
+					Operator: "+",
+					Left: &PrefixExpression{
+						Token:    token.Token{Type: token.MINUS, Literal: "-"},
+						Operator: "-",
+						Right:    &Identifier{Token: token.Token{Type: token.IDENT, Literal: "a"}, Value: "a"},
+					},
+					Right: &Identifier{Token: token.Token{Type: token.IDENT, Literal: "b"}, Value: "b"},
+				},
+			},
+		},
+	}
+
+	var visited []string
+	Inspect(program, func(n Node) bool {
+		if n != nil {
+			visited = append(visited, n.TokenLiteral())
+		}
+		return true
+	})
+
+	expected := []string{"let", "let", "x", "+", "-", "a", "b"}
+	if len(visited) != len(expected) {
+		t.Fatalf("wrong number of nodes visited. expected=%v, got=%v", expected, visited)
+	}
+	for i := range expected {
+		if visited[i] != expected[i] {
+			t.Errorf("visited[%d] wrong. expected=%q, got=%q", i, expected[i], visited[i])
+		}
+	}
+}
+
+func TestFprintAndJSON(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&ReturnStatement{
+				Token: token.Token{Type: token.RETURN, Literal: "return", Pos: token.Position{Line: 1, Column: 1}},
+				ReturnValue: &IntegerLiteral{
+					Token: token.Token{Type: token.INT, Literal: "5", Pos: token.Position{Offset: 7, Line: 1, Column: 8}},
+					Value: 5,
+				},
+			},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := Fprint(&out, program); err != nil {
+		t.Fatalf("Fprint returned error: %s", err)
+	}
+	expectedTree := "Program 1:1\n  Statements:\n    ReturnStatement 1:1\n      ReturnValue: IntegerLiteral 1:8 Value=5\n"
+	if out.String() != expectedTree {
+		t.Errorf("Fprint wrong.\nexpected=%q\ngot=%q", expectedTree, out.String())
+	}
+
+	js, err := JSON(program.Statements[0])
+	if err != nil {
+		t.Fatalf("JSON returned error: %s", err)
+	}
+	expectedJSON := `{
+  "node": "ReturnStatement",
+  "pos": "1:1",
+  "returnValue": {
+    "node": "IntegerLiteral",
+    "pos": "1:8",
+    "value": 5
+  }
+}`
+	if string(js) != expectedJSON {
+		t.Errorf("JSON wrong.\nexpected=%s\ngot=%s", expectedJSON, js)
+	}
+}
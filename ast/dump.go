@@ -0,0 +1,219 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Dumping works on the node structs through reflection, so node types added
+// later show up without changes here. The Token field is summarised by the
+// node's position, and HashLiteral pairs are listed in source order.
+
+// Fprint writes node to w as an indented tree, one node or field per line.
+func Fprint(w io.Writer, node Node) error {
+	var out bytes.Buffer
+	printNode(&out, "", node, 0)
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+func printNode(out *bytes.Buffer, label string, node Node, depth int) {
+	out.WriteString(strings.Repeat("  ", depth))
+	if label != "" {
+		out.WriteString(label + ": ")
+	}
+
+	v := reflect.ValueOf(node).Elem()
+	out.WriteString(v.Type().Name())
+	if pos := node.Pos(); pos.IsValid() {
+		out.WriteString(" " + pos.String())
+	}
+
+	var children []func()
+	for _, f := range nodeFields(v) {
+		switch val := f.value.(type) {
+		case Node:
+			name := f.name
+			children = append(children, func() { printNode(out, name, val, depth+1) })
+		case []Node:
+			name := f.name
+			children = append(children, func() {
+				out.WriteString(strings.Repeat("  ", depth+1) + name + ":")
+				if len(val) == 0 {
+					out.WriteString(" []")
+				}
+				out.WriteString("\n")
+				for _, n := range val {
+					printNode(out, "", n, depth+2)
+				}
+			})
+		case []pair:
+			name := f.name
+			children = append(children, func() {
+				out.WriteString(strings.Repeat("  ", depth+1) + name + ":")
+				if len(val) == 0 {
+					out.WriteString(" []")
+				}
+				out.WriteString("\n")
+				for _, p := range val {
+					printNode(out, "Key", p.Key, depth+2)
+					printNode(out, "Value", p.Value, depth+2)
+				}
+			})
+		default:
+			fmt.Fprintf(out, " %s=%s", f.name, formatScalar(val))
+		}
+	}
+	out.WriteString("\n")
+
+	for _, child := range children {
+		child()
+	}
+}
+
+func formatScalar(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprint(v)
+}
+
+// JSON returns node encoded as a JSON object. Every object carries a "node"
+// member naming its type and, when known, a "pos" member with its line:col.
+func JSON(node Node) ([]byte, error) {
+	return json.MarshalIndent(jsonNode(node), "", "  ")
+}
+
+func jsonNode(node Node) object {
+	v := reflect.ValueOf(node).Elem()
+	obj := object{{"node", v.Type().Name()}}
+	if pos := node.Pos(); pos.IsValid() {
+		obj = append(obj, member{"pos", pos.String()})
+	}
+
+	for _, f := range nodeFields(v) {
+		name := strings.ToLower(f.name[:1]) + f.name[1:]
+		switch val := f.value.(type) {
+		case Node:
+			obj = append(obj, member{name, jsonNode(val)})
+		case []Node:
+			list := []object{}
+			for _, n := range val {
+				list = append(list, jsonNode(n))
+			}
+			obj = append(obj, member{name, list})
+		case []pair:
+			list := []object{}
+			for _, p := range val {
+				list = append(list, object{{"key", jsonNode(p.Key)}, {"value", jsonNode(p.Value)}})
+			}
+			obj = append(obj, member{name, list})
+		default:
+			obj = append(obj, member{name, val})
+		}
+	}
+
+	return obj
+}
+
+type field struct {
+	name  string
+	value interface{} // a Node, []Node, []pair or a scalar
+}
+
+type pair struct {
+	Key, Value Node
+}
+
+var nodeType = reflect.TypeOf((*Node)(nil)).Elem()
+
+// nodeFields lists the exported fields of a node struct that carry syntax,
+// skipping the token, the annotations of package resolver and unset
+// optional children.
+func nodeFields(v reflect.Value) []field {
+	var fields []field
+
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		fv := v.Field(i)
+		if !sf.IsExported() || sf.Name == "Token" || sf.Name == "Keys" ||
+			sf.Name == "Slot" || sf.Name == "Locals" || sf.Name == "Cache" {
+			continue
+		}
+
+		switch {
+		case fv.Kind() == reflect.Map:
+			// HashLiteral.Pairs; Keys holds their source order.
+			var pairs []pair
+			keys := v.FieldByName("Keys")
+			for j := 0; j < keys.Len(); j++ {
+				key := keys.Index(j)
+				pairs = append(pairs, pair{key.Interface().(Node), fv.MapIndex(key).Interface().(Node)})
+			}
+			fields = append(fields, field{sf.Name, pairs})
+
+		case fv.Kind() == reflect.Slice:
+			nodes := []Node{}
+			for j := 0; j < fv.Len(); j++ {
+				if n, ok := fv.Index(j).Interface().(Node); ok && !isNil(fv.Index(j)) {
+					nodes = append(nodes, n)
+				}
+			}
+			fields = append(fields, field{sf.Name, nodes})
+
+		case fv.Type().Implements(nodeType) || fv.Kind() == reflect.Interface:
+			if isNil(fv) {
+				continue
+			}
+			fields = append(fields, field{sf.Name, fv.Interface().(Node)})
+
+		default:
+			fields = append(fields, field{sf.Name, fv.Interface()})
+		}
+	}
+
+	return fields
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
+		return v.IsNil() || (v.Kind() == reflect.Interface && v.Elem().Kind() == reflect.Ptr && v.Elem().IsNil())
+	}
+	return false
+}
+
+// object is a JSON object that keeps its members in insertion order.
+type object []member
+
+type member struct {
+	key   string
+	value interface{}
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteString("{")
+	for i, m := range o {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		key, err := json.Marshal(m.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(key)
+		out.WriteString(":")
+		out.Write(value)
+	}
+	out.WriteString("}")
+	return out.Bytes(), nil
+}
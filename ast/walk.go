@@ -0,0 +1,179 @@
+package ast
+
+// Visitor is implemented by types that traverse the AST with Walk. Visit is
+// called for every node; if the returned visitor w is not nil, Walk visits
+// each of the node's children with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order, starting with node. Children
+// are visited in source order.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, s := range n.Statements {
+			Walk(v, s)
+		}
+
+	case *LetStatement:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		walkIfNotNil(v, n.Value)
+
+	case *ReturnStatement:
+		walkIfNotNil(v, n.ReturnValue)
+
+	case *ExpressionStatement:
+		walkIfNotNil(v, n.Expression)
+
+	case *BlockStatement:
+		for _, s := range n.Statements {
+			Walk(v, s)
+		}
+
+	case *PrefixExpression:
+		walkIfNotNil(v, n.Right)
+
+	case *InfixExpression:
+		walkIfNotNil(v, n.Left)
+		walkIfNotNil(v, n.Right)
+
+	case *IfExpression:
+		walkIfNotNil(v, n.Condition)
+		if n.Consequence != nil {
+			Walk(v, n.Consequence)
+		}
+		if n.Alternative != nil {
+			Walk(v, n.Alternative)
+		}
+
+	case *FunctionLiteral:
+		for _, p := range n.Parameters {
+			Walk(v, p)
+		}
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+
+	case *AssignExpression:
+		Walk(v, n.Name)
+		walkIfNotNil(v, n.Value)
+
+	case *CallExpression:
+		walkIfNotNil(v, n.Function)
+		for _, a := range n.Arguments {
+			walkIfNotNil(v, a)
+		}
+
+	case *ArrayLiteral:
+		for _, e := range n.Elements {
+			walkIfNotNil(v, e)
+		}
+
+	case *IndexExpression:
+		walkIfNotNil(v, n.Left)
+		walkIfNotNil(v, n.Index)
+
+	case *SliceExpression:
+		walkIfNotNil(v, n.Left)
+		walkIfNotNil(v, n.Low)
+		walkIfNotNil(v, n.High)
+
+	case *HashLiteral:
+		for _, key := range n.Keys {
+			walkIfNotNil(v, key)
+			walkIfNotNil(v, n.Pairs[key])
+		}
+
+	case *EnumStatement:
+		Walk(v, n.Name)
+		for _, variant := range n.Variants {
+			Walk(v, variant)
+		}
+
+	case *EnumVariant:
+		Walk(v, n.Name)
+		for _, f := range n.Fields {
+			Walk(v, f)
+		}
+
+	case *WhileExpression:
+		walkIfNotNil(v, n.Condition)
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+
+	case *ForExpression:
+		if n.Key != nil {
+			Walk(v, n.Key)
+		}
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+		walkIfNotNil(v, n.Iterable)
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+
+	case *MatchExpression:
+		walkIfNotNil(v, n.Subject)
+		for _, arm := range n.Arms {
+			Walk(v, arm)
+		}
+
+	case *PostfixExpression:
+		walkIfNotNil(v, n.Target)
+
+	case *SwitchExpression:
+		walkIfNotNil(v, n.Subject)
+		for _, c := range n.Cases {
+			Walk(v, c)
+		}
+		if n.Default != nil {
+			Walk(v, n.Default)
+		}
+
+	case *SwitchCase:
+		walkIfNotNil(v, n.Value)
+		Walk(v, n.Body)
+
+	case *MatchArm:
+		Walk(v, n.Pattern)
+		for _, f := range n.Fields {
+			Walk(v, f)
+		}
+		Walk(v, n.Body)
+	}
+
+	v.Visit(nil)
+}
+
+// walkIfNotNil guards against the nil expressions a parser leaves behind
+// after a syntax error.
+func walkIfNotNil(v Visitor, e Expression) {
+	if e != nil {
+		Walk(v, e)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order, calling f for each node.
+// If f returns true, Inspect continues with the node's children, and it
+// calls f(nil) once they are done.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,172 @@
+// Package benchmark holds canonical Monkey programs and measures them on
+// both engines, the tree-walking evaluator and the bytecode VM, so their
+// performance can be compared and regressions tracked over time.
+//
+// The Go benchmarks run every program on every engine:
+//
+//	go test ./benchmark -bench .
+//
+// and a side-by-side report is printed by
+//
+//	go test ./benchmark -run Report -report
+package benchmark
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"text/tabwriter"
+
+	"github.com/frankie-mur/monkeylang/compiler"
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/parser"
+	"github.com/frankie-mur/monkeylang/resolver"
+	"github.com/frankie-mur/monkeylang/vm"
+)
+
+// The engines a program can be measured on. VMOptimized runs the bytecode
+// rewritten by compiler.Optimize, as `monkey run -O` does.
+const (
+	Eval        = "eval"
+	VM          = "vm"
+	VMOptimized = "vm-O"
+)
+
+// Engines lists every engine in report order.
+var Engines = []string{Eval, VM, VMOptimized}
+
+// Program is a benchmark program. Expected is the Inspect form of the value
+// of its last expression, which every engine must produce.
+type Program struct {
+	Name     string
+	Source   string
+	Expected string
+}
+
+// Prepare parses p, and compiles it for the VM, and returns a function that
+// runs it once on engine and returns its result.
+func Prepare(p Program, engine string) (func() (object.Object, error), error) {
+	l := lexer.New(p.Source)
+	pa := parser.New(l)
+	program := pa.ParseProgram()
+	if len(pa.ParseErrors()) != 0 {
+		return nil, fmt.Errorf("%s: %s", p.Name, pa.ParseErrors()[0])
+	}
+
+	switch engine {
+	case Eval:
+		resolver.Resolve(program)
+		return func() (object.Object, error) {
+			result := evaluator.Eval(program, object.NewEnvironment())
+			if errObj, ok := result.(*object.Error); ok {
+				return nil, errors.New(errObj.Message)
+			}
+			return result, nil
+		}, nil
+
+	case VM, VMOptimized:
+		bytecode, err := compiler.Compile(program)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p.Name, err)
+		}
+		if engine == VMOptimized {
+			bytecode = compiler.Optimize(bytecode)
+		}
+		return func() (object.Object, error) {
+			machine := vm.New(bytecode)
+			if err := machine.Run(); err != nil {
+				return nil, err
+			}
+			return machine.LastPoppedStackElem(), nil
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown engine %q", engine)
+}
+
+// Result is the measurement of one program on one engine.
+type Result struct {
+	Program     string
+	Engine      string
+	N           int
+	NsPerOp     int64
+	AllocsPerOp int64
+}
+
+// Measure runs p on engine for about a second, like a Go benchmark, after
+// checking that it produces the expected result.
+func Measure(p Program, engine string) (Result, error) {
+	run, err := Prepare(p, engine)
+	if err != nil {
+		return Result{}, err
+	}
+	result, err := run()
+	if err != nil {
+		return Result{}, fmt.Errorf("%s on %s: %w", p.Name, engine, err)
+	}
+	if result.Inspect() != p.Expected {
+		return Result{}, fmt.Errorf("%s on %s: got %s, want %s", p.Name, engine, result.Inspect(), p.Expected)
+	}
+
+	br := testing.Benchmark(func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			run()
+		}
+	})
+
+	return Result{
+		Program:     p.Name,
+		Engine:      engine,
+		N:           br.N,
+		NsPerOp:     br.NsPerOp(),
+		AllocsPerOp: br.AllocsPerOp(),
+	}, nil
+}
+
+// WriteReport writes a table comparing the engines on every program in
+// results, with the speedup of each VM engine over the evaluator.
+func WriteReport(w io.Writer, results []Result) {
+	byProgram := map[string]map[string]Result{}
+	var order []string
+	for _, r := range results {
+		if byProgram[r.Program] == nil {
+			byProgram[r.Program] = map[string]Result{}
+			order = append(order, r.Program)
+		}
+		byProgram[r.Program][r.Engine] = r
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "program\t")
+	for _, engine := range Engines {
+		fmt.Fprintf(tw, "%s ns/op\t%s allocs/op\t", engine, engine)
+	}
+	for _, engine := range Engines[1:] {
+		fmt.Fprintf(tw, "%s speedup\t", engine)
+	}
+	fmt.Fprintf(tw, "\n")
+
+	for _, name := range order {
+		fmt.Fprintf(tw, "%s\t", name)
+		for _, engine := range Engines {
+			r := byProgram[name][engine]
+			fmt.Fprintf(tw, "%d\t%d\t", r.NsPerOp, r.AllocsPerOp)
+		}
+		eval := byProgram[name][Eval]
+		for _, engine := range Engines[1:] {
+			r := byProgram[name][engine]
+			if eval.NsPerOp > 0 && r.NsPerOp > 0 {
+				fmt.Fprintf(tw, "%.2fx\t", float64(eval.NsPerOp)/float64(r.NsPerOp))
+			} else {
+				fmt.Fprintf(tw, "-\t")
+			}
+		}
+		fmt.Fprintf(tw, "\n")
+	}
+
+	tw.Flush()
+}
@@ -0,0 +1,66 @@
+package benchmark
+
+import (
+	"flag"
+	"os"
+	"testing"
+)
+
+var report = flag.Bool("report", false, "measure every program on every engine and print a comparison")
+
+func TestPrograms(t *testing.T) {
+	for _, p := range Programs {
+		for _, engine := range Engines {
+			run, err := Prepare(p, engine)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := run()
+			if err != nil {
+				t.Errorf("%s on %s: %s", p.Name, engine, err)
+				continue
+			}
+			if result.Inspect() != p.Expected {
+				t.Errorf("%s on %s: wrong result. want=%s, got=%s", p.Name, engine, p.Expected, result.Inspect())
+			}
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	if !*report {
+		t.Skip("run with -report to compare the engines")
+	}
+
+	var results []Result
+	for _, p := range Programs {
+		for _, engine := range Engines {
+			r, err := Measure(p, engine)
+			if err != nil {
+				t.Fatal(err)
+			}
+			results = append(results, r)
+		}
+	}
+	WriteReport(os.Stdout, results)
+}
+
+func BenchmarkPrograms(b *testing.B) {
+	for _, p := range Programs {
+		for _, engine := range Engines {
+			run, err := Prepare(p, engine)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.Run(p.Name+"/"+engine, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := run(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package benchmark
+
+// Programs are the canonical benchmark programs. Monkey has no loops, so
+// they iterate by recursion, mostly in tail position.
+var Programs = []Program{
+	{
+		Name: "fibonacci",
+		Source: `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+fib(20)`,
+		Expected: "6765",
+	},
+	{
+		Name: "array-sort",
+		Source: `
+let next = fn(seed) {
+  let x = seed * 1103515245 + 12345;
+  x - (x / 2147483648) * 2147483648
+};
+let build = fn(n, seed, acc) {
+  if (n == 0) { acc } else { build(n - 1, next(seed), push(acc, seed / 65536)) }
+};
+let concat = fn(acc, xs) {
+  if (len(xs) == 0) { acc } else { concat(push(acc, first(xs)), rest(xs)) }
+};
+let merge = fn(a, b, acc) {
+  if (len(a) == 0) { return concat(acc, b); };
+  if (len(b) == 0) { return concat(acc, a); };
+  if (first(b) < first(a)) {
+    merge(a, rest(b), push(acc, first(b)))
+  } else {
+    merge(rest(a), b, push(acc, first(a)))
+  }
+};
+let take = fn(xs, n, acc) {
+  if (n == 0) { acc } else { take(rest(xs), n - 1, push(acc, first(xs))) }
+};
+let drop = fn(xs, n) { if (n == 0) { xs } else { drop(rest(xs), n - 1) } };
+let sort = fn(xs) {
+  if (len(xs) < 2) { return xs; };
+  let half = len(xs) / 2;
+  merge(sort(take(xs, half, [])), sort(drop(xs, half)), [])
+};
+let sorted = fn(xs) {
+  if (len(xs) < 2) { return true; };
+  if (xs[1] < xs[0]) { false } else { sorted(rest(xs)) }
+};
+let xs = sort(build(200, 42, []));
+if (sorted(xs)) { len(xs) } else { -1 }`,
+		Expected: "200",
+	},
+	{
+		Name: "string-building",
+		Source: `
+let digits = ["0", "1", "2", "3", "4", "5", "6", "7", "8", "9"];
+let itoa = fn(n) {
+  if (n < 10) { digits[n] } else { itoa(n / 10) + digits[n - (n / 10) * 10] }
+};
+let build = fn(i, n, acc) {
+  if (i == n) { acc } else { build(i + 1, n, acc + itoa(i) + ",") }
+};
+len(build(0, 500, ""))`,
+		Expected: "1890",
+	},
+	{
+		Name: "hash-churn",
+		Source: `
+let churn = fn(i, n, acc) {
+  if (i == n) { return acc; };
+  let h = {"key": i, i: i * 2, true: "x", "name": "monkey"};
+  churn(i + 1, n, acc + h["key"] + h[i] + len(h["name"]))
+};
+churn(0, 2000, 0)`,
+		Expected: "6009000",
+	},
+	{
+		Name: "string-concat",
+		Source: `
+let double = fn(s, n) { if (n == 0) { s } else { double(s + s, n - 1) } };
+let piece = double("0123456789abcdef", 6);
+let build = fn(n, acc) { if (n == 0) { acc } else { build(n - 1, acc + piece) } };
+len(build(1024, ""))`,
+		Expected: "1048576",
+	},
+}
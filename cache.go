@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/frankie-mur/monkeylang/compiler"
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// `monkey run` caches the bytecode of programs it runs on the VM, so running
+// the same script again skips lexing, parsing and compiling it. Entries are
+// .mbc files named by a hash of the source, the language version it is read
+// as and the monkey version, bytecode format and builtins that compiled it,
+// so a new build, or one with other plugins, never loads bytecode an older
+// one wrote. They live in $MONKEY_CACHE, by default a directory in the
+// user's cache directory; MONKEY_CACHE=off disables the cache.
+
+// bytecodeCacheDir returns the directory of the bytecode cache, or "" when
+// caching is off or the user has no cache directory.
+func bytecodeCacheDir() string {
+	switch dir := os.Getenv("MONKEY_CACHE"); dir {
+	case "off":
+		return ""
+	case "":
+	default:
+		return dir
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "monkey", "bytecode")
+}
+
+// cachePath returns the file the bytecode of src, read as language version
+// lang, is cached in.
+func cachePath(dir, src string, lang token.Lang) string {
+	if lang == 0 {
+		lang = token.LangLatest
+	}
+	v, c := buildVersion()
+	h := sha256.New()
+	fmt.Fprintf(h, "monkey %s %s mbc %d\n", v, c, compiler.FormatVersion)
+	fmt.Fprintf(h, "builtins %s\n", strings.Join(evaluator.BuiltinNames(), " "))
+	fmt.Fprintf(h, "lang %s\n", lang)
+	io.WriteString(h, src)
+	return filepath.Join(dir, hex.EncodeToString(h.Sum(nil))+".mbc")
+}
+
+// loadCached returns the cached bytecode of src, if there is any that
+// loads.
+func loadCached(dir, src string, lang token.Lang) (*compiler.Bytecode, bool) {
+	f, err := os.Open(cachePath(dir, src, lang))
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	bytecode, err := compiler.Load(f)
+	return bytecode, err == nil
+}
+
+// storeCached adds the bytecode of src to the cache. The file is written
+// under a temporary name and renamed, so concurrent runs never load a
+// partial entry. Failing to store is not an error: the program is just
+// compiled again next time.
+func storeCached(dir, src string, lang token.Lang, bytecode *compiler.Bytecode) {
+	var buf bytes.Buffer
+	if err := compiler.Save(&buf, bytecode); err != nil {
+		return
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return
+	}
+
+	tmp, err := os.CreateTemp(dir, "*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(buf.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), cachePath(dir, src, lang))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
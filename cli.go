@@ -0,0 +1,203 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// command is a monkey subcommand.
+type command struct {
+	name    string
+	aliases []string
+	args    string // argument synopsis shown in the usage line
+	summary string
+	run     func(inv *invocation) int
+}
+
+// invocation is what a command runs with: a flag set already named after
+// the command and wired to print its usage, the arguments following the
+// command name and the standard streams.
+type invocation struct {
+	cmd    *command
+	flags  *flag.FlagSet
+	args   []string
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// parse parses the invocation's arguments against its flag set and returns
+// the positional arguments. Flags may follow positional arguments, as in
+// `monkey ast file.monkey --json`.
+func (inv *invocation) parse() ([]string, error) {
+	var positional []string
+	args := inv.args
+	for {
+		if err := inv.flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = inv.flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// commands lists the subcommands in the order help shows them. It is
+// filled in by init because the help command refers back to it.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{name: "repl", summary: "start an interactive session", run: replCommand},
+		{name: "run", args: "[--watch] [file]", summary: "run a program from a file or stdin", run: runCommand},
+		{name: "fmt", args: "[-w] [-d] [files...]", summary: "format source files", run: fmtCommand},
+		{name: "lint", aliases: []string{"vet"}, args: "[files...]", summary: "report suspicious constructs", run: lintCommand},
+		{name: "compile", args: "[-o out.mbc] [-S] [-O] file", summary: "compile a program to bytecode for the VM", run: compileCommand},
+		{name: "build", args: "[-o out] [-go|-js] file", summary: "build a native executable by translating a program to Go", run: buildCommand},
+		{name: "debug", args: "[--dap] [file]", summary: "step through a program on the VM", run: debugCommand},
+		{name: "playground", args: "[--addr :8080]", summary: "serve a web page for running programs", run: playgroundCommand},
+		{name: "lsp", summary: "run a language server on stdin and stdout", run: lspCommand},
+		{name: "check", args: "[files...]", summary: "check files for syntax errors without running them", run: checkCommand},
+		{name: "ast", args: "[file] [--json|--tree]", summary: "print the syntax tree of a program", run: astCommand},
+		{name: "lex", args: "[file]", summary: "print the tokens of a program", run: lexCommand},
+		{name: "test", args: "[-v] [-run substr] [paths...]", summary: "run test_* functions in *_test.monkey files", run: testCommand},
+		{name: "bench", args: "[-time d] [-e expr] [paths...]", summary: "run bench_* functions in *_test.monkey files", run: benchCommand},
+		{name: "doc", args: "[-html] [-builtins] [files...]", summary: "print documentation for functions and builtins", run: docCommand},
+		{name: "version", summary: "print version information", run: versionCommand},
+		{name: "help", args: "[command]", summary: "show help for a command", run: helpCommand},
+	}
+}
+
+func lookupCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+		for _, alias := range cmd.aliases {
+			if alias == name {
+				return cmd
+			}
+		}
+	}
+	return nil
+}
+
+// execute runs the monkey command line args (without the program name) and
+// returns the process exit code.
+//
+// Bare `monkey` starts the REPL, or runs the program on stdin when stdin is
+// not a terminal. `monkey file.monkey` is shorthand for `monkey run
+// file.monkey`.
+func execute(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	name := "repl"
+	if len(args) == 0 && !isTerminal(stdin) {
+		name = "run"
+	} else if len(args) > 0 {
+		switch {
+		case args[0] == "-h" || args[0] == "-help" || args[0] == "--help":
+			name, args = "help", args[1:]
+		case args[0] == "-version" || args[0] == "--version":
+			name, args = "version", args[1:]
+		case lookupCommand(args[0]) != nil:
+			name, args = args[0], args[1:]
+		case strings.HasPrefix(args[0], "-"):
+			fmt.Fprintf(stderr, "monkey: unknown flag %s\n", args[0])
+			printUsage(stderr)
+			return exitUsage
+		default:
+			name = "run"
+		}
+	}
+
+	cmd := lookupCommand(name)
+
+	inv := &invocation{
+		cmd:    cmd,
+		flags:  flag.NewFlagSet(cmd.name, flag.ContinueOnError),
+		args:   args,
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+	inv.flags.SetOutput(stderr)
+	inv.flags.Usage = func() { printCommandUsage(stderr, cmd, inv.flags) }
+
+	return cmd.run(inv)
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage:\n\n\tmonkey [file]\n\tmonkey <command> [arguments]\n\nCommands:\n\n")
+	width := 0
+	for _, cmd := range commands {
+		width = max(width, len(cmd.name))
+	}
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "\t%-*s %s\n", width, cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nWithout arguments monkey starts the REPL, or runs the program on stdin\nwhen it is not a terminal. Use \"monkey help <command>\" for more information.\n")
+}
+
+func printCommandUsage(w io.Writer, cmd *command, flags *flag.FlagSet) {
+	fmt.Fprintf(w, "usage: monkey %s %s\n\n%s%s.\n", cmd.name, cmd.args, strings.ToUpper(cmd.summary[:1]), cmd.summary[1:])
+	if len(cmd.aliases) > 0 {
+		fmt.Fprintf(w, "Also available as: %s.\n", strings.Join(cmd.aliases, ", "))
+	}
+
+	hasFlags := false
+	flags.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		fmt.Fprintf(w, "\nFlags:\n")
+		flags.PrintDefaults()
+	}
+}
+
+// helpCommand implements `monkey help [command]`.
+func helpCommand(inv *invocation) int {
+	args, err := inv.parse()
+	if err != nil {
+		return exitUsage
+	}
+	if len(args) == 0 {
+		printUsage(inv.stdout)
+		return exitOK
+	}
+
+	cmd := lookupCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(inv.stderr, "monkey help: unknown command %q\n", args[0])
+		return exitUsage
+	}
+
+	// Run the command with -h so its flags are registered and listed.
+	execute([]string{cmd.name, "-h"}, inv.stdin, inv.stdout, inv.stdout)
+	return exitOK
+}
+
+// versionCommand implements `monkey version`.
+func versionCommand(inv *invocation) int {
+	if _, err := inv.parse(); err != nil {
+		return exitUsage
+	}
+	printVersion(inv.stdout)
+	return exitOK
+}
+
+// isTerminal reports whether r is a file attached to a character device
+// such as a TTY.
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/parser"
+)
+
+// astCommand implements `monkey ast [file] [--json|--tree]`, dumping the
+// parsed program. The tree format is the default.
+func astCommand(inv *invocation) int {
+	asJSON := inv.flags.Bool("json", false, "print the AST as JSON")
+	inv.flags.Bool("tree", true, "print the AST as an indented tree")
+	files, err := inv.parse()
+	if err != nil {
+		return exitUsage
+	}
+	if len(files) > 1 {
+		inv.flags.Usage()
+		return exitUsage
+	}
+
+	name, src, err := readSource(files, inv.stdin)
+	if err != nil {
+		fmt.Fprintf(inv.stderr, "monkey ast: %s\n", err)
+		return exitUsage
+	}
+
+	l := lexer.New(stripShebang(src))
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.ParseErrors()) != 0 {
+		printParseErrors(inv.stderr, name, p.ParseErrors())
+		return exitParseError
+	}
+
+	if *asJSON {
+		out, err := ast.JSON(program)
+		if err != nil {
+			fmt.Fprintf(inv.stderr, "monkey ast: %s\n", err)
+			return exitRuntimeError
+		}
+		inv.stdout.Write(out)
+		io.WriteString(inv.stdout, "\n")
+		return exitOK
+	}
+
+	ast.Fprint(inv.stdout, program)
+	return exitOK
+}
+
+// readSource returns the name and contents of the single input file in
+// files, or of stdin when no file was given.
+func readSource(files []string, stdin io.Reader) (string, string, error) {
+	if len(files) == 0 {
+		src, err := io.ReadAll(stdin)
+		return "<stdin>", string(src), err
+	}
+
+	src, err := os.ReadFile(files[0])
+	return files[0], string(src), err
+}
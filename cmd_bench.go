@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/compiler"
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/parser"
+	"github.com/frankie-mur/monkeylang/resolver"
+	"github.com/frankie-mur/monkeylang/vm"
+)
+
+const benchFuncPrefix = "bench_"
+
+// benchOptions are the flags shared by every benchmark of a run.
+type benchOptions struct {
+	engine    engineFlag
+	benchtime time.Duration
+	warmup    int
+	filter    string
+}
+
+// benchResult summarises the measured iterations of one benchmark.
+type benchResult struct {
+	n       int
+	elapsed time.Duration
+	allocs  uint64
+	bytes   uint64
+}
+
+func (r benchResult) String() string {
+	perOp := r.elapsed / time.Duration(r.n)
+	opsPerSec := float64(r.n) / r.elapsed.Seconds()
+	return fmt.Sprintf("%8d\t%12.1f ops/s\t%12s/op\t%8d allocs/op\t%10d B/op",
+		r.n, opsPerSec, perOp, r.allocs/uint64(r.n), r.bytes/uint64(r.n))
+}
+
+// benchCommand implements `monkey bench [-time d] [-warmup n] [-run substr]
+// [-e expr] [--engine=eval|vm] [paths...]`. Without -e it runs every top-level bench_* function
+// found in *_test.monkey files under the given paths (default "."); with -e
+// it benchmarks evaluating the expression itself.
+func benchCommand(inv *invocation) int {
+	opts := benchOptions{}
+	inv.flags.DurationVar(&opts.benchtime, "time", time.Second, "minimum measuring time per benchmark")
+	inv.flags.IntVar(&opts.warmup, "warmup", 10, "number of unmeasured warmup iterations")
+	inv.flags.StringVar(&opts.filter, "run", "", "only run benchmarks whose name contains this string")
+	expr := inv.flags.String("e", "", "benchmark this expression instead of bench_* functions")
+	inv.flags.Var(&opts.engine, "engine", "run the benchmarks on the tree-walking evaluator (eval) or the bytecode VM (vm)")
+	profile := addProfileFlags(inv.flags)
+	paths, err := inv.parse()
+	if err != nil {
+		return exitUsage
+	}
+
+	stopProfile, ok := profile.start(inv.stderr)
+	if !ok {
+		return exitUsage
+	}
+	defer stopProfile()
+
+	if *expr != "" {
+		program, ok := parseBenchSource("-e", *expr, inv.stderr)
+		if !ok {
+			return exitParseError
+		}
+		op, ok := benchExpression(program, opts, inv.stderr)
+		if !ok {
+			return exitParseError
+		}
+		result, errObj := benchmark(opts, op)
+		if errObj != nil {
+			fmt.Fprintf(inv.stderr, "%s\n", errObj.Inspect())
+			return exitRuntimeError
+		}
+		fmt.Fprintf(inv.stdout, "%s\t%s\n", *expr, result)
+		return exitOK
+	}
+
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := findTestFiles(paths)
+	if err != nil {
+		fmt.Fprintf(inv.stderr, "monkey bench: %s\n", err)
+		return exitUsage
+	}
+
+	code := exitOK
+	for _, name := range files {
+		if c := benchFile(name, opts, inv.stdout, inv.stderr); c != exitOK {
+			code = c
+		}
+	}
+	return code
+}
+
+// benchExpression returns the operation that evaluates program on the
+// engine selected in opts. On the evaluator every iteration shares one
+// environment; on the VM the program is compiled once and every iteration
+// runs it on a new machine.
+func benchExpression(program *ast.Program, opts benchOptions, stderr io.Writer) (func() object.Object, bool) {
+	if opts.engine != engineVM {
+		resolver.Resolve(program)
+		env := object.NewEnvironment()
+		return func() object.Object { return evaluator.Eval(program, env) }, true
+	}
+
+	bytecode, ok := compileProgram(program, stderr)
+	if !ok {
+		return nil, false
+	}
+	return func() object.Object { return vmResult(vm.New(bytecode).Run()) }, true
+}
+
+func parseBenchSource(name, src string, stderr io.Writer) (*ast.Program, bool) {
+	l := lexer.New(stripShebang(src))
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.ParseErrors()) != 0 {
+		printParseErrors(stderr, name, p.ParseErrors())
+		return nil, false
+	}
+	return program, true
+}
+
+// benchFile evaluates a file once and then benchmarks each of its bench_*
+// functions against that environment.
+func benchFile(name string, opts benchOptions, stdout, stderr io.Writer) int {
+	src, err := os.ReadFile(name)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey bench: %s\n", err)
+		return exitUsage
+	}
+
+	program, ok := parseBenchSource(name, string(src), stderr)
+	if !ok {
+		return exitParseError
+	}
+
+	call, result := loadBenchFile(program, opts)
+	if isFailure(result) {
+		fmt.Fprintf(stderr, "%s: %s\n", name, result.Inspect())
+		return exitRuntimeError
+	}
+
+	code := exitOK
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || !strings.HasPrefix(let.Name.Value, benchFuncPrefix) || !strings.Contains(let.Name.Value, opts.filter) {
+			continue
+		}
+
+		result, errObj := benchmark(opts, call(let.Name.Value))
+		if errObj != nil {
+			fmt.Fprintf(stderr, "%s:%s: %s: %s\n", name, let.Name.Pos(), let.Name.Value, errObj.Inspect())
+			code = exitRuntimeError
+			continue
+		}
+		fmt.Fprintf(stdout, "%s\t%s\n", let.Name.Value, result)
+	}
+
+	return code
+}
+
+// loadBenchFile runs program on the engine selected in opts. It returns a
+// function giving the operation that calls one of the program's bench_*
+// functions, along with the failure of the program itself, if any.
+func loadBenchFile(program *ast.Program, opts benchOptions) (call func(name string) func() object.Object, failure object.Object) {
+	if opts.engine != engineVM {
+		resolver.Resolve(program)
+		env := object.NewEnvironment()
+		call = func(name string) func() object.Object {
+			fn, _ := env.Get(name)
+			return func() object.Object { return evaluator.Apply(fn, nil) }
+		}
+		return call, evaluator.Eval(program, env)
+	}
+
+	// Each call is compiled as a program of its own against the file's
+	// symbol table and runs on the file's globals.
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return nil, &object.Error{Message: err.Error()}
+	}
+	bytecode := comp.Bytecode()
+	globals := make([]object.Object, vm.GlobalSize)
+	if result := vmResult(vm.NewWithGlobalsStore(bytecode, globals).Run()); result != nil {
+		return nil, result
+	}
+
+	call = func(name string) func() object.Object {
+		callComp := compiler.NewWithState(comp.SymbolTable(), bytecode.Constants)
+		if err := callComp.Compile(parser.New(lexer.New(name + "()")).ParseProgram()); err != nil {
+			return func() object.Object { return &object.Error{Message: err.Error()} }
+		}
+		callBytecode := callComp.Bytecode()
+		return func() object.Object {
+			return vmResult(vm.NewWithGlobalsStore(callBytecode, globals).Run())
+		}
+	}
+	return call, nil
+}
+
+// benchmark warms up op and then runs it in growing batches until a batch
+// takes at least opts.benchtime, like Go's testing.B. It stops at the first
+// error op returns.
+func benchmark(opts benchOptions, op func() object.Object) (benchResult, object.Object) {
+	for i := 0; i < opts.warmup; i++ {
+		if result := op(); isFailure(result) {
+			return benchResult{}, result
+		}
+	}
+
+	n := 1
+	for {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+
+		for i := 0; i < n; i++ {
+			if result := op(); isFailure(result) {
+				return benchResult{}, result
+			}
+		}
+
+		elapsed := time.Since(start)
+		runtime.ReadMemStats(&after)
+
+		if elapsed >= opts.benchtime || n >= 1e9 {
+			return benchResult{
+				n:       n,
+				elapsed: elapsed,
+				allocs:  after.Mallocs - before.Mallocs,
+				bytes:   after.TotalAlloc - before.TotalAlloc,
+			}, nil
+		}
+
+		// Aim for the target time based on the rate so far, growing by at
+		// most 100x per round.
+		next := n * 100
+		if elapsed > 0 {
+			predicted := int(int64(n) * int64(opts.benchtime) / int64(elapsed))
+			next = min(max(predicted+predicted/5, n+1), next)
+		}
+		n = next
+	}
+}
+
+func isFailure(result object.Object) bool {
+	if result == nil {
+		return false
+	}
+	return result.Type() == object.ERROR_OBJ || result.Type() == object.EXIT_OBJ
+}
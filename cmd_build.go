@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/parser"
+	"github.com/frankie-mur/monkeylang/transpile"
+)
+
+// buildCommand implements `monkey build [-o out] [-go|-js] file`. It
+// translates a program to Go and builds it with the go command into a
+// native executable, by default named after the source without its
+// extension. With -go the Go source is written instead, to standard output
+// unless -o is given, for programs that want to be built by other means.
+// With -js a JavaScript script is written the same way.
+func buildCommand(inv *invocation) int {
+	output := inv.flags.String("o", "", "write the executable to `file` (default: the input without its extension)")
+	goSource := inv.flags.Bool("go", false, "write the Go source instead of building it")
+	jsSource := inv.flags.Bool("js", false, "write a JavaScript script instead of an executable")
+	files, err := inv.parse()
+	if err != nil {
+		return exitUsage
+	}
+	if len(files) != 1 || *goSource && *jsSource {
+		inv.flags.Usage()
+		return exitUsage
+	}
+	name := files[0]
+
+	src, err := os.ReadFile(name)
+	if err != nil {
+		fmt.Fprintf(inv.stderr, "monkey build: %s\n", err)
+		return exitUsage
+	}
+
+	p := parser.New(lexer.New(stripShebang(string(src))))
+	program := p.ParseProgram()
+	if len(p.ParseErrors()) != 0 {
+		printParseErrors(inv.stderr, name, p.ParseErrors())
+		return exitParseError
+	}
+
+	translate := transpile.Go
+	if *jsSource {
+		translate = transpile.JS
+	}
+	translated, err := translate(program)
+	if err != nil {
+		var transpileErr *transpile.Error
+		if errors.As(err, &transpileErr) {
+			fmt.Fprintf(inv.stderr, "%s:%s\n", name, transpileErr)
+		} else {
+			fmt.Fprintf(inv.stderr, "%s: %s\n", name, err)
+		}
+		return exitParseError
+	}
+
+	if *goSource || *jsSource {
+		if *output == "" {
+			inv.stdout.Write(translated)
+			return exitOK
+		}
+		if err := os.WriteFile(*output, translated, 0o644); err != nil {
+			fmt.Fprintf(inv.stderr, "monkey build: %s\n", err)
+			return exitUsage
+		}
+		return exitOK
+	}
+
+	if *output == "" {
+		*output = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	if err := goBuild(translated, *output, inv); err != nil {
+		fmt.Fprintf(inv.stderr, "monkey build: %s\n", err)
+		return exitUsage
+	}
+	return exitOK
+}
+
+// goBuild builds the Go program src into the executable out, in a module
+// of its own in a temporary directory.
+func goBuild(src []byte, out string, inv *invocation) error {
+	gocmd, err := exec.LookPath("go")
+	if err != nil {
+		return fmt.Errorf("building executables needs the go command: %s", err)
+	}
+	out, err = filepath.Abs(out)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "monkey-build-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), src, 0o644); err != nil {
+		return err
+	}
+	mod := "module monkeyprogram\n\ngo 1.22\n"
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(mod), 0o644); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(gocmd, "build", "-o", out, ".")
+	cmd.Dir = dir
+	// Keep a go.work of the caller's from pulling the module into a
+	// workspace it is not part of.
+	cmd.Env = append(os.Environ(), "GOWORK=off")
+	cmd.Stdout = inv.stderr
+	cmd.Stderr = inv.stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go build: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/parser"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// checkCommand implements `monkey check [files...]`. It only parses its
+// inputs, printing every syntax error as file:line:col: message, and exits
+// nonzero if any input failed to parse. Nothing is evaluated.
+func checkCommand(inv *invocation) int {
+	var lang token.Lang
+	addLangFlag(inv.flags, &lang)
+	files, err := inv.parse()
+	if err != nil {
+		return exitUsage
+	}
+
+	if len(files) == 0 {
+		src, err := io.ReadAll(inv.stdin)
+		if err != nil {
+			fmt.Fprintf(inv.stderr, "monkey check: %s\n", err)
+			return exitUsage
+		}
+		return checkSource("<stdin>", string(src), lang, inv.stdout)
+	}
+
+	code := exitOK
+	for _, name := range files {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintf(inv.stderr, "monkey check: %s\n", err)
+			code = exitUsage
+			continue
+		}
+		if c := checkSource(name, string(src), lang, inv.stdout); c != exitOK && code == exitOK {
+			code = c
+		}
+	}
+
+	return code
+}
+
+func checkSource(name, src string, lang token.Lang, out io.Writer) int {
+	l := lexer.New(stripShebang(src))
+	l.SetLang(lang)
+	p := parser.New(l)
+	p.ParseProgram()
+
+	if len(p.ParseErrors()) != 0 {
+		printParseErrors(out, name, p.ParseErrors())
+		return exitParseError
+	}
+	return exitOK
+}
+
+// printParseErrors writes errs as file:line:col: message lines, the format
+// editors and CI log scrapers recognise.
+func printParseErrors(out io.Writer, name string, errs []*parser.ParseError) {
+	for _, err := range errs {
+		fmt.Fprintf(out, "%s:%s\n", name, err)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/frankie-mur/monkeylang/compiler"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/parser"
+)
+
+// compileCommand implements `monkey compile [-o out.mbc] [-S] [-O] file`. It
+// compiles a program to bytecode and writes it as an .mbc file, by default
+// next to the source with the extension replaced, which `monkey run` can
+// start without parsing the source again. With -S the disassembly is
+// printed instead.
+func compileCommand(inv *invocation) int {
+	output := inv.flags.String("o", "", "write the bytecode to `file` (default: the input with an .mbc extension)")
+	disasm := inv.flags.Bool("S", false, "print the disassembled bytecode instead of writing a file")
+	optimize := inv.flags.Bool("O", false, "run the peephole optimizer over the bytecode")
+	files, err := inv.parse()
+	if err != nil {
+		return exitUsage
+	}
+	if len(files) != 1 {
+		inv.flags.Usage()
+		return exitUsage
+	}
+	name := files[0]
+
+	src, err := os.ReadFile(name)
+	if err != nil {
+		fmt.Fprintf(inv.stderr, "monkey compile: %s\n", err)
+		return exitUsage
+	}
+
+	bytecode, code := compileSource(name, string(src), inv.stderr)
+	if code != exitOK {
+		return code
+	}
+	if *optimize {
+		bytecode = compiler.Optimize(bytecode)
+	}
+
+	if *disasm {
+		disassemble(inv.stdout, bytecode)
+		return exitOK
+	}
+
+	if *output == "" {
+		*output = strings.TrimSuffix(name, filepath.Ext(name)) + ".mbc"
+	}
+
+	var buf bytes.Buffer
+	if err := compiler.Save(&buf, bytecode); err != nil {
+		fmt.Fprintf(inv.stderr, "monkey compile: %s\n", err)
+		return exitUsage
+	}
+	if err := os.WriteFile(*output, buf.Bytes(), 0o644); err != nil {
+		fmt.Fprintf(inv.stderr, "monkey compile: %s\n", err)
+		return exitUsage
+	}
+
+	return exitOK
+}
+
+// compileSource parses and compiles src, reporting errors to stderr as
+// file:line:col: message. Compiler warnings are reported the same way but
+// do not fail the compilation.
+func compileSource(name, src string, stderr io.Writer) (*compiler.Bytecode, int) {
+	l := lexer.New(stripShebang(src))
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.ParseErrors()) != 0 {
+		printParseErrors(stderr, name, p.ParseErrors())
+		return nil, exitParseError
+	}
+
+	c := compiler.New()
+	err := c.Compile(program)
+	for _, w := range c.Warnings() {
+		fmt.Fprintf(stderr, "%s:%s: warning: %s\n", name, w.Pos, w.Message)
+	}
+	if err != nil {
+		var compileErr *compiler.Error
+		if errors.As(err, &compileErr) {
+			fmt.Fprintf(stderr, "%s:%s\n", name, compileErr)
+		} else {
+			fmt.Fprintf(stderr, "%s: %s\n", name, err)
+		}
+		return nil, exitParseError
+	}
+
+	return c.Bytecode(), exitOK
+}
+
+// disassemble prints the main instructions of b followed by the constant
+// pool, with the instructions of every compiled function.
+func disassemble(w io.Writer, b *compiler.Bytecode) {
+	fmt.Fprintf(w, "main:\n%s", b.Instructions)
+
+	for i, c := range b.Constants {
+		switch c := c.(type) {
+		case *object.CompiledFunction:
+			fmt.Fprintf(w, "\nconstant %d: function (%d params, %d locals):\n%s", i, c.NumParameters, c.NumLocals, c.Instructions)
+		default:
+			fmt.Fprintf(w, "\nconstant %d: %s %s\n", i, c.Type(), c.Inspect())
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/frankie-mur/monkeylang/dap"
+	"github.com/frankie-mur/monkeylang/debugger"
+)
+
+// debugCommand implements `monkey debug [--dap] [file]`. It compiles the
+// program and runs it on the VM under the debugger, which reads its
+// commands from stdin. With --dap it serves the Debug Adapter Protocol on
+// stdin and stdout instead, and the editor names the program to launch.
+func debugCommand(inv *invocation) int {
+	serveDAP := inv.flags.Bool("dap", false, "serve the Debug Adapter Protocol on stdin and stdout")
+	files, err := inv.parse()
+	if err != nil {
+		return exitUsage
+	}
+	if *serveDAP {
+		if len(files) != 0 {
+			inv.flags.Usage()
+			return exitUsage
+		}
+		if err := dap.Serve(inv.stdin, inv.stdout); err != nil {
+			fmt.Fprintf(inv.stderr, "monkey debug: %s\n", err)
+			return exitRuntimeError
+		}
+		return exitOK
+	}
+	if len(files) != 1 {
+		inv.flags.Usage()
+		return exitUsage
+	}
+
+	src, err := os.ReadFile(files[0])
+	if err != nil {
+		fmt.Fprintf(inv.stderr, "monkey debug: %s\n", err)
+		return exitUsage
+	}
+
+	bytecode, code := compileSource(files[0], string(src), inv.stderr)
+	if code != exitOK {
+		return code
+	}
+
+	debugger.New(bytecode, string(src)).Start(inv.stdin, inv.stdout)
+	return exitOK
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/frankie-mur/monkeylang/doc"
+)
+
+// docCommand implements `monkey doc [-html] [-builtins] [files...]`. It
+// prints the doc comments of each file's top-level functions as Markdown,
+// or as an HTML page with -html. Without files it documents the builtins.
+func docCommand(inv *invocation) int {
+	asHTML := inv.flags.Bool("html", false, "render an HTML page instead of Markdown")
+	withBuiltins := inv.flags.Bool("builtins", false, "include the builtin functions")
+	files, err := inv.parse()
+	if err != nil {
+		return exitUsage
+	}
+
+	var docs []*doc.File
+	for _, name := range files {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintf(inv.stderr, "monkey doc: %s\n", err)
+			return exitUsage
+		}
+		file, err := doc.Extract(name, stripShebang(string(src)))
+		if err != nil {
+			fmt.Fprintln(inv.stderr, err)
+			return exitParseError
+		}
+		docs = append(docs, file)
+	}
+
+	var builtins []doc.Func
+	if *withBuiltins || len(files) == 0 {
+		builtins = doc.Builtins()
+	}
+
+	if *asHTML {
+		doc.HTML(inv.stdout, docs, builtins)
+	} else {
+		doc.Markdown(inv.stdout, docs, builtins)
+	}
+	return exitOK
+}
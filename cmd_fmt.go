@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/frankie-mur/monkeylang/format"
+)
+
+// fmtCommand implements `monkey fmt [-w] [-d] [files...]`. Without files the
+// program is read from stdin and the formatted result written to stdout.
+// The exit code is nonzero when any input was not already formatted, unless
+// -w rewrote it.
+func fmtCommand(inv *invocation) int {
+	write := inv.flags.Bool("w", false, "write the result back to the source file")
+	diff := inv.flags.Bool("d", false, "display diffs instead of rewriting files")
+	files, err := inv.parse()
+	if err != nil {
+		return exitUsage
+	}
+
+	if len(files) == 0 {
+		src, err := io.ReadAll(inv.stdin)
+		if err != nil {
+			fmt.Fprintf(inv.stderr, "monkey fmt: %s\n", err)
+			return exitUsage
+		}
+		return formatSource("<stdin>", string(src), false, *diff, inv.stdout, inv.stderr)
+	}
+
+	code := exitOK
+	for _, name := range files {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintf(inv.stderr, "monkey fmt: %s\n", err)
+			code = exitUsage
+			continue
+		}
+		if c := formatSource(name, string(src), *write, *diff, inv.stdout, inv.stderr); c != exitOK {
+			code = c
+		}
+	}
+
+	return code
+}
+
+// formatSource formats a single input and reports it according to the
+// -w and -d flags.
+func formatSource(name, src string, write, diff bool, stdout, stderr io.Writer) int {
+	// A shebang line is not Monkey syntax; carry it over untouched.
+	var shebang string
+	if strings.HasPrefix(src, "#!") {
+		end := strings.IndexByte(src, '\n')
+		if end < 0 {
+			end = len(src) - 1
+		}
+		shebang, src = src[:end+1], src[end+1:]
+	}
+
+	formatted, err := format.Source(src)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", name, err)
+		return exitParseError
+	}
+	src, formatted = shebang+src, shebang+formatted
+
+	changed := formatted != src
+
+	switch {
+	case write:
+		if changed {
+			if err := os.WriteFile(name, []byte(formatted), 0644); err != nil {
+				fmt.Fprintf(stderr, "monkey fmt: %s\n", err)
+				return exitUsage
+			}
+		}
+		return exitOK
+	case diff:
+		io.WriteString(stdout, unifiedDiff(name, src, formatted))
+	default:
+		io.WriteString(stdout, formatted)
+	}
+
+	if changed {
+		return 1
+	}
+	return exitOK
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// lexCommand implements `monkey lex [file]`, printing the token stream one
+// token per line as line:col, type and literal.
+func lexCommand(inv *invocation) int {
+	var lang token.Lang
+	addLangFlag(inv.flags, &lang)
+	files, err := inv.parse()
+	if err != nil {
+		return exitUsage
+	}
+	if len(files) > 1 {
+		inv.flags.Usage()
+		return exitUsage
+	}
+
+	_, src, err := readSource(files, inv.stdin)
+	if err != nil {
+		fmt.Fprintf(inv.stderr, "monkey lex: %s\n", err)
+		return exitUsage
+	}
+
+	l := lexer.New(stripShebang(src))
+	l.SetLang(lang)
+	for {
+		tok := l.NextToken()
+		fmt.Fprintf(inv.stdout, "%s\t%s\t%q\n", tok.Pos, tok.Type, tok.Literal)
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+
+	return exitOK
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/lint"
+	"github.com/frankie-mur/monkeylang/parser"
+)
+
+// lintCommand implements `monkey lint [files...]` (also spelled `vet`). Each
+// diagnostic is printed as file:line:col: message, and the exit code is
+// nonzero when anything was reported.
+func lintCommand(inv *invocation) int {
+	files, err := inv.parse()
+	if err != nil {
+		return exitUsage
+	}
+
+	if len(files) == 0 {
+		src, err := io.ReadAll(inv.stdin)
+		if err != nil {
+			fmt.Fprintf(inv.stderr, "monkey lint: %s\n", err)
+			return exitUsage
+		}
+		return lintSource("<stdin>", string(src), inv.stdout, inv.stderr)
+	}
+
+	code := exitOK
+	for _, name := range files {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintf(inv.stderr, "monkey lint: %s\n", err)
+			code = exitUsage
+			continue
+		}
+		if c := lintSource(name, string(src), inv.stdout, inv.stderr); c != exitOK {
+			code = c
+		}
+	}
+
+	return code
+}
+
+func lintSource(name, src string, stdout, stderr io.Writer) int {
+	l := lexer.New(stripShebang(src))
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.ParseErrors()) != 0 {
+		printParseErrors(stderr, name, p.ParseErrors())
+		return exitParseError
+	}
+
+	diagnostics := lint.Check(program)
+	for _, d := range diagnostics {
+		fmt.Fprintf(stdout, "%s:%s\n", name, d)
+	}
+
+	if len(diagnostics) != 0 {
+		return 1
+	}
+	return exitOK
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/frankie-mur/monkeylang/lsp"
+)
+
+// lspCommand implements `monkey lsp`. It runs a language server on stdin
+// and stdout for editors to start, e.g. VS Code or Neovim.
+func lspCommand(inv *invocation) int {
+	files, err := inv.parse()
+	if err != nil {
+		return exitUsage
+	}
+	if len(files) != 0 {
+		inv.flags.Usage()
+		return exitUsage
+	}
+
+	if err := lsp.Serve(inv.stdin, inv.stdout); err != nil {
+		fmt.Fprintf(inv.stderr, "monkey lsp: %s\n", err)
+		return exitRuntimeError
+	}
+	return exitOK
+}
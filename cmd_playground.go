@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/frankie-mur/monkeylang/playground"
+)
+
+// playgroundCommand implements `monkey playground [--addr :8080]`. It
+// serves a web page for running programs, each in a sandboxed interpreter
+// of its own with limited time, steps, call depth and allocation.
+func playgroundCommand(inv *invocation) int {
+	var opts playground.Options
+	addr := inv.flags.String("addr", ":8080", "listen on `address`")
+	inv.flags.DurationVar(&opts.Timeout, "timeout", 0, "stop each program after this long (default 5s)")
+	inv.flags.Var((*countFlag)(&opts.MaxSteps), "max-steps", "stop each program after evaluating `n` syntax nodes (default 1e7)")
+	inv.flags.IntVar(&opts.MaxDepth, "max-depth", 0, "maximum `depth` of nested function calls (default 1000)")
+	inv.flags.Var((*countFlag)(&opts.MaxAlloc), "max-alloc", "stop each program after it creates strings, arrays and hashes of `bytes` in total (default 256 MiB)")
+	inv.flags.IntVar(&opts.MaxRuns, "max-runs", 0, "run at most `n` programs at once, turning away requests beyond (default 4)")
+	args, err := inv.parse()
+	if err != nil {
+		return exitUsage
+	}
+	if len(args) != 0 {
+		inv.flags.Usage()
+		return exitUsage
+	}
+
+	fmt.Fprintf(inv.stderr, "monkey playground: serving on %s\n", *addr)
+	if err := http.ListenAndServe(*addr, playground.Handler(opts)); err != nil {
+		fmt.Fprintf(inv.stderr, "monkey playground: %s\n", err)
+		return exitRuntimeError
+	}
+	return exitOK
+}
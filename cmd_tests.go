@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/cover"
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/parser"
+)
+
+const (
+	testFileSuffix = "_test.monkey"
+	testFuncPrefix = "test_"
+)
+
+// testCommand implements `monkey test [-v] [-run substr] [paths...]`. It
+// discovers *_test.monkey files under the given paths (default "."), and
+// runs every top-level function named test_* in a fresh environment. A test
+// fails when it returns an error, typically from assert or assert_eq. With
+// --cover it reports which statements of the files the tests ran.
+func testCommand(inv *invocation) int {
+	verbose := inv.flags.Bool("v", false, "print every test as it runs")
+	filter := inv.flags.String("run", "", "only run tests whose name contains this string")
+	coverage := addCoverFlags(inv.flags)
+	paths, err := inv.parse()
+	if err != nil {
+		return exitUsage
+	}
+	profile := coverage.newProfile()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := findTestFiles(paths)
+	if err != nil {
+		fmt.Fprintf(inv.stderr, "monkey test: %s\n", err)
+		return exitUsage
+	}
+
+	var passed, failed int
+	for _, name := range files {
+		p, f := runTestFile(name, *filter, *verbose, profile, inv.stdout)
+		passed += p
+		failed += f
+	}
+	if profile != nil && !coverage.report(profile, inv.stdout, inv.stderr) {
+		return exitUsage
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(inv.stdout, "FAIL\t%d passed, %d failed\n", passed, failed)
+		return 1
+	}
+	fmt.Fprintf(inv.stdout, "ok\t%d passed\n", passed)
+	return exitOK
+}
+
+// findTestFiles expands paths into the test files they name or contain.
+func findTestFiles(paths []string) ([]string, error) {
+	var files []string
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(name, testFileSuffix) {
+				files = append(files, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// runTestFile runs the tests of one file and returns how many passed and
+// failed. Failing to load the file counts as a single failure. If profile
+// is not nil, it records the statements the tests run.
+func runTestFile(name, filter string, verbose bool, profile *cover.Profile, out io.Writer) (passed, failed int) {
+	src, err := os.ReadFile(name)
+	if err != nil {
+		fmt.Fprintf(out, "--- FAIL: %s\n    %s\n", name, err)
+		return 0, 1
+	}
+
+	l := lexer.New(stripShebang(string(src)))
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.ParseErrors()) != 0 {
+		fmt.Fprintf(out, "--- FAIL: %s\n", name)
+		for _, err := range p.ParseErrors() {
+			fmt.Fprintf(out, "    %s:%s\n", name, err)
+		}
+		return 0, 1
+	}
+	if profile != nil {
+		profile.Add(name, string(src), program)
+	}
+
+	for _, test := range testFunctions(program) {
+		if !strings.Contains(test.Value, filter) {
+			continue
+		}
+
+		if verbose {
+			fmt.Fprintf(out, "=== RUN   %s\n", test.Value)
+		}
+
+		if msg := runTest(program, test.Value, profile); msg != "" {
+			fmt.Fprintf(out, "--- FAIL: %s (%s:%s)\n    %s\n", test.Value, name, test.Pos(), msg)
+			failed++
+			continue
+		}
+
+		if verbose {
+			fmt.Fprintf(out, "--- PASS: %s\n", test.Value)
+		}
+		passed++
+	}
+
+	return passed, failed
+}
+
+// testFunctions returns the names of the top-level test_* functions of
+// program in source order.
+func testFunctions(program *ast.Program) []*ast.Identifier {
+	var tests []*ast.Identifier
+
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || !strings.HasPrefix(let.Name.Value, testFuncPrefix) {
+			continue
+		}
+		if _, ok := let.Value.(*ast.FunctionLiteral); ok {
+			tests = append(tests, let.Name)
+		}
+	}
+
+	return tests
+}
+
+// runTest evaluates program in a new environment, so tests cannot see each
+// other's side effects, and then calls the named test function. It returns
+// the failure message, or "" when the test passed.
+func runTest(program *ast.Program, name string, profile *cover.Profile) string {
+	env := object.NewEnvironment()
+	e := evaluator.New()
+	if profile != nil {
+		e.SetHook(profile.Hook)
+	}
+
+	result := e.Eval(program, env)
+	if msg := testFailure(result); msg != "" {
+		return "setup: " + msg
+	}
+
+	fn, ok := env.Get(name)
+	if !ok {
+		return "test function not defined"
+	}
+
+	return testFailure(e.Apply(fn, nil))
+}
+
+func testFailure(result object.Object) string {
+	switch result := result.(type) {
+	case *object.Error:
+		return result.Message
+	case *object.Exit:
+		return fmt.Sprintf("test called exit(%d)", result.Code)
+	}
+	return ""
+}
@@ -0,0 +1,268 @@
+// Package code defines the bytecode instruction set shared by the compiler
+// and the virtual machine.
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Instructions is a sequence of encoded instructions: an opcode byte
+// followed by its operands in big-endian order.
+type Instructions []byte
+
+// String disassembles ins, one instruction per line prefixed with its byte
+// offset.
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+// Opcode identifies an instruction.
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // push constants[operand]
+	OpPop                    // discard the top of the stack
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+
+	OpMinus
+	OpBang
+
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+	OpBitNot
+
+	OpJumpNotTruthy // pop a value and jump to operand if it is not truthy
+	OpJump          // jump to operand
+
+	OpGetGlobal
+	OpSetGlobal
+
+	OpArray // build an array from the top operand elements
+	OpHash  // build a hash from the top operand keys and values
+	OpIndex
+
+	OpCall        // call the function below the top operand arguments
+	OpReturnValue // return the top of the stack
+	OpReturn      // return null
+
+	OpGetLocal
+	OpSetLocal
+	OpGetBuiltin
+
+	OpClosure        // wrap constants[operand 1] with the top operand 2 free variables
+	OpGetFree        // push a free variable of the current closure
+	OpCurrentClosure // push the current closure, for recursive calls
+
+	OpTailCall    // like OpCall, but a called closure replaces the current frame
+	OpCallBuiltin // call builtin operand 1 with the top operand 2 arguments
+
+	// Superinstructions fuse pairs of instructions that are frequent in
+	// hot code. Only the optimizer emits them.
+	OpBinaryConstant // apply the binary operator operand 2 to the top of the stack and constants[operand 1]
+	OpGetLocalCall   // push local operand 1, then call with operand 2 arguments
+
+	// Cells hold the variables that closures capture and the program
+	// assigns, so the function binding one and its closures share it.
+	// Closures capture the cell itself, with OpGetLocal or OpGetFree.
+	OpCell        // wrap the value of local operand in a cell
+	OpGetCell     // push the value in the cell of local operand
+	OpSetCell     // pop a value into the cell of local operand
+	OpGetFreeCell // push the value in the cell of free variable operand
+	OpSetFreeCell // pop a value into the cell of free variable operand
+)
+
+// Definition describes an opcode: its name for disassembly and the width in
+// bytes of each of its operands.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpAdd: {"OpAdd", []int{}},
+	OpSub: {"OpSub", []int{}},
+	OpMul: {"OpMul", []int{}},
+	OpDiv: {"OpDiv", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpEqual:       {"OpEqual", []int{}},
+	OpNotEqual:    {"OpNotEqual", []int{}},
+	OpGreaterThan: {"OpGreaterThan", []int{}},
+	OpLessThan:    {"OpLessThan", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpBitAnd:     {"OpBitAnd", []int{}},
+	OpBitOr:      {"OpBitOr", []int{}},
+	OpBitXor:     {"OpBitXor", []int{}},
+	OpShiftLeft:  {"OpShiftLeft", []int{}},
+	OpShiftRight: {"OpShiftRight", []int{}},
+	OpBitNot:     {"OpBitNot", []int{}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+
+	OpGetGlobal: {"OpGetGlobal", []int{2}},
+	OpSetGlobal: {"OpSetGlobal", []int{2}},
+
+	OpArray: {"OpArray", []int{2}},
+	OpHash:  {"OpHash", []int{2}},
+	OpIndex: {"OpIndex", []int{}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+
+	OpGetLocal:   {"OpGetLocal", []int{1}},
+	OpSetLocal:   {"OpSetLocal", []int{1}},
+	OpGetBuiltin: {"OpGetBuiltin", []int{1}},
+
+	OpClosure:        {"OpClosure", []int{2, 1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+
+	OpTailCall:    {"OpTailCall", []int{1}},
+	OpCallBuiltin: {"OpCallBuiltin", []int{1, 1}},
+
+	OpBinaryConstant: {"OpBinaryConstant", []int{2, 1}},
+	OpGetLocalCall:   {"OpGetLocalCall", []int{1, 1}},
+
+	OpCell:        {"OpCell", []int{1}},
+	OpGetCell:     {"OpGetCell", []int{1}},
+	OpSetCell:     {"OpSetCell", []int{1}},
+	OpGetFreeCell: {"OpGetFreeCell", []int{1}},
+	OpSetFreeCell: {"OpSetFreeCell", []int{1}},
+}
+
+// Lookup returns the definition of opcode op.
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Make encodes an instruction. It returns an empty slice for an unknown
+// opcode.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction described by def from
+// ins, which starts right after the opcode. It returns the operands and the
+// number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+// ReadUint16 decodes a two-byte operand.
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// ReadUint8 decodes a one-byte operand.
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
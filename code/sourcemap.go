@@ -0,0 +1,48 @@
+package code
+
+import (
+	"sort"
+
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// SourceMapping records that the instructions from Offset up to the next
+// mapping were compiled from the node at Pos.
+type SourceMapping struct {
+	Offset int
+	Pos    token.Position
+}
+
+// SourceMap maps the offsets of a sequence of instructions back to source
+// positions. Its mappings are sorted by offset.
+type SourceMap []SourceMapping
+
+// Add records that the instruction at offset was compiled from pos. Offsets
+// must not decrease; a mapping that adds nothing new is not stored.
+func (m *SourceMap) Add(offset int, pos token.Position) {
+	n := len(*m)
+	if n > 0 && (*m)[n-1].Pos == pos {
+		return
+	}
+	if n > 0 && (*m)[n-1].Offset == offset {
+		(*m)[n-1].Pos = pos
+		return
+	}
+	*m = append(*m, SourceMapping{Offset: offset, Pos: pos})
+}
+
+// Truncate drops the mappings of the instructions at offset and after.
+func (m *SourceMap) Truncate(offset int) {
+	i := sort.Search(len(*m), func(i int) bool { return (*m)[i].Offset >= offset })
+	*m = (*m)[:i]
+}
+
+// Lookup returns the source position of the instruction at offset, or of
+// the instruction whose operands offset points into.
+func (m SourceMap) Lookup(offset int) (token.Position, bool) {
+	i := sort.Search(len(m), func(i int) bool { return m[i].Offset > offset })
+	if i == 0 {
+		return token.Position{}, false
+	}
+	return m[i-1].Pos, m[i-1].Pos.IsValid()
+}
@@ -0,0 +1,91 @@
+package compiler
+
+import "github.com/frankie-mur/monkeylang/ast"
+
+// bindings is what the compiler needs to know about the names the code of
+// a function, or of the main program, binds before it compiles the code.
+type bindings struct {
+	// assigned holds the names the code binds more than once, binds in a
+	// loop or assigns, itself or in the functions nested in it.
+	assigned map[string]bool
+
+	// cells are the parameters and let bindings of the function that are
+	// assigned and that nested functions refer to, in the order they are
+	// first bound. They are kept in cells, so the function and its
+	// closures share them like they share the environment in the
+	// evaluator.
+	cells []string
+}
+
+// analyze returns the bindings of the code of params and stmts. It ignores
+// shadowing, so it may give a variable a cell it does not need, which only
+// costs speed.
+func analyze(params []*ast.Identifier, stmts []ast.Statement) bindings {
+	b := bindings{assigned: map[string]bool{}}
+
+	bound := map[string]bool{}
+	var order []string
+	bind := func(name string) {
+		if bound[name] {
+			b.assigned[name] = true
+			return
+		}
+		bound[name] = true
+		order = append(order, name)
+	}
+	for _, param := range params {
+		bind(param.Value)
+	}
+
+	captured := map[string]bool{}
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.FunctionLiteral:
+				ast.Inspect(n, func(node ast.Node) bool {
+					if ident, ok := node.(*ast.Identifier); ok {
+						captured[ident.Value] = true
+					}
+					b.note(node)
+					return true
+				})
+				return false
+			case *ast.LetStatement:
+				if n.Name != nil {
+					bind(n.Name.Value)
+				}
+			case *ast.WhileExpression:
+				// A let in a loop binds its name again on every
+				// iteration.
+				ast.Inspect(n.Body, func(node ast.Node) bool {
+					if let, ok := node.(*ast.LetStatement); ok && let.Name != nil {
+						b.assigned[let.Name.Value] = true
+					}
+					_, ok := node.(*ast.FunctionLiteral)
+					return !ok
+				})
+			}
+			b.note(node)
+			return true
+		})
+	}
+
+	for _, name := range order {
+		if captured[name] && b.assigned[name] {
+			b.cells = append(b.cells, name)
+		}
+	}
+	return b
+}
+
+// note records the name node assigns, if it is an assignment.
+func (b *bindings) note(node ast.Node) {
+	switch n := node.(type) {
+	case *ast.AssignExpression:
+		b.assigned[n.Name.Value] = true
+	case *ast.PostfixExpression:
+		if ident, ok := n.Target.(*ast.Identifier); ok {
+			b.assigned[ident.Value] = true
+		}
+	}
+}
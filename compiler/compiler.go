@@ -0,0 +1,822 @@
+// Package compiler translates a parsed Monkey program into bytecode for the
+// virtual machine in package vm.
+package compiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/code"
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// Error is a compile error with the position of the offending node.
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Message
+}
+
+// Warning is a problem the compiler found that does not stop the program
+// from compiling, such as a local that is never used.
+type Warning struct {
+	Pos     token.Position
+	Message string
+}
+
+func (w Warning) String() string {
+	return w.Pos.String() + ": " + w.Message
+}
+
+// EmittedInstruction records an instruction the compiler emitted and where.
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// CompilationScope holds the instructions of the function being compiled
+// and where in the source they come from. The compiler pushes one for each
+// function literal it enters.
+type CompilationScope struct {
+	instructions        code.Instructions
+	sourceMap           code.SourceMap
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+
+	// lets are the let bindings of the function by name, checked for use
+	// when the name is bound again or the function ends.
+	lets map[string]*ast.Identifier
+
+	// assigned and cells are the names the code assigns and the variables
+	// it keeps in cells; see bindings.
+	assigned map[string]bool
+	cells    map[string]bool
+}
+
+// Compiler compiles AST nodes into instructions and a constant pool.
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// pos is the position of the innermost node being compiled, which
+	// emit records for every instruction.
+	pos token.Position
+
+	warnings []Warning
+}
+
+// New returns an empty compiler whose symbol table knows the builtins.
+func New() *Compiler {
+	mainScope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+
+	symbolTable := NewSymbolTable()
+	for i, name := range evaluator.BuiltinNames() {
+		symbolTable.DefineBuiltin(i, name)
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
+	}
+}
+
+// NewWithState returns a compiler that continues where an earlier one left
+// off, sharing its symbol table and constants. The REPL uses it to compile
+// each line in the context of the previous ones.
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
+}
+
+// SymbolTable returns the compiler's global symbol table, which a later
+// compilation can continue from with NewWithState.
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
+// Compile compiles program into bytecode.
+func Compile(program *ast.Program) (*Bytecode, error) {
+	c := New()
+	if err := c.Compile(program); err != nil {
+		return nil, err
+	}
+	return c.Bytecode(), nil
+}
+
+// Compile compiles node and appends the result to the compiler's
+// instructions.
+func (c *Compiler) Compile(node ast.Node) error {
+	if pos := node.Pos(); pos.IsValid() {
+		outer := c.pos
+		c.pos = pos
+		defer func() { c.pos = outer }()
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		c.scopes[c.scopeIndex].assigned = analyze(nil, node.Statements).assigned
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		// A function may call itself by the name it is bound to. If the
+		// program assigns the name, it refers to the binding instead.
+		fn, ok := node.Value.(*ast.FunctionLiteral)
+		var symbol Symbol
+		switch {
+		case ok && c.scopes[c.scopeIndex].assigned[node.Name.Value]:
+			symbol = c.define(node.Name, true)
+			if err := c.compileFunction(fn, ""); err != nil {
+				return err
+			}
+		case ok:
+			if err := c.compileFunction(fn, node.Name.Value); err != nil {
+				return err
+			}
+			symbol = c.define(node.Name, true)
+		default:
+			if err := c.Compile(node.Value); err != nil {
+				return err
+			}
+			symbol = c.define(node.Name, true)
+		}
+		if err := c.storeSymbol(node, symbol); err != nil {
+			return err
+		}
+
+	case *ast.AssignExpression:
+		// Like the evaluator, a compound assignment reads the variable
+		// before the value is evaluated, a plain one checks it after.
+		symbol, ok := c.symbolTable.Resolve(node.Name.Value)
+		bound := ok && symbol.Scope != BuiltinScope
+		if node.Operator != "" {
+			if !bound {
+				return c.errorf(node, "identifier not found: %s", node.Name.Value)
+			}
+			c.loadSymbol(symbol)
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if node.Operator != "" {
+			op, ok := infixOps[node.Operator]
+			if !ok {
+				return c.errorf(node, "unknown operator %s", node.Operator)
+			}
+			c.emit(op)
+		}
+
+		if !bound {
+			return c.errorf(node, "identifier not found: %s", node.Name.Value)
+		}
+		if err := c.storeSymbol(node, symbol); err != nil {
+			return err
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.PostfixExpression:
+		name, ok := node.Target.(*ast.Identifier)
+		if !ok {
+			return c.errorf(node, "%s on an element is not supported by the vm engine", node.Operator)
+		}
+		symbol, ok := c.symbolTable.Resolve(name.Value)
+		if !ok || symbol.Scope == BuiltinScope {
+			return c.errorf(node, "identifier not found: %s", name.Value)
+		}
+		// The first load is left on the stack as the value of the
+		// expression, the variable before the change.
+		c.loadSymbol(symbol)
+		c.loadSymbol(symbol)
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: 1}))
+		c.emit(infixOps[node.Operator[:1]])
+		if err := c.storeSymbol(node, symbol); err != nil {
+			return err
+		}
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return c.errorf(node, "identifier not found: %s", node.Value)
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.PrefixExpression:
+		if value, ok := constantValue(node); ok {
+			c.emitValue(value)
+			return nil
+		}
+
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		op, ok := prefixOps[node.Operator]
+		if !ok {
+			return c.errorf(node, "unknown operator %s", node.Operator)
+		}
+		c.emit(op)
+
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogical(node)
+		}
+		if value, ok := constantValue(node); ok {
+			c.emitValue(value)
+			return nil
+		}
+
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		op, ok := infixOps[node.Operator]
+		if !ok {
+			return c.errorf(node, "unknown operator %s", node.Operator)
+		}
+		c.emit(op)
+
+	case *ast.IfExpression:
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+
+		// Emit an `OpJumpNotTruthy` with a bogus value
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		if err := c.compileBranch(node.Consequence); err != nil {
+			return err
+		}
+
+		// Emit an `OpJump` with a bogus value
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else if err := c.compileBranch(node.Alternative); err != nil {
+			return err
+		}
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	case *ast.WhileExpression:
+		loopStart := len(c.currentInstructions())
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		// The statements of the body pop the values they leave, so the
+		// loop leaves nothing on the stack.
+		if err := c.Compile(node.Body); err != nil {
+			return err
+		}
+		c.emit(code.OpJump, loopStart)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+		// Like an if expression without an else, the loop's value is null.
+		c.emit(code.OpNull)
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		for _, k := range node.Keys {
+			if err := c.Compile(k); err != nil {
+				return err
+			}
+			if err := c.Compile(node.Pairs[k]); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Keys)*2)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.FunctionLiteral:
+		if err := c.compileFunction(node, ""); err != nil {
+			return err
+		}
+
+	case *ast.CallExpression:
+		if builtin, ok := c.calledBuiltin(node); ok {
+			return c.compileBuiltinCall(builtin, node)
+		}
+
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+
+		// The parser marks the calls whose result the calling function
+		// returns directly.
+		if node.Tail {
+			c.emit(code.OpTailCall, len(node.Arguments))
+		} else {
+			c.emit(code.OpCall, len(node.Arguments))
+		}
+
+	case *ast.EnumStatement, *ast.MatchExpression, *ast.ForExpression, *ast.SwitchExpression:
+		return c.errorf(node, "%s is not supported by the vm engine", node.TokenLiteral())
+
+	case *ast.SliceExpression:
+		return c.errorf(node, "slicing is not supported by the vm engine")
+
+	default:
+		return c.errorf(node, "cannot compile %T", node)
+	}
+
+	return nil
+}
+
+// compileBranch compiles the block of an if expression so that it leaves
+// exactly one value on the stack: the value of its last expression
+// statement, or null.
+func (c *Compiler) compileBranch(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+// compileFunction compiles a function literal into a constant and emits the
+// instructions creating a closure over its free variables. A non-empty name
+// is what the function is bound to, which its body may use to recurse.
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral, name string) error {
+	outer := c.pos
+	c.pos = node.Pos()
+	defer func() { c.pos = outer }()
+
+	c.enterScope()
+
+	b := analyze(node.Parameters, node.Body.Statements)
+	c.scopes[c.scopeIndex].assigned = b.assigned
+	for _, name := range b.cells {
+		c.scopes[c.scopeIndex].cells[name] = true
+	}
+
+	if name != "" {
+		c.symbolTable.DefineFunctionName(name)
+	}
+
+	for _, p := range node.Parameters {
+		c.define(p, false)
+	}
+
+	// The cells are made on entry, so the function's closures share them
+	// however often a loop runs a let. Parameters are wrapped in theirs;
+	// the cells of let bindings start out null, in the slot the binding
+	// gets once it is compiled.
+	letCells := map[string][]int{}
+	for _, name := range b.cells {
+		if symbol, ok := c.symbolTable.store[name]; ok && symbol.Scope == LocalScope {
+			c.emit(code.OpCell, symbol.Index)
+			continue
+		}
+		c.emit(code.OpNull)
+		letCells[name] = []int{c.emit(code.OpSetLocal, 0), c.emit(code.OpCell, 0)}
+	}
+
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	for name, positions := range letCells {
+		for _, pos := range positions {
+			c.changeOperand(pos, c.symbolTable.store[name].Index)
+		}
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	for name := range c.scopes[c.scopeIndex].lets {
+		c.checkUsed(name)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.NumDefinitions()
+	localNames := c.symbolTable.Names()
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	instructions := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.loadCaptured(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		SourceMap:     sourceMap,
+		LocalNames:    localNames,
+		Doc:           node.Doc(),
+	}
+	c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+
+	return nil
+}
+
+// compileLogical compiles a && or || expression, which evaluates its right
+// operand only when the left one does not decide the result. Negating an
+// operand twice turns it into the boolean of its truthiness.
+func (c *Compiler) compileLogical(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if node.Operator == "&&" {
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(code.OpBang)
+		c.emit(code.OpBang)
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+		c.emit(code.OpFalse)
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+		return nil
+	}
+
+	c.emit(code.OpTrue)
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+	c.emit(code.OpBang)
+	c.emit(code.OpBang)
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// calledBuiltin returns the symbol of the builtin call calls by name, if
+// the name is not shadowed.
+func (c *Compiler) calledBuiltin(call *ast.CallExpression) (Symbol, bool) {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return Symbol{}, false
+	}
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+	return symbol, ok && symbol.Scope == BuiltinScope
+}
+
+// compileBuiltinCall compiles a call of a builtin to OpCallBuiltin, which
+// spares the VM pushing the builtin and dispatching on the callee's type.
+func (c *Compiler) compileBuiltinCall(builtin Symbol, call *ast.CallExpression) error {
+	for _, a := range call.Arguments {
+		if err := c.Compile(a); err != nil {
+			return err
+		}
+	}
+
+	c.emit(code.OpCallBuiltin, builtin.Index, len(call.Arguments))
+	return nil
+}
+
+// emitValue emits the instruction that pushes a value computed at compile
+// time.
+func (c *Compiler) emitValue(value object.Object) {
+	switch value {
+	case evaluator.TRUE:
+		c.emit(code.OpTrue)
+	case evaluator.FALSE:
+		c.emit(code.OpFalse)
+	default:
+		c.emit(code.OpConstant, c.addConstant(value))
+	}
+}
+
+// loadSymbol emits the instruction that pushes the value of symbol.
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		if s.Cell {
+			c.emit(code.OpGetCell, s.Index)
+		} else {
+			c.emit(code.OpGetLocal, s.Index)
+		}
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		if s.Cell {
+			c.emit(code.OpGetFreeCell, s.Index)
+		} else {
+			c.emit(code.OpGetFree, s.Index)
+		}
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// loadCaptured emits the instruction that pushes what a closure captures of
+// symbol: the cell of a variable kept in one, else the value.
+func (c *Compiler) loadCaptured(s Symbol) {
+	switch {
+	case s.Scope == LocalScope && s.Cell:
+		c.emit(code.OpGetLocal, s.Index)
+	case s.Scope == FreeScope && s.Cell:
+		c.emit(code.OpGetFree, s.Index)
+	default:
+		c.loadSymbol(s)
+	}
+}
+
+// storeSymbol emits the instruction that pops a value into symbol, which
+// node assigns or binds.
+func (c *Compiler) storeSymbol(node ast.Node, s Symbol) error {
+	switch {
+	case s.Scope == GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case s.Scope == LocalScope && s.Cell:
+		c.emit(code.OpSetCell, s.Index)
+	case s.Scope == LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case s.Scope == FreeScope && s.Cell:
+		c.emit(code.OpSetFreeCell, s.Index)
+	default:
+		return c.errorf(node, "cannot assign to %s", s.Name)
+	}
+	return nil
+}
+
+// Bytecode is the result of a compilation: the instructions of the program,
+// the constants they refer to and the source map of the instructions.
+// GlobalNames are the names of the globals by index, for debuggers.
+// Compiled functions carry their own source maps and local names.
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	SourceMap    code.SourceMap
+	GlobalNames  []string
+}
+
+// Bytecode returns the instructions and constants compiled so far.
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
+		GlobalNames:  c.symbolTable.Names(),
+	}
+}
+
+// Warnings returns the warnings of everything compiled so far in source
+// order.
+func (c *Compiler) Warnings() []Warning {
+	warnings := append([]Warning(nil), c.warnings...)
+	sort.SliceStable(warnings, func(i, j int) bool {
+		return warnings[i].Pos.Offset < warnings[j].Pos.Offset
+	})
+	return warnings
+}
+
+// define binds the name of a let statement or parameter in the current
+// scope, warning if a function binds a name an enclosing scope already
+// does.
+func (c *Compiler) define(name *ast.Identifier, let bool) Symbol {
+	table := c.symbolTable
+	if c.scopeIndex > 0 {
+		if pos, ok := table.outerDefinition(name.Value); ok {
+			c.warnf(name, "%s shadows declaration at %s", name.Value, pos)
+		}
+		c.checkUsed(name.Value)
+	}
+
+	var symbol Symbol
+	if c.scopes[c.scopeIndex].cells[name.Value] {
+		symbol = table.DefineCell(name.Value)
+	} else {
+		symbol = table.Define(name.Value)
+	}
+	table.positions[name.Value] = name.Pos()
+	delete(table.resolved, name.Value)
+	if let && c.scopeIndex > 0 {
+		c.scopes[c.scopeIndex].lets[name.Value] = name
+	}
+	return symbol
+}
+
+// checkUsed warns about the let binding of name in the current function if
+// nothing resolved it. Names starting with an underscore are exempt.
+func (c *Compiler) checkUsed(name string) {
+	lets := c.scopes[c.scopeIndex].lets
+	ident, ok := lets[name]
+	if !ok {
+		return
+	}
+	delete(lets, name)
+	if !c.symbolTable.resolved[name] && !strings.HasPrefix(name, "_") {
+		c.warnf(ident, "%s declared and not used", name)
+	}
+}
+
+func (c *Compiler) warnf(node ast.Node, format string, args ...interface{}) {
+	c.warnings = append(c.warnings, Warning{Pos: node.Pos(), Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *Compiler) errorf(node ast.Node, format string, args ...interface{}) error {
+	return &Error{Pos: node.Pos(), Message: fmt.Sprintf(format, args...)}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+// emit appends an instruction to the current scope and returns its
+// position.
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+	c.scopes[c.scopeIndex].sourceMap.Add(pos, c.pos)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	updatedInstructions := append(c.currentInstructions(), ins...)
+
+	c.scopes[c.scopeIndex].instructions = updatedInstructions
+
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	old := c.currentInstructions()
+	new := old[:last.Position]
+
+	c.scopes[c.scopeIndex].instructions = new
+	c.scopes[c.scopeIndex].sourceMap.Truncate(last.Position)
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+// replaceLastPopWithReturn turns the function body's final expression
+// statement into its return value.
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+// changeOperand rewrites the operand of the instruction at opPos, which is
+// how jumps are patched once their target is known.
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+// enterScope starts compiling a function body.
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+		lets:                map[string]*ast.Identifier{},
+		cells:               map[string]bool{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// leaveScope ends the current function body and returns its instructions.
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
@@ -0,0 +1,1324 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/code"
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/parser"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1; 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "(1 + 2) * 3 - 4 / 2",
+			expectedConstants: []interface{}{7},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-1",
+			expectedConstants: []interface{}{-1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Left for the VM to report.
+			input:             "2 / (1 - 1)",
+			expectedConstants: []interface{}{2, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDiv),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let x = 1; x + (2 * 3)",
+			expectedConstants: []interface{}{1, 6},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 < 2",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "true != false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "!true",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpFalse),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `!("ab" + "c" == "abc") == !5`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Left for the VM to report.
+			input:             "-true",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// TestOperators checks the instruction of every operator, on operands the
+// compiler cannot fold.
+func TestOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []code.Instructions
+	}{
+		{"fn(a, b) { a + b }", []code.Instructions{code.Make(code.OpGetLocal, 0), code.Make(code.OpGetLocal, 1), code.Make(code.OpAdd)}},
+		{"fn(a, b) { a - b }", []code.Instructions{code.Make(code.OpGetLocal, 0), code.Make(code.OpGetLocal, 1), code.Make(code.OpSub)}},
+		{"fn(a, b) { a * b }", []code.Instructions{code.Make(code.OpGetLocal, 0), code.Make(code.OpGetLocal, 1), code.Make(code.OpMul)}},
+		{"fn(a, b) { a / b }", []code.Instructions{code.Make(code.OpGetLocal, 0), code.Make(code.OpGetLocal, 1), code.Make(code.OpDiv)}},
+		{"fn(a, b) { a > b }", []code.Instructions{code.Make(code.OpGetLocal, 0), code.Make(code.OpGetLocal, 1), code.Make(code.OpGreaterThan)}},
+		{"fn(a, b) { a < b }", []code.Instructions{code.Make(code.OpGetLocal, 0), code.Make(code.OpGetLocal, 1), code.Make(code.OpLessThan)}},
+		{"fn(a, b) { a == b }", []code.Instructions{code.Make(code.OpGetLocal, 0), code.Make(code.OpGetLocal, 1), code.Make(code.OpEqual)}},
+		{"fn(a, b) { a != b }", []code.Instructions{code.Make(code.OpGetLocal, 0), code.Make(code.OpGetLocal, 1), code.Make(code.OpNotEqual)}},
+		{"fn(a) { -a }", []code.Instructions{code.Make(code.OpGetLocal, 0), code.Make(code.OpMinus)}},
+		{"fn(a) { !a }", []code.Instructions{code.Make(code.OpGetLocal, 0), code.Make(code.OpBang)}},
+	}
+
+	for _, tt := range tests {
+		runCompilerTests(t, []compilerTestCase{{
+			input:             tt.input,
+			expectedConstants: []interface{}{append(tt.expected, code.Make(code.OpReturnValue))},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		}})
+	}
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { 10 } else { 20 }; 3333;",
+			expectedConstants: []interface{}{10, 20, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 13),
+				// 0010
+				code.Make(code.OpConstant, 1),
+				// 0013
+				code.Make(code.OpPop),
+				// 0014
+				code.Make(code.OpConstant, 2),
+				// 0017
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 8),
+				// 0004
+				code.Make(code.OpNull),
+				// 0005
+				code.Make(code.OpJump, 9),
+				// 0008
+				code.Make(code.OpNull),
+				// 0009
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestWhileLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "while (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 11),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpPop),
+				// 0008
+				code.Make(code.OpJump, 0),
+				// 0011
+				code.Make(code.OpNull),
+				// 0012
+				code.Make(code.OpPop),
+				// 0013
+				code.Make(code.OpConstant, 1),
+				// 0016
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let one = 1; let two = one; two;",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestStringArrayAndHashLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `"mon" + "key"`,
+			expectedConstants: []interface{}{"monkey"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[1, 2][0]",
+			expectedConstants: []interface{}{1, 2, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "{2: 3, 1: 4}",
+			expectedConstants: []interface{}{2, 3, 1, 4},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpHash, 4),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1;\ny", "2:1: identifier not found: y"},
+		{"let x = x;", "1:9: identifier not found: x"},
+		{"x = 1;", "1:1: identifier not found: x"},
+		{"len = 1;", "1:1: identifier not found: len"},
+	}
+
+	for _, tt := range tests {
+		_, err := Compile(parse(tt.input))
+		if err == nil {
+			t.Errorf("%q: expected a compile error", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; let f = fn() { x };", nil},
+		{"let f = fn(a) { let b = a; b };", nil},
+		{"let f = fn() { let x = 1; 2 };", []string{"1:20: x declared and not used"}},
+		{"let f = fn() { let _x = 1; 2 };", nil},
+		{"let f = fn() { let x = 1; let x = 2; x };", []string{"1:20: x declared and not used"}},
+		{"let f = fn() { let x = 1; let g = fn() { x }; g };", nil},
+		{"let f = fn(unused) { 1 };", nil},
+		{
+			"let x = 1;\nlet f = fn(x) { x };\nx",
+			[]string{"2:12: x shadows declaration at 1:5"},
+		},
+		{
+			"let f = fn(a) {\n  fn() { let a = 2; a }\n};",
+			[]string{"2:14: a shadows declaration at 1:12"},
+		},
+		{"let len = 1; len", nil},
+		{"let f = fn() { let len = 1; len };", nil},
+	}
+
+	for _, tt := range tests {
+		c := New()
+		if err := c.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("%q: compiler error: %s", tt.input, err)
+		}
+
+		var got []string
+		for _, w := range c.Warnings() {
+			got = append(got, w.String())
+		}
+		if !slices.Equal(got, tt.expected) {
+			t.Errorf("%q: wrong warnings.\nwant=%q\ngot =%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		err = testInstructions(tt.expectedInstructions, bytecode.Instructions)
+		if err != nil {
+			t.Fatalf("%q: testInstructions failed: %s", tt.input, err)
+		}
+
+		err = testConstants(tt.expectedConstants, bytecode.Constants)
+		if err != nil {
+			t.Fatalf("%q: testConstants failed: %s", tt.input, err)
+		}
+	}
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func testInstructions(expected []code.Instructions, actual code.Instructions) error {
+	concatted := concatInstructions(expected)
+
+	if len(actual) != len(concatted) {
+		return fmt.Errorf("wrong instructions length.\nwant=%q\ngot =%q", concatted, actual)
+	}
+
+	for i, ins := range concatted {
+		if actual[i] != ins {
+			return fmt.Errorf("wrong instruction at %d.\nwant=%q\ngot =%q", i, concatted, actual)
+		}
+	}
+
+	return nil
+}
+
+func testConstants(expected []interface{}, actual []object.Object) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("wrong number of constants. got=%d, want=%d", len(actual), len(expected))
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[i].(*object.Integer)
+			if !ok || integer.Value != int64(constant) {
+				return fmt.Errorf("constant %d - wrong value. want=%d, got=%s", i, constant, actual[i].Inspect())
+			}
+		case string:
+			str, ok := actual[i].(*object.String)
+			if !ok || str.Value != constant {
+				return fmt.Errorf("constant %d - wrong value. want=%q, got=%s", i, constant, actual[i].Inspect())
+			}
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("constant %d - not a function: %T", i, actual[i])
+			}
+			if err := testInstructions(constant, fn.Instructions); err != nil {
+				return fmt.Errorf("constant %d - testInstructions failed: %s", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a) { return a + 10 }",
+			expectedConstants: []interface{}{
+				10,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { 1; 2 }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFunctionCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "let oneArg = fn(a) { a }; oneArg(24);",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				24,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { let num = 55; num }",
+			expectedConstants: []interface{}{
+				55,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a) { fn(b) { a + b } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "let countDown = fn(x) { countDown(x - 1); };",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCells(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a) { let b = 1; fn() { a = b; b++ } }",
+			expectedConstants: []interface{}{
+				1,
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetFreeCell, 1),
+					code.Make(code.OpSetFreeCell, 0),
+					code.Make(code.OpGetFreeCell, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetFreeCell, 1),
+					code.Make(code.OpGetFreeCell, 1),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpSetFreeCell, 1),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCell, 0),
+					code.Make(code.OpNull),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpCell, 1),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetCell, 1),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpClosure, 2, 2),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// An assigned name a function refers to itself by is its
+			// binding, which is in a cell inside a function.
+			input: "fn() { let f = fn() { f = 1 }; f }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetFreeCell, 0),
+					code.Make(code.OpGetFreeCell, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpNull),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpCell, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpSetCell, 0),
+					code.Make(code.OpGetCell, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(f) { if (f) { return f(); }; f(1) + 1 }",
+			expectedConstants: []interface{}{
+				1,
+				1,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpGetLocal, 0),
+					// 0002
+					code.Make(code.OpJumpNotTruthy, 14),
+					// 0005
+					code.Make(code.OpGetLocal, 0),
+					// 0007
+					code.Make(code.OpTailCall, 0),
+					// 0009
+					code.Make(code.OpReturnValue),
+					// 0010
+					code.Make(code.OpNull),
+					// 0011
+					code.Make(code.OpJump, 15),
+					// 0014
+					code.Make(code.OpNull),
+					// 0015
+					code.Make(code.OpPop),
+					// 0016
+					code.Make(code.OpGetLocal, 0),
+					// 0018
+					code.Make(code.OpConstant, 0),
+					// 0021
+					code.Make(code.OpCall, 1),
+					// 0023
+					code.Make(code.OpConstant, 1),
+					// 0026
+					code.Make(code.OpAdd),
+					// 0027
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(f) { if (f) { f() } else { len(f) } }; return len([]);",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpGetLocal, 0),
+					// 0002
+					code.Make(code.OpJumpNotTruthy, 12),
+					// 0005
+					code.Make(code.OpGetLocal, 0),
+					// 0007
+					code.Make(code.OpTailCall, 0),
+					// 0009
+					code.Make(code.OpJump, 17),
+					// 0012
+					code.Make(code.OpGetLocal, 0),
+					// 0014
+					code.Make(code.OpCallBuiltin, builtinIndex("len"), 1),
+					// 0017
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCallBuiltin, builtinIndex("len"), 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// builtinIndex returns the index of the builtin name, which changes as
+// builtins are added.
+func builtinIndex(name string) int {
+	for i, builtin := range evaluator.BuiltinNames() {
+		if builtin == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestBuiltins(t *testing.T) {
+	lenIndex := builtinIndex("len")
+
+	tests := []compilerTestCase{
+		{
+			input:             "len([])",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCallBuiltin, lenIndex, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let l = len; l([])",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, lenIndex),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(len) { len(1) }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCompilerScopes(t *testing.T) {
+	compiler := New()
+	globalSymbolTable := compiler.symbolTable
+
+	compiler.emit(code.OpMul)
+
+	compiler.enterScope()
+	if compiler.scopeIndex != 1 {
+		t.Errorf("scopeIndex wrong. got=%d, want=%d", compiler.scopeIndex, 1)
+	}
+	compiler.emit(code.OpSub)
+	if compiler.symbolTable.Outer != globalSymbolTable {
+		t.Errorf("compiler did not enclose symbolTable")
+	}
+
+	compiler.leaveScope()
+	if compiler.scopeIndex != 0 {
+		t.Errorf("scopeIndex wrong. got=%d, want=%d", compiler.scopeIndex, 0)
+	}
+	if compiler.symbolTable != globalSymbolTable {
+		t.Errorf("compiler did not restore global symbol table")
+	}
+
+	compiler.emit(code.OpAdd)
+	last := compiler.scopes[compiler.scopeIndex].lastInstruction
+	previous := compiler.scopes[compiler.scopeIndex].previousInstruction
+	if last.Opcode != code.OpAdd || previous.Opcode != code.OpMul {
+		t.Errorf("wrong instructions in main scope. last=%d, previous=%d", last.Opcode, previous.Opcode)
+	}
+}
+
+func TestDefine(t *testing.T) {
+	expected := map[string]Symbol{
+		"a": {Name: "a", Scope: GlobalScope, Index: 0},
+		"b": {Name: "b", Scope: GlobalScope, Index: 1},
+		"c": {Name: "c", Scope: LocalScope, Index: 0},
+		"d": {Name: "d", Scope: LocalScope, Index: 1},
+	}
+
+	global := NewSymbolTable()
+	if a := global.Define("a"); a != expected["a"] {
+		t.Errorf("expected a=%+v, got=%+v", expected["a"], a)
+	}
+	if b := global.Define("b"); b != expected["b"] {
+		t.Errorf("expected b=%+v, got=%+v", expected["b"], b)
+	}
+	if a := global.Define("a"); a != expected["a"] {
+		t.Errorf("redefinition got a new slot. expected a=%+v, got=%+v", expected["a"], a)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	if c := local.Define("c"); c != expected["c"] {
+		t.Errorf("expected c=%+v, got=%+v", expected["c"], c)
+	}
+	if d := local.Define("d"); d != expected["d"] {
+		t.Errorf("expected d=%+v, got=%+v", expected["d"], d)
+	}
+}
+
+func TestNames(t *testing.T) {
+	bytecode, err := Compile(parse("let a = 1; let f = fn(x) { let y = x; let a = y; a }; let b = 2;"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	if want := []string{"a", "f", "b"}; !slices.Equal(bytecode.GlobalNames, want) {
+		t.Errorf("wrong global names. want=%q, got=%q", want, bytecode.GlobalNames)
+	}
+	fn := bytecode.Constants[1].(*object.CompiledFunction)
+	if want := []string{"x", "y", "a"}; !slices.Equal(fn.LocalNames, want) {
+		t.Errorf("wrong local names. want=%q, got=%q", want, fn.LocalNames)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.DefineBuiltin(0, "len")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("b")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("c")
+
+	tests := []struct {
+		table    *SymbolTable
+		expected []Symbol
+	}{
+		{
+			firstLocal,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 0},
+				{Name: "len", Scope: BuiltinScope, Index: 0},
+				{Name: "b", Scope: LocalScope, Index: 0},
+			},
+		},
+		{
+			secondLocal,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 0},
+				{Name: "len", Scope: BuiltinScope, Index: 0},
+				{Name: "b", Scope: FreeScope, Index: 0},
+				{Name: "c", Scope: LocalScope, Index: 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, sym := range tt.expected {
+			result, ok := tt.table.Resolve(sym.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+			}
+		}
+	}
+
+	expectedFree := []Symbol{{Name: "b", Scope: LocalScope, Index: 0}}
+	if len(secondLocal.FreeSymbols) != len(expectedFree) || secondLocal.FreeSymbols[0] != expectedFree[0] {
+		t.Errorf("wrong free symbols. want=%+v, got=%+v", expectedFree, secondLocal.FreeSymbols)
+	}
+
+	if _, ok := global.Resolve("nope"); ok {
+		t.Errorf("undefined name resolved")
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	input := "let x = 1;\nlet f = fn(a) {\n  a + x\n};\nf(2)"
+
+	bytecode, err := Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	tests := []struct {
+		sourceMap code.SourceMap
+		offset    int
+		expected  string
+	}{
+		{bytecode.SourceMap, 0, "1:9"},  // OpConstant 1
+		{bytecode.SourceMap, 3, "1:1"},  // OpSetGlobal x
+		{bytecode.SourceMap, 4, "1:1"},  // operand of OpSetGlobal
+		{bytecode.SourceMap, 6, "2:9"},  // OpClosure
+		{bytecode.SourceMap, 10, "2:1"}, // OpSetGlobal f
+		{bytecode.SourceMap, 13, "5:1"}, // OpGetGlobal f
+		{bytecode.SourceMap, 16, "5:3"}, // OpConstant 2
+		{bytecode.SourceMap, 19, "5:1"}, // OpCall
+	}
+
+	fn := bytecode.Constants[1].(*object.CompiledFunction)
+	tests = append(tests, []struct {
+		sourceMap code.SourceMap
+		offset    int
+		expected  string
+	}{
+		{fn.SourceMap, 0, "3:3"}, // OpGetLocal a
+		{fn.SourceMap, 2, "3:7"}, // OpGetGlobal x
+		{fn.SourceMap, 5, "3:3"}, // OpAdd
+	}...)
+
+	for _, tt := range tests {
+		pos, ok := tt.sourceMap.Lookup(tt.offset)
+		if !ok || pos.String() != tt.expected {
+			t.Errorf("wrong position for offset %d. want=%s, got=%s (%t)", tt.offset, tt.expected, pos, ok)
+		}
+	}
+
+	optimized := Optimize(bytecode)
+	if pos, _ := optimized.SourceMap.Lookup(13); pos.String() != "5:1" {
+		t.Errorf("optimized main lost its source map. got=%s", pos)
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 / 0",
+			expectedConstants: []interface{}{1, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpBinaryConstant, 1, int(code.OpDiv)),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { 1; 2 }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { if (true) { return 1; } else { return 2; }; 3 }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				3,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpTrue),
+					// 0001
+					code.Make(code.OpJumpNotTruthy, 8),
+					// 0004
+					code.Make(code.OpConstant, 0),
+					// 0007
+					code.Make(code.OpReturnValue),
+					// 0008
+					code.Make(code.OpConstant, 1),
+					// 0011
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(f, x) { f(x) + 1 }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocalCall, 1, 1),
+					code.Make(code.OpBinaryConstant, 0, int(code.OpAdd)),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(f, x) { f(if (x) { 2 } else { x }) * 3 }",
+			expectedConstants: []interface{}{
+				2,
+				3,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpGetLocal, 0),
+					// 0002
+					code.Make(code.OpGetLocal, 1),
+					// 0004
+					code.Make(code.OpJumpNotTruthy, 13),
+					// 0007
+					code.Make(code.OpConstant, 0),
+					// 0010
+					code.Make(code.OpJump, 15),
+					// 0013
+					code.Make(code.OpGetLocal, 1),
+					// 0015: not fused, as the jump lands here
+					code.Make(code.OpCall, 1),
+					// 0017
+					code.Make(code.OpBinaryConstant, 1, int(code.OpMul)),
+					// 0021
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let x = true; if (x) { if (x) { 1 } else { 2 } } else { 3 }; 4",
+			expectedConstants: []interface{}{1, 2, 3, 4},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpSetGlobal, 0),
+				// 0004
+				code.Make(code.OpGetGlobal, 0),
+				// 0007
+				code.Make(code.OpJumpNotTruthy, 28),
+				// 0010
+				code.Make(code.OpGetGlobal, 0),
+				// 0013
+				code.Make(code.OpJumpNotTruthy, 22),
+				// 0016
+				code.Make(code.OpConstant, 0),
+				// 0019: jumps past the outer else directly
+				code.Make(code.OpJump, 31),
+				// 0022
+				code.Make(code.OpConstant, 1),
+				// 0025
+				code.Make(code.OpJump, 31),
+				// 0028
+				code.Make(code.OpConstant, 2),
+				// 0031
+				code.Make(code.OpPop),
+				// 0032
+				code.Make(code.OpConstant, 3),
+				// 0035
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		bytecode, err := Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		optimized := Optimize(bytecode)
+
+		if err := testInstructions(tt.expectedInstructions, optimized.Instructions); err != nil {
+			t.Errorf("%q: testInstructions failed: %s", tt.input, err)
+		}
+		if err := testConstants(tt.expectedConstants, optimized.Constants); err != nil {
+			t.Errorf("%q: testConstants failed: %s", tt.input, err)
+		}
+	}
+}
+
+// TestOptimizeFolding checks the folding of the optimizer on bytecode
+// written by hand, as the compiler already folds constant expressions.
+func TestOptimizeFolding(t *testing.T) {
+	// 1 + 2 * 3; 4
+	bytecode := &Bytecode{
+		Instructions: concatInstructions([]code.Instructions{
+			code.Make(code.OpConstant, 0),
+			code.Make(code.OpConstant, 1),
+			code.Make(code.OpConstant, 2),
+			code.Make(code.OpMul),
+			code.Make(code.OpAdd),
+			code.Make(code.OpPop),
+			code.Make(code.OpConstant, 3),
+			code.Make(code.OpMinus),
+			code.Make(code.OpConstant, 3),
+			code.Make(code.OpMinus),
+			code.Make(code.OpEqual),
+			code.Make(code.OpPop),
+		}),
+		Constants: []object.Object{
+			&object.Integer{Value: 1},
+			&object.Integer{Value: 2},
+			&object.Integer{Value: 3},
+			&object.Integer{Value: 5},
+		},
+	}
+
+	optimized := Optimize(bytecode)
+
+	// The first statement is folded to 7, then dropped as it is popped
+	// straight away; -5 == -5 is folded to true.
+	expectedInstructions := []code.Instructions{
+		code.Make(code.OpTrue),
+		code.Make(code.OpPop),
+	}
+	if err := testInstructions(expectedInstructions, optimized.Instructions); err != nil {
+		t.Errorf("testInstructions failed: %s", err)
+	}
+	if err := testConstants([]interface{}{1, 2, 3, 5, 6, -5, -5, 7}, optimized.Constants); err != nil {
+		t.Errorf("testConstants failed: %s", err)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	input := `let greet = fn(name) { "Greets name."; fn() { "hello " + name } }; greet("monkey")(); -12345678901;`
+
+	bytecode, err := Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := Save(&buf, bytecode); err != nil {
+		t.Fatalf("Save failed: %s", err)
+	}
+	if !IsBytecode(buf.Bytes()) {
+		t.Fatalf("saved bytecode does not start with the magic header")
+	}
+
+	loaded, err := Load(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Load failed: %s", err)
+	}
+
+	if err := testInstructions([]code.Instructions{bytecode.Instructions}, loaded.Instructions); err != nil {
+		t.Errorf("main instructions differ: %s", err)
+	}
+	if !reflect.DeepEqual(loaded.SourceMap, bytecode.SourceMap) {
+		t.Errorf("main source map differs. want=%v, got=%v", bytecode.SourceMap, loaded.SourceMap)
+	}
+	if !slices.Equal(loaded.GlobalNames, bytecode.GlobalNames) {
+		t.Errorf("global names differ. want=%q, got=%q", bytecode.GlobalNames, loaded.GlobalNames)
+	}
+
+	expected := []interface{}{}
+	for _, c := range bytecode.Constants {
+		switch c := c.(type) {
+		case *object.Integer:
+			expected = append(expected, int(c.Value))
+		case *object.String:
+			expected = append(expected, c.Value)
+		case *object.CompiledFunction:
+			expected = append(expected, []code.Instructions{c.Instructions})
+			fn := loaded.Constants[len(expected)-1].(*object.CompiledFunction)
+			if fn.NumLocals != c.NumLocals || fn.NumParameters != c.NumParameters {
+				t.Errorf("function counts differ. want=%d/%d, got=%d/%d", c.NumLocals, c.NumParameters, fn.NumLocals, fn.NumParameters)
+			}
+			if !reflect.DeepEqual(fn.SourceMap, c.SourceMap) {
+				t.Errorf("function source map differs. want=%v, got=%v", c.SourceMap, fn.SourceMap)
+			}
+			if !slices.Equal(fn.LocalNames, c.LocalNames) {
+				t.Errorf("local names differ. want=%q, got=%q", c.LocalNames, fn.LocalNames)
+			}
+			if fn.Doc != c.Doc {
+				t.Errorf("docstrings differ. want=%q, got=%q", c.Doc, fn.Doc)
+			}
+		}
+	}
+	if err := testConstants(expected, loaded.Constants); err != nil {
+		t.Errorf("constants differ: %s", err)
+	}
+}
+
+// saveBytecode returns the .mbc encoding of a program of ins and constants,
+// which need not be a program the compiler would produce.
+func saveBytecode(t *testing.T, ins code.Instructions, constants ...object.Object) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := Save(&buf, &Bytecode{Instructions: ins, Constants: constants}); err != nil {
+		t.Fatalf("Save failed: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestLoadErrors(t *testing.T) {
+	var valid bytes.Buffer
+	if err := Save(&valid, &Bytecode{Instructions: code.Make(code.OpTrue), Constants: []object.Object{&object.Integer{Value: 1}}}); err != nil {
+		t.Fatalf("Save failed: %s", err)
+	}
+
+	wrongVersion := append([]byte{}, valid.Bytes()...)
+	wrongVersion[len(Magic)+1]++
+
+	tests := []struct {
+		input    []byte
+		expected string
+	}{
+		{[]byte("let x = 1;"), "not a compiled monkey program"},
+		{[]byte{}, "not a compiled monkey program"},
+		{wrongVersion, fmt.Sprintf("unsupported bytecode version %d (want %d); recompile the program", FormatVersion+1, FormatVersion)},
+		{valid.Bytes()[:valid.Len()-1], "corrupt bytecode: unexpected EOF"},
+		{saveBytecode(t, []byte{255}), "corrupt bytecode: main program: offset 0: opcode 255 undefined"},
+		{saveBytecode(t, []byte{byte(code.OpConstant), 0}), "corrupt bytecode: main program: offset 0: OpConstant is missing operands"},
+		{saveBytecode(t, code.Make(code.OpConstant, 1)), "corrupt bytecode: main program: offset 0: constant 1 out of range"},
+		{saveBytecode(t, code.Make(code.OpGetGlobal, 0)), "corrupt bytecode: main program: offset 0: global 0 out of range"},
+		{saveBytecode(t, code.Make(code.OpGetLocal, 0)), "corrupt bytecode: main program: offset 0: local 0 out of range"},
+		{saveBytecode(t, code.Make(code.OpGetBuiltin, 255)), "corrupt bytecode: main program: offset 0: builtin 255 out of range"},
+		{saveBytecode(t, code.Make(code.OpJump, 4)), "corrupt bytecode: main program: offset 0: jump to 4 out of range"},
+		{saveBytecode(t, code.Make(code.OpJump, 1)), "corrupt bytecode: main program: offset 0: jump to 1 is not to an instruction"},
+		{saveBytecode(t, code.Make(code.OpReturn)), "corrupt bytecode: main program: offset 0: OpReturn outside a function"},
+		{saveBytecode(t, code.Make(code.OpPop)), "corrupt bytecode: main program: offset 0: OpPop pops 1 values of 0 on the stack"},
+		{saveBytecode(t, concatInstructions([]code.Instructions{
+			code.Make(code.OpTrue),
+			code.Make(code.OpJumpNotTruthy, 4),
+			code.Make(code.OpPop),
+		})), "corrupt bytecode: main program: offset 4: OpPop pops 1 values of 0 on the stack"},
+		{saveBytecode(t, concatInstructions([]code.Instructions{
+			code.Make(code.OpTrue),
+			code.Make(code.OpJumpNotTruthy, 5),
+			code.Make(code.OpNull),
+			code.Make(code.OpNull),
+		})), "corrupt bytecode: main program: offset 5: reached with 0 and 1 values on the stack"},
+		{saveBytecode(t, code.Make(code.OpClosure, 0, 0), &object.Integer{Value: 1}), "corrupt bytecode: main program: offset 0: constant 0 is not a function"},
+		{saveBytecode(t, code.Make(code.OpClosure, 0, 0), &object.CompiledFunction{
+			Instructions: concatInstructions([]code.Instructions{code.Make(code.OpGetFree, 0), code.Make(code.OpReturnValue)}),
+		}), "corrupt bytecode: constant 0: offset 0: free variable 0 out of range"},
+	}
+
+	for _, tt := range tests {
+		_, err := Load(bytes.NewReader(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("Load(%q) wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package compiler
+
+import (
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/code"
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/object"
+)
+
+// Constant folding is shared by the compiler, which evaluates constant
+// expressions in the syntax tree, and the optimizer, which folds the
+// constants it finds in bytecode, so that both compute exactly what the VM
+// would.
+
+var prefixOps = map[string]code.Opcode{
+	"!": code.OpBang,
+	"-": code.OpMinus,
+	"~": code.OpBitNot,
+}
+
+var infixOps = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	">":  code.OpGreaterThan,
+	"<":  code.OpLessThan,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	"&":  code.OpBitAnd,
+	"|":  code.OpBitOr,
+	"^":  code.OpBitXor,
+	"<<": code.OpShiftLeft,
+	">>": code.OpShiftRight,
+}
+
+// constantValue evaluates node if it is a literal integer, string or
+// boolean, or operators applied to such values.
+func constantValue(node ast.Expression) (object.Object, bool) {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}, true
+
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}, true
+
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}, true
+
+	case *ast.Boolean:
+		return nativeBool(node.Value), true
+
+	case *ast.PrefixExpression:
+		op, ok := prefixOps[node.Operator]
+		if !ok {
+			return nil, false
+		}
+		operand, ok := constantValue(node.Right)
+		if !ok {
+			return nil, false
+		}
+		return foldUnary(op, operand)
+
+	case *ast.InfixExpression:
+		op, ok := infixOps[node.Operator]
+		if !ok {
+			return nil, false
+		}
+		left, ok := constantValue(node.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := constantValue(node.Right)
+		if !ok {
+			return nil, false
+		}
+		return foldBinary(op, left, right)
+	}
+
+	return nil, false
+}
+
+// foldUnary computes op on a constant operand the way the VM would.
+func foldUnary(op code.Opcode, operand object.Object) (object.Object, bool) {
+	switch op {
+	case code.OpBang:
+		switch operand {
+		case evaluator.TRUE:
+			return evaluator.FALSE, true
+		case evaluator.FALSE, evaluator.NULL:
+			return evaluator.TRUE, true
+		}
+		return evaluator.FALSE, true
+
+	case code.OpMinus:
+		switch operand := operand.(type) {
+		case *object.Integer:
+			return &object.Integer{Value: -operand.Value}, true
+		case *object.Float:
+			return &object.Float{Value: -operand.Value}, true
+		}
+
+	case code.OpBitNot:
+		if i, ok := operand.(*object.Integer); ok {
+			return &object.Integer{Value: ^i.Value}, true
+		}
+	}
+
+	return nil, false
+}
+
+// foldBinary computes op on two constant operands of the same type the way
+// the VM would. Division by zero and operators that do not apply to the
+// operands are left for the VM to report.
+func foldBinary(op code.Opcode, left, right object.Object) (object.Object, bool) {
+	switch left := left.(type) {
+	case *object.Integer:
+		right, ok := right.(*object.Integer)
+		if !ok {
+			return nil, false
+		}
+		switch op {
+		case code.OpAdd:
+			return &object.Integer{Value: left.Value + right.Value}, true
+		case code.OpSub:
+			return &object.Integer{Value: left.Value - right.Value}, true
+		case code.OpMul:
+			return &object.Integer{Value: left.Value * right.Value}, true
+		case code.OpDiv:
+			if right.Value != 0 {
+				return &object.Integer{Value: left.Value / right.Value}, true
+			}
+		case code.OpEqual:
+			return nativeBool(left.Value == right.Value), true
+		case code.OpNotEqual:
+			return nativeBool(left.Value != right.Value), true
+		case code.OpGreaterThan:
+			return nativeBool(left.Value > right.Value), true
+		case code.OpLessThan:
+			return nativeBool(left.Value < right.Value), true
+		case code.OpBitAnd:
+			return &object.Integer{Value: left.Value & right.Value}, true
+		case code.OpBitOr:
+			return &object.Integer{Value: left.Value | right.Value}, true
+		case code.OpBitXor:
+			return &object.Integer{Value: left.Value ^ right.Value}, true
+		case code.OpShiftLeft:
+			if right.Value >= 0 {
+				return &object.Integer{Value: left.Value << right.Value}, true
+			}
+		case code.OpShiftRight:
+			if right.Value >= 0 {
+				return &object.Integer{Value: left.Value >> right.Value}, true
+			}
+		}
+
+	case *object.Float:
+		right, ok := right.(*object.Float)
+		if !ok {
+			return nil, false
+		}
+		switch op {
+		case code.OpAdd:
+			return &object.Float{Value: left.Value + right.Value}, true
+		case code.OpSub:
+			return &object.Float{Value: left.Value - right.Value}, true
+		case code.OpMul:
+			return &object.Float{Value: left.Value * right.Value}, true
+		case code.OpDiv:
+			if right.Value != 0 {
+				return &object.Float{Value: left.Value / right.Value}, true
+			}
+		case code.OpEqual:
+			return nativeBool(left.Value == right.Value), true
+		case code.OpNotEqual:
+			return nativeBool(left.Value != right.Value), true
+		case code.OpGreaterThan:
+			return nativeBool(left.Value > right.Value), true
+		case code.OpLessThan:
+			return nativeBool(left.Value < right.Value), true
+		}
+
+	case *object.String:
+		right, ok := right.(*object.String)
+		if !ok {
+			return nil, false
+		}
+		switch op {
+		case code.OpAdd:
+			return &object.String{Value: left.Value + right.Value}, true
+		case code.OpEqual:
+			return nativeBool(left.Value == right.Value), true
+		case code.OpNotEqual:
+			return nativeBool(left.Value != right.Value), true
+		}
+
+	case *object.Boolean:
+		if _, ok := right.(*object.Boolean); !ok {
+			return nil, false
+		}
+		switch op {
+		case code.OpEqual:
+			return nativeBool(left == right), true
+		case code.OpNotEqual:
+			return nativeBool(left != right), true
+		}
+	}
+
+	return nil, false
+}
+
+func nativeBool(b bool) *object.Boolean {
+	if b {
+		return evaluator.TRUE
+	}
+	return evaluator.FALSE
+}
@@ -0,0 +1,265 @@
+package compiler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/frankie-mur/monkeylang/code"
+	"github.com/frankie-mur/monkeylang/object"
+)
+
+// A compiled program is stored in an .mbc file as
+//
+//	magic      "MBC\x1a"
+//	version    uint16, big-endian
+//	constants  uvarint count, then each constant as a tag byte and its data
+//	main       the program's instructions as uvarint length and bytes,
+//	           followed by their source map and the names of the globals
+//
+// where the constant data is a varint for integers, the IEEE 754 bits as a
+// uvarint for floats, a uvarint length and bytes for strings, and the local
+// count, parameter count, instructions, source map, local names and
+// docstring for compiled functions. Function literals at any depth are all
+// entries of the one constant pool. A source map is a
+// uvarint count of mappings, each the instruction offset and the source
+// offset, line and column as uvarints. A list of names is a uvarint count of
+// strings.
+
+// Magic starts every .mbc file.
+const Magic = "MBC\x1a"
+
+// FormatVersion is the version of the .mbc format and instruction set this
+// package reads and writes. It must change whenever either does, or the set
+// of builtins, whose indexes the instructions hold, so stale files are
+// rejected instead of misinterpreted.
+const FormatVersion = 16
+
+// ErrNotBytecode is returned by Load for input without the .mbc magic.
+var ErrNotBytecode = errors.New("not a compiled monkey program")
+
+const (
+	tagInteger  byte = 1
+	tagString   byte = 2
+	tagFunction byte = 3
+	tagFloat    byte = 4
+)
+
+// IsBytecode reports whether data starts like an .mbc file.
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+// Save writes b to w in the .mbc format.
+func Save(w io.Writer, b *Bytecode) error {
+	buf := []byte(Magic)
+	buf = binary.BigEndian.AppendUint16(buf, FormatVersion)
+
+	buf = binary.AppendUvarint(buf, uint64(len(b.Constants)))
+	for i, c := range b.Constants {
+		switch c := c.(type) {
+		case *object.Integer:
+			buf = append(buf, tagInteger)
+			buf = binary.AppendVarint(buf, c.Value)
+		case *object.Float:
+			buf = append(buf, tagFloat)
+			buf = binary.AppendUvarint(buf, math.Float64bits(c.Value))
+		case *object.String:
+			buf = append(buf, tagString)
+			buf = appendBytes(buf, []byte(c.Value))
+		case *object.CompiledFunction:
+			buf = append(buf, tagFunction)
+			buf = binary.AppendUvarint(buf, uint64(c.NumLocals))
+			buf = binary.AppendUvarint(buf, uint64(c.NumParameters))
+			buf = appendBytes(buf, c.Instructions)
+			buf = appendSourceMap(buf, c.SourceMap)
+			buf = appendNames(buf, c.LocalNames)
+			buf = appendBytes(buf, []byte(c.Doc))
+		default:
+			return fmt.Errorf("constant %d: cannot encode %s", i, c.Type())
+		}
+	}
+
+	buf = appendBytes(buf, b.Instructions)
+	buf = appendSourceMap(buf, b.SourceMap)
+	buf = appendNames(buf, b.GlobalNames)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+func appendBytes(buf, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+func appendSourceMap(buf []byte, m code.SourceMap) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(m)))
+	for _, mapping := range m {
+		buf = binary.AppendUvarint(buf, uint64(mapping.Offset))
+		buf = binary.AppendUvarint(buf, uint64(mapping.Pos.Offset))
+		buf = binary.AppendUvarint(buf, uint64(mapping.Pos.Line))
+		buf = binary.AppendUvarint(buf, uint64(mapping.Pos.Column))
+	}
+	return buf
+}
+
+func appendNames(buf []byte, names []string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(names)))
+	for _, name := range names {
+		buf = appendBytes(buf, []byte(name))
+	}
+	return buf
+}
+
+// Load reads a program in the .mbc format from r. It fails with
+// ErrNotBytecode if r does not hold one, and with an error naming both
+// versions if it was written by an incompatible version. Instructions that
+// would make the VM read outside its constants, globals or stack, or jump
+// outside the instructions, are rejected as corrupt.
+func Load(r io.Reader) (*Bytecode, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(Magic)+2)
+	if _, err := io.ReadFull(br, header); err != nil || !IsBytecode(header) {
+		return nil, ErrNotBytecode
+	}
+	if version := binary.BigEndian.Uint16(header[len(Magic):]); version != FormatVersion {
+		return nil, fmt.Errorf("unsupported bytecode version %d (want %d); recompile the program", version, FormatVersion)
+	}
+
+	d := &decoder{r: br}
+	n := d.uvarint()
+	if d.err == nil && n > uint64(1<<16) {
+		d.err = fmt.Errorf("too many constants: %d", n)
+	}
+
+	b := &Bytecode{Constants: []object.Object{}}
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		switch tag := d.byte(); tag {
+		case tagInteger:
+			b.Constants = append(b.Constants, &object.Integer{Value: d.varint()})
+		case tagFloat:
+			b.Constants = append(b.Constants, &object.Float{Value: math.Float64frombits(d.uvarint())})
+		case tagString:
+			b.Constants = append(b.Constants, &object.String{Value: string(d.bytes())})
+		case tagFunction:
+			fn := &object.CompiledFunction{}
+			fn.NumLocals = int(d.uvarint())
+			fn.NumParameters = int(d.uvarint())
+			fn.Instructions = d.bytes()
+			fn.SourceMap = d.sourceMap()
+			fn.LocalNames = d.names()
+			fn.Doc = string(d.bytes())
+			b.Constants = append(b.Constants, fn)
+		default:
+			if d.err == nil {
+				d.err = fmt.Errorf("constant %d: unknown tag %d", i, tag)
+			}
+		}
+	}
+	b.Instructions = d.bytes()
+	b.SourceMap = d.sourceMap()
+	b.GlobalNames = d.names()
+
+	if d.err == nil {
+		d.err = verify(b)
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("corrupt bytecode: %w", d.err)
+	}
+	return b, nil
+}
+
+// decoder reads the parts of an .mbc file, remembering the first error so
+// callers can check once at the end.
+type decoder struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	b, err := d.r.ReadByte()
+	d.setErr(err)
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	d.setErr(err)
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(d.r)
+	d.setErr(err)
+	return v
+}
+
+func (d *decoder) bytes() code.Instructions {
+	n := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if n > 1<<30 {
+		d.err = fmt.Errorf("length %d too large", n)
+		return nil
+	}
+	b := make([]byte, n)
+	_, err := io.ReadFull(d.r, b)
+	d.setErr(err)
+	return b
+}
+
+func (d *decoder) sourceMap() code.SourceMap {
+	n := d.uvarint()
+	if d.err == nil && n > 1<<30 {
+		d.err = fmt.Errorf("source map length %d too large", n)
+	}
+
+	var m code.SourceMap
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		var mapping code.SourceMapping
+		mapping.Offset = int(d.uvarint())
+		mapping.Pos.Offset = int(d.uvarint())
+		mapping.Pos.Line = int(d.uvarint())
+		mapping.Pos.Column = int(d.uvarint())
+		m = append(m, mapping)
+	}
+	return m
+}
+
+func (d *decoder) names() []string {
+	n := d.uvarint()
+	if d.err == nil && n > 1<<16 {
+		d.err = fmt.Errorf("%d names are too many", n)
+	}
+
+	var names []string
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		names = append(names, string(d.bytes()))
+	}
+	return names
+}
+
+func (d *decoder) setErr(err error) {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if d.err == nil {
+		d.err = err
+	}
+}
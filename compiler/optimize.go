@@ -0,0 +1,333 @@
+package compiler
+
+import (
+	"github.com/frankie-mur/monkeylang/code"
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// Optimize returns a copy of bytecode with the main program and every
+// compiled function rewritten by a peephole optimizer, which
+//
+//   - folds arithmetic, comparisons and negations of constants,
+//   - drops values that are pushed only to be popped again,
+//   - points jumps to jumps straight at the final target, and
+//   - removes code after a return or jump that nothing jumps to, and
+//   - fuses frequent pairs of instructions into superinstructions.
+//
+// Folded values are appended to the constant pool, so the constant indices
+// of the original bytecode stay valid. The value popped last by the main
+// program is kept, as the REPL and tests read the result from it.
+func Optimize(bytecode *Bytecode) *Bytecode {
+	constants := make([]object.Object, len(bytecode.Constants))
+	copy(constants, bytecode.Constants)
+
+	for i, c := range constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			optimized := *fn
+			optimized.Instructions, optimized.SourceMap, constants = optimize(fn.Instructions, fn.SourceMap, constants, false)
+			constants[i] = &optimized
+		}
+	}
+
+	main, sourceMap, constants := optimize(bytecode.Instructions, bytecode.SourceMap, constants, true)
+	return &Bytecode{Instructions: main, Constants: constants, SourceMap: sourceMap, GlobalNames: bytecode.GlobalNames}
+}
+
+// instruction is a decoded instruction. The operand of a jump is the index
+// of the instruction it jumps to, which may be len(ins) for the end.
+type instruction struct {
+	op       code.Opcode
+	operands []int
+	pos      token.Position
+	dead     bool
+}
+
+type optimizer struct {
+	ins       []instruction
+	constants []object.Object
+}
+
+func optimize(ins code.Instructions, sourceMap code.SourceMap, constants []object.Object, keepLastPop bool) (code.Instructions, code.SourceMap, []object.Object) {
+	o := &optimizer{ins: decode(ins, sourceMap), constants: constants}
+
+	for changed := true; changed; {
+		changed = o.threadJumps()
+		changed = o.removeUnreachable() || changed
+		changed = o.fold(keepLastPop) || changed
+	}
+	o.fuse()
+
+	ins, sourceMap = o.encode()
+	return ins, sourceMap, o.constants
+}
+
+func isJump(op code.Opcode) bool {
+	return op == code.OpJump || op == code.OpJumpNotTruthy
+}
+
+func decode(ins code.Instructions, sourceMap code.SourceMap) []instruction {
+	var decoded []instruction
+	index := map[int]int{}
+
+	for i := 0; i < len(ins); {
+		def, _ := code.Lookup(ins[i])
+		operands, read := code.ReadOperands(def, ins[i+1:])
+
+		pos, _ := sourceMap.Lookup(i)
+		index[i] = len(decoded)
+		decoded = append(decoded, instruction{op: code.Opcode(ins[i]), operands: operands, pos: pos})
+		i += 1 + read
+	}
+	index[len(ins)] = len(decoded)
+
+	for i := range decoded {
+		if isJump(decoded[i].op) {
+			decoded[i].operands[0] = index[decoded[i].operands[0]]
+		}
+	}
+
+	return decoded
+}
+
+// next returns the index of the first live instruction at or after i, or
+// len(o.ins).
+func (o *optimizer) next(i int) int {
+	for i < len(o.ins) && o.ins[i].dead {
+		i++
+	}
+	return i
+}
+
+// targets returns the set of instructions live jumps land on.
+func (o *optimizer) targets() map[int]bool {
+	targets := map[int]bool{}
+	for _, in := range o.ins {
+		if !in.dead && isJump(in.op) {
+			targets[o.next(in.operands[0])] = true
+		}
+	}
+	return targets
+}
+
+// threadJumps makes jumps that land on an unconditional jump go directly
+// to its target, and removes unconditional jumps to the next instruction.
+func (o *optimizer) threadJumps() bool {
+	changed := false
+
+	for i := range o.ins {
+		in := &o.ins[i]
+		if in.dead || !isJump(in.op) {
+			continue
+		}
+
+		target := o.next(in.operands[0])
+		for hops := 0; target < len(o.ins) && o.ins[target].op == code.OpJump && target != i && hops < len(o.ins); hops++ {
+			target = o.next(o.ins[target].operands[0])
+			changed = true
+		}
+		in.operands[0] = target
+
+		if in.op == code.OpJump && target == o.next(i+1) {
+			in.dead = true
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// removeUnreachable removes the instructions following a return or an
+// unconditional jump up to the next jump target.
+func (o *optimizer) removeUnreachable() bool {
+	changed := false
+	targets := o.targets()
+
+	unreachable := false
+	for i := range o.ins {
+		in := &o.ins[i]
+		if in.dead {
+			continue
+		}
+		if targets[i] {
+			unreachable = false
+		}
+		if unreachable {
+			in.dead = true
+			changed = true
+			continue
+		}
+
+		switch in.op {
+		case code.OpJump, code.OpReturnValue, code.OpReturn:
+			unreachable = true
+		}
+	}
+
+	return changed
+}
+
+// fold rewrites short sequences of live instructions that no jump lands in
+// the middle of.
+func (o *optimizer) fold(keepLastPop bool) bool {
+	changed := false
+	targets := o.targets()
+
+	for a := o.next(0); a < len(o.ins); a = o.next(a + 1) {
+		b := o.next(a + 1)
+		if b == len(o.ins) || targets[b] {
+			continue
+		}
+		first, second := &o.ins[a], &o.ins[b]
+
+		if second.op == code.OpPop && pushesOnly(first.op) {
+			if keepLastPop && o.next(b+1) == len(o.ins) {
+				continue
+			}
+			first.dead, second.dead = true, true
+			changed = true
+			continue
+		}
+
+		operand, isValue := o.value(first)
+		if !isValue {
+			continue
+		}
+		if folded, ok := foldUnary(second.op, operand); ok {
+			pos := first.pos
+			*first = o.push(folded)
+			first.pos = pos
+			second.dead = true
+			changed = true
+			continue
+		}
+
+		c := o.next(b + 1)
+		if c == len(o.ins) || targets[c] {
+			continue
+		}
+		right, isValue := o.value(second)
+		if !isValue {
+			continue
+		}
+		if folded, ok := foldBinary(o.ins[c].op, operand, right); ok {
+			pos := first.pos
+			*first = o.push(folded)
+			first.pos = pos
+			second.dead, o.ins[c].dead = true, true
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// fuse replaces pairs of live instructions that no jump lands in the middle
+// of with the superinstruction doing the work of both. It runs once the
+// other rewrites are done, as they only recognize plain instructions. The
+// superinstruction takes the position of the second instruction, which is
+// the one that can fail.
+func (o *optimizer) fuse() {
+	targets := o.targets()
+
+	for a := o.next(0); a < len(o.ins); a = o.next(a + 1) {
+		b := o.next(a + 1)
+		if b == len(o.ins) || targets[b] {
+			continue
+		}
+		first, second := &o.ins[a], &o.ins[b]
+
+		switch {
+		case first.op == code.OpConstant && isBinary(second.op):
+			*first = instruction{op: code.OpBinaryConstant, operands: []int{first.operands[0], int(second.op)}, pos: second.pos}
+			second.dead = true
+		case first.op == code.OpGetLocal && second.op == code.OpCall:
+			*first = instruction{op: code.OpGetLocalCall, operands: []int{first.operands[0], second.operands[0]}, pos: second.pos}
+			second.dead = true
+		}
+	}
+}
+
+func isBinary(op code.Opcode) bool {
+	switch op {
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+		code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+		code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight:
+		return true
+	}
+	return false
+}
+
+// pushesOnly reports whether op only pushes a value, so that pushing it and
+// popping it straight away has no effect.
+func pushesOnly(op code.Opcode) bool {
+	switch op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull,
+		code.OpGetGlobal, code.OpGetLocal, code.OpGetBuiltin, code.OpGetFree, code.OpCurrentClosure:
+		return true
+	}
+	return false
+}
+
+// value returns the value an instruction pushes if it is a constant.
+func (o *optimizer) value(in *instruction) (object.Object, bool) {
+	switch in.op {
+	case code.OpConstant:
+		return o.constants[in.operands[0]], true
+	case code.OpTrue:
+		return evaluator.TRUE, true
+	case code.OpFalse:
+		return evaluator.FALSE, true
+	case code.OpNull:
+		return evaluator.NULL, true
+	}
+	return nil, false
+}
+
+// push returns the instruction pushing value, adding integers and strings
+// to the constant pool.
+func (o *optimizer) push(value object.Object) instruction {
+	switch value {
+	case evaluator.TRUE:
+		return instruction{op: code.OpTrue}
+	case evaluator.FALSE:
+		return instruction{op: code.OpFalse}
+	case evaluator.NULL:
+		return instruction{op: code.OpNull}
+	}
+	o.constants = append(o.constants, value)
+	return instruction{op: code.OpConstant, operands: []int{len(o.constants) - 1}}
+}
+
+func (o *optimizer) encode() (code.Instructions, code.SourceMap) {
+	offsets := make([]int, len(o.ins)+1)
+	size := 0
+	for i, in := range o.ins {
+		offsets[i] = size
+		if !in.dead {
+			def, _ := code.Lookup(byte(in.op))
+			size++
+			for _, w := range def.OperandWidths {
+				size += w
+			}
+		}
+	}
+	offsets[len(o.ins)] = size
+
+	ins := make(code.Instructions, 0, size)
+	var sourceMap code.SourceMap
+	for i, in := range o.ins {
+		if in.dead {
+			continue
+		}
+		operands := in.operands
+		if isJump(in.op) {
+			operands = []int{offsets[o.next(in.operands[0])]}
+		}
+		sourceMap.Add(offsets[i], in.pos)
+		ins = append(ins, code.Make(in.op, operands...)...)
+	}
+
+	return ins, sourceMap
+}
@@ -0,0 +1,170 @@
+package compiler
+
+import "github.com/frankie-mur/monkeylang/token"
+
+// SymbolScope is the kind of storage a symbol resolves to, which decides
+// the instructions used to read and write it.
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	BuiltinScope  SymbolScope = "BUILTIN"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+// Symbol is a resolved name: its scope and its index within that scope.
+// Cell reports whether the local or free variable is kept in a cell.
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	Cell  bool
+}
+
+// SymbolTable maps names to symbols for one scope. Function bodies get an
+// enclosed table whose Outer is the table of the surrounding code.
+//
+// A SymbolTable outlives a single compilation, so the REPL can compile each
+// line with NewWithState and the table of the previous lines.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	// FreeSymbols are the symbols of enclosing function scopes that this
+	// scope refers to, in the order they were first resolved.
+	FreeSymbols []Symbol
+
+	// positions and resolved serve the compiler's warnings: where the
+	// names of this scope were last defined, and which were resolved since.
+	positions map[string]token.Position
+	resolved  map[string]bool
+}
+
+// NewSymbolTable returns an empty global symbol table.
+func NewSymbolTable() *SymbolTable {
+	s := make(map[string]Symbol)
+	free := []Symbol{}
+	return &SymbolTable{
+		store:       s,
+		FreeSymbols: free,
+		positions:   map[string]token.Position{},
+		resolved:    map[string]bool{},
+	}
+}
+
+// NewEnclosedSymbolTable returns an empty local symbol table inside outer.
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Define binds name in the table's own scope. Defining a name again in the
+// same scope reuses its slot.
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name, Index: s.numDefinitions}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+// DefineCell binds name like Define, as a variable kept in a cell.
+func (s *SymbolTable) DefineCell(name string) Symbol {
+	symbol := s.Define(name)
+	symbol.Cell = true
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineBuiltin binds name to the builtin with the given index.
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineFree records original, a local of an enclosing function, as a free
+// variable of this scope and returns the symbol to access it with.
+func (s *SymbolTable) DefineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Cell: original.Cell}
+	symbol.Scope = FreeScope
+
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// DefineFunctionName binds name to the function whose body this table is
+// for, so the function can call itself without capturing its own binding.
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// Resolve looks name up in this scope and the enclosing ones. Locals of an
+// enclosing function become free symbols of this scope; globals and
+// builtins resolve as they are.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	obj, ok := s.store[name]
+	if ok {
+		s.resolved[name] = true
+	}
+	if !ok && s.Outer != nil {
+		obj, ok = s.Outer.Resolve(name)
+		if !ok {
+			return obj, ok
+		}
+
+		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+			return obj, ok
+		}
+
+		free := s.DefineFree(obj)
+		return free, true
+	}
+	return obj, ok
+}
+
+// outerDefinition returns where name is defined as a global or local of an
+// enclosing scope, if it is.
+func (s *SymbolTable) outerDefinition(name string) (token.Position, bool) {
+	for outer := s.Outer; outer != nil; outer = outer.Outer {
+		if symbol, ok := outer.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+			return outer.positions[name], true
+		}
+	}
+	return token.Position{}, false
+}
+
+// Names returns the names defined in the table's own scope, indexed by the
+// slot they use.
+func (s *SymbolTable) Names() []string {
+	names := make([]string, s.numDefinitions)
+	for name, symbol := range s.store {
+		if symbol.Scope == GlobalScope || symbol.Scope == LocalScope {
+			names[symbol.Index] = name
+		}
+	}
+	return names
+}
+
+// NumDefinitions returns how many slots the table's own scope uses.
+func (s *SymbolTable) NumDefinitions() int {
+	return s.numDefinitions
+}
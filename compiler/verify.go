@@ -0,0 +1,263 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/frankie-mur/monkeylang/code"
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/object"
+)
+
+// maxLocals is the number of locals a one-byte operand can address.
+const maxLocals = 1 << 8
+
+// checkedInstruction is an instruction of a block being verified and its offset.
+type checkedInstruction struct {
+	offset   int
+	op       code.Opcode
+	operands []int
+}
+
+// block is the code of the main program or of a compiled function, with
+// what its instructions may refer to.
+type block struct {
+	name         string
+	instructions []checkedInstruction
+	length       int
+	main         bool
+	numLocals    int
+	numFree      int
+}
+
+// verify checks that the VM can run b without reading outside its
+// instructions, constants, globals, builtins, locals, free variables or
+// stack, which a hand-made or corrupt .mbc file could otherwise make it do.
+// The compiler only produces bytecode that passes.
+func verify(b *Bytecode) error {
+	main, err := decodeBlock("main program", b.Instructions)
+	if err != nil {
+		return err
+	}
+	main.main = true
+	blocks := []*block{main}
+
+	functions := map[int]*block{}
+	for i, c := range b.Constants {
+		fn, ok := c.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		if fn.NumLocals > maxLocals {
+			return fmt.Errorf("constant %d: %d locals are too many", i, fn.NumLocals)
+		}
+		bl, err := decodeBlock(fmt.Sprintf("constant %d", i), fn.Instructions)
+		if err != nil {
+			return err
+		}
+		bl.numLocals = fn.NumLocals
+		bl.numFree = -1
+		blocks = append(blocks, bl)
+		functions[i] = bl
+	}
+
+	// A function can use as many free variables as the fewest any closure
+	// of it is made with.
+	for _, bl := range blocks {
+		for _, ins := range bl.instructions {
+			if ins.op != code.OpClosure {
+				continue
+			}
+			fn, ok := functions[ins.operands[0]]
+			if !ok {
+				return fmt.Errorf("%s: offset %d: constant %d is not a function", bl.name, ins.offset, ins.operands[0])
+			}
+			if fn.numFree < 0 || ins.operands[1] < fn.numFree {
+				fn.numFree = ins.operands[1]
+			}
+		}
+	}
+
+	for _, bl := range blocks {
+		if err := bl.verify(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeBlock splits ins into instructions, checking that each opcode is
+// defined and that its operands are all there.
+func decodeBlock(name string, ins code.Instructions) (*block, error) {
+	bl := &block{name: name, length: len(ins)}
+	for offset := 0; offset < len(ins); {
+		def, err := code.Lookup(ins[offset])
+		if err != nil {
+			return nil, fmt.Errorf("%s: offset %d: %w", name, offset, err)
+		}
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if offset+1+width > len(ins) {
+			return nil, fmt.Errorf("%s: offset %d: %s is missing operands", name, offset, def.Name)
+		}
+		operands, _ := code.ReadOperands(def, ins[offset+1:])
+		bl.instructions = append(bl.instructions, checkedInstruction{offset, code.Opcode(ins[offset]), operands})
+		offset += 1 + width
+	}
+	return bl, nil
+}
+
+// verify checks the operands of the block's instructions and follows every
+// path through them, checking that each instruction finds the values it
+// pops on the stack and that paths meet with the same number there.
+func (bl *block) verify(b *Bytecode) error {
+	at := make(map[int]int, len(bl.instructions))
+	for i, ins := range bl.instructions {
+		at[ins.offset] = i
+		if err := bl.checkOperands(b, ins); err != nil {
+			return fmt.Errorf("%s: offset %d: %w", bl.name, ins.offset, err)
+		}
+	}
+
+	heights := make([]int, len(bl.instructions))
+	for i := range heights {
+		heights[i] = -1
+	}
+
+	var pending []int
+	reach := func(from checkedInstruction, offset, height int) error {
+		if offset == bl.length {
+			return nil
+		}
+		i, ok := at[offset]
+		if !ok {
+			return fmt.Errorf("%s: offset %d: jump to %d is not to an instruction", bl.name, from.offset, offset)
+		}
+		switch heights[i] {
+		case -1:
+			heights[i] = height
+			pending = append(pending, i)
+		case height:
+		default:
+			return fmt.Errorf("%s: offset %d: reached with %d and %d values on the stack", bl.name, offset, heights[i], height)
+		}
+		return nil
+	}
+
+	if len(bl.instructions) > 0 {
+		heights[0] = 0
+		pending = append(pending, 0)
+	}
+	for len(pending) > 0 {
+		i := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		ins := bl.instructions[i]
+
+		pops, pushes := stackEffect(ins)
+		if pops > heights[i] {
+			return fmt.Errorf("%s: offset %d: %s pops %d values of %d on the stack", bl.name, ins.offset, opName(ins.op), pops, heights[i])
+		}
+		height := heights[i] - pops + pushes
+
+		next := bl.length
+		if i+1 < len(bl.instructions) {
+			next = bl.instructions[i+1].offset
+		}
+		switch ins.op {
+		case code.OpReturnValue, code.OpReturn:
+			continue
+		case code.OpJump:
+			next = ins.operands[0]
+		case code.OpJumpNotTruthy:
+			if err := reach(ins, ins.operands[0], height); err != nil {
+				return err
+			}
+		}
+		if err := reach(ins, next, height); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkOperands checks that the operands of ins refer to things that exist.
+func (bl *block) checkOperands(b *Bytecode, ins checkedInstruction) error {
+	switch ins.op {
+	case code.OpConstant, code.OpBinaryConstant, code.OpClosure:
+		if ins.operands[0] >= len(b.Constants) {
+			return fmt.Errorf("constant %d out of range", ins.operands[0])
+		}
+	}
+
+	switch ins.op {
+	case code.OpBinaryConstant:
+		switch code.Opcode(ins.operands[1]) {
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight:
+		default:
+			return fmt.Errorf("%s is not a binary operator", opName(code.Opcode(ins.operands[1])))
+		}
+	case code.OpGetGlobal, code.OpSetGlobal:
+		if ins.operands[0] >= len(b.GlobalNames) {
+			return fmt.Errorf("global %d out of range", ins.operands[0])
+		}
+	case code.OpGetLocal, code.OpSetLocal, code.OpGetLocalCall, code.OpCell, code.OpGetCell, code.OpSetCell:
+		if ins.operands[0] >= bl.numLocals {
+			return fmt.Errorf("local %d out of range", ins.operands[0])
+		}
+	case code.OpGetBuiltin, code.OpCallBuiltin:
+		if ins.operands[0] >= len(evaluator.BuiltinNames()) {
+			return fmt.Errorf("builtin %d out of range", ins.operands[0])
+		}
+	case code.OpGetFree, code.OpGetFreeCell, code.OpSetFreeCell:
+		if ins.operands[0] >= bl.numFree {
+			return fmt.Errorf("free variable %d out of range", ins.operands[0])
+		}
+	case code.OpHash:
+		if ins.operands[0]%2 != 0 {
+			return fmt.Errorf("hash of %d keys and values", ins.operands[0])
+		}
+	case code.OpJump, code.OpJumpNotTruthy:
+		if ins.operands[0] > bl.length {
+			return fmt.Errorf("jump to %d out of range", ins.operands[0])
+		}
+	case code.OpReturn, code.OpTailCall:
+		if bl.main {
+			return fmt.Errorf("%s outside a function", opName(ins.op))
+		}
+	}
+	return nil
+}
+
+// stackEffect returns how many values ins pops off the stack and how many
+// it pushes.
+func stackEffect(ins checkedInstruction) (pops, pushes int) {
+	switch ins.op {
+	case code.OpPop, code.OpJumpNotTruthy, code.OpSetGlobal, code.OpSetLocal, code.OpSetCell, code.OpSetFreeCell, code.OpReturnValue:
+		return 1, 0
+	case code.OpJump, code.OpReturn, code.OpCell:
+		return 0, 0
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+		code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+		code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight,
+		code.OpIndex:
+		return 2, 1
+	case code.OpMinus, code.OpBang, code.OpBitNot, code.OpBinaryConstant:
+		return 1, 1
+	case code.OpArray, code.OpHash, code.OpClosure, code.OpCallBuiltin, code.OpGetLocalCall:
+		return ins.operands[len(ins.operands)-1], 1
+	case code.OpCall, code.OpTailCall:
+		return ins.operands[0] + 1, 1
+	default:
+		return 0, 1
+	}
+}
+
+func opName(op code.Opcode) string {
+	if def, err := code.Lookup(byte(op)); err == nil {
+		return def.Name
+	}
+	return fmt.Sprintf("opcode %d", op)
+}
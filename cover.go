@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/frankie-mur/monkeylang/cover"
+)
+
+// coverFlags are the coverage flags of `monkey run` and `monkey test`.
+type coverFlags struct {
+	cover   bool
+	profile string
+}
+
+// addCoverFlags registers --cover and --coverprofile.
+func addCoverFlags(flags *flag.FlagSet) *coverFlags {
+	c := &coverFlags{}
+	flags.BoolVar(&c.cover, "cover", false, "report which statements ran")
+	flags.StringVar(&c.profile, "coverprofile", "", "write the coverage to `file`, as HTML if it ends in .html and as LCOV otherwise; implies --cover")
+	return c
+}
+
+// newProfile returns the profile to record coverage in, or nil if coverage
+// is off.
+func (c *coverFlags) newProfile() *cover.Profile {
+	if !c.cover && c.profile == "" {
+		return nil
+	}
+	return cover.New()
+}
+
+// report writes the summary of profile to w and the profile to the
+// --coverprofile file, if any. It reports failures to stderr and returns
+// false.
+func (c *coverFlags) report(profile *cover.Profile, w, stderr io.Writer) bool {
+	profile.WriteSummary(w)
+	if c.profile == "" {
+		return true
+	}
+
+	f, err := os.Create(c.profile)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return false
+	}
+	if filepath.Ext(c.profile) == ".html" {
+		err = profile.WriteHTML(f)
+	} else {
+		err = profile.WriteLCOV(f)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,192 @@
+// Package cover measures the statement coverage of Monkey programs: which
+// of their statements run, for example while `monkey test` runs their
+// tests. A Profile learns the statements of each file, counts them as an
+// evaluator runs them and reports the result as a summary, in the LCOV
+// format read by coverage services and editors, or as annotated HTML.
+package cover
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// Profile records the statements of the files added to it and how often
+// each ran.
+type Profile struct {
+	files      []*File
+	statements map[ast.Node]*Statement
+}
+
+// File is the coverage of one source file.
+type File struct {
+	Name       string
+	Src        string
+	Statements []*Statement // in source order
+}
+
+// Statement is a statement of a file and the number of times it ran.
+type Statement struct {
+	Pos   token.Position
+	Count int
+}
+
+// New returns an empty Profile.
+func New() *Profile {
+	return &Profile{statements: map[ast.Node]*Statement{}}
+}
+
+// Add adds the statements of program, parsed from src, the contents of the
+// file name. Statements in function bodies count as well as top-level ones;
+// the blocks holding them do not.
+func (p *Profile) Add(name, src string, program *ast.Program) {
+	f := &File{Name: name, Src: src}
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		// The parser leaves nil statements where it failed to parse one.
+		case *ast.LetStatement:
+			if node == nil {
+				return false
+			}
+		case *ast.ReturnStatement:
+			if node == nil {
+				return false
+			}
+		case *ast.ExpressionStatement:
+			if node == nil {
+				return false
+			}
+		case *ast.BlockStatement, nil:
+			return true
+		}
+		if stmt, ok := node.(ast.Statement); ok {
+			s := &Statement{Pos: stmt.Pos()}
+			p.statements[stmt] = s
+			f.Statements = append(f.Statements, s)
+		}
+		return true
+	})
+	sort.SliceStable(f.Statements, func(i, j int) bool {
+		return f.Statements[i].Pos.Offset < f.Statements[j].Pos.Offset
+	})
+	p.files = append(p.files, f)
+}
+
+// Hook counts node if it is a statement of a file of p. It is meant for
+// Evaluator.SetHook.
+func (p *Profile) Hook(node ast.Node) {
+	if s, ok := p.statements[node]; ok {
+		s.Count++
+	}
+}
+
+// Files returns the files of p in the order they were added.
+func (p *Profile) Files() []*File {
+	return p.files
+}
+
+// Covered returns how many statements of f ran at least once.
+func (f *File) Covered() int {
+	n := 0
+	for _, s := range f.Statements {
+		if s.Count > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Percent returns the percentage of the statements of f that ran, or 100
+// if f has none.
+func (f *File) Percent() float64 {
+	if len(f.Statements) == 0 {
+		return 100
+	}
+	return 100 * float64(f.Covered()) / float64(len(f.Statements))
+}
+
+// WriteSummary writes a line with the coverage of each file to w, e.g.
+//
+//	math.monkey	coverage: 75.0% of statements
+func (p *Profile) WriteSummary(w io.Writer) {
+	for _, f := range p.files {
+		if len(f.Statements) == 0 {
+			fmt.Fprintf(w, "%s\tcoverage: [no statements]\n", f.Name)
+			continue
+		}
+		fmt.Fprintf(w, "%s\tcoverage: %.1f%% of statements\n", f.Name, f.Percent())
+	}
+}
+
+// lines returns the lines of f that start statements, each with the
+// lowest count of those statements, so a line counts as run only if all
+// of its statements ran.
+func (f *File) lines() map[int]int {
+	lines := map[int]int{}
+	for _, s := range f.Statements {
+		if count, ok := lines[s.Pos.Line]; !ok || s.Count < count {
+			lines[s.Pos.Line] = s.Count
+		}
+	}
+	return lines
+}
+
+// WriteLCOV writes p in the LCOV tracefile format, with one DA record for
+// every line that starts statements.
+func (p *Profile) WriteLCOV(w io.Writer) error {
+	var b strings.Builder
+	for _, f := range p.files {
+		lines := f.lines()
+		numbers := make([]int, 0, len(lines))
+		for line := range lines {
+			numbers = append(numbers, line)
+		}
+		sort.Ints(numbers)
+
+		fmt.Fprintf(&b, "TN:\nSF:%s\n", f.Name)
+		hit := 0
+		for _, line := range numbers {
+			fmt.Fprintf(&b, "DA:%d,%d\n", line, lines[line])
+			if lines[line] > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(&b, "LF:%d\nLH:%d\nend_of_record\n", len(numbers), hit)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteHTML writes p as a standalone HTML page showing the source of each
+// file with the lines whose statements all ran in green and the others
+// that start statements in red.
+func (p *Profile) WriteHTML(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>Monkey coverage</title>\n")
+	b.WriteString("<style>pre { line-height: 1.3; } .cov { background: #cfc; } .uncov { background: #fcc; }</style>\n</head>\n<body>\n")
+	for _, f := range p.files {
+		fmt.Fprintf(&b, "<h1>%s</h1>\n<p>%.1f%% of %d statements</p>\n<pre>\n", html.EscapeString(f.Name), f.Percent(), len(f.Statements))
+		lines := f.lines()
+		for i, line := range strings.Split(strings.TrimSuffix(f.Src, "\n"), "\n") {
+			text := html.EscapeString(line)
+			count, ok := lines[i+1]
+			switch {
+			case !ok:
+				fmt.Fprintf(&b, "%s\n", text)
+			case count > 0:
+				fmt.Fprintf(&b, "<span class=\"cov\" title=\"%d\">%s</span>\n", count, text)
+			default:
+				fmt.Fprintf(&b, "<span class=\"uncov\" title=\"0\">%s</span>\n", text)
+			}
+		}
+		b.WriteString("</pre>\n")
+	}
+	b.WriteString("</body>\n</html>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
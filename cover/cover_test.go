@@ -0,0 +1,72 @@
+package cover
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/parser"
+)
+
+const source = `let abs = fn(n) {
+  if (n < 0) {
+    return -n;
+  }
+  n
+};
+abs(1);
+abs(2);
+`
+
+func TestProfile(t *testing.T) {
+	program := parser.New(lexer.New(source)).ParseProgram()
+	p := New()
+	p.Add("abs.monkey", source, program)
+
+	e := evaluator.New()
+	e.SetHook(p.Hook)
+	e.Eval(program, object.NewEnvironment())
+
+	f := p.Files()[0]
+	var counts []int
+	for _, s := range f.Statements {
+		counts = append(counts, s.Count)
+	}
+	if fmt.Sprint(counts) != "[1 2 0 2 1 1]" {
+		t.Errorf("wrong counts. got=%v", counts)
+	}
+	if f.Covered() != 5 || len(f.Statements) != 6 {
+		t.Errorf("wrong coverage. got=%d of %d", f.Covered(), len(f.Statements))
+	}
+
+	var out bytes.Buffer
+	p.WriteSummary(&out)
+	if out.String() != "abs.monkey\tcoverage: 83.3% of statements\n" {
+		t.Errorf("wrong summary. got=%q", out.String())
+	}
+
+	out.Reset()
+	p.WriteLCOV(&out)
+	expected := "TN:\nSF:abs.monkey\nDA:1,1\nDA:2,2\nDA:3,0\nDA:5,2\nDA:7,1\nDA:8,1\nLF:6\nLH:5\nend_of_record\n"
+	if out.String() != expected {
+		t.Errorf("wrong LCOV.\nwant=%q\ngot =%q", expected, out.String())
+	}
+
+	out.Reset()
+	p.WriteHTML(&out)
+	for _, want := range []string{
+		"<h1>abs.monkey</h1>\n<p>83.3% of 6 statements</p>",
+		`<span class="uncov" title="0">    return -n;</span>`,
+		`<span class="cov" title="2">  n</span>`,
+		"\n  }\n",
+		`<span class="cov" title="1">abs(1);</span>`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("HTML lacks %q:\n%s", want, out.String())
+		}
+	}
+}
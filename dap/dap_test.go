@@ -0,0 +1,241 @@
+package dap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const program = `let add = fn(a, b) {
+  let sum = a + b;
+  sum
+};
+let r = add(1, 2);
+puts(r);
+exit(add(r, 4));
+`
+
+type message struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	RequestSeq int             `json:"request_seq"`
+	Command    string          `json:"command"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// session sends the requests of a client to the server and returns what
+// the server wrote back.
+func session(t *testing.T, requests ...map[string]interface{}) []message {
+	t.Helper()
+
+	var in bytes.Buffer
+	for i, req := range requests {
+		req["seq"] = i + 1
+		req["type"] = "request"
+		if err := writeMessage(&in, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := Serve(&in, &out); err != nil {
+		t.Fatalf("Serve failed: %s", err)
+	}
+
+	var messages []message
+	r := bufio.NewReader(&out)
+	for {
+		body, err := readMessage(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading the output: %s", err)
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatalf("invalid message %s", body)
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+func command(name string, args interface{}) map[string]interface{} {
+	return map[string]interface{}{"command": name, "arguments": args}
+}
+
+func writeProgram(t *testing.T, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "prog.monkey")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// summary renders the messages compactly: responses as the command and
+// whether it succeeded, events by name with the fields that matter here.
+func summary(t *testing.T, messages []message) []string {
+	var lines []string
+	for _, msg := range messages {
+		switch msg.Type {
+		case "response":
+			line := msg.Command
+			if !msg.Success {
+				line += " failed: " + msg.Message
+			}
+			lines = append(lines, line)
+		case "event":
+			var body struct {
+				Reason   string `json:"reason"`
+				Output   string `json:"output"`
+				ExitCode *int   `json:"exitCode"`
+			}
+			json.Unmarshal(msg.Body, &body)
+			line := "event " + msg.Event
+			switch {
+			case body.Reason != "":
+				line += " " + body.Reason
+			case body.Output != "":
+				line += " " + strings.TrimSpace(body.Output)
+			case body.ExitCode != nil:
+				line += " " + strings.TrimSpace(string(msg.Body))
+			}
+			lines = append(lines, line)
+		default:
+			t.Errorf("unexpected message type %q", msg.Type)
+		}
+	}
+	return lines
+}
+
+func TestSession(t *testing.T) {
+	path := writeProgram(t, program)
+
+	messages := session(t,
+		command("initialize", map[string]interface{}{"adapterID": "monkey"}),
+		command("launch", map[string]interface{}{"program": path}),
+		command("setBreakpoints", map[string]interface{}{
+			"source":      map[string]string{"path": path},
+			"breakpoints": []map[string]int{{"line": 2}},
+		}),
+		command("configurationDone", nil),
+		command("threads", nil),
+		command("stackTrace", map[string]int{"threadId": 1}),
+		command("scopes", map[string]int{"frameId": 0}),
+		command("variables", map[string]int{"variablesReference": 2}),
+		command("next", map[string]int{"threadId": 1}),
+		command("evaluate", map[string]interface{}{"expression": "sum", "frameId": 0}),
+		command("evaluate", map[string]interface{}{"expression": "nope", "frameId": 0}),
+		command("continue", map[string]int{"threadId": 1}),
+		command("variables", map[string]int{"variablesReference": 2}),
+		command("continue", map[string]int{"threadId": 1}),
+		command("disconnect", nil),
+	)
+
+	want := []string{
+		"initialize",
+		"event initialized",
+		"launch",
+		"setBreakpoints",
+		"configurationDone",
+		"event stopped breakpoint",
+		"threads",
+		"stackTrace",
+		"scopes",
+		"variables",
+		"next",
+		"event stopped step",
+		"evaluate",
+		"evaluate failed: no variable nope",
+		"continue",
+		"event output 3",
+		"event stopped breakpoint",
+		"variables",
+		"continue",
+		`event exited {"exitCode":7}`,
+		"event terminated",
+		"disconnect",
+	}
+	got := summary(t, messages)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("wrong messages.\nwant:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	bodies := map[int]string{}
+	for _, msg := range messages {
+		if msg.Type == "response" {
+			bodies[msg.RequestSeq] = string(msg.Body)
+		}
+	}
+	checks := []struct {
+		seq      int
+		contains []string
+	}{
+		{6, []string{`"name":"fn"`, `"line":2`, `"name":"main"`, `"line":5`, `"path":"` + path + `"`, `"totalFrames":2`}},
+		{7, []string{`{"name":"Locals","variablesReference":2`, `{"name":"Globals","variablesReference":1`}},
+		{8, []string{`{"name":"a","value":"1"`, `{"name":"b","value":"2"`}},
+		{10, []string{`"result":"3"`}},
+		{13, []string{`{"name":"a","value":"3"`, `{"name":"b","value":"4"`}},
+	}
+	for _, c := range checks {
+		for _, want := range c.contains {
+			if !strings.Contains(bodies[c.seq], want) {
+				t.Errorf("response to request %d lacks %s: %s", c.seq, want, bodies[c.seq])
+			}
+		}
+	}
+}
+
+func TestLaunchErrors(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"let x = ;", ":1:9: no prefix parse function for token ';' found"},
+		{"puts(y);", ":1:6: identifier not found: y"},
+	}
+
+	for _, tt := range tests {
+		path := writeProgram(t, tt.src)
+		messages := session(t, command("launch", map[string]interface{}{"program": path}))
+		if len(messages) != 1 || messages[0].Success || messages[0].Message != path+tt.expected {
+			t.Errorf("%q: launch should fail with %q. got=%+v", tt.src, path+tt.expected, messages)
+		}
+	}
+}
+
+func TestStopOnEntry(t *testing.T) {
+	path := writeProgram(t, "let x = 1;\nlet y = x + 1;\n")
+	got := summary(t, session(t,
+		command("launch", map[string]interface{}{"program": path, "stopOnEntry": true}),
+		command("configurationDone", nil),
+		command("next", nil),
+		command("next", nil),
+		command("next", nil),
+	))
+
+	want := []string{
+		"launch",
+		"configurationDone",
+		"event stopped entry",
+		"next",
+		"event stopped step",
+		"next",
+		`event exited {"exitCode":0}`,
+		"event terminated",
+		"next",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("wrong messages.\nwant:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
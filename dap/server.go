@@ -0,0 +1,403 @@
+// Package dap implements a Debug Adapter Protocol server over the step
+// debugger of package debugger, so editors can set breakpoints, step
+// through a program running on the VM and inspect its variables.
+//
+// The server debugs one program with a single thread, which runs only
+// while the server handles continue and step requests.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/frankie-mur/monkeylang/compiler"
+	"github.com/frankie-mur/monkeylang/debugger"
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/parser"
+	"github.com/frankie-mur/monkeylang/vm"
+)
+
+const threadID = 1
+
+// globalsReference is the variables reference of the globals. The locals
+// of the stack frame with ID i have the reference i+2.
+const globalsReference = 1
+
+type server struct {
+	in  *bufio.Reader
+	out io.Writer
+	seq int
+
+	program     string
+	stopOnEntry bool
+	debugger    *debugger.Debugger
+	breakpoints []int
+	terminated  bool
+
+	// stdout is where puts wrote before the program's output was
+	// redirected to output events.
+	stdout io.Writer
+}
+
+// Serve answers the requests read from in, writing responses and events to
+// out, until the client disconnects or in ends.
+func Serve(in io.Reader, out io.Writer) error {
+	s := &server{in: bufio.NewReader(in), out: out}
+	defer s.releaseOutput()
+
+	for {
+		body, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			return fmt.Errorf("invalid message: %s", err)
+		}
+		if req.Type != "request" {
+			continue
+		}
+
+		done, err := s.handle(&req)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// handle answers req and runs the program if req asks for it. It reports
+// whether the session is over.
+func (s *server) handle(req *request) (bool, error) {
+	switch req.Command {
+	case "initialize":
+		if err := s.respond(req, capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsEvaluateForHovers:        true,
+			SupportsTerminateRequest:         true,
+		}); err != nil {
+			return false, err
+		}
+		return false, s.event("initialized", nil)
+
+	case "launch":
+		var args launchArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return false, s.fail(req, err.Error())
+		}
+		if err := s.launch(args); err != nil {
+			return false, s.fail(req, err.Error())
+		}
+		return false, s.respond(req, nil)
+
+	case "setBreakpoints":
+		var args setBreakpointsArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return false, s.fail(req, err.Error())
+		}
+		s.breakpoints = s.breakpoints[:0]
+		breakpoints := []Breakpoint{}
+		for _, b := range args.Breakpoints {
+			s.breakpoints = append(s.breakpoints, b.Line)
+			breakpoints = append(breakpoints, Breakpoint{Verified: true, Line: b.Line})
+		}
+		s.applyBreakpoints()
+		return false, s.respond(req, map[string]interface{}{"breakpoints": breakpoints})
+
+	case "configurationDone":
+		if err := s.respond(req, nil); err != nil {
+			return false, err
+		}
+		if s.debugger == nil {
+			return false, nil
+		}
+		if s.stopOnEntry {
+			return false, s.stopped("entry")
+		}
+		return false, s.resume(s.debugger.Continue, "breakpoint")
+
+	case "threads":
+		return false, s.respond(req, map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": threadID, "name": "main"}},
+		})
+
+	case "stackTrace":
+		if s.debugger == nil {
+			return false, s.fail(req, "no program is running")
+		}
+		frames := s.stackFrames()
+		return false, s.respond(req, map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)})
+
+	case "scopes":
+		var args scopesArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return false, s.fail(req, err.Error())
+		}
+		scopes := []Scope{}
+		if s.debugger != nil && args.FrameID < len(s.debugger.Frames())-1 {
+			scopes = append(scopes, Scope{Name: "Locals", VariablesReference: args.FrameID + 2})
+		}
+		scopes = append(scopes, Scope{Name: "Globals", VariablesReference: globalsReference})
+		return false, s.respond(req, map[string]interface{}{"scopes": scopes})
+
+	case "variables":
+		var args variablesArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return false, s.fail(req, err.Error())
+		}
+		return false, s.respond(req, map[string]interface{}{"variables": s.variables(args.VariablesReference)})
+
+	case "evaluate":
+		var args evaluateArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return false, s.fail(req, err.Error())
+		}
+		name := strings.TrimSpace(args.Expression)
+		if s.debugger == nil {
+			return false, s.fail(req, "no program is running")
+		}
+		v, ok := s.debugger.Lookup(name)
+		if !ok {
+			return false, s.fail(req, "no variable "+name)
+		}
+		return false, s.respond(req, map[string]interface{}{"result": inspect(v.Value), "variablesReference": 0})
+
+	case "continue", "next", "stepIn", "stepOut":
+		if s.debugger == nil {
+			return false, s.fail(req, "no program is running")
+		}
+		var body interface{}
+		if req.Command == "continue" {
+			body = map[string]interface{}{"allThreadsContinued": true}
+		}
+		if err := s.respond(req, body); err != nil {
+			return false, err
+		}
+		switch req.Command {
+		case "continue":
+			return false, s.resume(s.debugger.Continue, "breakpoint")
+		case "next":
+			return false, s.resume(s.debugger.Next, "step")
+		case "stepIn":
+			return false, s.resume(s.debugger.StepIn, "step")
+		default:
+			return false, s.resume(s.debugger.StepOut, "step")
+		}
+
+	case "disconnect", "terminate":
+		s.releaseOutput()
+		if err := s.respond(req, nil); err != nil {
+			return false, err
+		}
+		if req.Command == "terminate" {
+			return false, s.terminate(0)
+		}
+		return true, nil
+
+	default:
+		return false, s.fail(req, "unsupported request "+req.Command)
+	}
+}
+
+// launch compiles the program and loads it into a debugger, stopped before
+// its first instruction.
+func (s *server) launch(args launchArguments) error {
+	if args.Program == "" {
+		return errors.New("launch: no program given")
+	}
+	src, err := os.ReadFile(args.Program)
+	if err != nil {
+		return err
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if errs := p.ParseErrors(); len(errs) != 0 {
+		msgs := []string{}
+		for _, err := range errs {
+			msgs = append(msgs, args.Program+":"+err.Error())
+		}
+		return errors.New(strings.Join(msgs, "\n"))
+	}
+	bytecode, err := compiler.Compile(program)
+	if err != nil {
+		return fmt.Errorf("%s:%s", args.Program, err)
+	}
+
+	s.program = args.Program
+	s.stopOnEntry = args.StopOnEntry
+	s.debugger = debugger.New(bytecode, string(src))
+	s.applyBreakpoints()
+	s.captureOutput()
+	return nil
+}
+
+func (s *server) applyBreakpoints() {
+	if s.debugger == nil {
+		return
+	}
+	for _, line := range s.debugger.Breakpoints() {
+		s.debugger.ClearBreakpoint(line)
+	}
+	for _, line := range s.breakpoints {
+		s.debugger.SetBreakpoint(line)
+	}
+}
+
+// resume runs the program with run and tells the client why it stopped:
+// with reason, because of an error it can still inspect, or because the
+// program finished.
+func (s *server) resume(run func() error, reason string) error {
+	if s.terminated {
+		return nil
+	}
+	err := run()
+
+	var exit *vm.ExitError
+	switch {
+	case errors.As(err, &exit):
+		return s.terminate(int(exit.Code))
+	case err != nil:
+		if err := s.event("output", outputEvent{Category: "stderr", Output: "runtime error: " + err.Error() + "\n"}); err != nil {
+			return err
+		}
+		return s.event("stopped", stoppedEvent{
+			Reason:            "exception",
+			Description:       "runtime error",
+			Text:              err.Error(),
+			ThreadID:          threadID,
+			AllThreadsStopped: true,
+		})
+	case s.debugger.Finished():
+		return s.terminate(0)
+	}
+
+	pos, _ := s.debugger.Pos()
+	for _, line := range s.breakpoints {
+		if pos.Line == line {
+			reason = "breakpoint"
+		}
+	}
+	return s.stopped(reason)
+}
+
+func (s *server) stopped(reason string) error {
+	return s.event("stopped", stoppedEvent{Reason: reason, ThreadID: threadID, AllThreadsStopped: true})
+}
+
+// terminate tells the client that the program ended with code.
+func (s *server) terminate(code int) error {
+	s.releaseOutput()
+	s.terminated = true
+	if err := s.event("exited", map[string]int{"exitCode": code}); err != nil {
+		return err
+	}
+	return s.event("terminated", nil)
+}
+
+func (s *server) stackFrames() []StackFrame {
+	frames := []StackFrame{}
+	positions := s.debugger.Frames()
+	for i, pos := range positions {
+		name := "fn"
+		if i == len(positions)-1 {
+			name = "main"
+		}
+		frames = append(frames, StackFrame{
+			ID:     i,
+			Name:   name,
+			Source: Source{Name: filepath.Base(s.program), Path: s.program},
+			Line:   pos.Line,
+			Column: pos.Column,
+		})
+	}
+	return frames
+}
+
+func (s *server) variables(ref int) []Variable {
+	vars := []Variable{}
+	if s.debugger == nil {
+		return vars
+	}
+
+	var values []debugger.Variable
+	if ref == globalsReference {
+		values = s.debugger.Globals()
+	} else {
+		values = s.debugger.FrameLocals(ref - 2)
+	}
+	for _, v := range values {
+		vars = append(vars, Variable{Name: v.Name, Value: inspect(v.Value)})
+	}
+	return vars
+}
+
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "<unbound>"
+	}
+	return obj.Inspect()
+}
+
+// captureOutput sends the output of puts to the client as output events
+// while the program runs, as the server's own output may be the standard
+// output.
+func (s *server) captureOutput() {
+	s.stdout, evaluator.Output = evaluator.Output, outputWriter{s}
+}
+
+// releaseOutput restores the output of puts.
+func (s *server) releaseOutput() {
+	if s.stdout != nil {
+		evaluator.Output, s.stdout = s.stdout, nil
+	}
+}
+
+type outputWriter struct {
+	s *server
+}
+
+func (w outputWriter) Write(p []byte) (int, error) {
+	if err := w.s.event("output", outputEvent{Category: "stdout", Output: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *server) respond(req *request, body interface{}) error {
+	return s.send(func(seq int) interface{} {
+		return response{Seq: seq, Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: true, Body: body}
+	})
+}
+
+func (s *server) fail(req *request, message string) error {
+	return s.send(func(seq int) interface{} {
+		return response{Seq: seq, Type: "response", RequestSeq: req.Seq, Command: req.Command, Message: message}
+	})
+}
+
+func (s *server) event(name string, body interface{}) error {
+	return s.send(func(seq int) interface{} {
+		return event{Seq: seq, Type: "event", Event: name, Body: body}
+	})
+}
+
+// send writes the message msg builds with the next sequence number.
+func (s *server) send(msg func(seq int) interface{}) error {
+	s.seq++
+	return writeMessage(s.out, msg(s.seq))
+}
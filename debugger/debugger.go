@@ -0,0 +1,246 @@
+// Package debugger implements a step debugger for programs run on the
+// bytecode VM. It stops on source lines through the source maps of the
+// bytecode, steps one instruction at a time and shows the values of locals
+// and globals by the names the compiler recorded for them.
+package debugger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/frankie-mur/monkeylang/compiler"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/token"
+	"github.com/frankie-mur/monkeylang/vm"
+)
+
+// Debugger runs one program under the control of the caller.
+type Debugger struct {
+	machine     *vm.VM
+	bytecode    *compiler.Bytecode
+	lines       []string
+	breakpoints map[int]bool
+
+	// err is the error that stopped the program, which stays stopped at
+	// the failing instruction so its state can be inspected.
+	err error
+}
+
+// Variable is a named value of the program.
+type Variable struct {
+	Name  string
+	Value object.Object // nil if the variable has not been bound yet
+}
+
+// New returns a debugger for bytecode compiled from src, stopped before its
+// first instruction.
+func New(bytecode *compiler.Bytecode, src string) *Debugger {
+	return &Debugger{
+		machine:     vm.New(bytecode),
+		bytecode:    bytecode,
+		lines:       strings.Split(src, "\n"),
+		breakpoints: map[int]bool{},
+	}
+}
+
+// SetBreakpoint makes Continue stop before the first instruction of line
+// each time the program reaches it.
+func (d *Debugger) SetBreakpoint(line int) {
+	d.breakpoints[line] = true
+}
+
+// ClearBreakpoint removes the breakpoint on line.
+func (d *Debugger) ClearBreakpoint(line int) {
+	delete(d.breakpoints, line)
+}
+
+// Breakpoints returns the lines with breakpoints in ascending order.
+func (d *Debugger) Breakpoints() []int {
+	var lines []int
+	for line := range d.breakpoints {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// Finished reports whether the program ran to its end, exited or failed.
+func (d *Debugger) Finished() bool {
+	return d.machine.Done() || d.err != nil
+}
+
+// Err returns the error that stopped the program: a *vm.ExitError if it
+// called exit, a *vm.RuntimeError if it failed, or nil.
+func (d *Debugger) Err() error {
+	return d.err
+}
+
+// Step executes one instruction.
+func (d *Debugger) Step() error {
+	if d.Finished() {
+		return d.err
+	}
+	d.err = d.machine.Step()
+	return d.err
+}
+
+// location is where a program is stopped: the call and the line of the
+// next instruction.
+type location struct {
+	frame *vm.Frame
+	line  int
+}
+
+func (d *Debugger) location() location {
+	pos, _ := d.machine.NextPos()
+	return location{d.machine.CurrentFrame(), pos.Line}
+}
+
+// Continue runs the program until it reaches a line with a breakpoint from
+// another line or call, or finishes.
+func (d *Debugger) Continue() error {
+	return d.runUntil(func(location) bool { return false })
+}
+
+// StepIn runs the program until it reaches another line, of the current
+// call, of a call it makes or of the one it returns to.
+func (d *Debugger) StepIn() error {
+	start := d.location()
+	return d.runUntil(func(at location) bool {
+		return at != start
+	})
+}
+
+// Next runs the program until it reaches another line of the current call
+// or returns from it, stepping over the calls it makes.
+func (d *Debugger) Next() error {
+	start, depth := d.location(), d.depth()
+	return d.runUntil(func(at location) bool {
+		return d.depth() < depth || d.depth() == depth && at.line != start.line
+	})
+}
+
+// StepOut runs the program until the current call returns.
+func (d *Debugger) StepOut() error {
+	depth := d.depth()
+	return d.runUntil(func(location) bool {
+		return d.depth() < depth
+	})
+}
+
+// runUntil steps the program until it reaches a location with a source
+// line that stop accepts, stops on a breakpoint as in Continue or
+// finishes.
+func (d *Debugger) runUntil(stop func(at location) bool) error {
+	for !d.Finished() {
+		from := d.location()
+		if err := d.Step(); err != nil {
+			return err
+		}
+		at := d.location()
+		if at == from || d.Finished() {
+			continue
+		}
+		if d.breakpoints[at.line] || at.line > 0 && stop(at) {
+			return nil
+		}
+	}
+	return d.err
+}
+
+func (d *Debugger) depth() int {
+	return len(d.machine.Frames())
+}
+
+// Pos returns the source position of the instruction the program executes
+// next or, once it failed, the one that failed.
+func (d *Debugger) Pos() (token.Position, bool) {
+	var runtimeErr *vm.RuntimeError
+	if errors.As(d.err, &runtimeErr) {
+		return runtimeErr.Pos, runtimeErr.Pos.IsValid()
+	}
+	return d.machine.NextPos()
+}
+
+// Line returns the source text of line, numbered from 1.
+func (d *Debugger) Line(line int) (string, bool) {
+	if line < 1 || line > len(d.lines) {
+		return "", false
+	}
+	return d.lines[line-1], true
+}
+
+// Instruction returns the disassembly of the instruction the program
+// executes next, prefixed with its offset.
+func (d *Debugger) Instruction() string {
+	f := d.machine.CurrentFrame()
+	prefix := fmt.Sprintf("%04d ", f.NextOffset())
+	for _, line := range strings.Split(f.Instructions().String(), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+	return ""
+}
+
+// Locals returns the locals of the innermost call in progress.
+func (d *Debugger) Locals() []Variable {
+	f := d.machine.CurrentFrame()
+	return variables(f.Function().LocalNames, d.machine.Locals(f))
+}
+
+// FrameLocals returns the locals of the i-th call in progress, counting
+// from the innermost as Frames does.
+func (d *Debugger) FrameLocals(i int) []Variable {
+	frames := d.machine.Frames()
+	if i < 0 || i >= len(frames) {
+		return nil
+	}
+	f := frames[i]
+	return variables(f.Function().LocalNames, d.machine.Locals(f))
+}
+
+// Globals returns the globals of the program.
+func (d *Debugger) Globals() []Variable {
+	return variables(d.bytecode.GlobalNames, d.machine.Globals())
+}
+
+func variables(names []string, values []object.Object) []Variable {
+	vars := make([]Variable, len(names))
+	for i, name := range names {
+		vars[i].Name = name
+		if i < len(values) {
+			vars[i].Value = values[i]
+		}
+	}
+	return vars
+}
+
+// Lookup returns the value of the variable name as the innermost call in
+// progress sees it: its local, or else the global.
+func (d *Debugger) Lookup(name string) (Variable, bool) {
+	for _, vars := range [][]Variable{d.Locals(), d.Globals()} {
+		for _, v := range vars {
+			if v.Name == name {
+				return v, true
+			}
+		}
+	}
+	return Variable{}, false
+}
+
+// Frames returns the source positions of the calls in progress, innermost
+// first.
+func (d *Debugger) Frames() []token.Position {
+	var positions []token.Position
+	for i, f := range d.machine.Frames() {
+		pos, _ := f.Pos()
+		if i == 0 {
+			pos, _ = d.Pos()
+		}
+		positions = append(positions, pos)
+	}
+	return positions
+}
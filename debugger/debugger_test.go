@@ -0,0 +1,175 @@
+package debugger
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/frankie-mur/monkeylang/compiler"
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/parser"
+	"github.com/frankie-mur/monkeylang/vm"
+)
+
+const program = `let total = 10;
+let add = fn(a, b) {
+  let sum = a + b;
+  sum
+};
+let r = add(1, total);
+let s = add(r, 5);
+r + "x";`
+
+func newDebugger(t *testing.T, src string) *Debugger {
+	t.Helper()
+	bytecode, err := compiler.Compile(parser.New(lexer.New(src)).ParseProgram())
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return New(bytecode, src)
+}
+
+func TestBreakpoints(t *testing.T) {
+	d := newDebugger(t, program)
+	d.SetBreakpoint(4)
+
+	for _, want := range []string{"a=1 b=10 sum=11", "a=11 b=5 sum=16"} {
+		if err := d.Continue(); err != nil {
+			t.Fatalf("Continue failed: %s", err)
+		}
+		if pos, _ := d.Pos(); pos.Line != 4 {
+			t.Fatalf("should stop on line 4. got=%s", pos)
+		}
+		var got []string
+		for _, v := range d.Locals() {
+			got = append(got, v.Name+"="+v.Value.Inspect())
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("wrong locals. want=%q, got=%q", want, strings.Join(got, " "))
+		}
+		if frames := d.Frames(); len(frames) != 2 {
+			t.Errorf("expected 2 frames. got=%v", frames)
+		}
+	}
+
+	if v, ok := d.Lookup("r"); !ok || v.Value.Inspect() != "11" {
+		t.Errorf("wrong value of r. got=%v, %t", v, ok)
+	}
+	if v, ok := d.Lookup("s"); !ok || v.Value != nil {
+		t.Errorf("s should not be bound yet. got=%v, %t", v, ok)
+	}
+
+	d.ClearBreakpoint(4)
+	err := d.Continue()
+	var runtimeErr *vm.RuntimeError
+	if !errors.As(err, &runtimeErr) || err.Error() != "8:1: type mismatch: INTEGER + STRING" {
+		t.Fatalf("expected the runtime error. got=%v", err)
+	}
+	if !d.Finished() {
+		t.Errorf("the program should be finished")
+	}
+	if v, ok := d.Lookup("s"); !ok || v.Value.Inspect() != "16" {
+		t.Errorf("globals should stay inspectable after an error. got=%v, %t", v, ok)
+	}
+}
+
+func TestStep(t *testing.T) {
+	d := newDebugger(t, "let a = 1;\nlet x = a + 2;\nexit(x);")
+
+	var instructions []string
+	for !d.Finished() {
+		instructions = append(instructions, d.Instruction())
+		d.Step()
+	}
+
+	exitIndex := slices.Index(evaluator.BuiltinNames(), "exit")
+	want := []string{
+		"0000 OpConstant 0", "0003 OpSetGlobal 0",
+		"0006 OpGetGlobal 0", "0009 OpConstant 1", "0012 OpAdd", "0013 OpSetGlobal 1",
+		"0016 OpGetGlobal 1", fmt.Sprintf("0019 OpCallBuiltin %d 1", exitIndex),
+	}
+	if strings.Join(instructions, "\n") != strings.Join(want, "\n") {
+		t.Errorf("wrong instructions. want=%q, got=%q", want, instructions)
+	}
+
+	var exit *vm.ExitError
+	if !errors.As(d.Err(), &exit) || exit.Code != 3 {
+		t.Errorf("expected exit(3). got=%v", d.Err())
+	}
+}
+
+func TestStepLines(t *testing.T) {
+	d := newDebugger(t, program)
+
+	steps := []struct {
+		name  string
+		step  func() error
+		line  int
+		depth int
+	}{
+		{"next", d.Next, 2, 1},
+		{"next", d.Next, 6, 1},
+		{"step in", d.StepIn, 3, 2},
+		{"step in", d.StepIn, 4, 2},
+		{"step out", d.StepOut, 6, 1},
+		{"next", d.Next, 7, 1},
+		{"next", d.Next, 8, 1},
+	}
+	for i, s := range steps {
+		if err := s.step(); err != nil {
+			t.Fatalf("step %d (%s) failed: %s", i, s.name, err)
+		}
+		pos, _ := d.Pos()
+		if pos.Line != s.line || len(d.Frames()) != s.depth {
+			t.Fatalf("step %d (%s): want line %d at depth %d. got=%s at depth %d", i, s.name, s.line, s.depth, pos, len(d.Frames()))
+		}
+	}
+
+	d = newDebugger(t, program)
+	d.SetBreakpoint(3)
+	d.Next()
+	if err := d.Next(); err != nil {
+		t.Fatalf("next failed: %s", err)
+	}
+	if pos, _ := d.Pos(); pos.Line != 6 {
+		t.Fatalf("next should stop on line 6. got=%s", pos)
+	}
+	if err := d.Next(); err != nil {
+		t.Fatalf("next failed: %s", err)
+	}
+	if pos, _ := d.Pos(); pos.Line != 3 {
+		t.Errorf("next should stop on a breakpoint in a call. got=%s", pos)
+	}
+	if got := d.FrameLocals(1); len(got) != 0 {
+		t.Errorf("the main program has no locals. got=%v", got)
+	}
+	if got := d.FrameLocals(0); len(got) != 3 || got[0].Value.Inspect() != "1" {
+		t.Errorf("wrong locals of the call. got=%v", got)
+	}
+}
+
+func TestSession(t *testing.T) {
+	d := newDebugger(t, program)
+	in := strings.NewReader("b 3\nc\np a\nwhere\nclear 3\nc\nc\nbogus\nq\n")
+
+	var out strings.Builder
+	d.Start(in, &out)
+
+	expected := `1:13: let total = 10;
+(mdb) (mdb) 3:13: let sum = a + b;
+(mdb) a = 1
+(mdb) #0 3:13
+#1 6:9
+(mdb) (mdb) runtime error: 8:1: type mismatch: INTEGER + STRING
+8:1: r + "x";
+(mdb) runtime error: 8:1: type mismatch: INTEGER + STRING
+8:1: r + "x";
+(mdb) unknown command "bogus"; try help
+(mdb) `
+	if out.String() != expected {
+		t.Errorf("wrong session output. want=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,164 @@
+package debugger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/vm"
+)
+
+const PROMPT = "(mdb) "
+
+const help = `commands:
+  break LINE, b LINE   stop whenever the program reaches LINE
+  clear LINE           remove the breakpoint on LINE
+  breakpoints          list the breakpoints
+  continue, c          run until a breakpoint or the end of the program
+  step, s              execute one instruction
+  where, bt            show the calls in progress
+  locals               show the locals of the current call
+  globals              show the globals
+  print NAME, p NAME   show the value of a local or global
+  help                 show this help
+  quit, q              stop debugging
+`
+
+// Start reads debugger commands from in until it ends or a quit command,
+// writing their results to out. The program's own output is not
+// redirected.
+func (d *Debugger) Start(in io.Reader, out io.Writer) {
+	scanner := bufio.NewScanner(in)
+	d.printLocation(out)
+
+	for {
+		fmt.Fprint(out, PROMPT)
+		if !scanner.Scan() {
+			return
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		cmd, args := fields[0], fields[1:]
+
+		switch cmd {
+		case "break", "b", "clear":
+			line, err := lineArg(args)
+			if err != nil {
+				fmt.Fprintf(out, "%s: %s\n", cmd, err)
+				continue
+			}
+			if cmd == "clear" {
+				d.ClearBreakpoint(line)
+			} else {
+				d.SetBreakpoint(line)
+			}
+
+		case "breakpoints":
+			for _, line := range d.Breakpoints() {
+				text, _ := d.Line(line)
+				fmt.Fprintf(out, "%4d  %s\n", line, strings.TrimSpace(text))
+			}
+
+		case "continue", "c", "step", "s":
+			if d.Finished() {
+				d.printLocation(out)
+				continue
+			}
+			if cmd == "step" || cmd == "s" {
+				d.Step()
+			} else {
+				d.Continue()
+			}
+			d.printLocation(out)
+			if !d.Finished() && (cmd == "step" || cmd == "s") {
+				fmt.Fprintf(out, "      %s\n", d.Instruction())
+			}
+
+		case "where", "bt":
+			for i, pos := range d.Frames() {
+				fmt.Fprintf(out, "#%d %s\n", i, pos)
+			}
+
+		case "locals":
+			printVariables(out, d.Locals())
+
+		case "globals":
+			printVariables(out, d.Globals())
+
+		case "print", "p":
+			if len(args) != 1 {
+				fmt.Fprintf(out, "%s: want a name\n", cmd)
+				continue
+			}
+			v, ok := d.Lookup(args[0])
+			if !ok {
+				fmt.Fprintf(out, "no variable %s\n", args[0])
+				continue
+			}
+			printVariables(out, []Variable{v})
+
+		case "help":
+			io.WriteString(out, help)
+
+		case "quit", "q":
+			return
+
+		default:
+			fmt.Fprintf(out, "unknown command %q; try help\n", cmd)
+		}
+	}
+}
+
+func lineArg(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, errors.New("want a line number")
+	}
+	line, err := strconv.Atoi(args[0])
+	if err != nil || line < 1 {
+		return 0, fmt.Errorf("invalid line %q", args[0])
+	}
+	return line, nil
+}
+
+// printLocation writes where the program stopped, or how it finished.
+func (d *Debugger) printLocation(out io.Writer) {
+	var exit *vm.ExitError
+	switch {
+	case errors.As(d.err, &exit):
+		fmt.Fprintf(out, "the program exited with code %d\n", exit.Code)
+		return
+	case d.err != nil:
+		fmt.Fprintf(out, "runtime error: %s\n", d.err)
+	case d.machine.Done():
+		fmt.Fprintln(out, "the program has finished")
+		return
+	}
+
+	pos, ok := d.Pos()
+	if !ok {
+		fmt.Fprintln(out, "stopped")
+		return
+	}
+	text, _ := d.Line(pos.Line)
+	fmt.Fprintf(out, "%s: %s\n", pos, strings.TrimSpace(text))
+}
+
+func printVariables(out io.Writer, vars []Variable) {
+	for _, v := range vars {
+		fmt.Fprintf(out, "%s = %s\n", v.Name, inspect(v.Value))
+	}
+}
+
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "<unbound>"
+	}
+	return obj.Inspect()
+}
@@ -0,0 +1,200 @@
+package doc
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/parser"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// Func documents a function: a top-level `let name = fn(...)` binding of a
+// Monkey file, or a builtin.
+type Func struct {
+	Name   string
+	Params []string
+	Doc    string
+	Pos    token.Position // unset for builtins
+}
+
+// Signature returns the function's name and parameter list, e.g. "add(x, y)".
+func (f Func) Signature() string {
+	return f.Name + "(" + strings.Join(f.Params, ", ") + ")"
+}
+
+// File is the documentation of one Monkey source file. Doc is the comment
+// opening the file when it is separated from the first statement by a blank
+// line.
+type File struct {
+	Name  string
+	Doc   string
+	Funcs []Func
+}
+
+// Extract parses src and collects its file comment and the documentation of
+// its top-level functions: the function's docstring, or else its doc
+// comment, the block of // lines directly above the let statement.
+func Extract(name, src string) (*File, error) {
+	l := lexer.New(src)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.ParseErrors()) != 0 {
+		msgs := []string{}
+		for _, err := range p.ParseErrors() {
+			msgs = append(msgs, name+":"+err.Error())
+		}
+		return nil, errors.New(strings.Join(msgs, "\n"))
+	}
+
+	groups := commentGroups(l.Comments())
+	file := &File{Name: name}
+
+	if len(groups) > 0 {
+		first := groups[0]
+		lastLine := first[len(first)-1].End.Line
+		if len(program.Statements) == 0 || program.Statements[0].Pos().Line > lastLine+1 {
+			file.Doc = commentText(first)
+		}
+	}
+
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok {
+			continue
+		}
+		fn, ok := let.Value.(*ast.FunctionLiteral)
+		if !ok {
+			continue
+		}
+
+		f := Func{Name: let.Name.Value, Pos: let.Pos()}
+		for _, param := range fn.Parameters {
+			f.Params = append(f.Params, param.Value)
+		}
+		f.Doc = fn.Doc()
+		for _, g := range groups {
+			if f.Doc == "" && g[len(g)-1].End.Line == let.Pos().Line-1 {
+				f.Doc = commentText(g)
+				break
+			}
+		}
+		file.Funcs = append(file.Funcs, f)
+	}
+
+	return file, nil
+}
+
+// Builtins returns the documentation of every builtin function, sorted by
+// name.
+func Builtins() []Func {
+	var funcs []Func
+	for _, name := range evaluator.BuiltinNames() {
+		b, _ := evaluator.LookupBuiltin(name)
+		funcs = append(funcs, Func{Name: name, Params: b.Params, Doc: b.Doc})
+	}
+	return funcs
+}
+
+// commentGroups splits comments into runs on consecutive lines.
+func commentGroups(comments []token.Token) [][]token.Token {
+	var groups [][]token.Token
+	for _, c := range comments {
+		n := len(groups)
+		if n > 0 {
+			prev := groups[n-1][len(groups[n-1])-1]
+			if c.Pos.Line == prev.End.Line+1 && c.Pos.Column == prev.Pos.Column {
+				groups[n-1] = append(groups[n-1], c)
+				continue
+			}
+		}
+		groups = append(groups, []token.Token{c})
+	}
+	return groups
+}
+
+// commentText strips the comment markers from a group and joins its lines.
+// The lines of a block comment may start with a decorative *.
+func commentText(group []token.Token) string {
+	lines := []string{}
+	for _, c := range group {
+		if !strings.HasPrefix(c.Literal, "/*") {
+			lines = append(lines, strings.TrimPrefix(strings.TrimPrefix(c.Literal, "//"), " "))
+			continue
+		}
+		text := strings.TrimSuffix(strings.TrimPrefix(c.Literal, "/*"), "*/")
+		for _, line := range strings.Split(text, "\n") {
+			line = strings.TrimSpace(line)
+			line = strings.TrimPrefix(strings.TrimPrefix(line, "*"), " ")
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// Markdown renders files, followed by builtins if any are given, as a
+// Markdown document.
+func Markdown(w io.Writer, files []*File, builtins []Func) {
+	for _, file := range files {
+		fmt.Fprintf(w, "# %s\n\n", file.Name)
+		if file.Doc != "" {
+			fmt.Fprintf(w, "%s\n\n", file.Doc)
+		}
+		for _, f := range file.Funcs {
+			markdownFunc(w, f)
+		}
+	}
+
+	if len(builtins) > 0 {
+		fmt.Fprintf(w, "# Builtins\n\n")
+		for _, f := range builtins {
+			markdownFunc(w, f)
+		}
+	}
+}
+
+func markdownFunc(w io.Writer, f Func) {
+	fmt.Fprintf(w, "## %s\n\n```\n%s\n```\n\n", f.Name, f.Signature())
+	if f.Doc != "" {
+		fmt.Fprintf(w, "%s\n\n", f.Doc)
+	}
+}
+
+// HTML renders files, followed by builtins if any are given, as a
+// standalone HTML page.
+func HTML(w io.Writer, files []*File, builtins []Func) {
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>Monkey documentation</title></head>\n<body>\n")
+
+	for _, file := range files {
+		fmt.Fprintf(w, "<h1>%s</h1>\n", html.EscapeString(file.Name))
+		if file.Doc != "" {
+			fmt.Fprintf(w, "<p>%s</p>\n", html.EscapeString(file.Doc))
+		}
+		for _, f := range file.Funcs {
+			htmlFunc(w, f)
+		}
+	}
+
+	if len(builtins) > 0 {
+		fmt.Fprintf(w, "<h1>Builtins</h1>\n")
+		for _, f := range builtins {
+			htmlFunc(w, f)
+		}
+	}
+
+	fmt.Fprintf(w, "</body>\n</html>\n")
+}
+
+func htmlFunc(w io.Writer, f Func) {
+	fmt.Fprintf(w, "<h2 id=\"%s\">%s</h2>\n<pre>%s</pre>\n",
+		html.EscapeString(f.Name), html.EscapeString(f.Name), html.EscapeString(f.Signature()))
+	if f.Doc != "" {
+		fmt.Fprintf(w, "<p>%s</p>\n", html.EscapeString(f.Doc))
+	}
+}
@@ -0,0 +1,93 @@
+package doc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	input := `// Math helpers.
+
+// add returns the sum of x and y.
+// It works on integers.
+let add = fn(x, y) { x + y };
+
+let undocumented = fn() { 1 };
+
+// Comments give way to docstrings.
+let sub = fn(x, y) {
+  "sub returns x minus y.";
+  x - y
+};
+
+let value_only = fn() { "not a docstring" };
+
+/*
+ * mul returns the product of x and y.
+ */
+let mul = fn(x, y) { x * y };
+
+// not attached
+
+let value = 5;
+`
+
+	file, err := Extract("math.monkey", input)
+	if err != nil {
+		t.Fatalf("Extract returned error: %s", err)
+	}
+
+	if file.Doc != "Math helpers." {
+		t.Errorf("file.Doc wrong. got=%q", file.Doc)
+	}
+	if len(file.Funcs) != 5 {
+		t.Fatalf("wrong number of functions. got=%d", len(file.Funcs))
+	}
+
+	add := file.Funcs[0]
+	if add.Signature() != "add(x, y)" {
+		t.Errorf("add.Signature() wrong. got=%q", add.Signature())
+	}
+	if add.Doc != "add returns the sum of x and y.\nIt works on integers." {
+		t.Errorf("add.Doc wrong. got=%q", add.Doc)
+	}
+	if file.Funcs[1].Doc != "" {
+		t.Errorf("undocumented.Doc should be empty. got=%q", file.Funcs[1].Doc)
+	}
+	if file.Funcs[2].Doc != "sub returns x minus y." {
+		t.Errorf("sub.Doc wrong. got=%q", file.Funcs[2].Doc)
+	}
+	if file.Funcs[3].Doc != "" {
+		t.Errorf("value_only.Doc should be empty. got=%q", file.Funcs[3].Doc)
+	}
+	if file.Funcs[4].Doc != "mul returns the product of x and y." {
+		t.Errorf("mul.Doc wrong. got=%q", file.Funcs[4].Doc)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	file := &File{Name: "m.monkey", Funcs: []Func{{Name: "add", Params: []string{"x", "y"}, Doc: "Adds."}}}
+
+	var out bytes.Buffer
+	Markdown(&out, []*File{file}, nil)
+
+	expected := "# m.monkey\n\n## add\n\n```\nadd(x, y)\n```\n\nAdds.\n\n"
+	if out.String() != expected {
+		t.Errorf("Markdown wrong.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	for _, f := range Builtins() {
+		if f.Doc == "" {
+			t.Errorf("builtin %s has no documentation", f.Name)
+		}
+	}
+
+	var out bytes.Buffer
+	HTML(&out, nil, Builtins())
+	if !strings.Contains(out.String(), "<pre>len(value)</pre>") {
+		t.Errorf("HTML is missing the len builtin. got=%q", out.String())
+	}
+}
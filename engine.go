@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/compiler"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/vm"
+)
+
+// The engines a program can run on.
+const (
+	engineEval = "eval" // the tree-walking evaluator
+	engineVM   = "vm"   // the bytecode compiler and virtual machine
+)
+
+// engineFlag is the value of --engine.
+type engineFlag string
+
+func (e *engineFlag) String() string {
+	if *e == "" {
+		return engineEval
+	}
+	return string(*e)
+}
+
+func (e *engineFlag) Set(value string) error {
+	switch value {
+	case engineEval, engineVM:
+		*e = engineFlag(value)
+		return nil
+	}
+	return fmt.Errorf("unknown engine %q (want eval or vm)", value)
+}
+
+// vmUnsupported returns the first option in opts that the VM does not
+// implement, or "" when the program can run on the VM.
+func (opts runOptions) vmUnsupported() string {
+	switch {
+	case opts.trace.eval:
+		return "--trace=eval"
+	case opts.limits.MaxSteps != 0:
+		return "--max-steps"
+	case opts.limits.NoIO:
+		return "--no-io"
+	case opts.limits.Sandbox != nil:
+		return "--sandbox"
+	case opts.timeout != 0:
+		return "--timeout"
+	case opts.cover != nil:
+		return "--cover"
+	case opts.inspect != "":
+		return "--inspect"
+	}
+	return ""
+}
+
+// vmOnly returns the first option in opts that only the VM implements, or
+// "" when there is none.
+func (opts runOptions) vmOnly() string {
+	switch {
+	case opts.optimize:
+		return "-O"
+	case opts.dump:
+		return "--dump"
+	}
+	return ""
+}
+
+// vmOptions translates the run options the VM supports. --max-depth counts
+// nested calls, which excludes the frame of the main program.
+func (opts runOptions) vmOptions() vm.Options {
+	var vmOpts vm.Options
+	if opts.limits.MaxDepth > 0 {
+		vmOpts.MaxFrames = opts.limits.MaxDepth + 1
+	}
+	return vmOpts
+}
+
+// compileProgram compiles program for the VM, reporting compile errors to
+// errOut like run reports parser errors.
+func compileProgram(program *ast.Program, errOut io.Writer) (*compiler.Bytecode, bool) {
+	bytecode, err := compiler.Compile(program)
+	if err != nil {
+		io.WriteString(errOut, "compile errors:\n")
+		io.WriteString(errOut, "\t"+err.Error()+"\n")
+		return nil, false
+	}
+	return bytecode, true
+}
+
+// runVM runs bytecode and returns the process exit code, like run does for
+// the evaluator.
+func runVM(ctx context.Context, bytecode *compiler.Bytecode, opts runOptions, errOut io.Writer) int {
+	if opts.optimize {
+		bytecode = compiler.Optimize(bytecode)
+	}
+
+	vmOpts := opts.vmOptions()
+	vmOpts.Context = ctx
+	machine := vm.NewWithOptions(bytecode, vmOpts)
+
+	switch result := vmResult(machine.Run()).(type) {
+	case *object.Error:
+		io.WriteString(errOut, result.Inspect())
+		io.WriteString(errOut, "\n")
+		if opts.dump {
+			machine.Dump(errOut)
+		}
+		return exitRuntimeError
+	case *object.Exit:
+		return int(result.Code)
+	}
+
+	return exitOK
+}
+
+// vmResult turns the error returned by the VM's Run into the error or exit
+// object the evaluator produces in the same situation, or nil on success.
+func vmResult(err error) object.Object {
+	if err == nil {
+		return nil
+	}
+	var exit *vm.ExitError
+	if errors.As(err, &exit) {
+		return &object.Exit{Code: exit.Code}
+	}
+	return &object.Error{Message: err.Error()}
+}
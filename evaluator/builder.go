@@ -0,0 +1,59 @@
+package evaluator
+
+import (
+	"strings"
+
+	"github.com/frankie-mur/monkeylang/object"
+)
+
+// builderBuiltin returns a string builder. Monkey values have no methods,
+// so the builder is a hash of builtins sharing one buffer, which take time
+// linear in the length of the string however it is assembled.
+var builderBuiltin = &object.Builtin{
+	Doc: "Returns a string builder, a hash of functions: add(values...) appends the values, strings as they are and others as they print; add_line(values...) appends them and a newline; build() returns the string built so far.",
+	Fn: func(args ...object.Object) object.Object {
+		if len(args) != 0 {
+			return newError("wrong number of arguments. got=%d, want=0", len(args))
+		}
+
+		var buf strings.Builder
+		add := func(args []object.Object) {
+			for _, arg := range args {
+				if s, ok := arg.(*object.String); ok {
+					buf.WriteString(s.Value)
+				} else {
+					buf.WriteString(arg.Inspect())
+				}
+			}
+		}
+
+		builder := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair)}
+		setField(builder, "add", &object.Builtin{
+			Params: []string{"values..."},
+			Doc:    "Appends the values to the string.",
+			Fn: func(args ...object.Object) object.Object {
+				add(args)
+				return NULL
+			},
+		})
+		setField(builder, "add_line", &object.Builtin{
+			Params: []string{"values..."},
+			Doc:    "Appends the values and a newline to the string.",
+			Fn: func(args ...object.Object) object.Object {
+				add(args)
+				buf.WriteByte('\n')
+				return NULL
+			},
+		})
+		setField(builder, "build", &object.Builtin{
+			Doc: "Returns the string built so far.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 0 {
+					return newError("wrong number of arguments. got=%d, want=0", len(args))
+				}
+				return &object.String{Value: buf.String()}
+			},
+		})
+		return builder
+	},
+}
@@ -2,21 +2,56 @@ package evaluator
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"sort"
 
 	"github.com/frankie-mur/monkeylang/object"
 )
 
+// Output is where puts writes. It is shared by every evaluation and VM in
+// the process; hosts that capture a program's output, such as the
+// WebAssembly build, replace it while the program runs.
+var Output io.Writer = os.Stdout
+
+// BuiltinNames returns the names of all builtin functions in sorted order.
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupBuiltin returns the builtin function with the given name.
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	b, ok := builtins[name]
+	return b, ok
+}
+
 // builtins is a map of built-in functions available in the Monkey programming language.
 var builtins = map[string]*object.Builtin{
 	"puts": {
+		Params: []string{"values..."},
+		Doc:    "Prints each argument on its own line and returns null.",
+		IO:     true,
+		Warn: func(args ...object.Object) string {
+			if len(args) == 0 {
+				return "puts without arguments prints nothing"
+			}
+			return ""
+		},
 		Fn: func(args ...object.Object) object.Object {
 			for _, arg := range args {
-				fmt.Println(arg.Inspect())
+				fmt.Fprintln(Output, arg.Inspect())
 			}
 			return NULL
 		},
 	},
 	"len": {
+		Params: []string{"value"},
+		Doc:    "Returns the length of a string in bytes or the number of elements of an array.",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
@@ -33,6 +68,8 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"first": &object.Builtin{
+		Params: []string{"array"},
+		Doc:    "Returns the first element of an array, or null if it is empty.",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
@@ -50,6 +87,8 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"last": &object.Builtin{
+		Params: []string{"array"},
+		Doc:    "Returns the last element of an array, or null if it is empty.",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
@@ -68,6 +107,8 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"rest": &object.Builtin{
+		Params: []string{"array"},
+		Doc:    "Returns a new array holding every element but the first, or null if the array is empty.",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
@@ -88,6 +129,8 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"push": &object.Builtin{
+		Params: []string{"array", "value"},
+		Doc:    "Returns a new array with value appended to the elements of array.",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 2 {
 				return newError("wrong number of arguments. got=%d, want=2", len(args))
@@ -105,4 +148,196 @@ var builtins = map[string]*object.Builtin{
 			return &object.Array{Elements: newElements}
 		},
 	},
+	"exit": &object.Builtin{
+		Params: []string{"code"},
+		Doc:    "Stops the program. The process exits with code, or 0 when it is omitted.",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) > 1 {
+				return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+			}
+			if len(args) == 0 {
+				return &object.Exit{Code: 0}
+			}
+			if args[0].Type() != object.INTEGER_OBJ {
+				return newError("argument to `exit` must be INTEGER, got %s", args[0].Type())
+			}
+
+			return &object.Exit{Code: args[0].(*object.Integer).Value}
+		},
+	},
+	"assert": &object.Builtin{
+		Params: []string{"condition", "message"},
+		Doc:    "Fails with an error if condition is not truthy. The optional message is included in the error.",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+			if isTruthy(args[0]) {
+				return NULL
+			}
+			if len(args) == 2 {
+				if msg, ok := args[1].(*object.String); ok {
+					return newError("assertion failed: %s", msg.Value)
+				}
+				return newError("assertion failed: %s", args[1].Inspect())
+			}
+			return newError("assertion failed")
+		},
+	},
+	"assert_eq": &object.Builtin{
+		Params: []string{"actual", "expected"},
+		Doc:    "Fails with an error unless actual and expected hold equal values. Arrays and hashes are compared element by element.",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if !objectsEqual(args[0], args[1]) {
+				return newError("assertion failed: expected %s, got %s", args[1].Inspect(), args[0].Inspect())
+			}
+			return NULL
+		},
+	},
+	"stats":     statsBuiltin,
+	"builder":   builderBuiltin,
+	"on_signal": onSignalBuiltin,
+	"get": &object.Builtin{
+		Params: []string{"hash", "key", "default"},
+		Doc:    "Returns the value of key in hash, or default if hash has no such key. The function of a default_hash is not called.",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=3", len(args))
+			}
+			hash, ok := args[0].(*object.Hash)
+			if !ok {
+				return newError("argument to `get` must be HASH, got %s", args[0].Type())
+			}
+			key, ok := args[1].(object.Hashable)
+			if !ok {
+				return newError("unusable as hash key: %s", args[1].Type())
+			}
+			if pair, ok := hash.Pairs[key.HashKey()]; ok {
+				return pair.Value
+			}
+			return args[2]
+		},
+	},
+	"default_hash": &object.Builtin{
+		Params: []string{"fn", "hash"},
+		Doc:    "Returns a hash that indexing with a missing key calls fn with the key for a value rather than returning null. Its pairs are those of the optional hash.",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+			if _, _, ok := Describe(args[0]); !ok {
+				return newError("argument to `default_hash` must be FUNCTION, got %s", args[0].Type())
+			}
+			pairs := make(map[object.HashKey]object.HashPair)
+			if len(args) == 2 {
+				hash, ok := args[1].(*object.Hash)
+				if !ok {
+					return newError("argument to `default_hash` must be HASH, got %s", args[1].Type())
+				}
+				for k, pair := range hash.Pairs {
+					pairs[k] = pair
+				}
+			}
+			return &object.Hash{Pairs: pairs, Default: args[0]}
+		},
+	},
+	"doc": &object.Builtin{
+		Params: []string{"fn"},
+		Doc:    "Returns the documentation of a function or builtin, or null if it has none. A function is documented by a string literal opening its body.",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			_, doc, ok := Describe(args[0])
+			if !ok {
+				return newError("argument to `doc` must be FUNCTION, got %s", args[0].Type())
+			}
+			if doc == "" {
+				return NULL
+			}
+			return &object.String{Value: doc}
+		},
+	},
+}
+
+// Describe returns the parameter names and documentation of fn, a function
+// of either engine or a builtin. ok is false if fn is not a function.
+func Describe(fn object.Object) (params []string, doc string, ok bool) {
+	switch fn := fn.(type) {
+	case *object.Function:
+		for _, p := range fn.Parameters {
+			params = append(params, p.Value)
+		}
+		return params, fn.Doc, true
+	case *object.Closure:
+		// A compiled function's locals start with its parameters.
+		names := fn.Fn.LocalNames
+		if len(names) >= fn.Fn.NumParameters {
+			params = names[:fn.Fn.NumParameters]
+		}
+		return params, fn.Fn.Doc, true
+	case *object.Builtin:
+		return fn.Params, fn.Doc, true
+	}
+	return nil, "", false
+}
+
+// objectsEqual reports whether a and b hold the same value, comparing
+// arrays and hashes element by element.
+func objectsEqual(a, b object.Object) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *object.Integer:
+		return a.Value == b.(*object.Integer).Value
+	case *object.Float:
+		return a.Value == b.(*object.Float).Value
+	case *object.String:
+		return a.Value == b.(*object.String).Value
+	case *object.Boolean:
+		return a.Value == b.(*object.Boolean).Value
+	case *object.Null:
+		return true
+	case *object.Array:
+		other := b.(*object.Array)
+		if len(a.Elements) != len(other.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !objectsEqual(a.Elements[i], other.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *object.Variant:
+		other := b.(*object.Variant)
+		if a.Enum != other.Enum || a.Tag != other.Tag || len(a.Values) != len(other.Values) {
+			return false
+		}
+		for i := range a.Values {
+			if !objectsEqual(a.Values[i], other.Values[i]) {
+				return false
+			}
+		}
+		return true
+	case *object.Hash:
+		other := b.(*object.Hash)
+		if len(a.Pairs) != len(other.Pairs) {
+			return false
+		}
+		for key, pair := range a.Pairs {
+			otherPair, ok := other.Pairs[key]
+			if !ok || !objectsEqual(pair.Value, otherPair.Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
 }
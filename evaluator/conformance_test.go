@@ -0,0 +1,128 @@
+package evaluator_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/frankie-mur/monkeylang/compiler"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/parser"
+	"github.com/frankie-mur/monkeylang/vm"
+)
+
+// checkConformance runs input on the VM, with and without the peephole
+// optimizer, and reports an error unless it produces the same value, error
+// or exit as the evaluator did.
+func checkConformance(t *testing.T, input string, evaluated object.Object) {
+	t.Helper()
+
+	// A program ending in a let statement has no value in the evaluator,
+	// while the VM reports the last value it discarded.
+	if evaluated == nil {
+		return
+	}
+
+	compiled := runVM(input, false)
+	if !sameResult(evaluated, compiled) {
+		t.Errorf("%q: engines disagree. evaluator=%s, vm=%s", input, evaluated.Inspect(), compiled.Inspect())
+	}
+
+	optimized := runVM(input, true)
+	if !sameResult(evaluated, optimized) {
+		t.Errorf("%q: engines disagree. evaluator=%s, optimized vm=%s", input, evaluated.Inspect(), optimized.Inspect())
+	}
+}
+
+// runVM compiles, optionally optimizes, and runs input, turning compile and runtime errors into
+// error objects and exits into exit objects like the evaluator produces.
+func runVM(input string, optimize bool) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	bytecode, err := compiler.Compile(program)
+	if err != nil {
+		var compileErr *compiler.Error
+		if errors.As(err, &compileErr) {
+			return &object.Error{Message: compileErr.Message}
+		}
+		return &object.Error{Message: err.Error()}
+	}
+
+	if optimize {
+		bytecode = compiler.Optimize(bytecode)
+	}
+
+	machine := vm.New(bytecode)
+	if err := machine.Run(); err != nil {
+		var exit *vm.ExitError
+		if errors.As(err, &exit) {
+			return &object.Exit{Code: exit.Code}
+		}
+		var runtimeErr *vm.RuntimeError
+		if errors.As(err, &runtimeErr) {
+			return &object.Error{Message: runtimeErr.Message}
+		}
+		return &object.Error{Message: err.Error()}
+	}
+
+	return machine.LastPoppedStackElem()
+}
+
+// sameResult reports whether a result of the evaluator and of the VM are
+// equivalent. Functions only need to be functions on both sides, as the
+// engines represent them differently.
+func sameResult(evaluated, compiled object.Object) bool {
+	switch evaluated := evaluated.(type) {
+	case *object.Function:
+		_, ok := compiled.(*object.Closure)
+		return ok
+
+	case *object.Error:
+		compiled, ok := compiled.(*object.Error)
+		return ok && compiled.Message == evaluated.Message
+
+	case *object.Exit:
+		compiled, ok := compiled.(*object.Exit)
+		return ok && compiled.Code == evaluated.Code
+
+	case *object.Integer:
+		compiled, ok := compiled.(*object.Integer)
+		return ok && compiled.Value == evaluated.Value
+
+	case *object.Float:
+		compiled, ok := compiled.(*object.Float)
+		return ok && compiled.Value == evaluated.Value
+
+	case *object.String:
+		compiled, ok := compiled.(*object.String)
+		return ok && compiled.Value == evaluated.Value
+
+	case *object.Array:
+		compiled, ok := compiled.(*object.Array)
+		if !ok || len(compiled.Elements) != len(evaluated.Elements) {
+			return false
+		}
+		for i := range evaluated.Elements {
+			if !sameResult(evaluated.Elements[i], compiled.Elements[i]) {
+				return false
+			}
+		}
+		return true
+
+	case *object.Hash:
+		compiled, ok := compiled.(*object.Hash)
+		if !ok || len(compiled.Pairs) != len(evaluated.Pairs) {
+			return false
+		}
+		for key, pair := range evaluated.Pairs {
+			other, ok := compiled.Pairs[key]
+			if !ok || !sameResult(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+	}
+
+	// Booleans, null and builtins are singletons shared by both engines.
+	return evaluated == compiled
+}
@@ -0,0 +1,391 @@
+package evaluator_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/compiler"
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/parser"
+	"github.com/frankie-mur/monkeylang/resolver"
+	"github.com/frankie-mur/monkeylang/token"
+	"github.com/frankie-mur/monkeylang/vm"
+)
+
+// Limits of the evaluator in differential runs, which keep generated and
+// mutated programs from running forever.
+const (
+	diffMaxSteps = 200000
+	diffMaxDepth = 200
+)
+
+// compareEngines runs src on the evaluator and on the VM, with and without
+// the peephole optimizer, and fails unless they agree on the value or on
+// the class of the error. It also checks that the evaluator gets the same
+// result once the program is resolved. Programs the engines cannot be
+// expected to agree on are skipped:
+//
+//   - programs that do not parse or that the compiler rejects, such as
+//     functions referring to globals defined after them, which the
+//     evaluator resolves at run time;
+//   - programs the evaluator stops for using more than diffMaxSteps
+//     steps, a limit the VM does not have, or for nesting calls deeper
+//     than diffMaxDepth, less deep than the VM allows;
+//   - programs that call builtins performing I/O, which the harness must
+//     not run on random input.
+func compareEngines(t *testing.T, src string) {
+	t.Helper()
+
+	l := lexer.New(src)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if b, ok := evaluator.LookupBuiltin(tok.Literal); ok && tok.Type == token.IDENT && b.IO {
+			return
+		}
+	}
+
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return
+	}
+	if _, err := compiler.Compile(program); err != nil {
+		return
+	}
+
+	evaluated := evalLimited(program)
+	// Resolving the variables of the program must not change what it
+	// evaluates to, even where it stops.
+	resolver.Resolve(program)
+	if resolved := evalLimited(program); inspect(resolved) != inspect(evaluated) {
+		t.Errorf("resolving changes the result of\n%s\nunresolved=%s\nresolved=%s",
+			src, inspect(evaluated), inspect(resolved))
+	}
+	if err, ok := evaluated.(*object.Error); ok && (strings.HasPrefix(err.Message, "step limit exceeded") ||
+		strings.HasPrefix(err.Message, "maximum call depth")) {
+		return
+	}
+	if evaluated == nil {
+		// A program ending in a let statement has no value in the
+		// evaluator, while the VM reports the last value it discarded.
+		return
+	}
+
+	for _, optimize := range []bool{false, true} {
+		compiled := runVMLimited(program, optimize)
+		if !sameOutcome(evaluated, compiled) {
+			t.Errorf("engines disagree (optimize=%t) on\n%s\nevaluator=%s\nvm=%s",
+				optimize, src, inspect(evaluated), inspect(compiled))
+		}
+	}
+}
+
+// evalLimited evaluates program under the differential limits, turning a
+// panic into an error so it is reported as a divergence rather than
+// crashing the run.
+func evalLimited(program *ast.Program) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = &object.Error{Message: fmt.Sprintf("panic: %v", r)}
+		}
+	}()
+
+	e := evaluator.New()
+	e.SetLimits(evaluator.Limits{MaxSteps: diffMaxSteps, MaxDepth: diffMaxDepth, NoIO: true})
+	return e.Eval(program, object.NewEnvironment())
+}
+
+// runVMLimited is runVM for a parsed program, with panics turned into
+// errors.
+func runVMLimited(program *ast.Program, optimize bool) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = &object.Error{Message: fmt.Sprintf("panic: %v", r)}
+		}
+	}()
+
+	bytecode, err := compiler.Compile(program)
+	if err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	if optimize {
+		bytecode = compiler.Optimize(bytecode)
+	}
+
+	machine := vm.New(bytecode)
+	if err := machine.Run(); err != nil {
+		var exit *vm.ExitError
+		if errors.As(err, &exit) {
+			return &object.Exit{Code: exit.Code}
+		}
+		var runtimeErr *vm.RuntimeError
+		if errors.As(err, &runtimeErr) {
+			return &object.Error{Message: runtimeErr.Message}
+		}
+		return &object.Error{Message: err.Error()}
+	}
+	return machine.LastPoppedStackElem()
+}
+
+// sameOutcome is sameResult with errors compared by class, as the engines
+// word some errors differently.
+func sameOutcome(evaluated, compiled object.Object) bool {
+	if evaluated, ok := evaluated.(*object.Error); ok {
+		compiled, ok := compiled.(*object.Error)
+		return ok && errorClass(evaluated.Message) == errorClass(compiled.Message)
+	}
+	return sameResult(evaluated, compiled)
+}
+
+// errorClass returns the kind of error message msg reports: the text
+// before its details, which name the types of values, and the engines name
+// functions differently.
+func errorClass(msg string) string {
+	if i := strings.IndexAny(msg, ":.,"); i >= 0 {
+		return msg[:i]
+	}
+	return msg
+}
+
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+	return obj.Inspect()
+}
+
+// diffSeeds are programs the fuzz targets start from, chosen to cover the
+// parts of the language where the engines are implemented differently.
+var diffSeeds = []string{
+	"1 + 2 * 3 - 4 / 2",
+	"-5 < 10 == !false",
+	`"mon" + "key" == "monkey"`,
+	"if (1 > 2) { 10 } else { 20 }",
+	"if (false) { 1 }",
+	"let a = [1, 2, 3]; a[0] + a[2] + len(rest(push(a, 4)))",
+	`let h = {"one": 1, true: 2, 3: [4]}; h["one"] + h[true] + h[3][0]`,
+	"let add = fn(a, b) { a + b }; add(1, add(2, 3))",
+	"let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(12)",
+	"let adder = fn(x) { fn(y) { x + y } }; adder(2)(3)",
+	"let f = fn() { f() }; f()",
+	"1 + true",
+	`"a" - "b"`,
+	"[1][true]",
+	"{[1]: 2}",
+	"let x = 1; x(2)",
+	"first([]); last([1, 2]); rest([])",
+	"exit(3)",
+	"10 / 0",
+	"fn(a, b) { a }(1)",
+	"fn(a) { a }(1, 2)",
+}
+
+// FuzzEngines mutates programs and fails when the evaluator and the VM
+// disagree on one of them. Run it with
+//
+//	go test ./evaluator -run '^$' -fuzz FuzzEngines
+func FuzzEngines(f *testing.F) {
+	for _, seed := range diffSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		compareEngines(t, src)
+	})
+}
+
+// FuzzGenerated compares the engines on programs generated from random
+// seeds, which unlike mutated programs almost always parse.
+func FuzzGenerated(f *testing.F) {
+	for seed := int64(0); seed < 8; seed++ {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, seed int64) {
+		compareEngines(t, generateProgram(rand.New(rand.NewSource(seed))))
+	})
+}
+
+// TestGeneratedPrograms runs a fixed set of generated programs, so the
+// differential test runs with every go test and not only when fuzzing.
+func TestGeneratedPrograms(t *testing.T) {
+	n := 2000
+	if testing.Short() {
+		n = 200
+	}
+	for seed := int64(0); seed < int64(n); seed++ {
+		compareEngines(t, generateProgram(rand.New(rand.NewSource(seed))))
+	}
+}
+
+func TestDiffSeeds(t *testing.T) {
+	for _, seed := range diffSeeds {
+		compareEngines(t, seed)
+	}
+}
+
+// generator writes random Monkey programs. It keeps track of the names in
+// scope so most identifiers it uses are defined, and of how deeply it has
+// nested expressions so programs stay small.
+type generator struct {
+	r      *rand.Rand
+	b      strings.Builder
+	scopes [][]string
+	depth  int
+}
+
+// generateProgram returns a program of a few let statements followed by
+// an expression, whose value the engines are compared on.
+func generateProgram(r *rand.Rand) string {
+	g := &generator{r: r, scopes: [][]string{nil}}
+	for i := r.Intn(5); i > 0; i-- {
+		g.let()
+	}
+	g.expr()
+	return g.b.String()
+}
+
+var (
+	genNames     = []string{"a", "b", "c", "f", "g", "x", "y", "xs", "h"}
+	genOperators = []string{"+", "-", "*", "/", "<", ">", "==", "!="}
+	genBuiltins  = []string{"len", "first", "last", "rest", "push"}
+	genStrings   = []string{`""`, `"a"`, `"monkey"`, `"1"`}
+)
+
+func (g *generator) let() {
+	name := genNames[g.r.Intn(len(genNames))]
+	fmt.Fprintf(&g.b, "let %s = ", name)
+	// Defining the name first lets functions call themselves.
+	scope := &g.scopes[len(g.scopes)-1]
+	*scope = append(*scope, name)
+	g.expr()
+	g.b.WriteString(";\n")
+}
+
+// ident returns a name in scope, or now and then one that is not.
+func (g *generator) ident() string {
+	var names []string
+	for _, scope := range g.scopes {
+		names = append(names, scope...)
+	}
+	if len(names) == 0 || g.r.Intn(20) == 0 {
+		return genNames[g.r.Intn(len(genNames))]
+	}
+	return names[g.r.Intn(len(names))]
+}
+
+func (g *generator) expr() {
+	g.depth++
+	defer func() { g.depth-- }()
+
+	choice := g.r.Intn(14)
+	if g.depth > 4 {
+		choice = g.r.Intn(4)
+	}
+	switch choice {
+	case 0:
+		fmt.Fprint(&g.b, g.r.Intn(21)-5)
+	case 1:
+		g.b.WriteString(genStrings[g.r.Intn(len(genStrings))])
+	case 2:
+		fmt.Fprint(&g.b, g.r.Intn(2) == 0)
+	case 3:
+		g.b.WriteString(g.ident())
+	case 4, 5:
+		g.b.WriteString("(")
+		g.expr()
+		fmt.Fprintf(&g.b, " %s ", genOperators[g.r.Intn(len(genOperators))])
+		g.expr()
+		g.b.WriteString(")")
+	case 6:
+		// The operand is parenthesized so that - and a negative
+		// number do not lex as --.
+		g.b.WriteString([]string{"-(", "!("}[g.r.Intn(2)])
+		g.expr()
+		g.b.WriteString(")")
+	case 7:
+		g.b.WriteString("if (")
+		g.expr()
+		g.b.WriteString(") { ")
+		g.block()
+		g.b.WriteString(" }")
+		if g.r.Intn(2) == 0 {
+			g.b.WriteString(" else { ")
+			g.block()
+			g.b.WriteString(" }")
+		}
+	case 8:
+		g.b.WriteString("[")
+		g.list(3)
+		g.b.WriteString("]")
+	case 9:
+		g.b.WriteString("{")
+		for i := g.r.Intn(3); i > 0; i-- {
+			g.expr()
+			g.b.WriteString(": ")
+			g.expr()
+			if i > 1 {
+				g.b.WriteString(", ")
+			}
+		}
+		g.b.WriteString("}")
+	case 10:
+		g.expr()
+		g.b.WriteString("[")
+		g.expr()
+		g.b.WriteString("]")
+	case 11:
+		g.fn()
+	case 12:
+		g.b.WriteString(g.ident())
+		g.b.WriteString("(")
+		g.list(3)
+		g.b.WriteString(")")
+	case 13:
+		g.b.WriteString(genBuiltins[g.r.Intn(len(genBuiltins))])
+		g.b.WriteString("(")
+		g.list(2)
+		g.b.WriteString(")")
+	}
+}
+
+// fn writes a function literal, whose parameters are in scope in its body.
+func (g *generator) fn() {
+	var params []string
+	for i := g.r.Intn(3); i > 0; i-- {
+		params = append(params, genNames[g.r.Intn(len(genNames))])
+	}
+	fmt.Fprintf(&g.b, "fn(%s) { ", strings.Join(params, ", "))
+	g.scopes = append(g.scopes, params)
+	g.block()
+	g.scopes = g.scopes[:len(g.scopes)-1]
+	g.b.WriteString(" }")
+}
+
+// block writes the statements of a block, ending in an expression or a
+// return.
+func (g *generator) block() {
+	g.scopes = append(g.scopes, nil)
+	defer func() { g.scopes = g.scopes[:len(g.scopes)-1] }()
+
+	for i := g.r.Intn(3); i > 0; i-- {
+		g.let()
+	}
+	if g.r.Intn(4) == 0 {
+		g.b.WriteString("return ")
+	}
+	g.expr()
+}
+
+// list writes up to max comma-separated expressions.
+func (g *generator) list(max int) {
+	for i := g.r.Intn(max + 1); i > 0; i-- {
+		g.expr()
+		if i > 1 {
+			g.b.WriteString(", ")
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/object"
+)
+
+// evalEnumStatement binds the variants of an enum declaration: a
+// constructor for each variant with fields, and the only value of each
+// variant without.
+func (e *Evaluator) evalEnumStatement(node *ast.EnumStatement, env *object.Enviroment) {
+	for _, variant := range node.Variants {
+		if variant.Fields == nil {
+			bind(env, variant.Name, e.created(&object.Variant{Enum: node.Name.Value, Tag: variant.Name.Value}))
+		} else {
+			bind(env, variant.Name, variantConstructor(node.Name.Value, variant))
+		}
+	}
+}
+
+// variantConstructor returns the builtin that constructs values of the
+// variant of the enum named enum.
+func variantConstructor(enum string, variant *ast.EnumVariant) *object.Builtin {
+	tag := variant.Name.Value
+	fields := make([]string, len(variant.Fields))
+	for i, f := range variant.Fields {
+		fields[i] = f.Value
+	}
+
+	return &object.Builtin{
+		Params:  fields,
+		Doc:     fmt.Sprintf("Returns a %s value of the enum %s.", tag, enum),
+		Variant: &object.Variant{Enum: enum, Tag: tag, Fields: fields},
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != len(fields) {
+				return newError("wrong number of arguments: want=%d, got=%d", len(fields), len(args))
+			}
+			values := append([]object.Object(nil), args...)
+			return &object.Variant{Enum: enum, Tag: tag, Fields: fields, Values: values}
+		},
+	}
+}
+
+// evalMatchExpression evaluates the body of the first arm of node whose
+// pattern matches the subject: the arm naming the subject's variant of the
+// subject's enum, or the arm _. Each arm is evaluated in an environment of
+// its own, where it binds the variant's fields like let statements would.
+// It is an error for no arm to match.
+func (e *Evaluator) evalMatchExpression(node *ast.MatchExpression, env *object.Enviroment) object.Object {
+	subject := e.Eval(node.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+	variant, _ := subject.(*object.Variant)
+
+	for _, arm := range node.Arms {
+		if arm.Pattern.Value == "_" {
+			return e.Eval(arm.Body, armEnv(arm, env))
+		}
+		if variant == nil || variant.Tag != arm.Pattern.Value {
+			continue
+		}
+
+		inner := armEnv(arm, env)
+		pattern := e.evalIdentifier(arm.Pattern, inner)
+		if isError(pattern) {
+			return pattern
+		}
+		if p := patternVariant(pattern); p == nil || p.Enum != variant.Enum || p.Tag != variant.Tag {
+			continue
+		}
+		if arm.Fields != nil && len(arm.Fields) != len(variant.Values) {
+			return newError("wrong number of fields in pattern %s: want=%d, got=%d", arm.Pattern.Value, len(variant.Values), len(arm.Fields))
+		}
+		for i, f := range arm.Fields {
+			if f.Value != "_" {
+				bind(inner, f, variant.Values[i])
+			}
+		}
+		return e.Eval(arm.Body, inner)
+	}
+
+	return newError("no match arm for %s", subject.Inspect())
+}
+
+// armEnv creates the environment of a match arm, enclosed within env. The
+// environment of a resolved arm keeps its locals in slots.
+func armEnv(arm *ast.MatchArm, env *object.Enviroment) *object.Enviroment {
+	if arm.Locals != nil {
+		return object.NewSlotEnvironment(env, arm.Locals)
+	}
+	return object.NewEnclosedEnvironment(env)
+}
+
+// patternVariant returns the variant the value of a pattern names: the
+// value of a variant without fields or the variant a constructor
+// constructs. It returns nil for any other value.
+func patternVariant(pattern object.Object) *object.Variant {
+	switch pattern := pattern.(type) {
+	case *object.Variant:
+		return pattern
+	case *object.Builtin:
+		return pattern.Variant
+	}
+	return nil
+}
+
+// evalVariantIndexExpression evaluates an index expression on a variant,
+// which returns the value of the field the index names.
+func evalVariantIndexExpression(variant, index object.Object) object.Object {
+	v := variant.(*object.Variant)
+	name := index.(*object.String).Value
+
+	value, ok := v.Field(name)
+	if !ok {
+		return newError("unknown field %q of %s", name, v.Tag)
+	}
+	return value
+}
+
+// bind binds the variable ident in env, in its slot if it was resolved.
+func bind(env *object.Enviroment, ident *ast.Identifier, value object.Object) {
+	if slot := ident.Slot; slot != nil {
+		env.SetSlot(slot.Index, ident.Value, value)
+	} else {
+		env.Set(ident.Value, value)
+	}
+}
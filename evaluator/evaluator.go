@@ -1,10 +1,14 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
 
 	"github.com/frankie-mur/monkeylang/ast"
 	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/token"
 )
 
 var (
@@ -13,119 +17,282 @@ var (
 	FALSE = &object.Boolean{Value: false}
 )
 
+// Evaluator evaluates Monkey programs. It carries the settings and state of
+// an evaluation, such as tracing and limits; the zero value is ready to use.
+type Evaluator struct {
+	traceOut   io.Writer
+	traceDepth int
+	hook       func(ast.Node)
+
+	// inspect, if not nil, sees every node along with its environment and
+	// inspectCalls, the calls in progress; see SetInspector.
+	inspect      func(ast.Node, *object.Enviroment, []Call)
+	inspectCalls []Call
+
+	limits    Limits
+	ctx       context.Context
+	steps     int64
+	depth     int
+	nesting   int   // the node evaluations in progress
+	allocated int64 // the bytes of the values created; see valueSize
+
+	// Counters for Stats; steps is shared with the limits.
+	calls     int64
+	maxDepth  int
+	allocs    map[object.ObjectType]int64
+	heapStart uint64
+
+	// literals holds the value of each string literal evaluated in the
+	// current program, which its later evaluations share along with its
+	// cached hash key.
+	literals map[*ast.StringLiteral]*object.String
+
+	// signals receives the signals the program handles, with on_signal,
+	// and handlers holds their handlers.
+	signals  chan os.Signal
+	handlers map[os.Signal]object.Object
+
+	// warnFn receives the warnings of the evaluation; warned holds those
+	// already reported.
+	warnFn func(Warning)
+	warned map[Warning]bool
+
+	// lastErr is the error most recently produced by a node, at errPos.
+	lastErr *object.Error
+	errPos  token.Position
+}
+
+// New returns an Evaluator with default settings.
+func New() *Evaluator {
+	return &Evaluator{}
+}
+
+// Eval evaluates node in env with a new Evaluator.
 func Eval(node ast.Node, env *object.Enviroment) object.Object {
+	return New().Eval(node, env)
+}
+
+// Eval evaluates node in env.
+func (e *Evaluator) Eval(node ast.Node, env *object.Enviroment) object.Object {
+	var result object.Object
+	if limit := e.limits.maxNesting(); e.nesting >= limit {
+		result = newError(nestingExceeded+" of %d exceeded", limit)
+	} else if err := e.step(); err != nil {
+		result = err
+	} else {
+		e.nesting++
+		defer func() { e.nesting-- }()
+
+		if e.hook != nil {
+			e.hook(node)
+		}
+		if e.inspect != nil {
+			e.inspect(node, env, e.inspectCalls)
+		}
+		if e.traceOut != nil {
+			result = e.traceEval(node, env)
+		} else {
+			result = e.eval(node, env)
+		}
+	}
+
+	// The first node to return an error is the one that produced it, as
+	// the nodes enclosing it return the same error.
+	if err, ok := result.(*object.Error); ok && err != e.lastErr {
+		e.lastErr, e.errPos = err, node.Pos()
+	}
+	return result
+}
+
+// ErrorPos returns the position of the node whose evaluation produced err,
+// the last error e produced. It reports false for other errors.
+func (e *Evaluator) ErrorPos(err *object.Error) (token.Position, bool) {
+	if err == nil || err != e.lastErr {
+		return token.Position{}, false
+	}
+	return e.errPos, true
+}
+
+// Located returns err with the position ErrorPos reports for it before its
+// message, as in "2:1: type mismatch: INTEGER + BOOLEAN", the way the VM
+// reports runtime errors. Without a position it returns err.
+func (e *Evaluator) Located(err *object.Error) *object.Error {
+	pos, ok := e.ErrorPos(err)
+	if !ok || !pos.IsValid() {
+		return err
+	}
+	return &object.Error{Message: fmt.Sprintf("%s: %s", pos, err.Message)}
+}
+
+func (e *Evaluator) eval(node ast.Node, env *object.Enviroment) object.Object {
 	switch node := node.(type) {
 
 	case *ast.Program:
-		return evalProgram(node, env)
+		return e.evalProgram(node, env)
 
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return e.Eval(node.Expression, env)
 
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		val := e.Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		if slot := node.Name.Slot; slot != nil {
+			env.SetSlot(slot.Index, node.Name.Value, val)
+		} else {
+			env.Set(node.Name.Value, val)
+		}
 	//Expressions
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		return e.created(&object.Integer{Value: node.Value})
+
+	case *ast.FloatLiteral:
+		return e.created(&object.Float{Value: node.Value})
 
 	case *ast.StringLiteral:
-		return &object.String{Value: node.Value}
+		return e.stringLiteral(node)
 
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return e.created(evalPrefixExpression(node.Operator, right))
 
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		if node.Operator == "&&" || node.Operator == "||" {
+			return e.evalLogicalExpression(node, env)
+		}
+		left := e.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		right := Eval(node.Right, env)
+		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 
-		return evalInfixExpression(node.Operator, left, right)
+		return e.infix(node.Operator, left, right)
 
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := e.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
+		index := e.Eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
+		if hash, ok := left.(*object.Hash); ok && hash.Default != nil {
+			return e.evalDefaultIndexExpression(hash, index)
+		}
 		return evalIndexExpression(left, index)
 
+	case *ast.SliceExpression:
+		return e.created(e.evalSliceExpression(node, env))
+
 	case *ast.BlockStatement:
-		return evalBlockStaement(node, env)
+		return e.evalBlockStaement(node, env)
 
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return e.evalIfExpression(node, env)
+
+	case *ast.AssignExpression:
+		return e.evalAssignExpression(node, env)
+
+	case *ast.PostfixExpression:
+		return e.evalPostfixExpression(node, env)
+
+	case *ast.WhileExpression:
+		return e.evalWhileExpression(node, env)
+
+	case *ast.ForExpression:
+		return e.evalForExpression(node, env)
+
+	case *ast.MatchExpression:
+		return e.evalMatchExpression(node, env)
+
+	case *ast.SwitchExpression:
+		return e.evalSwitchExpression(node, env)
+
+	case *ast.EnumStatement:
+		e.evalEnumStatement(node, env)
 
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		val := e.Eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
+		function := e.callee(node, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
+		args := e.evalExpressions(node.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		if builtin, ok := function.(*object.Builtin); ok && e.warnFn != nil {
+			e.warnCall(node, builtin, args)
+		}
+		if node.Tail && e.inspect == nil {
+			// The function making the call makes it in its own place, so
+			// that tail calls do not nest. Inspectors see every call in
+			// progress, so they bypass it.
+			return &tailCall{node: node, fn: function, args: args}
+		}
+		if e.inspect != nil {
+			return e.inspectedCall(node, env, function, args)
+		}
+		return e.applyFunction(function, args)
 
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return e.evalIdentifier(node, env)
 
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return e.created(&object.Function{Parameters: params, Body: body, Env: env, Doc: node.Doc(), Locals: node.Locals})
 
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
+		elements := e.evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return e.created(&object.Array{Elements: elements})
 
 	case *ast.HashLiteral:
-		return evalHashExpression(node, env)
+		return e.created(e.evalHashExpression(node, env))
 
 	}
 
 	return nil
 }
 
-func evalProgram(program *ast.Program, env *object.Enviroment) object.Object {
+func (e *Evaluator) evalProgram(program *ast.Program, env *object.Enviroment) object.Object {
+	defer e.stopSignals()
+	// The values of string literals are shared within a program only, so
+	// an evaluator that runs one program after another, like the REPL's,
+	// does not keep those of them all.
+	defer func() { e.literals = nil }()
 	var result object.Object
 
 	for _, stmt := range program.Statements {
-		result = Eval(stmt, env)
+		result = e.Eval(stmt, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
 			return result.Value
 		case *object.Error:
 			return result
+		case *object.Exit:
+			return result
 		}
 
 	}
@@ -133,15 +300,15 @@ func evalProgram(program *ast.Program, env *object.Enviroment) object.Object {
 	return result
 }
 
-func evalBlockStaement(block *ast.BlockStatement, env *object.Enviroment) object.Object {
+func (e *Evaluator) evalBlockStaement(block *ast.BlockStatement, env *object.Enviroment) object.Object {
 	var result object.Object
 
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = e.Eval(statement, env)
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.EXIT_OBJ {
 				return result
 			}
 		}
@@ -156,6 +323,12 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		i, ok := right.(*object.Integer)
+		if !ok {
+			return newError("unknown operator: ~%s", right.Type())
+		}
+		return &object.Integer{Value: ^i.Value}
 	default:
 		return newError("unknown operator: %s%s", operator, right.Type())
 	}
@@ -168,8 +341,13 @@ func evalInfixExpression(
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		// One operand is a float, so the integer, if any, is promoted.
+		return evalFloatInfixExpression(operator, toFloat(left), toFloat(right))
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
+	case left.Type() == object.ARRAY_OBJ && (operator == "+" || operator == "*"):
+		return evalArrayInfixExpression(operator, left, right)
 	//NOTE: In boolean types we can compare the objects themselves because they are an enum of TRUE, FALSE
 	case operator == "==":
 		return nativeBoolToBooleanObject(left == right)
@@ -184,12 +362,42 @@ func evalInfixExpression(
 	}
 }
 
+// evalArrayInfixExpression evaluates the array operators: + concatenates
+// two arrays and * repeats an array a number of times.
+func evalArrayInfixExpression(
+	operator string,
+	left, right object.Object,
+) object.Object {
+	array := left.(*object.Array)
+
+	switch {
+	case operator == "+" && right.Type() == object.ARRAY_OBJ:
+		concatenated, err := array.Concat(right.(*object.Array))
+		if err != nil {
+			return newError("%s", err)
+		}
+		return concatenated
+	case operator == "*" && right.Type() == object.INTEGER_OBJ:
+		repeated, err := array.Repeat(right.(*object.Integer).Value)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return repeated
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+	case left.Type() == object.VARIANT_OBJ && index.Type() == object.STRING_OBJ:
+		return evalVariantIndexExpression(left, index)
 	default:
 		return newError("index operator not supported: %s", left.Type())
 	}
@@ -210,6 +418,84 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrayObject.Elements[idx]
 }
 
+// infix evaluates left operator right as evalInfixExpression does, failing
+// before it builds a string or an array exceeding the allocation limit.
+func (e *Evaluator) infix(operator string, left, right object.Object) object.Object {
+	if err := e.checkAlloc(infixSize(operator, left, right)); err != nil {
+		return err
+	}
+	return e.created(evalInfixExpression(operator, left, right))
+}
+
+// evalSliceExpression evaluates left[low:high] on an array or a string. It
+// returns a new array or string, leaving left as it was. A negative bound
+// counts back from the end, and bounds out of range are clamped to it, so
+// slicing never fails on an integer bound. A string's indexes count bytes,
+// as len does.
+func (e *Evaluator) evalSliceExpression(se *ast.SliceExpression, env *object.Enviroment) object.Object {
+	left := e.Eval(se.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	var length int64
+	switch left := left.(type) {
+	case *object.Array:
+		length = int64(len(left.Elements))
+	case *object.String:
+		length = int64(len(left.Value))
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+
+	low, err := e.sliceBound(se.Low, 0, length, env)
+	if err != nil {
+		return err
+	}
+	high, err := e.sliceBound(se.High, length, length, env)
+	if err != nil {
+		return err
+	}
+	if high < low {
+		high = low
+	}
+
+	if s, ok := left.(*object.String); ok {
+		return &object.String{Value: s.Value[low:high]}
+	}
+	elements := make([]object.Object, high-low)
+	copy(elements, left.(*object.Array).Elements[low:high])
+	return &object.Array{Elements: elements}
+}
+
+// sliceBound evaluates a bound of a slice of length elements, returning
+// def if the bound is left out.
+func (e *Evaluator) sliceBound(bound ast.Expression, def, length int64, env *object.Enviroment) (int64, object.Object) {
+	if bound == nil {
+		return def, nil
+	}
+	obj := e.Eval(bound, env)
+	if isError(obj) {
+		return 0, obj
+	}
+	i, ok := obj.(*object.Integer)
+	if !ok {
+		return 0, newError("slice bound must be INTEGER, got %s", obj.Type())
+	}
+
+	n := i.Value
+	if n < 0 {
+		n += length
+	}
+	if n < 0 {
+		return 0, nil
+	}
+	if n > length {
+		return length, nil
+	}
+	return n, nil
+}
+
 // evalHashIndexExpression evaluates an index expression on a hash object.
 // It takes a hash object and an index object, and returns the value associated with the specified key.
 // If the key is not found in the hash, it returns NULL.
@@ -228,6 +514,20 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 	return pair.Value
 }
 
+// evalDefaultIndexExpression evaluates an index expression on a hash made
+// by default_hash, calling its default function if the key is missing.
+func (e *Evaluator) evalDefaultIndexExpression(hash *object.Hash, index object.Object) object.Object {
+	hashKey, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	if pair, ok := hash.Pairs[hashKey.HashKey()]; ok {
+		return pair.Value
+	}
+	return e.applyFunction(hash.Default, []object.Object{index})
+}
+
 func evalIntegerInfixExpression(
 	operator string,
 	left, right object.Object,
@@ -243,6 +543,9 @@ func evalIntegerInfixExpression(
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
 		return &object.Integer{Value: leftVal / rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
@@ -252,11 +555,81 @@ func evalIntegerInfixExpression(
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
+	case "&":
+		return &object.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal | rightVal}
+	case "^":
+		return &object.Integer{Value: leftVal ^ rightVal}
+	case "<<", ">>":
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal)
+		}
+		if operator == "<<" {
+			return &object.Integer{Value: leftVal << rightVal}
+		}
+		return &object.Integer{Value: leftVal >> rightVal}
 	default:
 		return NULL
 	}
 }
 
+// evalFloatInfixExpression applies operator to two floats, as for integers.
+// Division by zero is an error, not an infinity.
+func evalFloatInfixExpression(operator string, left, right float64) object.Object {
+	switch operator {
+	case "+":
+		return &object.Float{Value: left + right}
+	case "-":
+		return &object.Float{Value: left - right}
+	case "*":
+		return &object.Float{Value: left * right}
+	case "/":
+		if right == 0 {
+			return newError("division by zero")
+		}
+		return &object.Float{Value: left / right}
+	case "<":
+		return nativeBoolToBooleanObject(left < right)
+	case ">":
+		return nativeBoolToBooleanObject(left > right)
+	case "==":
+		return nativeBoolToBooleanObject(left == right)
+	case "!=":
+		return nativeBoolToBooleanObject(left != right)
+	default:
+		return newError("unknown operator: FLOAT %s FLOAT", operator)
+	}
+}
+
+// isNumber reports whether obj is an integer or a float.
+func isNumber(obj object.Object) bool {
+	t := obj.Type()
+	return t == object.INTEGER_OBJ || t == object.FLOAT_OBJ
+}
+
+// toFloat returns the value of obj, an integer or a float, as a float.
+func toFloat(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
+// stringLiteral returns the value of node. Strings are immutable, so one
+// value serves every evaluation of the literal.
+func (e *Evaluator) stringLiteral(node *ast.StringLiteral) object.Object {
+	if str, ok := e.literals[node]; ok {
+		return str
+	}
+	if e.literals == nil {
+		e.literals = make(map[*ast.StringLiteral]*object.String)
+	}
+	str := &object.String{Value: node.Value}
+	e.literals[node] = str
+	return e.created(str)
+}
+
 func evalStringInfixExpression(
 	operator string,
 	left, right object.Object,
@@ -266,7 +639,11 @@ func evalStringInfixExpression(
 
 	switch operator {
 	case "+":
-		return &object.String{Value: leftVal + rightVal}
+		concatenated, err := left.(*object.String).Concat(rightVal)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return concatenated
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
@@ -276,21 +653,155 @@ func evalStringInfixExpression(
 	}
 }
 
+// evalAssignExpression assigns the value of node to its variable, which must
+// be bound already. A compound assignment reads the variable before its
+// value is evaluated, as the infix expression it stands for would.
+func (e *Evaluator) evalAssignExpression(node *ast.AssignExpression, env *object.Enviroment) object.Object {
+	var current object.Object
+	if node.Operator != "" {
+		// Unlike evalIdentifier, this does not fall back to the builtins,
+		// which cannot be assigned.
+		var ok bool
+		if current, ok = env.Get(node.Name.Value); !ok {
+			return newError("identifier not found: %s", node.Name.Value)
+		}
+	}
+
+	val := e.Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+	if current != nil {
+		val = e.infix(node.Operator, current, val)
+		if isError(val) {
+			return val
+		}
+	}
+
+	if !env.Assign(node.Name.Value, val) {
+		return newError("identifier not found: %s", node.Name.Value)
+	}
+	return val
+}
+
+// evalPostfixExpression evaluates x++ or x--: it adds one to or subtracts
+// one from the variable, or the element of an array or a hash, as x += 1
+// would, and evaluates to its value before the change. The element must
+// exist, unless the hash has a default.
+func (e *Evaluator) evalPostfixExpression(node *ast.PostfixExpression, env *object.Enviroment) object.Object {
+	operator := node.Operator[:1]
+	step := func(current object.Object) object.Object {
+		return e.created(evalInfixExpression(operator, current, &object.Integer{Value: 1}))
+	}
+
+	if name, ok := node.Target.(*ast.Identifier); ok {
+		current, ok := env.Get(name.Value)
+		if !ok {
+			return newError("identifier not found: %s", name.Value)
+		}
+		val := step(current)
+		if isError(val) {
+			return val
+		}
+		env.Assign(name.Value, val)
+		return current
+	}
+
+	target := node.Target.(*ast.IndexExpression)
+	left := e.Eval(target.Left, env)
+	if isError(left) {
+		return left
+	}
+	index := e.Eval(target.Index, env)
+	if isError(index) {
+		return index
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return newError("index operator not supported: %s[%s]", left.Type(), index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return newError("index out of range: %d", i.Value)
+		}
+		current := left.Elements[i.Value]
+		val := step(current)
+		if isError(val) {
+			return val
+		}
+		left.Elements[i.Value] = val
+		return current
+
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		var current object.Object
+		if pair, ok := left.Pairs[key.HashKey()]; ok {
+			current = pair.Value
+		} else if left.Default != nil {
+			if current = e.applyFunction(left.Default, []object.Object{index}); isError(current) {
+				return current
+			}
+		} else {
+			return newError("key not found: %s", index.Inspect())
+		}
+		val := step(current)
+		if isError(val) {
+			return val
+		}
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: val}
+		return current
+
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+// evalLogicalExpression evaluates a && or || expression to a boolean. The
+// right operand is only evaluated when the left one does not decide the
+// result: when it is truthy for &&, falsy for ||.
+func (e *Evaluator) evalLogicalExpression(node *ast.InfixExpression, env *object.Enviroment) object.Object {
+	left := e.Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+	if isTruthy(left) != (node.Operator == "&&") {
+		return nativeBoolToBooleanObject(isTruthy(left))
+	}
+
+	right := e.Eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
 // evalIdentifier evaluates an identifier node in the given environment. It first
 // looks up the identifier in the environment, and if found, returns the
 // associated value. If not found in the environment, it checks if the
 // identifier is a built-in function, and if so, returns the built-in function
 // object. If the identifier is not found in either the environment or the
 // built-ins, it returns an error.
-func evalIdentifier(
+func (e *Evaluator) evalIdentifier(
 	node *ast.Identifier,
 	env *object.Enviroment,
 ) object.Object {
-	if value, ok := env.Get(node.Value); ok {
+	if slot := node.Slot; slot != nil {
+		if value, ok := env.Lookup(slot.Depth, slot.Index, node.Value); ok {
+			return value
+		}
+	} else if value, ok := env.Get(node.Value); ok {
 		return value
 	}
 
 	if builtin, ok := builtins[node.Value]; ok {
+		if reason := e.limits.Unavailable(builtin); reason != "" {
+			return newError("%s is not available: %s", node.Value, reason)
+		}
 		return builtin
 	}
 
@@ -311,6 +822,9 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+	if f, ok := right.(*object.Float); ok {
+		return &object.Float{Value: -f.Value}
+	}
 	if right.Type() != object.INTEGER_OBJ {
 		return newError("unknown operator: -%s", right.Type())
 	}
@@ -319,40 +833,239 @@ func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 	return &object.Integer{Value: -value}
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Enviroment) object.Object {
-	condition := Eval(ie.Condition, env)
+func (e *Evaluator) evalIfExpression(ie *ast.IfExpression, env *object.Enviroment) object.Object {
+	condition := e.Eval(ie.Condition, env)
+	if isError(condition) {
+		return condition
+	}
 
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return e.Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return e.Eval(ie.Alternative, env)
 	} else {
 		return NULL
 	}
 }
 
+// evalSwitchExpression evaluates the body of the first case of se whose
+// value equals the subject as == compares them, trying the cases in order.
+// Without a matching case it evaluates the default case, if any, and to
+// null otherwise.
+func (e *Evaluator) evalSwitchExpression(se *ast.SwitchExpression, env *object.Enviroment) object.Object {
+	subject := e.Eval(se.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, c := range se.Cases {
+		value := e.Eval(c.Value, env)
+		if isError(value) {
+			return value
+		}
+		if evalInfixExpression("==", subject, value) == TRUE {
+			return e.Eval(c.Body, env)
+		}
+	}
+
+	if se.Default != nil {
+		return e.Eval(se.Default, env)
+	}
+	return NULL
+}
+
+// evalWhileExpression evaluates the body of we for as long as its condition
+// is truthy. A return, an error or an exit in the body ends the loop.
+func (e *Evaluator) evalWhileExpression(we *ast.WhileExpression, env *object.Enviroment) object.Object {
+	for {
+		condition := e.Eval(we.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		result := e.Eval(we.Body, env)
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.EXIT_OBJ {
+				return result
+			}
+		}
+	}
+}
+
+// evalForExpression evaluates the body of fe once for each element of the
+// collection its iterable evaluates to, binding the loop variables other
+// than _ like let statements would. A return, an error or an exit in the body ends the
+// loop.
+func (e *Evaluator) evalForExpression(fe *ast.ForExpression, env *object.Enviroment) object.Object {
+	iterable := e.Eval(fe.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+	collection, ok := iterable.(object.Iterable)
+	if !ok {
+		return newError("cannot iterate over %s", iterable.Type())
+	}
+
+	var result object.Object = NULL
+	collection.Iterate(func(key, value object.Object) bool {
+		if fe.Key == nil && iterable.Type() == object.HASH_OBJ {
+			// A single variable ranges over the keys of a hash.
+			value = key
+		}
+		if fe.Key != nil && fe.Key.Value != "_" {
+			bind(env, fe.Key, key)
+		}
+		if fe.Value.Value != "_" {
+			bind(env, fe.Value, value)
+		}
+
+		body := e.Eval(fe.Body, env)
+		if body != nil {
+			rt := body.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.EXIT_OBJ {
+				result = body
+				return false
+			}
+		}
+		return true
+	})
+	return result
+}
+
+// Apply calls fn, a function or builtin object, with args. It lets host code
+// such as the test runner invoke Monkey functions after evaluating a program.
+func Apply(fn object.Object, args []object.Object) object.Object {
+	return New().Apply(fn, args)
+}
+
+// Apply calls fn with args using e's settings.
+func (e *Evaluator) Apply(fn object.Object, args []object.Object) object.Object {
+	return e.applyFunction(fn, args)
+}
+
 // applyFunction applies the given function object to the provided arguments.
 // It creates an extended environment for the function, evaluates the function body,
 // and returns the unwrapped return value.
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func (e *Evaluator) applyFunction(fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		if limit := e.limits.maxDepth(); e.depth >= limit {
+			return newError(depthExceeded+" of %d exceeded", limit)
+		}
+		if len(args) != len(fn.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+		}
+		e.calls++
+		e.depth++
+		e.maxDepth = max(e.maxDepth, e.depth)
+		defer func() { e.depth-- }()
+
+		for {
+			extendedEnv := extendFunctionEnv(fn, args)
+			evaluated := unwrapReturnValue(e.Eval(fn.Body, extendedEnv))
+			call, ok := evaluated.(*tailCall)
+			if !ok {
+				return evaluated
+			}
+			next, ok := call.fn.(*object.Function)
+			if !ok || len(call.args) != len(next.Parameters) {
+				return e.applyTailCall(call)
+			}
+			e.calls++
+			fn, args = next, call.args
+		}
 
 	case *object.Builtin:
-		return fn.Fn(args...)
+		e.calls++
+		if fn == statsBuiltin {
+			return e.statsHash()
+		}
+		if fn == onSignalBuiltin {
+			return e.onSignal(args)
+		}
+		return e.created(fn.Fn(args...))
 
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
+// tailCall is the value of a call in tail position, which the function
+// making it returns for applyFunction to make the call in its place.
+type tailCall struct {
+	node *ast.CallExpression
+	fn   object.Object
+	args []object.Object
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call of " + tc.node.Function.String() }
+
+// applyTailCall applies call, a tail call other than of a function taking
+// its arguments. An error it produces is the call node's, as it would be
+// without tail calls.
+func (e *Evaluator) applyTailCall(call *tailCall) object.Object {
+	result := e.applyFunction(call.fn, call.args)
+	if err, ok := result.(*object.Error); ok && err != e.lastErr {
+		e.lastErr, e.errPos = err, call.node.Pos()
+	}
+	return result
+}
+
+// callCache is what the evaluator caches at a call site whose function is
+// a global or a builtin: the function it found. It remains valid for calls
+// by the same evaluator from the same named scope as long as no environment
+// binds a name, as only that could change what the name refers to there:
+// the slot environments in between never bind the global's name.
+type callCache struct {
+	e          *Evaluator
+	scope      *object.Enviroment
+	generation uint64
+	callee     object.Object
+}
+
+// callee evaluates the function of the call node, or takes it from the
+// call site's cache. A cached function still counts as a step, so limits
+// apply as without the cache; tracing, hooks and inspectors see every
+// node, so they bypass it.
+func (e *Evaluator) callee(node *ast.CallExpression, env *object.Enviroment) object.Object {
+	if node.Cache == nil || e.traceOut != nil || e.hook != nil || e.inspect != nil {
+		return e.Eval(node.Function, env)
+	}
+
+	scope := env.Named()
+	generation := object.Generation()
+	if c, ok := node.Cache.Load().(*callCache); ok && c.e == e && c.scope == scope && c.generation == generation {
+		if err := e.step(); err != nil {
+			return err
+		}
+		return c.callee
+	}
+
+	callee := e.Eval(node.Function, env)
+	if !isError(callee) {
+		node.Cache.Store(&callCache{e: e, scope: scope, generation: generation, callee: callee})
+	}
+	return callee
+}
+
 // extendFunctionEnv creates a new environment that encloses the function's environment
-// and sets the function's parameters to the provided arguments.
+// and sets the function's parameters to the provided arguments. The
+// environment of a resolved function keeps its locals in slots.
 func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Enviroment {
+	if fn.Locals != nil {
+		env := object.NewSlotEnvironment(fn.Env, fn.Locals)
+		for paramIdx, param := range fn.Parameters {
+			env.SetSlot(param.Slot.Index, param.Value, args[paramIdx])
+		}
+		return env
+	}
+
 	env := object.NewEnclosedEnvironment(fn.Env)
 
 	for paramIdx, param := range fn.Parameters {
@@ -376,14 +1089,14 @@ func unwrapReturnValue(obj object.Object) object.Object {
 // and returns a slice of the resulting objects.
 // If any of the expressions result in an error, the function will return
 // a slice containing only the error object.
-func evalExpressions(
+func (e *Evaluator) evalExpressions(
 	exps []ast.Expression,
 	env *object.Enviroment,
 ) []object.Object {
 	var result []object.Object
 
-	for _, e := range exps {
-		evaluated := Eval(e, env)
+	for _, exp := range exps {
+		evaluated := e.Eval(exp, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -396,27 +1109,31 @@ func evalExpressions(
 // evalHashExpression evaluates a hash literal expression in the given environment.
 // It creates a new hash object with key-value pairs based on the expressions in the hash literal.
 // If any of the key or value expressions result in an error, the function will return the error object.
-func evalHashExpression(he *ast.HashLiteral, env *object.Enviroment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
-
-	for keyNode, valueNode := range he.Pairs {
-		key := Eval(keyNode, env)
+func (e *Evaluator) evalHashExpression(he *ast.HashLiteral, env *object.Enviroment) object.Object {
+	// Every key and value is evaluated before any key is hashed, as the
+	// VM does, so both report the same error first.
+	evaluated := make([]object.HashPair, 0, len(he.Keys))
+	for _, keyNode := range he.Keys {
+		key := e.Eval(keyNode, env)
 		if isError(key) {
 			return key
 		}
 
-		hashKey, ok := key.(object.Hashable)
-		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
-		}
-
-		value := Eval(valueNode, env)
+		value := e.Eval(he.Pairs[keyNode], env)
 		if isError(value) {
 			return value
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		evaluated = append(evaluated, object.HashPair{Key: key, Value: value})
+	}
+
+	pairs := make(map[object.HashKey]object.HashPair, len(evaluated))
+	for _, pair := range evaluated {
+		hashKey, ok := pair.Key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", pair.Key.Type())
+		}
+		pairs[hashKey.HashKey()] = pair
 	}
 
 	return &object.Hash{Pairs: pairs}
@@ -447,9 +1164,14 @@ func newError(format string, args ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, args...)}
 }
 
+// isError reports whether obj aborts evaluation. Besides errors this covers
+// the exit signal so that exit() unwinds from inside any expression, and
+// return values so that a return inside an if expression leaves the
+// enclosing function rather than becoming an operand.
 func isError(obj object.Object) bool {
 	if obj != nil {
-		return obj.Type() == object.ERROR_OBJ
+		rt := obj.Type()
+		return rt == object.ERROR_OBJ || rt == object.EXIT_OBJ || rt == object.RETURN_VALUE_OBJ
 	}
 	return false
 }
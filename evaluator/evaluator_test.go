@@ -1,11 +1,26 @@
-package evaluator
+package evaluator_test
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/frankie-mur/monkeylang/evaluator"
 	"github.com/frankie-mur/monkeylang/lexer"
 	"github.com/frankie-mur/monkeylang/object"
 	"github.com/frankie-mur/monkeylang/parser"
+	"github.com/frankie-mur/monkeylang/resolver"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -17,6 +32,7 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"10", 10},
 		{"-5", -5},
 		{"-10", -10},
+		{"1_000_000 / 0x10_00", 244},
 		{"5 + 5 + 5 + 5 - 10", 10},
 		{"2 * 2 * 2 * 2 * 2", 32},
 		{"-50 + 100 + -50", 0},
@@ -31,18 +47,52 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testIntegerObject(t, evaluated, tt.expected)
 	}
 }
 
-func testEval(input string) object.Object {
+// testEval evaluates input and checks that the bytecode VM agrees on the
+// result, so every evaluator test doubles as a conformance test.
+func testEval(t *testing.T, input string) object.Object {
+	t.Helper()
+
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
 	env := object.NewEnvironment()
 
-	return Eval(program, env)
+	evaluated := evaluator.Eval(program, env)
+	checkConformance(t, input, evaluated)
+	return evaluated
+}
+
+// testEvalResolved evaluates input as it is and once resolved, and checks
+// that both give expected: an int or bool for a value of that type, nil for
+// null, or a string that is the result's Inspect or its error message.
+func testEvalResolved(t *testing.T, input string, expected interface{}) {
+	t.Helper()
+
+	for _, resolve := range []bool{false, true} {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		if resolve {
+			resolver.Resolve(program)
+		}
+		evaluated := evaluator.Eval(program, object.NewEnvironment())
+
+		switch expected := expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if evaluated == nil || evaluated.Inspect() != expected && evaluated.Inspect() != "ERROR: "+expected {
+				t.Errorf("%q: wrong result. want=%q, got=%v", input, expected, evaluated)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
 }
 
 func TestEvalBooleanExpression(t *testing.T) {
@@ -72,11 +122,81 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evauluated := testEval(tt.input)
+		evauluated := testEval(t, tt.input)
 		testBooleanObject(t, evauluated, tt.expected)
 	}
 }
 
+func TestFloatExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1.5", "1.5"},
+		{"1.5 + 2", "3.5"},
+		{"7 / 2.0", "3.5"},
+		{"7 / 2", "3"},
+		{"-2.5 * 2", "-5.0"},
+		{"0.1 + 0.2", "0.30000000000000004"},
+		{"let x = 1; x += 0.5; x", "1.5"},
+		{"1 == 1.0", true},
+		{"2.5 > 2", true},
+		{"1.5 != 1.5", false},
+		{"1.0 / 0", "division by zero"},
+		{"1.5 + \"a\"", "type mismatch: FLOAT + STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, expected, errObj.Message)
+				}
+			} else if evaluated.Inspect() != expected {
+				t.Errorf("%q: wrong result. want=%s, got=%s (%T)", tt.input, expected, evaluated.Inspect(), evaluated)
+			}
+		}
+	}
+}
+
+func TestLogicalExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && \"a\"", true},
+		{"if (false) { 1 } || 0", true},
+		{"1 < 2 && 2 < 3 || false", true},
+		{"false && len(1)", false},
+		{"true || len(1)", true},
+		{"true && len(1)", "argument to `len` not supported, got INTEGER"},
+		{"let n = 0; let f = fn() { n = n + 1; true }; false && f(); true || f(); true && f(); n", 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != expected {
+				t.Errorf("%q: wrong result. want error %q, got=%v", tt.input, expected, evaluated)
+			}
+		}
+	}
+}
+
 func TestBangOperator(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -91,7 +211,7 @@ func TestBangOperator(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evalutated := testEval(tt.input)
+		evalutated := testEval(t, tt.input)
 		testBooleanObject(t, evalutated, tt.expected)
 	}
 }
@@ -111,7 +231,30 @@ func TestIfElseExpressions(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestWhileExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"while (false) { 10 }", nil},
+		{"let i = 0; while (i < 5) { let i = i + 1; } i", 5},
+		{"let f = fn(n) { let acc = 1; while (n > 0) { let acc = acc * n; let n = n - 1; } acc }; f(5)", 120},
+		{"let f = fn() { let i = 0; while (true) { let i = i + 1; if (i == 3) { return i * 10; } } }; f()", 30},
+		{"let i = 0; while (i < 3) { let i = i + 1; i }", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
 		integer, ok := tt.expected.(int)
 		if ok {
 			testIntegerObject(t, evaluated, int64(integer))
@@ -121,6 +264,245 @@ func TestIfElseExpressions(t *testing.T) {
 	}
 }
 
+func TestAssignments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; x = 5; x", 5},
+		{"let x = 1; x = x + 1", 2},
+		{"let a = 1; let b = 2; a = b = 3; a + b", 6},
+		{"let x = 1; let f = fn() { x = x + 1; }; f(); f(); x", 3},
+		{"let f = fn(n) { n = n * 2; n }; f(4)", 8},
+		{"let i = 0; while (i < 5) { i = i + 1 }; i", 5},
+		{"x = 5", "identifier not found: x"},
+		{"len = 1", "identifier not found: len"},
+		{"let x = 1; x = y", "identifier not found: y"},
+		{"let x = 10; x += 5; x -= 3; x *= 4; x /= 6; x", 8},
+		{"let s = \"a\"; s += \"bc\"; len(s)", 3},
+		{"let x = 1; x += x += 2; x", 4},
+		{"let f = fn(n) { let acc = 0; let i = 1; while (i < n + 1) { acc += i; i += 1 } acc }; f(10)", 55},
+		{"y += 1", "identifier not found: y"},
+		{"len += 1", "identifier not found: len"},
+		{"let x = true; x += 1", "type mismatch: BOOLEAN + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != expected {
+				t.Errorf("%q: wrong result. want error %q, got=%v", tt.input, expected, evaluated)
+			}
+		}
+	}
+}
+
+func TestPostfixExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; x++", 1},
+		{"let x = 1; x++; x", 2},
+		{"let x = 1; x--; x--; x", -1},
+		{"let x = 5; let y = x-- * 2; x + y", 14},
+		{"let f = fn(n) { let i = 0; let acc = 0; while (i < n) { acc += i++ }; acc }; f(5)", 10},
+		{"let x = 1.5; x++; x", 2.5},
+		{"y++", "identifier not found: y"},
+		{"len++", "identifier not found: len"},
+		{"let s = \"a\"; s++", "type mismatch: STRING + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			f, ok := evaluated.(*object.Float)
+			if !ok || f.Value != expected {
+				t.Errorf("%q: wrong result. want=%g, got=%v", tt.input, expected, evaluated)
+			}
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != expected {
+				t.Errorf("%q: wrong result. want error %q, got=%v", tt.input, expected, evaluated)
+			}
+		}
+	}
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"1 << 4", 16},
+		{"-16 >> 2", -4},
+		{"~5", -6},
+		{"1 << 64", 0},
+		{"-1 >> 64", -1},
+		{"let x = 3; x << 1 | 1", 7},
+		{"1 << -1", "negative shift count: -1"},
+		{"~true", "unknown operator: ~BOOLEAN"},
+		{"~1.5", "unknown operator: ~FLOAT"},
+		{"true & false", "unknown operator: BOOLEAN & BOOLEAN"},
+		{"1 | \"a\"", "type mismatch: INTEGER | STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != expected {
+				t.Errorf("%q: wrong result. want error %q, got=%v", tt.input, expected, evaluated)
+			}
+		}
+	}
+}
+
+func TestPostfixElements(t *testing.T) {
+	// The VM has no instructions that change an element, so only the
+	// evaluator runs these.
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = [1, 2, 3]; a[1]++; a", "[1, 3, 3]"},
+		{"let a = [1, 2, 3]; let b = a; a[0]--; b[0]", 0},
+		{"let a = [5]; a[0]++", 5},
+		{`let h = {"n": 1}; h["n"]++; h["n"]`, 2},
+		{`let counts = default_hash(fn(k) { 0 }); for (w in ["a", "b", "a"]) { counts[w]++ }; counts["a"] * 10 + counts["b"]`, 21},
+		{"let f = fn(xs) { xs[0]++ }; let a = [7]; f(a); a[0]", 8},
+		{"let a = [1]; a[1]++", "index out of range: 1"},
+		{"let a = [1]; a[-1]++", "index out of range: -1"},
+		{`let a = [1]; a["x"]++`, "index operator not supported: ARRAY[STRING]"},
+		{`let h = {}; h["n"]++`, `key not found: "n"`},
+		{`let h = {}; h[[1]]++`, "unusable as hash key: ARRAY"},
+		{`let s = "ab"; s[0]++`, "index operator not supported: STRING"},
+		{`let a = [true]; a[0]++; a`, "type mismatch: BOOLEAN + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		testEvalResolved(t, tt.input, tt.expected)
+	}
+}
+
+func TestSliceExpressions(t *testing.T) {
+	// The VM has no slice instruction, so only the evaluator runs these.
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3, 4][1:3]", "[2, 3]"},
+		{"[1, 2, 3, 4][:2]", "[1, 2]"},
+		{"[1, 2, 3, 4][2:]", "[3, 4]"},
+		{"[1, 2, 3, 4][:]", "[1, 2, 3, 4]"},
+		{"[1, 2, 3, 4][-3:-1]", "[2, 3]"},
+		{"[1, 2, 3, 4][-10:10]", "[1, 2, 3, 4]"},
+		{"[1, 2, 3, 4][3:1]", "[]"},
+		{"[1, 2, 3, 4][5:]", "[]"},
+		{"let a = [1, 2, 3]; let b = a[:]; b[0]++; a[0]", 1},
+		{"let a = [1, 2, 3]; let n = 1; a[n:n + 1][0]", 2},
+		{`"hello"[1:4]`, `"ell"`},
+		{`"hello"[-3:]`, `"llo"`},
+		{`"hello"[9:]`, `""`},
+		{`let s = "abc"; s[:len(s) - 1]`, `"ab"`},
+		{`{"a": 1}[0:1]`, "slice operator not supported: HASH"},
+		{`[1, 2][true:]`, "slice bound must be INTEGER, got BOOLEAN"},
+		{`[1, 2][:"1"]`, "slice bound must be INTEGER, got STRING"},
+		{"[1, 2][x:]", "identifier not found: x"},
+	}
+
+	for _, tt := range tests {
+		testEvalResolved(t, tt.input, tt.expected)
+	}
+}
+
+func TestClosureAssignments(t *testing.T) {
+	// The VM runs these too, but for the for loop, in its TestClosureAssignments.
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"let counter = fn() { let n = 0; fn() { n = n + 1 } }; let c = counter(); c(); c()", 2},
+		{"let counter = fn() { let n = 0; fn() { n = n + 1 } }; let c = counter(); c(); counter()()", 1},
+		{"let f = fn() { let n = 1; let g = fn() { n = 10 }; g(); n }; f()", 10},
+		{"let sum = 0; for (x in [1, 2, 3]) { sum = sum + x }; sum", 6},
+		{"let f = fn() { let x = 1; let g = fn() { let x = 2; x = 3 }; g(); x }; f()", 1},
+		{"let f = fn() { let n = 1; let g = fn() { n }; n = 5; g() }; f()", 5},
+		{"let f = fn() { let n = 1; let g = fn() { n }; let n = 7; g() }; f()", 7},
+		{"let f = fn() { let n = 0; let inc = fn() { n++ }; inc(); inc(); n }; f()", 2},
+		{"let f = fn() { let n = 0; let g = fn() { fn() { n += 5 } }; g()(); n }; f()", 5},
+		{"let f = fn(n) { let add = fn(d) { n = n + d }; add(2); add(3); n }; f(10)", 15},
+		{"let f = fn() { let g = fn() { 1 }; let h = fn() { g() }; g = fn() { 2 }; h() }; f()", 2},
+		{"let f = fn() { let g = fn(n) { if (n > 0) { g(n - 1) } else { 0 } }; let h = g; g = fn(n) { 9 }; h(1) }; f()", 9},
+		{"let fs = fn() { let i = 0; let fs = []; while (i < 3) { let j = i; let fs = push(fs, fn() { j }); i += 1 }; fs }; fs()[0]()", 2},
+	}
+
+	for _, tt := range tests {
+		testEvalResolved(t, tt.input, tt.expected)
+	}
+}
+
+func TestForExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"for (x in []) { 10 }", nil},
+		{"let sum = 0; for (x in [1, 2, 3]) { let sum = sum + x; } sum", 6},
+		{"let sum = 0; for (i, x in [5, 6, 7]) { let sum = sum + i * x; } sum", 20},
+		{`let s = ""; for (k in {"b": 2, "a": 1, "c": 3}) { let s = s + k; } s`, `"abc"`},
+		{`let s = 0; for (k, v in {1: 10, 2: 20}) { let s = s + k * v; } s`, 50},
+		{`let s = ""; for (c in "héllo") { let s = c + s; } s`, `"olléh"`},
+		{`let n = 0; for (i, c in "héllo") { let n = i; } n`, 4},
+		{"for (x in [1, 2]) { x }; x", 2},
+		{"let f = fn(xs) { for (x in xs) { if (x > 2) { return x; } }; -1 }; f([1, 3, 5])", 3},
+		{"let f = fn(xs) { for (x in xs) { if (x > 9) { return x; } }; -1 }; f([1, 3, 5])", -1},
+		{"let f = fn(xs) { let t = 0; for (x in xs) { let t = t + x; } t }; f([1, 2, 3, 4])", 10},
+		{"for (x in 5) { x }", "cannot iterate over INTEGER"},
+		{"for (x in [1, true]) { x + 1 }", "type mismatch: BOOLEAN + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		testEvalResolved(t, tt.input, tt.expected)
+	}
+}
+
+func TestSwitchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`switch (2) { case 1: { "one" } case 2: { "two" } default: { "many" } }`, `"two"`},
+		{`switch (5) { case 1: { "one" } default: { "many" } }`, `"many"`},
+		{`switch (5) { case 1: { "one" } }`, nil},
+		{`switch ("b") { case "a": { 1 } case "b": { 2 } }`, 2},
+		{`switch (1) { case 1.0: { 1 } case true: { 2 } }`, 1},
+		{`switch (true) { case 1: { 1 } case 1 < 2: { 2 } }`, 2},
+		{`let n = 0; let f = fn(x) { n += 1; x }; switch (2) { case f(1): { 0 } case f(2): { 0 } case f(3): { 0 } }; n`, 2},
+		{"let f = fn(x) { switch (x) { case 0: { return 10; } }; 20 }; f(0) + f(1)", 30},
+		{"let count = fn(n, acc) { switch (n) { case 0: { acc } default: { count(n - 1, acc + 1) } } }; count(5000, 0)", 5000},
+		{"switch (len(1)) { default: { 1 } }", "argument to `len` not supported, got INTEGER"},
+		{"switch (1) { case len(1): { 1 } }", "argument to `len` not supported, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		testEvalResolved(t, tt.input, tt.expected)
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -130,10 +512,12 @@ func TestReturnStatements(t *testing.T) {
 		{"return 10; 9;", 10},
 		{"return 2 * 5; 9;", 10},
 		{"9; return 2 * 5; 9;", 10},
+		{"let f = fn() { let x = if (true) { return 1; }; 2 }; f() + 9", 10},
+		{"let f = fn(x) { (if (x) { return 10; }) + 1 }; f(true)", 10},
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testIntegerObject(t, evaluated, tt.expected)
 	}
 
@@ -188,10 +572,15 @@ if (10 > 1) {
 			"unknown operator: BOOLEAN + BOOLEAN",
 		},
 		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
+		{"10 / (5 - 5)", "division by zero"},
+		{"fn(a, b) { a }(1)", "wrong number of arguments: want=2, got=1"},
+		{"fn(a) { a }(1, 2)", "wrong number of arguments: want=1, got=2"},
+		{"if (1 + true) { 1 } else { 2 }", "type mismatch: INTEGER + BOOLEAN"},
+		{"{[1]: 1 + true}", "type mismatch: INTEGER + BOOLEAN"},
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 
 		errObj, ok := evaluated.(*object.Error)
 		if !ok {
@@ -219,7 +608,7 @@ func TestLetStatement(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testIntegerObject(t, evaluated, tt.expected)
 	}
 }
@@ -227,7 +616,7 @@ func TestLetStatement(t *testing.T) {
 func TestFunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; };"
 
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	fn, ok := evaluated.(*object.Function)
 	if !ok {
 		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
@@ -263,14 +652,14 @@ func TestFunctionApplication(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		testIntegerObject(t, testEval(tt.input), tt.expected)
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
 	}
 }
 
 func TestStringObject(t *testing.T) {
 	input := `"Hello World!"`
 	expected := "Hello World!"
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	str, ok := evaluated.(*object.String)
 	if !ok {
 		t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
@@ -284,7 +673,7 @@ func TestStringObject(t *testing.T) {
 func TestStringConcatenation(t *testing.T) {
 	input := `"Hello" + " " + "World!"`
 	expected := "Hello World!"
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	str, ok := evaluated.(*object.String)
 	if !ok {
 		t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
@@ -295,6 +684,48 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"tab\there"`, "tab\there"},
+		{`"line\n" + "\"quoted\""`, "line\n\"quoted\""},
+		{`"back\\slash"`, `back\slash`},
+		{`"caf\u{e9}"`, "café"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok || str.Value != tt.expected {
+			t.Errorf("%s: wrong result. want=%q, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"ab" != "a" + "b"`, false},
+		{`let s = "x"; s + s == "xx"`, true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input), tt.expected)
+	}
+
+	evaluated := testEval(t, `"a" < "b"`)
+	if err, ok := evaluated.(*object.Error); !ok || err.Message != "unknown operator: STRING < STRING" {
+		t.Errorf("wrong result for string <. got=%v", evaluated)
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -317,19 +748,55 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`rest([])`, nil},
 		{`push([], 1)`, []int64{1}},
 		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`assert(1 > 2)`, "assertion failed"},
+		{`assert(false, "math is broken")`, "assertion failed: math is broken"},
+		{`assert_eq(1 + 1, 3)`, "assertion failed: expected 3, got 2"},
+		{`assert_eq([1, [2]], [1, [3]])`, "assertion failed: expected [1, [3]], got [1, [2]]"},
+		{`assert_eq({"a": [1]}, {"a": [2]})`, "assertion failed: expected {\"a\": [2]}, got {\"a\": [1]}"},
+		{`doc(fn(x) { "Doubles x."; x * 2 }) == "Doubles x."`, true},
+		{`doc(fn() { "not a docstring" })`, nil},
+		{`doc(fn() { 1; "not first" })`, nil},
+		{`doc(len) == "Returns the length of a string in bytes or the number of elements of an array."`, true},
+		{`doc(1)`, "argument to `doc` must be FUNCTION, got INTEGER"},
+		{`let b = builder(); b["add"]("n=", 1); b["add_line"](); b["add_line"]("a", [true]); b["build"]() == "n=1
+a[true]
+"`, true},
+		{`let b = builder(); let s = b["build"](); b["add"]("x"); s == ""`, true},
+		{`builder()["build"](1)`, "wrong number of arguments. got=1, want=0"},
+		{`builder(1)`, "wrong number of arguments. got=1, want=0"},
+		{`get({"a": 1}, "a", 0)`, 1},
+		{`get({"a": 1}, "b", 5)`, 5},
+		{`get({}, "a")`, "wrong number of arguments. got=2, want=3"},
+		{`get([1], 0, 1)`, "argument to `get` must be HASH, got ARRAY"},
+		{`get({}, [], 1)`, "unusable as hash key: ARRAY"},
+		{`let h = default_hash(fn(k) { k * 2 }); h[21]`, 42},
+		{`let h = default_hash(fn(k) { k * 2 }, {1: 5}); h[1] + h[2]`, 9},
+		{`let h = default_hash(fn(k) { return 1; 2 }); let f = fn() { h["x"] + 1 }; f()`, 2},
+		{`default_hash(len)["four"]`, 4},
+		{`get(default_hash(fn(k) { 1 }), "a", 0)`, 0},
+		{`default_hash(fn(k) { k + true })[1]`, "type mismatch: INTEGER + BOOLEAN"},
+		{`default_hash(fn(k) { k })[[1]]`, "unusable as hash key: ARRAY"},
+		{`default_hash(1)`, "argument to `default_hash` must be FUNCTION, got INTEGER"},
+		{`default_hash(len, [])`, "argument to `default_hash` must be HASH, got ARRAY"},
+		{`default_hash()`, "wrong number of arguments. got=0, want=1 or 2"},
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 
 		switch expected := tt.expected.(type) {
 		case int:
 			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
 		case string:
 			errObj, ok := evaluated.(*object.Error)
 			if !ok {
 				t.Errorf("object is not Error. got=%T (%+v)",
 					evaluated, evaluated)
+				continue
 			}
 			if errObj.Message != expected {
 				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
@@ -340,7 +807,7 @@ func TestBuiltinFunctions(t *testing.T) {
 
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	result := evaluated.(*object.Array)
 
 	if len(result.Elements) != 3 {
@@ -370,7 +837,7 @@ func TestArrayIndexExpressions(t *testing.T) {
 		{"[1, 2, 3][-1]", nil},
 	}
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		integer, ok := tt.expected.(int)
 		if ok {
 			testIntegerObject(t, evaluated, int64(integer))
@@ -380,9 +847,61 @@ func TestArrayIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestArrayOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2] + [3]", []int64{1, 2, 3}},
+		{"[] + []", []int64{}},
+		{"let a = [1]; let b = a + a; a", []int64{1}},
+		{"[0] * 5", []int64{0, 0, 0, 0, 0}},
+		{"[1, 2] * 2", []int64{1, 2, 1, 2}},
+		{"[1] * 0", []int64{}},
+		{"[] * 1000000000", []int64{}},
+		{"[1] * -1", "negative repeat count: -1"},
+		{"[1, 2] * 100000000", "repeated array too long: 2 elements repeated 100000000 times"},
+		{"[1] + 1", "type mismatch: ARRAY + INTEGER"},
+		{"[1] * [2]", "unknown operator: ARRAY * ARRAY"},
+		{"[1] - [1]", "unknown operator: ARRAY - ARRAY"},
+		{"[1] + [1] == [1, 1]", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case []int64:
+			arr, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("%q: object is not Array. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if len(arr.Elements) != len(expected) {
+				t.Errorf("%q: wrong num of elements. want=%d, got=%d", tt.input, len(expected), len(arr.Elements))
+				continue
+			}
+			for i, want := range expected {
+				testIntegerObject(t, arr.Elements[i], want)
+			}
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
 func TestHashLiterals(t *testing.T) {
 	input := `let two = "two"; { "one": 10 - 9, two: 1 + 1, "thr" + "ee": 6 / 2, 4: 4, true: 5, false: 6 }`
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	result, ok := evaluated.(*object.Hash)
 	if !ok {
 		t.Errorf("object is not Hash. got=%T (%+v)", evaluated, evaluated)
@@ -394,8 +913,8 @@ func TestHashLiterals(t *testing.T) {
 		(&object.String{Value: "two"}).HashKey():   2,
 		(&object.String{Value: "three"}).HashKey(): 3,
 		(&object.Integer{Value: 4}).HashKey():      4,
-		TRUE.HashKey():                             5,
-		FALSE.HashKey():                            6,
+		evaluator.TRUE.HashKey():                   5,
+		evaluator.FALSE.HashKey():                  6,
 	}
 
 	if len(result.Pairs) != len(expected) {
@@ -450,7 +969,7 @@ func TestHashIndexExpressions(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		integer, ok := tt.expected.(int)
 		if ok {
 			testIntegerObject(t, evaluated, int64(integer))
@@ -460,8 +979,55 @@ func TestHashIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestEnums(t *testing.T) {
+	shapes := `enum Shape { Circle(r), Rect(w, h), Empty }
+let area = fn(s) {
+  match (s) {
+    Circle(r) => { 3 * r * r }
+    Rect(w, _) => { let h = s["h"]; w * h }
+    Empty => { 0 }
+  }
+};
+`
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{shapes + "area(Circle(2))", 12},
+		{shapes + "area(Rect(2, 5))", 10},
+		{shapes + "area(Empty)", 0},
+		{shapes + "Rect(1, 2)", "Rect(1, 2)"},
+		{shapes + "Empty", "Empty"},
+		{shapes + `Circle(1)["r"]`, 1},
+		{shapes + "Empty == Empty", true},
+		{shapes + "Circle(1) == Circle(1)", false},
+		{shapes + `assert_eq(Circle(1), Circle(1)); assert_eq([Circle(1)], [Circle(2)])`, "assertion failed: expected [Circle(2)], got [Circle(1)]"},
+		{shapes + "match (Rect(1, 2)) { Circle => { 1 } _ => { 2 } }", 2},
+		{shapes + "match (5) { Circle => { 1 } _ => { 2 } }", 2},
+		{shapes + "let f = fn() { enum Bit { On, Off } match (On) { Off => { 0 } On => { 1 } } }; f()", 1},
+		{shapes + "match (Circle(4)) { Circle(radius) => { radius } }; radius", "identifier not found: radius"},
+		{shapes + "match (Circle(4)) { Circle(r) => { let d = 2 * r; d } }; d", "identifier not found: d"},
+		{shapes + "let r = 1; match (Circle(4)) { Circle(r) => { r } }; r", 1},
+		{shapes + "let r = 1; match (Circle(4)) { Circle(_) => { r = 2 } }; r", 2},
+		{shapes + "let f = fn(x) { fn() { let y = 2; match (Circle(x)) { Circle(r) => { r + x + y } } } }; f(1)()", 4},
+		{shapes + "let g = match (Circle(3)) { Circle(r) => { fn() { r } } }; g()", 3},
+		{"enum A { X } let a = X; enum B { X } match (a) { X => { 1 } _ => { 2 } }", 2},
+		{"enum A { P(v) } let a = P(1); enum B { P(v) } match (a) { P(v) => { v } _ => { 0 } }", 0},
+		{"let f = fn() { enum A { X } X }; match (f()) { X => { 1 } }", "identifier not found: X"},
+		{shapes + "area(Rect(1))", "wrong number of arguments: want=2, got=1"},
+		{shapes + "match (Rect(1, 2)) { Circle(r) => { r } }", "no match arm for Rect(1, 2)"},
+		{shapes + "match (Rect(1, 2)) { Rect(w) => { w } }", "wrong number of fields in pattern Rect: want=2, got=1"},
+		{shapes + `Circle(1)["d"]`, `unknown field "d" of Circle`},
+		{shapes + "Empty[0]", "index operator not supported: VARIANT"},
+	}
+
+	for _, tt := range tests {
+		testEvalResolved(t, tt.input, tt.expected)
+	}
+}
+
 func testNullObject(t *testing.T, obj object.Object) bool {
-	if obj != NULL {
+	if obj != evaluator.NULL {
 		t.Errorf("object is not NULL. got=%T (%v)", obj, obj)
 		return false
 	}
@@ -493,3 +1059,410 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 
 	return true
 }
+
+func TestExitBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"exit()", 0},
+		{"exit(3)", 3},
+		{"exit(2); 10", 2},
+		{"let f = fn() { exit(4); 1 }; f(); 5", 4},
+		{"1 + exit(5)", 5},
+		{"if (true) { exit(6) } else { 1 }", 6},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		exit, ok := evaluated.(*object.Exit)
+		if !ok {
+			t.Errorf("object is not Exit. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if exit.Code != tt.expected {
+			t.Errorf("wrong exit code. expected=%d, got=%d", tt.expected, exit.Code)
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	var out bytes.Buffer
+
+	l := lexer.New("let f = fn(x) { x }; f(2)")
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	e := evaluator.New()
+	e.SetTrace(&out)
+	testIntegerObject(t, e.Eval(program, object.NewEnvironment()), 2)
+
+	expected := `BEGIN Program 1:1 let f = fn(x) x;f(2)
+  BEGIN LetStatement 1:1 let f = fn(x) x;
+    BEGIN FunctionLiteral 1:9 fn(x) x
+    END FunctionLiteral => fn(x) { x }
+  END LetStatement => <nil>
+  BEGIN ExpressionStatement 1:22 f(2)
+    BEGIN CallExpression 1:22 f(2)
+      BEGIN Identifier 1:22 f
+      END Identifier => fn(x) { x }
+      BEGIN IntegerLiteral 1:24 2
+      END IntegerLiteral => 2
+      BEGIN BlockStatement 1:15 x
+        BEGIN ExpressionStatement 1:17 x
+          BEGIN Identifier 1:17 x
+          END Identifier => 2
+        END ExpressionStatement => 2
+      END BlockStatement => 2
+    END CallExpression => 2
+  END ExpressionStatement => 2
+END Program => 2
+`
+	if out.String() != expected {
+		t.Errorf("wrong trace.\nexpected=%s\ngot=%s", expected, out.String())
+	}
+}
+
+func TestLimits(t *testing.T) {
+	countdown := "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } };"
+	sum := "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } };"
+	// Deep expressions in deep calls, which would overflow the Go stack
+	// if only the call depth were bounded.
+	nested := "let f = fn(n) { if (n > 0) { " + strings.Repeat("!", 2000) + "f(n - 1) } else { true } };"
+
+	tests := []struct {
+		input    string
+		limits   evaluator.Limits
+		expected string
+	}{
+		{countdown + "f(10)", evaluator.Limits{MaxSteps: 50}, "step limit exceeded: evaluated more than 50 nodes"},
+		{sum + "f(10)", evaluator.Limits{MaxDepth: 5}, "maximum call depth of 5 exceeded"},
+		{"puts(1)", evaluator.Limits{NoIO: true}, "puts is not available: I/O is disabled"},
+		{sum + "f(10)", evaluator.Limits{MaxSteps: 1000, MaxDepth: 11}, ""},
+		{countdown + "f(10)", evaluator.Limits{MaxDepth: 1}, ""},
+		{"let f = fn() { 1 + f() }; f()", evaluator.Limits{}, "maximum call depth of 10000 exceeded"},
+		{sum + "f(9999)", evaluator.Limits{}, ""},
+		{sum + "f(10)", evaluator.Limits{MaxNesting: 20}, "maximum nesting of 20 exceeded"},
+		{nested + "f(9000)", evaluator.Limits{}, "maximum nesting of 250000 exceeded"},
+		{nested + "f(100)", evaluator.Limits{}, ""},
+		{`let s = "ab"; while (true) { s = s + s }`, evaluator.Limits{MaxAlloc: 1 << 20}, "allocation limit exceeded: created more than 1048576 bytes of values"},
+		{"let a = [1, 2]; a * 100000", evaluator.Limits{MaxAlloc: 1 << 20}, "allocation limit exceeded: created more than 1048576 bytes of values"},
+		{"let a = []; let i = 0; while (i < 100) { a = push(a, i); i += 1 }; a[1:]", evaluator.Limits{MaxAlloc: 1 << 20}, ""},
+		{"len(\"abc\")", evaluator.Limits{NoIO: true}, ""},
+		{"now()", evaluator.Limits{Sandbox: &evaluator.Sandbox{Filesystem: true}}, "now is not available: the time capability is not granted"},
+		{"now()", evaluator.Limits{Sandbox: &evaluator.Sandbox{Time: true}}, ""},
+		{"now()", evaluator.Limits{Sandbox: &evaluator.Sandbox{Time: true}, NoIO: true}, "now is not available: I/O is disabled"},
+		{"len(\"\")", evaluator.Limits{Sandbox: &evaluator.Sandbox{}}, ""},
+		{"gc()", evaluator.Limits{Sandbox: &evaluator.Sandbox{Time: true}}, "gc is not available: the runtime capability is not granted"},
+		{"gc(); runtime_stats()", evaluator.Limits{Sandbox: &evaluator.Sandbox{Runtime: true}, NoIO: true}, ""},
+		{`on_signal("INT", fn() {})`, evaluator.Limits{Sandbox: &evaluator.Sandbox{Runtime: true}}, "on_signal is not available: the signal capability is not granted"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		e := evaluator.New()
+		e.SetLimits(tt.limits)
+		result := e.Eval(program, object.NewEnvironment())
+
+		errObj, isErr := result.(*object.Error)
+		if tt.expected == "" {
+			if isErr {
+				t.Errorf("%q: unexpected error: %s", tt.input, errObj.Message)
+			}
+			continue
+		}
+		if !isErr {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, result, result)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+		if limit := !strings.Contains(tt.expected, "not available"); evaluator.IsLimitError(errObj) != limit {
+			t.Errorf("%q: IsLimitError should be %t", tt.input, limit)
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(100000)", 0},
+		{"let f = fn(n, acc) { if (n == 0) { return acc; } return f(n - 1, acc + n); }; f(100000, 0)", 5000050000},
+		{"let f = fn(g, n) { if (n == 0) { 0 } else { g(g, n - 1) } }; f(f, 100000)", 0},
+		{"let f = fn(n) { if (n == 0) { len([1, 2]) } else { f(n - 1) } }; f(100000)", 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+
+	// Calls that are not in tail position still nest.
+	input := "let f = fn(n) { if (n == 0) { 0 } else { let r = f(n - 1); r } }; f(100000)"
+	evaluated := evaluator.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "maximum call depth of 10000 exceeded" {
+		t.Errorf("expected a call depth error. got=%v", evaluated)
+	}
+}
+
+func TestErrorPos(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1;\nx + true", "2:1"},
+		{"let f = fn(a) {\n  [1][a]\n};\nf(1);\nf(true)", "2:3"},
+		{"len(1, 2)", "1:1"},
+		{"[1, nope]", "1:5"},
+		{"let f = fn() {\n  len(1, 2)\n};\nf()", "2:3"},
+		{"let g = fn(a) { a };\nlet f = fn() {\n  g(1, 2)\n};\nf()", "3:3"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		e := evaluator.New()
+		errObj, ok := e.Eval(program, object.NewEnvironment()).(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned", tt.input)
+			continue
+		}
+		pos, ok := e.ErrorPos(errObj)
+		if !ok || pos.String() != tt.expected {
+			t.Errorf("%q: wrong position. want=%s, got=%s (%t)", tt.input, tt.expected, pos, ok)
+		}
+		if located := e.Located(errObj).Message; located != tt.expected+": "+errObj.Message {
+			t.Errorf("%q: wrong located message %q", tt.input, located)
+		}
+	}
+
+	if _, ok := evaluator.New().ErrorPos(&object.Error{Message: "other"}); ok {
+		t.Errorf("ErrorPos should not know errors the evaluator did not produce")
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	input := `old(1);
+let f = fn(x) { puts(); old(x) };
+f(1);
+f(2);
+puts("ok");`
+	env := object.NewEnvironment()
+	env.Set("old", &object.Builtin{
+		Deprecated: "use len instead",
+		Fn:         func(args ...object.Object) object.Object { return evaluator.NULL },
+	})
+
+	var warnings []string
+	e := evaluator.New()
+	e.SetWarn(func(w evaluator.Warning) { warnings = append(warnings, w.String()) })
+	defer func(w io.Writer) { evaluator.Output = w }(evaluator.Output)
+	evaluator.Output = io.Discard
+	e.Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+
+	expected := []string{
+		"1:1: old is deprecated: use len instead",
+		"2:17: puts without arguments prints nothing",
+		"2:25: old is deprecated: use len instead",
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("wrong warnings.\nwant=%q\ngot= %q", expected, warnings)
+	}
+}
+
+func TestStats(t *testing.T) {
+	input := `let f = fn(n) { if (n == 0) { [] } else { push(f(n - 1), "x") } }; f(3)`
+	program := parser.New(lexer.New(input)).ParseProgram()
+	e := evaluator.New()
+	e.Eval(program, object.NewEnvironment())
+
+	stats := e.Stats()
+	if stats.Calls != 7 || stats.MaxDepth != 4 {
+		t.Errorf("wrong calls or depth. want=7, 4, got=%d, %d", stats.Calls, stats.MaxDepth)
+	}
+	// 3, then per call 0, and in the three calls recursing 1, n - 1 and
+	// the array push returns. The value of "x" is shared by the calls.
+	want := map[object.ObjectType]int64{"FUNCTION": 1, "INTEGER": 11, "ARRAY": 4, "STRING": 1}
+	if !reflect.DeepEqual(stats.Allocs, want) {
+		t.Errorf("wrong allocs. want=%v, got=%v", want, stats.Allocs)
+	}
+	if stats.Steps != e.Stats().Steps || stats.Steps == 0 {
+		t.Errorf("wrong steps. got=%d", stats.Steps)
+	}
+
+	result := e.Eval(parser.New(lexer.New(`let s = stats(); [s["calls"], s["max_depth"], s["allocs"]["FUNCTION"]]`)).ParseProgram(), object.NewEnvironment())
+	if result == nil || result.Inspect() != "[8, 4, 1]" {
+		t.Errorf("wrong stats(). got=%v", result)
+	}
+
+	// The value of "x" is not kept for later programs.
+	before := e.Stats().Allocs["STRING"]
+	e.Eval(program, object.NewEnvironment())
+	if got := e.Stats().Allocs["STRING"] - before; got != 1 {
+		t.Errorf("wrong string allocs of a second run. want=1, got=%d", got)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	var out bytes.Buffer
+	defer func(w io.Writer) { evaluator.Output = w }(evaluator.Output)
+	evaluator.Output = &out
+
+	program := parser.New(lexer.New(`puts(1, "two"); puts([3]);`)).ParseProgram()
+	evaluator.Eval(program, object.NewEnvironment())
+	if out.String() != "1\n\"two\"\n[3]\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
+
+func TestSystemBuiltins(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.txt")
+	t.Setenv("MONKEY_TEST_VAR", "set")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/hello" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, "hello")
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{fmt.Sprintf("write_file(%q, \"abc\"); read_file(%[1]q)", path), "abc"},
+		{fmt.Sprintf("read_file(%q)", filepath.Join(dir, "nope")), &object.Error{Message: "open " + filepath.Join(dir, "nope") + ": no such file or directory"}},
+		{"read_file(1)", &object.Error{Message: "argument to `read_file` must be STRING, got INTEGER"}},
+		{`getenv("MONKEY_TEST_VAR")`, "set"},
+		{`getenv("MONKEY_TEST_UNSET")`, nil},
+		{fmt.Sprintf("http_get(%q)", server.URL+"/hello"), "hello"},
+		{fmt.Sprintf("http_get(%q)", server.URL+"/nope"), &object.Error{Message: "GET " + server.URL + "/nope: 404 Not Found"}},
+		{`exec("go", "env", "GOOS")`, runtime.GOOS + "\n"},
+		{"now() > 1600000000000", true},
+		{`gc(); runtime_stats()["num_gc"] > 0`, true},
+		{`runtime_stats()["goroutines"] > 0`, true},
+		{"gc(1)", &object.Error{Message: "wrong number of arguments. got=1, want=0"}},
+		{"exec()", &object.Error{Message: "wrong number of arguments. got=0, want at least 1"}},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%q: wrong result. want=%q, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		case *object.Error:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != expected.Message {
+				t.Errorf("%q: wrong error. want=%q, got=%s", tt.input, expected.Message, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestOnSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("processes cannot signal themselves on Windows")
+	}
+	env := object.NewEnvironment()
+	env.Set("raise", &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		process, err := os.FindProcess(os.Getpid())
+		if err == nil {
+			err = process.Signal(syscall.SIGTERM)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return evaluator.NULL
+	}})
+	// The signal arrives asynchronously, so the program waits for it.
+	env.Set("pause", &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		time.Sleep(time.Millisecond)
+		return evaluator.NULL
+	}})
+
+	input := `let handled = fn() { exit(3) };
+on_signal("SIGTERM", handled);
+raise();
+let wait = fn(n) { if (n > 0) { pause(); wait(n - 1) } };
+wait(5000);`
+	result := evaluator.Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	exit, ok := result.(*object.Exit)
+	if !ok || exit.Code != 3 {
+		t.Fatalf("the handler did not exit the program. got=%T (%+v)", result, result)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`on_signal("WINCH", fn() {})`, `unknown signal "WINCH"`},
+		{`on_signal(2, fn() {})`, "argument to `on_signal` must be STRING, got INTEGER"},
+		{`on_signal("INT", 1)`, "argument to `on_signal` must be FUNCTION, got INTEGER"},
+		{`on_signal("INT")`, "wrong number of arguments. got=1, want=2"},
+	}
+	for _, tt := range tests {
+		errObj, ok := evaluator.Eval(parser.New(lexer.New(tt.input)).ParseProgram(), object.NewEnvironment()).(*object.Error)
+		if !ok || errObj.Message != tt.expected {
+			t.Errorf("%q: wrong result. want error %q, got=%+v", tt.input, tt.expected, errObj)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	evaluator.Register("triple", &object.Builtin{
+		Params: []string{"n"},
+		Doc:    "Returns n times 3.",
+		Fn: func(args ...object.Object) object.Object {
+			return &object.Integer{Value: 3 * args[0].(*object.Integer).Value}
+		},
+	})
+	testIntegerObject(t, testEval(t, "let f = fn(x) { triple(x) + 1 }; f(2)"), 7)
+
+	noop := &object.Builtin{Fn: func(args ...object.Object) object.Object { return evaluator.NULL }}
+	tests := []struct {
+		name     string
+		builtin  *object.Builtin
+		expected string
+	}{
+		{"triple", noop, "builtin triple is already registered"},
+		{"len", noop, "builtin len is already registered"},
+		{"fn", noop, "invalid builtin name \"fn\""},
+		{"two words", noop, "invalid builtin name \"two words\""},
+		{"empty", &object.Builtin{}, "builtin empty has no function"},
+	}
+	for _, tt := range tests {
+		err := evaluator.DefaultRegistry.Register(tt.name, tt.builtin)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("Register(%q): wrong error. want=%q, got=%v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestContextTimeout(t *testing.T) {
+	input := "let loop = fn(n) { loop(n + 1) }; loop(0)"
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	e := evaluator.New()
+	e.SetContext(ctx)
+	// Bound the depth so the runaway recursion ends before the stack does
+	// if the timeout were ignored.
+	e.SetLimits(evaluator.Limits{MaxDepth: 1e6})
+
+	errObj, ok := e.Eval(program, object.NewEnvironment()).(*object.Error)
+	if !ok || errObj.Message != "timeout exceeded" {
+		t.Errorf("expected timeout error. got=%v", errObj)
+	}
+}
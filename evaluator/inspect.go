@@ -0,0 +1,34 @@
+package evaluator
+
+import (
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// Call is a call in progress, as an inspector sees it: where it was made,
+// what it calls and the environment of the caller at that point.
+type Call struct {
+	Pos      token.Position
+	Function string // the source of the called expression, such as "fib"
+	Env      *object.Enviroment
+}
+
+// SetInspector makes e call inspect with every node before evaluating it,
+// along with the environment the node is evaluated in and the calls in
+// progress, outermost first. Unlike a hook, an inspector can look at the
+// program's bindings and block to pause it; the calls must not be kept
+// after inspect returns. A nil inspect removes it.
+func (e *Evaluator) SetInspector(inspect func(node ast.Node, env *object.Enviroment, calls []Call)) {
+	e.inspect = inspect
+	e.inspectCalls = nil
+}
+
+// inspectedCall applies fn to args for the call node in env, recording the
+// call for the inspector while it is in progress.
+func (e *Evaluator) inspectedCall(node *ast.CallExpression, env *object.Enviroment, fn object.Object, args []object.Object) object.Object {
+	e.inspectCalls = append(e.inspectCalls, Call{Pos: node.Pos(), Function: node.Function.String(), Env: env})
+	result := e.applyFunction(fn, args)
+	e.inspectCalls = e.inspectCalls[:len(e.inspectCalls)-1]
+	return result
+}
@@ -0,0 +1,270 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/frankie-mur/monkeylang/object"
+)
+
+// Limits bound the work an evaluation may do, so untrusted or buggy
+// programs cannot run forever or exhaust memory. Zero fields mean no limit,
+// except MaxDepth.
+type Limits struct {
+	// MaxSteps is the number of AST nodes an Evaluator may evaluate.
+	MaxSteps int64
+	// MaxDepth is the number of nested function calls allowed. Zero means
+	// DefaultMaxDepth, as calls nest on the Go stack, which running out of
+	// would crash the process.
+	MaxDepth int
+	// MaxNesting is the number of syntax nodes whose evaluation may be in
+	// progress at once, counting those of every call in progress. Zero
+	// means DefaultMaxNesting. Nodes are evaluated on the Go stack, so
+	// this bounds the stack deep expressions in deep calls can use.
+	MaxNesting int
+	// MaxAlloc is the number of bytes the strings, arrays and hashes an
+	// evaluation creates may take up. They are counted as they are
+	// created, so values the program has since dropped still count.
+	MaxAlloc int64
+	// NoIO disables the builtins that perform input or output.
+	NoIO bool
+	// Sandbox, if not nil, disables the builtins of the capabilities it
+	// does not grant.
+	Sandbox *Sandbox
+}
+
+// DefaultMaxDepth is the depth of nested function calls allowed when
+// Limits.MaxDepth is zero.
+const DefaultMaxDepth = 10000
+
+// maxDepth returns the number of nested function calls l allows.
+func (l Limits) maxDepth() int {
+	if l.MaxDepth <= 0 {
+		return DefaultMaxDepth
+	}
+	return l.MaxDepth
+}
+
+// DefaultMaxNesting is the nesting of node evaluations allowed when
+// Limits.MaxNesting is zero. The evaluation of a node takes up to about a
+// kilobyte of Go stack, so it stays well below the Go stack's limit.
+const DefaultMaxNesting = 250_000
+
+// maxNesting returns the nesting of node evaluations l allows.
+func (l Limits) maxNesting() int {
+	if l.MaxNesting <= 0 {
+		return DefaultMaxNesting
+	}
+	return l.MaxNesting
+}
+
+// Sandbox grants an evaluation the capabilities of the outside world its
+// program may use. Builtins that need a capability it does not grant are
+// unavailable; builtins without one, such as puts, are unaffected.
+type Sandbox struct {
+	Filesystem  bool // read_file, write_file
+	Network     bool // http_get
+	Process     bool // exec
+	Environment bool // getenv
+	Time        bool // now
+	Runtime     bool // runtime_stats, gc
+	Signal      bool // on_signal
+}
+
+// Grants reports whether s grants the capability c. A nil Sandbox grants
+// every capability.
+func (s *Sandbox) Grants(c object.Capability) bool {
+	if s == nil {
+		return true
+	}
+	switch c {
+	case object.CapFilesystem:
+		return s.Filesystem
+	case object.CapNetwork:
+		return s.Network
+	case object.CapProcess:
+		return s.Process
+	case object.CapEnvironment:
+		return s.Environment
+	case object.CapTime:
+		return s.Time
+	case object.CapRuntime:
+		return s.Runtime
+	case object.CapSignal:
+		return s.Signal
+	}
+	return c == ""
+}
+
+// Grant grants the capability c, failing for capabilities s does not know.
+func (s *Sandbox) Grant(c object.Capability) error {
+	switch c {
+	case object.CapFilesystem:
+		s.Filesystem = true
+	case object.CapNetwork:
+		s.Network = true
+	case object.CapProcess:
+		s.Process = true
+	case object.CapEnvironment:
+		s.Environment = true
+	case object.CapTime:
+		s.Time = true
+	case object.CapRuntime:
+		s.Runtime = true
+	case object.CapSignal:
+		s.Signal = true
+	default:
+		return fmt.Errorf("unknown capability %q", c)
+	}
+	return nil
+}
+
+// Unavailable returns the reason the builtin b may not be called under l,
+// or "" if it may.
+func (l Limits) Unavailable(b *object.Builtin) string {
+	switch {
+	case b.IO && l.NoIO:
+		return "I/O is disabled"
+	case !l.Sandbox.Grants(b.Capability):
+		return fmt.Sprintf("the %s capability is not granted", b.Capability)
+	}
+	return ""
+}
+
+// The messages of the errors that stop an evaluation for exceeding a limit
+// start with one of these.
+const (
+	stepsExceeded   = "step limit exceeded"
+	depthExceeded   = "maximum call depth"
+	nestingExceeded = "maximum nesting"
+	allocExceeded   = "allocation limit exceeded"
+	timeoutExceeded = "timeout exceeded"
+	canceled        = "evaluation canceled"
+)
+
+// IsLimitError reports whether err stopped an evaluation for exceeding one
+// of its limits or for its context being done, rather than for an error
+// in the program.
+func IsLimitError(err *object.Error) bool {
+	for _, prefix := range []string{stepsExceeded, depthExceeded, nestingExceeded, allocExceeded, timeoutExceeded, canceled} {
+		if strings.HasPrefix(err.Message, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkContextEvery is how many steps pass between checks of the
+// evaluator's context, which is cheap but not free.
+const checkContextEvery = 1024
+
+// SetLimits sets the limits of e. Steps are counted across all Eval calls
+// on e.
+func (e *Evaluator) SetLimits(limits Limits) {
+	e.limits = limits
+}
+
+// Limits returns the limits of e.
+func (e *Evaluator) Limits() Limits {
+	return e.limits
+}
+
+// SetContext makes evaluation stop with an error once ctx is done, which
+// is how timeouts and cancellation are implemented.
+func (e *Evaluator) SetContext(ctx context.Context) {
+	e.ctx = ctx
+}
+
+// step accounts for evaluating one node and runs the handler of a signal
+// received meanwhile. It returns an error object once a limit is exceeded
+// or the context is done, or the error or exit of a signal handler.
+func (e *Evaluator) step() object.Object {
+	if e.steps == 0 {
+		e.heapStart = readHeapAllocs()
+	}
+	e.steps++
+	if e.limits.MaxSteps > 0 && e.steps > e.limits.MaxSteps {
+		return newError(stepsExceeded+": evaluated more than %d nodes", e.limits.MaxSteps)
+	}
+
+	if e.ctx != nil && e.steps%checkContextEvery == 0 {
+		if err := e.ctx.Err(); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return newError(timeoutExceeded)
+			}
+			return newError(canceled)
+		}
+	}
+
+	if e.signals != nil {
+		return e.handleSignal()
+	}
+	return nil
+}
+
+// The sizes valueSize counts for an element of an array and a pair of a
+// hash, roughly what they take up in memory.
+const (
+	elementSize = 16
+	pairSize    = 64
+)
+
+// valueSize returns the bytes obj counts for against Limits.MaxAlloc. Only
+// strings, arrays and hashes count, as only they can grow without bound.
+func valueSize(obj object.Object) int64 {
+	switch obj := obj.(type) {
+	case *object.String:
+		return int64(len(obj.Value))
+	case *object.Array:
+		return int64(len(obj.Elements)) * elementSize
+	case *object.Hash:
+		return int64(len(obj.Pairs)) * pairSize
+	}
+	return 0
+}
+
+// infixSize returns the bytes the value of left operator right counts for
+// if it is a new string or array, before it is built.
+func infixSize(operator string, left, right object.Object) int64 {
+	switch left := left.(type) {
+	case *object.String:
+		if right, ok := right.(*object.String); ok && operator == "+" {
+			return int64(len(left.Value) + len(right.Value))
+		}
+	case *object.Array:
+		switch right := right.(type) {
+		case *object.Array:
+			if operator == "+" {
+				return int64(len(left.Elements)+len(right.Elements)) * elementSize
+			}
+		case *object.Integer:
+			n := int64(len(left.Elements))
+			if operator == "*" && n != 0 && right.Value > 0 {
+				if right.Value > object.MaxArrayLen/n {
+					// Repeat fails for it anyway.
+					return 0
+				}
+				return n * right.Value * elementSize
+			}
+		}
+	}
+	return 0
+}
+
+// allocate accounts for obj, a value e created, failing once the values
+// created exceed the allocation limit.
+func (e *Evaluator) allocate(obj object.Object) object.Object {
+	e.allocated += valueSize(obj)
+	return e.checkAlloc(0)
+}
+
+// checkAlloc fails if creating size more bytes of values would exceed the
+// allocation limit.
+func (e *Evaluator) checkAlloc(size int64) object.Object {
+	if max := e.limits.MaxAlloc; max > 0 && e.allocated+size > max {
+		return newError(allocExceeded+": created more than %d bytes of values", max)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// Registry adds builtin functions to the language. Plugins, shared objects
+// built with `go build -buildmode=plugin`, hand their builtins to a
+// Registry from the function they export as
+//
+//	func Register(r evaluator.Registry) error
+type Registry interface {
+	Register(name string, builtin *object.Builtin) error
+}
+
+// DefaultRegistry adds builtins to the ones every evaluation, compiler and
+// VM of the process know.
+var DefaultRegistry Registry = defaultRegistry{}
+
+type defaultRegistry struct{}
+
+// Register fails if name cannot be used as an identifier or already names
+// a builtin.
+func (defaultRegistry) Register(name string, builtin *object.Builtin) error {
+	if !isIdentifier(name) {
+		return fmt.Errorf("invalid builtin name %q", name)
+	}
+	if builtin == nil || builtin.Fn == nil {
+		return fmt.Errorf("builtin %s has no function", name)
+	}
+	if _, ok := builtins[name]; ok {
+		return fmt.Errorf("builtin %s is already registered", name)
+	}
+	builtins[name] = builtin
+	builtinList = listBuiltins()
+	return nil
+}
+
+// Register adds builtin under name to the builtins every evaluation,
+// compiler and VM know. Packages of builtins call it from an init function
+// so programs get them by importing the package for its side effects, like
+// database/sql drivers:
+//
+//	import _ "example.com/monkeystrings"
+//
+// Builtins must be registered before programs are compiled or run, and
+// bytecode compiled with other builtins than the running process has does
+// not run correctly. Register panics if DefaultRegistry would fail.
+func Register(name string, builtin *object.Builtin) {
+	if err := DefaultRegistry.Register(name, builtin); err != nil {
+		panic("evaluator: " + err.Error())
+	}
+}
+
+// isIdentifier reports whether the lexer reads name as one identifier.
+func isIdentifier(name string) bool {
+	if name == "" || token.LookupIdent(name) != token.IDENT {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		ch := name[i]
+		if !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// builtinList holds Builtins, updated by every registration.
+var builtinList = listBuiltins()
+
+// Builtins returns the builtin functions in the order of BuiltinNames,
+// which is how the compiler and VM index them. The slice must not be
+// modified.
+func Builtins() []*object.Builtin {
+	return builtinList
+}
+
+func listBuiltins() []*object.Builtin {
+	var list []*object.Builtin
+	for _, name := range BuiltinNames() {
+		list = append(list, builtins[name])
+	}
+	return list
+}
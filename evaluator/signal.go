@@ -0,0 +1,87 @@
+package evaluator
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/frankie-mur/monkeylang/object"
+)
+
+// signals are the signals programs may handle, by the names on_signal
+// takes. Unix systems add more.
+var signals = map[string]os.Signal{
+	"INT":  os.Interrupt,
+	"TERM": syscall.SIGTERM,
+}
+
+// onSignalBuiltin is applied by the evaluator itself, which runs the
+// handlers between the steps of its evaluation. The VM has no such hook.
+var onSignalBuiltin = &object.Builtin{
+	Params:     []string{"name", "handler"},
+	Doc:        `Calls handler, a function without parameters, when the process receives the signal name, "INT", "TERM" or, on Unix, "HUP", "USR1" or "USR2", while the program runs, instead of the signal's default action. A handler can stop the program gracefully by calling exit. Returns null.`,
+	Capability: object.CapSignal,
+	Fn: func(args ...object.Object) object.Object {
+		return newError("on_signal is not supported by the vm engine")
+	},
+}
+
+// onSignal registers the handler of a signal for on_signal(args...).
+func (e *Evaluator) onSignal(args []object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	name, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `on_signal` must be STRING, got %s", args[0].Type())
+	}
+	sig, ok := signals[strings.TrimPrefix(name.Value, "SIG")]
+	if !ok {
+		return newError("unknown signal %q", name.Value)
+	}
+	if _, _, ok := Describe(args[1]); !ok {
+		return newError("argument to `on_signal` must be FUNCTION, got %s", args[1].Type())
+	}
+
+	if e.signals == nil {
+		e.signals = make(chan os.Signal, 1)
+		e.handlers = make(map[os.Signal]object.Object)
+	}
+	e.handlers[sig] = args[1]
+	signal.Notify(e.signals, sig)
+	return NULL
+}
+
+// handleSignal runs the handler of a signal received since the last step,
+// if there is one. It returns the error or exit that stops the program, if
+// the handler produced one.
+func (e *Evaluator) handleSignal() object.Object {
+	var sig os.Signal
+	select {
+	case sig = <-e.signals:
+	default:
+		return nil
+	}
+
+	// Steps of the handler itself do not run handlers, so it is not
+	// interrupted by a signal arriving again.
+	signals := e.signals
+	e.signals = nil
+	defer func() { e.signals = signals }()
+
+	switch result := e.applyFunction(e.handlers[sig], nil).(type) {
+	case *object.Error, *object.Exit:
+		return result
+	}
+	return nil
+}
+
+// stopSignals restores the default actions of the signals the program
+// handles, once it has finished.
+func (e *Evaluator) stopSignals() {
+	if e.signals != nil {
+		signal.Stop(e.signals)
+		e.signals, e.handlers = nil, nil
+	}
+}
@@ -0,0 +1,11 @@
+//go:build unix
+
+package evaluator
+
+import "syscall"
+
+func init() {
+	signals["HUP"] = syscall.SIGHUP
+	signals["USR1"] = syscall.SIGUSR1
+	signals["USR2"] = syscall.SIGUSR2
+}
@@ -0,0 +1,106 @@
+package evaluator
+
+import (
+	"runtime/metrics"
+
+	"github.com/frankie-mur/monkeylang/object"
+)
+
+// Stats are counters of the work an Evaluator has done, across all Eval
+// and Apply calls on it.
+type Stats struct {
+	// Steps is the number of syntax tree nodes evaluated.
+	Steps int64
+	// Calls is the number of calls of functions and builtins.
+	Calls int64
+	// MaxDepth is the deepest nesting of function calls reached.
+	MaxDepth int
+	// Allocs counts the values created by literals and operators and
+	// returned by builtins, by type. The shared booleans and null are not
+	// counted.
+	Allocs map[object.ObjectType]int64
+	// HeapBytes is the number of bytes the Go runtime allocated on the
+	// heap since the evaluation started. It covers the whole process, so
+	// it includes the allocations of concurrent goroutines, and as the
+	// runtime only accounts for memory in blocks it is coarse for short
+	// evaluations.
+	HeapBytes uint64
+}
+
+// heapAllocs is the runtime metric behind Stats.HeapBytes. Unlike
+// runtime.ReadMemStats, reading it does not stop the world.
+const heapAllocs = "/gc/heap/allocs:bytes"
+
+func readHeapAllocs() uint64 {
+	sample := []metrics.Sample{{Name: heapAllocs}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// Stats returns the counters of e's work so far.
+func (e *Evaluator) Stats() Stats {
+	stats := Stats{
+		Steps:    e.steps,
+		Calls:    e.calls,
+		MaxDepth: e.maxDepth,
+		Allocs:   make(map[object.ObjectType]int64, len(e.allocs)),
+	}
+	for t, n := range e.allocs {
+		stats.Allocs[t] = n
+	}
+	if e.steps > 0 {
+		stats.HeapBytes = readHeapAllocs() - e.heapStart
+	}
+	return stats
+}
+
+// created counts obj as a value e has created and returns it, or the error
+// of exceeding the allocation limit with it.
+func (e *Evaluator) created(obj object.Object) object.Object {
+	if obj == nil || obj == TRUE || obj == FALSE || obj == NULL {
+		return obj
+	}
+	if e.allocs == nil {
+		e.allocs = make(map[object.ObjectType]int64)
+	}
+	e.allocs[obj.Type()]++
+	if err := e.allocate(obj); err != nil {
+		return err
+	}
+	return obj
+}
+
+// statsBuiltin is applied by the evaluator itself, as its result depends
+// on the evaluation calling it. The VM keeps no such counters.
+var statsBuiltin = &object.Builtin{
+	Params: []string{},
+	Doc:    `Returns counters of the evaluation so far as a hash with the keys "steps", "calls", "max_depth", "heap_bytes" and "allocs", a hash of the number of values created by type.`,
+	Fn: func(args ...object.Object) object.Object {
+		return newError("stats is not supported by the vm engine")
+	},
+}
+
+// statsHash returns e's stats as the hash stats() returns.
+func (e *Evaluator) statsHash() object.Object {
+	stats := e.Stats()
+	allocs := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair)}
+	for t, n := range stats.Allocs {
+		setField(allocs, string(t), &object.Integer{Value: n})
+	}
+
+	hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair)}
+	setField(hash, "steps", &object.Integer{Value: stats.Steps})
+	setField(hash, "calls", &object.Integer{Value: stats.Calls})
+	setField(hash, "max_depth", &object.Integer{Value: int64(stats.MaxDepth)})
+	setField(hash, "heap_bytes", &object.Integer{Value: int64(stats.HeapBytes)})
+	setField(hash, "allocs", allocs)
+	return hash
+}
+
+func setField(hash *object.Hash, name string, value object.Object) {
+	key := &object.String{Value: name}
+	hash.Pairs[key.HashKey()] = object.HashPair{Key: key, Value: value}
+}
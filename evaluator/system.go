@@ -0,0 +1,194 @@
+package evaluator
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/frankie-mur/monkeylang/object"
+)
+
+// httpClient makes the requests of http_get. Its timeout keeps a server
+// that never answers from hanging a program, which a limit on steps would
+// not notice.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+func init() {
+	for name, b := range systemBuiltins {
+		Register(name, b)
+	}
+}
+
+// systemBuiltins reach the outside world, each needing the capability of
+// its group.
+var systemBuiltins = map[string]*object.Builtin{
+	"read_file": {
+		Params:     []string{"path"},
+		Doc:        "Returns the contents of the file at path.",
+		IO:         true,
+		Capability: object.CapFilesystem,
+		Fn: func(args ...object.Object) object.Object {
+			strs, err := stringArgs("read_file", args, 1)
+			if err != nil {
+				return err
+			}
+			data, readErr := os.ReadFile(strs[0])
+			if readErr != nil {
+				return newError("%s", readErr)
+			}
+			return &object.String{Value: string(data)}
+		},
+	},
+	"write_file": {
+		Params:     []string{"path", "contents"},
+		Doc:        "Writes contents to the file at path, replacing the file if it exists, and returns null.",
+		IO:         true,
+		Capability: object.CapFilesystem,
+		Fn: func(args ...object.Object) object.Object {
+			strs, err := stringArgs("write_file", args, 2)
+			if err != nil {
+				return err
+			}
+			if writeErr := os.WriteFile(strs[0], []byte(strs[1]), 0o644); writeErr != nil {
+				return newError("%s", writeErr)
+			}
+			return NULL
+		},
+	},
+	"http_get": {
+		Params:     []string{"url"},
+		Doc:        "Fetches url and returns the body of the response. Responses with a status other than 2xx are errors.",
+		IO:         true,
+		Capability: object.CapNetwork,
+		Fn: func(args ...object.Object) object.Object {
+			strs, err := stringArgs("http_get", args, 1)
+			if err != nil {
+				return err
+			}
+			resp, getErr := httpClient.Get(strs[0])
+			if getErr != nil {
+				return newError("%s", getErr)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				return newError("GET %s: %s", strs[0], resp.Status)
+			}
+			body, readErr := io.ReadAll(resp.Body)
+			if readErr != nil {
+				return newError("GET %s: %s", strs[0], readErr)
+			}
+			return &object.String{Value: string(body)}
+		},
+	},
+	"exec": {
+		Params:     []string{"command", "args..."},
+		Doc:        "Runs command with args and returns its standard output. A command that fails is an error that includes its standard error.",
+		IO:         true,
+		Capability: object.CapProcess,
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) == 0 {
+				return newError("wrong number of arguments. got=0, want at least 1")
+			}
+			strs, err := stringArgs("exec", args, len(args))
+			if err != nil {
+				return err
+			}
+			var stderr bytes.Buffer
+			cmd := exec.Command(strs[0], strs[1:]...)
+			cmd.Stderr = &stderr
+			out, runErr := cmd.Output()
+			if runErr != nil {
+				if msg := strings.TrimSpace(stderr.String()); msg != "" {
+					return newError("%s: %s: %s", strs[0], runErr, msg)
+				}
+				return newError("%s: %s", strs[0], runErr)
+			}
+			return &object.String{Value: string(out)}
+		},
+	},
+	"getenv": {
+		Params:     []string{"name"},
+		Doc:        "Returns the value of the environment variable name, or null if it is not set.",
+		IO:         true,
+		Capability: object.CapEnvironment,
+		Fn: func(args ...object.Object) object.Object {
+			strs, err := stringArgs("getenv", args, 1)
+			if err != nil {
+				return err
+			}
+			value, ok := os.LookupEnv(strs[0])
+			if !ok {
+				return NULL
+			}
+			return &object.String{Value: value}
+		},
+	},
+	"now": {
+		Params:     []string{},
+		Doc:        "Returns the current time as the number of milliseconds since January 1, 1970 UTC.",
+		IO:         true,
+		Capability: object.CapTime,
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0", len(args))
+			}
+			return &object.Integer{Value: time.Now().UnixMilli()}
+		},
+	},
+	"runtime_stats": {
+		Params:     []string{},
+		Doc:        `Returns statistics of the Go runtime running the program as a hash: "heap_alloc", the bytes of live and not yet collected heap objects, "heap_objects", their number, "total_alloc", the bytes allocated in total, "sys", the bytes obtained from the system, "num_gc", the number of garbage collections, "gc_pause_ns", the total time they stopped the program, and "goroutines".`,
+		Capability: object.CapRuntime,
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0", len(args))
+			}
+			var m runtime.MemStats
+			runtime.ReadMemStats(&m)
+
+			hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair)}
+			setField(hash, "heap_alloc", &object.Integer{Value: int64(m.HeapAlloc)})
+			setField(hash, "heap_objects", &object.Integer{Value: int64(m.HeapObjects)})
+			setField(hash, "total_alloc", &object.Integer{Value: int64(m.TotalAlloc)})
+			setField(hash, "sys", &object.Integer{Value: int64(m.Sys)})
+			setField(hash, "num_gc", &object.Integer{Value: int64(m.NumGC)})
+			setField(hash, "gc_pause_ns", &object.Integer{Value: int64(m.PauseTotalNs)})
+			setField(hash, "goroutines", &object.Integer{Value: int64(runtime.NumGoroutine())})
+			return hash
+		},
+	},
+	"gc": {
+		Params:     []string{},
+		Doc:        "Runs a garbage collection, blocking until it is done, so that runtime_stats reports only live memory. Returns null.",
+		Capability: object.CapRuntime,
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0", len(args))
+			}
+			runtime.GC()
+			return NULL
+		},
+	},
+}
+
+// stringArgs checks that the builtin name got want arguments, all strings,
+// and returns them.
+func stringArgs(name string, args []object.Object, want int) ([]string, *object.Error) {
+	if len(args) != want {
+		return nil, newError("wrong number of arguments. got=%d, want=%d", len(args), want)
+	}
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		s, ok := arg.(*object.String)
+		if !ok {
+			return nil, newError("argument to `%s` must be STRING, got %s", name, arg.Type())
+		}
+		strs[i] = s.Value
+	}
+	return strs, nil
+}
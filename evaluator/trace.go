@@ -0,0 +1,53 @@
+package evaluator
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/object"
+)
+
+// maxTraceText limits how much of a node's source or of a value a trace
+// line shows.
+const maxTraceText = 40
+
+// SetTrace makes e write an indented BEGIN line for every node it evaluates
+// and an END line with the result to w. A nil w turns tracing off.
+func (e *Evaluator) SetTrace(w io.Writer) {
+	e.traceOut = w
+}
+
+// SetHook makes e call hook with every node before evaluating it, which
+// tools such as coverage use to watch a program run. A nil hook removes it.
+func (e *Evaluator) SetHook(hook func(ast.Node)) {
+	e.hook = hook
+}
+
+func (e *Evaluator) traceEval(node ast.Node, env *object.Enviroment) object.Object {
+	name := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+	indent := strings.Repeat("  ", e.traceDepth)
+
+	fmt.Fprintf(e.traceOut, "%sBEGIN %s %s %s\n", indent, name, node.Pos(), traceText(node.String()))
+	e.traceDepth++
+	result := e.eval(node, env)
+	e.traceDepth--
+
+	value := "<nil>"
+	if result != nil {
+		value = traceText(result.Inspect())
+	}
+	fmt.Fprintf(e.traceOut, "%sEND %s => %s\n", indent, name, value)
+
+	return result
+}
+
+// traceText shortens s to a single line of at most maxTraceText bytes.
+func traceText(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > maxTraceText {
+		s = s[:maxTraceText-3] + "..."
+	}
+	return s
+}
@@ -0,0 +1,51 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// Warning is a problem an evaluation found that does not stop it, such as
+// a call of a deprecated builtin.
+type Warning struct {
+	Pos     token.Position
+	Message string
+}
+
+func (w Warning) String() string {
+	return w.Pos.String() + ": " + w.Message
+}
+
+// SetWarn makes e call warn with the warnings of its evaluations, each
+// once however often the node causing it is evaluated. A nil warn, the
+// default, drops warnings.
+func (e *Evaluator) SetWarn(warn func(Warning)) {
+	e.warnFn = warn
+}
+
+// warnCall reports what is wrong with calling builtin with args at node.
+func (e *Evaluator) warnCall(node *ast.CallExpression, builtin *object.Builtin, args []object.Object) {
+	if builtin.Deprecated != "" {
+		e.warn(node, "%s is deprecated: %s", node.Function, builtin.Deprecated)
+	}
+	if builtin.Warn != nil {
+		if msg := builtin.Warn(args...); msg != "" {
+			e.warn(node, "%s", msg)
+		}
+	}
+}
+
+func (e *Evaluator) warn(node ast.Node, format string, args ...interface{}) {
+	w := Warning{Pos: node.Pos(), Message: fmt.Sprintf(format, args...)}
+	if e.warned[w] {
+		return
+	}
+	if e.warned == nil {
+		e.warned = make(map[Warning]bool)
+	}
+	e.warned[w] = true
+	e.warnFn(w)
+}
@@ -0,0 +1,424 @@
+package format
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/parser"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+const indent = "    "
+
+// maxInlineFunction is the longest function body that is kept on the same
+// line as its "fn(...) {" header.
+const maxInlineFunction = 40
+
+// Operator precedences, mirroring the parser's binding powers. They decide
+// where the formatter has to put parentheses back.
+const (
+	_ int = iota
+	lowest
+	assign
+	or
+	and
+	equals
+	lessGreater
+	bitOr
+	bitXor
+	bitAnd
+	shift
+	sum
+	product
+	prefix
+	postfix
+	call
+)
+
+var precedences = map[string]int{
+	"||": or,
+	"&&": and,
+	"==": equals,
+	"!=": equals,
+	"<":  lessGreater,
+	">":  lessGreater,
+	"|":  bitOr,
+	"^":  bitXor,
+	"&":  bitAnd,
+	"<<": shift,
+	">>": shift,
+	"+":  sum,
+	"-":  sum,
+	"*":  product,
+	"/":  product,
+}
+
+// Source parses src and returns it in canonical Monkey formatting. If the
+// source does not parse the parser errors are returned instead.
+func Source(src string) (string, error) {
+	l := lexer.New(src)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	// Lex the source a second time to learn where every token ends, which
+	// tells where the author left blank lines.
+	var ends []token.Position
+	for l2 := lexer.New(src); ; {
+		tok := l2.NextToken()
+		if tok.Type == token.EOF {
+			break
+		}
+		ends = append(ends, tok.End)
+	}
+	for _, c := range l.Comments() {
+		ends = append(ends, c.End)
+	}
+	sort.Slice(ends, func(i, j int) bool { return ends[i].Offset < ends[j].Offset })
+
+	f := &formatter{comments: &commentQueue{pending: l.Comments(), ends: ends}}
+	return f.program(program), nil
+}
+
+// Program returns the canonical formatting of program: one statement per
+// line, four space indentation and only the parentheses precedence needs.
+func Program(program *ast.Program) string {
+	f := &formatter{comments: &commentQueue{}}
+	return f.program(program)
+}
+
+type formatter struct {
+	out      bytes.Buffer
+	depth    int
+	comments *commentQueue // shared with the formatters of nested blocks
+}
+
+// commentQueue holds the source comments not yet written. Comments are
+// attached at statement granularity: a comment is written on its own line
+// before the first statement that starts below it, or at the end of the
+// line of the statement it trails.
+type commentQueue struct {
+	pending []token.Token
+	ends    []token.Position // end of every token and comment, by offset
+}
+
+// blankLineBefore reports whether the source has an empty line between pos
+// and the token preceding it.
+func (q *commentQueue) blankLineBefore(pos token.Position) bool {
+	i := sort.Search(len(q.ends), func(i int) bool { return q.ends[i].Offset > pos.Offset })
+	if i == 0 {
+		return false
+	}
+	return q.ends[i-1].Line < pos.Line-1
+}
+
+// popBefore removes and returns the next pending comment if it starts on a
+// line before line.
+func (q *commentQueue) popBefore(line int) (token.Token, bool) {
+	if len(q.pending) == 0 || q.pending[0].Pos.Line >= line {
+		return token.Token{}, false
+	}
+	c := q.pending[0]
+	q.pending = q.pending[1:]
+	return c, true
+}
+
+// separate writes a single empty line before pos if the author had one
+// there, except at the start of the output or of a block.
+func (f *formatter) separate(pos token.Position) {
+	if f.out.Len() > 0 && f.comments.blankLineBefore(pos) {
+		f.out.WriteString("\n")
+	}
+}
+
+func (f *formatter) program(program *ast.Program) string {
+	f.statements(program.Statements, false)
+	for _, c := range f.comments.pending {
+		f.separate(c.Pos)
+		f.line(c.Literal)
+	}
+	f.comments.pending = nil
+	return f.out.String()
+}
+
+func (f *formatter) line(s string) {
+	f.out.WriteString(strings.Repeat(indent, f.depth))
+	f.out.WriteString(s)
+	f.out.WriteString("\n")
+}
+
+// statements writes one statement per line. In a block the trailing
+// expression statement produces the block's value and is written without a
+// semicolon.
+func (f *formatter) statements(stmts []ast.Statement, inBlock bool) {
+	for i, stmt := range stmts {
+		last := inBlock && i == len(stmts)-1
+		pos := stmt.Pos()
+
+		for {
+			c, ok := f.comments.popBefore(pos.Line)
+			if !ok {
+				break
+			}
+			f.separate(c.Pos)
+			f.line(c.Literal)
+		}
+		f.separate(pos)
+
+		s := f.statement(stmt, last)
+
+		if len(f.comments.pending) > 0 && f.comments.pending[0].Pos.Line == pos.Line {
+			trailing := " " + f.comments.pending[0].Literal
+			f.comments.pending = f.comments.pending[1:]
+			if i := strings.IndexByte(s, '\n'); i >= 0 {
+				s = s[:i] + trailing + s[i:]
+			} else {
+				s += trailing
+			}
+		}
+
+		f.line(s)
+	}
+}
+
+func (f *formatter) statement(stmt ast.Statement, last bool) string {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return "let " + stmt.Name.Value + " = " + f.expression(stmt.Value, lowest) + ";"
+	case *ast.ReturnStatement:
+		if stmt.ReturnValue == nil {
+			return "return;"
+		}
+		return "return " + f.expression(stmt.ReturnValue, lowest) + ";"
+	case *ast.ExpressionStatement:
+		s := f.expression(stmt.Expression, lowest)
+		if last || endsWithBlock(stmt.Expression) {
+			return s
+		}
+		return s + ";"
+	case *ast.BlockStatement:
+		return f.block(stmt)
+	default:
+		return stmt.String()
+	}
+}
+
+// endsWithBlock reports whether exp is a statement-like expression closed by
+// a brace, which reads better without a trailing semicolon.
+func endsWithBlock(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.IfExpression, *ast.WhileExpression, *ast.ForExpression, *ast.MatchExpression, *ast.SwitchExpression:
+		return true
+	}
+	return false
+}
+
+// block formats a block statement starting at the opening brace. The
+// closing brace is indented to the current depth.
+func (f *formatter) block(block *ast.BlockStatement) string {
+	if block == nil || len(block.Statements) == 0 {
+		return "{}"
+	}
+
+	inner := &formatter{depth: f.depth + 1, comments: f.comments}
+	inner.statements(block.Statements, true)
+
+	return "{\n" + inner.out.String() + strings.Repeat(indent, f.depth) + "}"
+}
+
+// expression formats exp, wrapping it in parentheses when it binds more
+// loosely than the surrounding context requires.
+func (f *formatter) expression(exp ast.Expression, context int) string {
+	switch exp := exp.(type) {
+	case nil:
+		return ""
+	case *ast.Identifier:
+		return exp.Value
+	case *ast.IntegerLiteral:
+		return exp.Token.Literal
+	case *ast.FloatLiteral:
+		return exp.Token.Literal
+	case *ast.StringLiteral:
+		return quote(exp.Value)
+	case *ast.Boolean:
+		return exp.Token.Literal
+	case *ast.PrefixExpression:
+		right := f.expression(exp.Right, prefix)
+		if strings.HasPrefix(right, "-") && exp.Operator == "-" {
+			right = "(" + right + ")"
+		}
+		return parenthesize(exp.Operator+right, prefix, context)
+	case *ast.InfixExpression:
+		prec := precedences[exp.Operator]
+		left := f.expression(exp.Left, prec)
+		// Infix operators are left associative, so an equal precedence
+		// operand on the right needs its parentheses kept.
+		right := f.expression(exp.Right, prec+1)
+		return parenthesize(left+" "+exp.Operator+" "+right, prec, context)
+	case *ast.AssignExpression:
+		// Assignment is right associative, so an assignment on the right
+		// needs no parentheses.
+		return parenthesize(exp.Name.Value+" "+exp.Token.Literal+" "+f.expression(exp.Value, assign), assign, context)
+	case *ast.PostfixExpression:
+		return parenthesize(f.expression(exp.Target, postfix)+exp.Operator, postfix, context)
+	case *ast.IfExpression:
+		s := "if (" + f.expression(exp.Condition, lowest) + ") " + f.block(exp.Consequence)
+		if exp.Alternative != nil {
+			s += " else " + f.block(exp.Alternative)
+		}
+		return s
+	case *ast.WhileExpression:
+		return "while (" + f.expression(exp.Condition, lowest) + ") " + f.block(exp.Body)
+	case *ast.ForExpression:
+		s := "for ("
+		if exp.Key != nil {
+			s += exp.Key.Value + ", "
+		}
+		return s + exp.Value.Value + " in " + f.expression(exp.Iterable, lowest) + ") " + f.block(exp.Body)
+	case *ast.FunctionLiteral:
+		return f.function(exp)
+	case *ast.MatchExpression:
+		return f.match(exp)
+	case *ast.SwitchExpression:
+		return f.switchExpression(exp)
+	case *ast.CallExpression:
+		return f.expression(exp.Function, call) + "(" + f.list(exp.Arguments) + ")"
+	case *ast.ArrayLiteral:
+		return "[" + f.list(exp.Elements) + "]"
+	case *ast.IndexExpression:
+		return f.expression(exp.Left, call) + "[" + f.expression(exp.Index, lowest) + "]"
+	case *ast.SliceExpression:
+		s := f.expression(exp.Left, call) + "["
+		if exp.Low != nil {
+			s += f.expression(exp.Low, lowest)
+		}
+		s += ":"
+		if exp.High != nil {
+			s += f.expression(exp.High, lowest)
+		}
+		return s + "]"
+	case *ast.HashLiteral:
+		pairs := []string{}
+		for _, key := range exp.Keys {
+			pairs = append(pairs, f.expression(key, lowest)+": "+f.expression(exp.Pairs[key], lowest))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	default:
+		return exp.String()
+	}
+}
+
+// function formats a function literal. Bodies made of a single short
+// expression stay on one line, everything else is expanded into a block.
+func (f *formatter) function(fn *ast.FunctionLiteral) string {
+	params := []string{}
+	for _, p := range fn.Parameters {
+		params = append(params, p.Value)
+	}
+	header := "fn(" + strings.Join(params, ", ") + ") "
+	return header + f.body(fn.Body)
+}
+
+// body formats the block of a function literal, a match arm or a switch
+// case. Blocks made of a single short expression stay on one line.
+func (f *formatter) body(block *ast.BlockStatement) string {
+	if block != nil && len(block.Statements) == 1 && !f.hasCommentWithin(block) {
+		if stmt, ok := block.Statements[0].(*ast.ExpressionStatement); ok {
+			body := f.expression(stmt.Expression, lowest)
+			if !strings.Contains(body, "\n") && len(body) <= maxInlineFunction {
+				return "{ " + body + " }"
+			}
+		}
+	}
+	return f.block(block)
+}
+
+// match formats a match expression with one arm per line.
+func (f *formatter) match(exp *ast.MatchExpression) string {
+	inner := &formatter{depth: f.depth + 1, comments: f.comments}
+	for _, arm := range exp.Arms {
+		pattern := arm.Pattern.Value
+		if arm.Fields != nil {
+			fields := []string{}
+			for _, field := range arm.Fields {
+				fields = append(fields, field.Value)
+			}
+			pattern += "(" + strings.Join(fields, ", ") + ")"
+		}
+		inner.line(pattern + " => " + inner.body(arm.Body))
+	}
+
+	return "match (" + f.expression(exp.Subject, lowest) + ") {\n" + inner.out.String() + strings.Repeat(indent, f.depth) + "}"
+}
+
+// switchExpression formats a switch expression with one case per line.
+func (f *formatter) switchExpression(exp *ast.SwitchExpression) string {
+	inner := &formatter{depth: f.depth + 1, comments: f.comments}
+	for _, c := range exp.Cases {
+		inner.line("case " + inner.expression(c.Value, lowest) + ": " + inner.body(c.Body))
+	}
+	if exp.Default != nil {
+		inner.line("default: " + inner.body(exp.Default))
+	}
+
+	return "switch (" + f.expression(exp.Subject, lowest) + ") {\n" + inner.out.String() + strings.Repeat(indent, f.depth) + "}"
+}
+
+// hasCommentWithin reports whether a pending comment sits between the
+// opening brace of block and its last statement. Such a block is never
+// collapsed onto one line.
+func (f *formatter) hasCommentWithin(block *ast.BlockStatement) bool {
+	if len(f.comments.pending) == 0 || len(block.Statements) == 0 {
+		return false
+	}
+	c := f.comments.pending[0]
+	last := block.Statements[len(block.Statements)-1].Pos()
+	return c.Pos.Offset > block.Pos().Offset && c.Pos.Line <= last.Line
+}
+
+func (f *formatter) list(exps []ast.Expression) string {
+	items := []string{}
+	for _, e := range exps {
+		items = append(items, f.expression(e, lowest))
+	}
+	return strings.Join(items, ", ")
+}
+
+func parenthesize(s string, prec, context int) string {
+	if prec < context {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// quote returns s as a string literal, escaping the chars that cannot
+// appear in one as they are.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < ' ' || r == 0x7f:
+			fmt.Fprintf(&b, `\u{%x}`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,126 @@
+package format
+
+import "testing"
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=5", "let x = 5;\n"},
+		{"let a = 1;\n\n\nlet b = 2;", "let a = 1;\n\nlet b = 2;\n"},
+		{"let f = fn() {\n\n  let a = 1;\n\n  a\n};", "let f = fn() {\n    let a = 1;\n\n    a\n};\n"},
+		{"1+2*3", "1 + 2 * 3;\n"},
+		{"1.50*-2.0", "1.50 * -2.0;\n"},
+		{"(1+2)*3", "(1 + 2) * 3;\n"},
+		{"1-(2-3)", "1 - (2 - 3);\n"},
+		{"(1-2)-3", "1 - 2 - 3;\n"},
+		{"-(-a)", "-(-a);\n"},
+		{"!(a == b)", "!(a == b);\n"},
+		{"return  x", "return x;\n"},
+		{`puts( "hi" , [1,2] , {"a":1,"b":2} )`, `puts("hi", [1, 2], {"a": 1, "b": 2});` + "\n"},
+		{"a[1+1]", "a[1 + 1];\n"},
+		{`"say \"hi\"\n\u{7}\u{e9}\\"`, `"say \"hi\"\n\u{7}é\\";` + "\n"},
+		{"let add = fn(x,y){x+y};", "let add = fn(x, y) { x + y };\n"},
+		{
+			"let f = fn(x) { let y = x * 2; y }",
+			"let f = fn(x) {\n    let y = x * 2;\n    y\n};\n",
+		},
+		{
+			"if (x < y) { x } else { y }",
+			"if (x < y) {\n    x\n} else {\n    y\n}\n",
+		},
+		{
+			"let f = fn() { if (true) { return 1; }; 2 }",
+			"let f = fn() {\n    if (true) {\n        return 1;\n    }\n    2\n};\n",
+		},
+		{"(a||b)&&c==d||e", "(a || b) && c == d || e;\n"},
+		{"x=y=1;(x=2)+1", "x = y = 1;\n(x = 2) + 1;\n"},
+		{"x++;-a[i+1]--;(-x)+(y--)", "x++;\n-a[i + 1]--;\n-x + y--;\n"},
+		{"(a|b)&~c<<(1+2);a|b^c&d", "(a | b) & ~c << 1 + 2;\na | b ^ c & d;\n"},
+		{"a[1:n-1];a[ : ];(-x)[:2][0]", "a[1:n - 1];\na[:];\n(-x)[:2][0];\n"},
+		{"x+=y*=2;x/=(x-=1)", "x += y *= 2;\nx /= x -= 1;\n"},
+		{"while(i<3){let i=i+1;};puts(i)", "while (i < 3) {\n    let i = i + 1;\n}\nputs(i);\n"},
+		{"for(k,v in {1:2}){puts(k,v)};for(x in[1]){x}", "for (k, v in {1: 2}) {\n    puts(k, v)\n}\nfor (x in [1]) {\n    x\n}\n"},
+		{
+			"switch(x){case 1:{\"one\"}case y+1:{let z=y;z}default:{0}}",
+			"switch (x) {\n    case 1: { \"one\" }\n    case y + 1: {\n        let z = y;\n        z\n    }\n    default: { 0 }\n}\n",
+		},
+		{"enum Shape{Circle(r),Rect(w,h),Empty,};", "enum Shape { Circle(r), Rect(w, h), Empty }\n"},
+		{
+			"let f = fn(s) { match(s){Circle(r)=>{r*r} _=>{let a = 1; a}} }",
+			"let f = fn(s) {\n    match (s) {\n        Circle(r) => { r * r }\n        _ => {\n            let a = 1;\n            a\n        }\n    }\n};\n",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := Source(tt.input)
+		if err != nil {
+			t.Errorf("Source(%q) returned error: %s", tt.input, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("Source(%q) wrong.\nexpected=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestSourceIsIdempotent(t *testing.T) {
+	input := `let map = fn(arr, f) { let iter = fn(arr, acc) { if (len(arr) == 0) { acc } else { iter(rest(arr), push(acc, f(first(arr)))) } }; iter(arr, []) };
+map([1, 2, 3], fn(x) { x * 2 });`
+
+	once, err := Source(input)
+	if err != nil {
+		t.Fatalf("Source returned error: %s", err)
+	}
+	twice, err := Source(once)
+	if err != nil {
+		t.Fatalf("Source returned error on formatted output: %s", err)
+	}
+	if once != twice {
+		t.Errorf("formatting is not idempotent.\nfirst=%q\nsecond=%q", once, twice)
+	}
+}
+
+func TestSourceParseError(t *testing.T) {
+	if _, err := Source("let = 5"); err == nil {
+		t.Errorf("expected an error for invalid source")
+	}
+}
+
+func TestSourceKeepsComments(t *testing.T) {
+	input := `// Package comment
+
+// double returns twice x.
+let double = fn(x) {
+  // multiply
+  x*2
+};
+let y = double(2); // four
+/* a block
+   comment */
+let z = y; /* inline */
+// trailing
+`
+	expected := `// Package comment
+
+// double returns twice x.
+let double = fn(x) {
+    // multiply
+    x * 2
+};
+let y = double(2); // four
+/* a block
+   comment */
+let z = y; /* inline */
+// trailing
+`
+
+	got, err := Source(input)
+	if err != nil {
+		t.Fatalf("Source returned error: %s", err)
+	}
+	if got != expected {
+		t.Errorf("comments not preserved.\nexpected=%q\ngot=%q", expected, got)
+	}
+}
@@ -0,0 +1,149 @@
+// Package highlight classifies the tokens of Monkey source for syntax
+// highlighting. Its spans map directly onto the semantic tokens of the
+// Language Server Protocol and are simple to turn into highlighting data
+// for editors without it.
+package highlight
+
+import (
+	"sort"
+
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/parser"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// Class is what a span of source is.
+type Class int
+
+const (
+	Keyword    Class = iota // fn, let, if, true, ...
+	Identifier              // names other than function names
+	String                  // string literals, quotes included
+	Number                  // integer literals
+	Operator                // =, +, ==, ...
+	Comment                 // // comments
+	Function                // the names of functions where they are bound or called
+)
+
+// names are the names of the classes, which are the token types of the
+// Language Server Protocol.
+var names = [...]string{
+	Keyword:    "keyword",
+	Identifier: "variable",
+	String:     "string",
+	Number:     "number",
+	Operator:   "operator",
+	Comment:    "comment",
+	Function:   "function",
+}
+
+// String returns the name of the semantic token type of c in the Language
+// Server Protocol.
+func (c Class) String() string {
+	if c < 0 || int(c) >= len(names) {
+		return "unknown"
+	}
+	return names[c]
+}
+
+// Classes returns every class in order, which makes their names the token
+// types legend of LSP semantic tokens.
+func Classes() []Class {
+	classes := make([]Class, len(names))
+	for i := range classes {
+		classes[i] = Class(i)
+	}
+	return classes
+}
+
+// Span is a classified token, from its first character at Pos to just
+// after its last one at End. Punctuation such as parentheses and commas has
+// no spans.
+type Span struct {
+	Class Class
+	Pos   token.Position
+	End   token.Position
+}
+
+// Classify returns the spans of src in source order. Identifiers that name
+// functions are found by parsing src: the names let statements bind to
+// function literals and the names of called functions, builtins included.
+// Source with syntax errors is classified as far as it parses.
+func Classify(src string) []Span {
+	functions := functionNames(src)
+
+	var spans []Span
+	l := lexer.New(src)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		class, ok := classify(tok)
+		if !ok {
+			continue
+		}
+		if class == Identifier && functions[tok.Pos.Offset] {
+			class = Function
+		}
+		spans = append(spans, Span{Class: class, Pos: tok.Pos, End: tok.End})
+	}
+
+	// Comments are not part of the token stream, so they are merged in.
+	for _, c := range l.Comments() {
+		spans = append(spans, Span{Class: Comment, Pos: c.Pos, End: c.End})
+	}
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].Pos.Offset < spans[j].Pos.Offset
+	})
+	return spans
+}
+
+// classify returns the class of tok, or false if it has none.
+func classify(tok token.Token) (Class, bool) {
+	switch tok.Type {
+	case token.IDENT:
+		return Identifier, true
+	case token.INT, token.FLOAT:
+		return Number, true
+	case token.STRING:
+		return String, true
+	case token.FUNCTION, token.LET, token.TRUE, token.FALSE, token.IF, token.ELSE, token.RETURN,
+		token.ENUM, token.MATCH, token.WHILE, token.FOR, token.IN, token.SWITCH, token.CASE, token.DEFAULT:
+		return Keyword, true
+	case token.ASSIGN, token.PLUS, token.MINUS, token.BANG, token.ASTERISK, token.SLASH,
+		token.LT, token.GT, token.EQ, token.NOT_EQ, token.ARROW, token.AND, token.OR,
+		token.PLUS_ASSIGN, token.MINUS_ASSIGN, token.ASTERISK_ASSIGN, token.SLASH_ASSIGN, token.INCREMENT, token.DECREMENT,
+		token.AMPERSAND, token.PIPE, token.CARET, token.TILDE, token.SHIFT_LEFT, token.SHIFT_RIGHT:
+		return Operator, true
+	}
+	return 0, false
+}
+
+// functionNames returns the offsets of the identifiers in src that name
+// functions.
+func functionNames(src string) map[int]bool {
+	offsets := map[int]bool{}
+	program := parser.New(lexer.New(src)).ParseProgram()
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		// The parser leaves nil statements where it failed to parse one.
+		case *ast.ReturnStatement:
+			return node != nil
+		case *ast.ExpressionStatement:
+			return node != nil
+
+		case *ast.LetStatement:
+			if node == nil {
+				return false
+			}
+			if _, ok := node.Value.(*ast.FunctionLiteral); ok && node.Name != nil {
+				offsets[node.Name.Pos().Offset] = true
+			}
+		case *ast.CallExpression:
+			if ident, ok := node.Function.(*ast.Identifier); ok {
+				offsets[ident.Pos().Offset] = true
+			}
+		}
+		return true
+	})
+	return offsets
+}
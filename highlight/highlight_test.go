@@ -0,0 +1,48 @@
+package highlight
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	src := `// double doubles.
+let double = fn(x) { x * 2 };
+if (true) { puts(double(1), "a") }
+let f = g(1) + ;
+f(x)`
+
+	type span struct {
+		text  string
+		class Class
+	}
+	expected := []span{
+		{"// double doubles.", Comment},
+		{"let", Keyword}, {"double", Function}, {"=", Operator}, {"fn", Keyword},
+		{"x", Identifier}, {"x", Identifier}, {"*", Operator}, {"2", Number},
+		{"if", Keyword}, {"true", Keyword},
+		{"puts", Function}, {"double", Function}, {"1", Number}, {`"a"`, String},
+		// The statement that fails to parse is still classified.
+		{"let", Keyword}, {"f", Identifier}, {"=", Operator}, {"g", Function}, {"1", Number}, {"+", Operator},
+		{"f", Function}, {"x", Identifier},
+	}
+
+	var got []span
+	for _, s := range Classify(src) {
+		got = append(got, span{src[s.Pos.Offset:s.End.Offset], s.Class})
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong spans.\nwant=%v\ngot =%v", expected, got)
+	}
+}
+
+func TestClassNames(t *testing.T) {
+	var names []string
+	for _, c := range Classes() {
+		names = append(names, c.String())
+	}
+	expected := []string{"keyword", "variable", "string", "number", "operator", "comment", "function"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("wrong class names. want=%q, got=%q", expected, names)
+	}
+}
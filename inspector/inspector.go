@@ -0,0 +1,354 @@
+// Package inspector serves control connections to a program running on
+// the evaluator, as `monkey run --inspect` does. A client can pause the
+// program, look at the calls in progress and the variables they see, and
+// evaluate expressions where it stopped, then let it continue.
+//
+// Connections speak a line-based text protocol: the inspector writes a
+// prompt, the client a command, and the inspector its result. Any number
+// of clients may connect, one after the other or at once. An inspector
+// with a token asks clients for it first and closes the connection of
+// those that do not know it, as anyone who can evaluate expressions in a
+// program can do whatever it may.
+package inspector
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/parser"
+)
+
+const PROMPT = "(inspect) "
+
+// TOKEN_PROMPT asks a client for the inspector's token.
+const TOKEN_PROMPT = "token: "
+
+// evalSteps limits the nodes an expression evaluated by a client may
+// evaluate, so that a mistaken loop cannot hang the inspector.
+const evalSteps = 10_000_000
+
+const help = `commands:
+  pause                stop the program at the next expression
+  continue, c          let the program run again
+  step, s              run the program to its next expression
+  where, bt            show the calls in progress
+  locals [N]           show the variables of call N, by default the current one
+  globals              show the top-level variables
+  eval EXPR, p EXPR    evaluate EXPR where the program stopped
+  help                 show this help
+  quit, q              close the connection, letting the program run
+`
+
+// Inspector pauses a program for its clients. Attach it to the evaluator
+// running the program, call Serve to accept clients and Finish once the
+// evaluation is over.
+type Inspector struct {
+	lines []string // the program's source, by line
+	token string   // what clients must send first, if not ""
+
+	// limits are those of the program, which expressions clients evaluate
+	// run under too.
+	limits evaluator.Limits
+
+	// pausing asks the program to pause at its next node. It is checked
+	// without the lock, as the program checks it at every node.
+	pausing atomic.Bool
+
+	mu       sync.Mutex
+	changed  *sync.Cond // broadcast when the program pauses, resumes or finishes
+	stopped  *stop      // where the program is paused, or nil while it runs
+	finished bool
+}
+
+// stop is where the program paused: the node about to be evaluated, its
+// environment and the calls in progress.
+type stop struct {
+	node  ast.Node
+	env   *object.Enviroment
+	calls []evaluator.Call
+}
+
+// New returns an Inspector for the program with the source src.
+func New(src string) *Inspector {
+	in := &Inspector{lines: strings.Split(src, "\n")}
+	in.changed = sync.NewCond(&in.mu)
+	return in
+}
+
+// SetToken makes sessions start by asking for token, ending unless the
+// client sends it.
+func (in *Inspector) SetToken(token string) {
+	in.token = token
+}
+
+// Attach makes the evaluation of e pause whenever a client asks it to.
+// Expressions clients evaluate run under the limits e has, such as its
+// sandbox, so set them first.
+func (in *Inspector) Attach(e *evaluator.Evaluator) {
+	in.limits = e.Limits()
+	e.SetInspector(in.inspect)
+}
+
+// Finish tells clients that the program has finished, so that they stop
+// waiting for it to pause.
+func (in *Inspector) Finish() {
+	in.mu.Lock()
+	in.finished = true
+	in.changed.Broadcast()
+	in.mu.Unlock()
+}
+
+// Serve accepts clients on l until it is closed, serving each on its own
+// goroutine.
+func (in *Inspector) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			in.Session(conn, conn)
+		}()
+	}
+}
+
+// inspect is the evaluator's inspector; it blocks while the program is
+// paused.
+func (in *Inspector) inspect(node ast.Node, env *object.Enviroment, calls []evaluator.Call) {
+	if !in.pausing.Load() {
+		return
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.pausing.Store(false)
+	s := &stop{node: node, env: env, calls: calls}
+	in.stopped = s
+	in.changed.Broadcast()
+	for in.stopped == s {
+		in.changed.Wait()
+	}
+}
+
+// pause asks the program to pause and waits until it has, or finished.
+func (in *Inspector) pause() {
+	in.mu.Lock()
+	if in.stopped == nil && !in.finished {
+		in.pausing.Store(true)
+	}
+	for in.stopped == nil && !in.finished {
+		in.changed.Wait()
+	}
+	in.mu.Unlock()
+}
+
+// resume lets a paused program run again. With step, it pauses again at
+// the next node, and resume waits until it has.
+func (in *Inspector) resume(step bool) {
+	in.mu.Lock()
+	s := in.stopped
+	if s == nil {
+		in.mu.Unlock()
+		return
+	}
+	if step {
+		in.pausing.Store(true)
+	}
+	in.stopped = nil
+	in.changed.Broadcast()
+	for step && (in.stopped == nil || in.stopped == s) && !in.finished {
+		in.changed.Wait()
+	}
+	in.mu.Unlock()
+}
+
+// Session reads commands from r until it ends or a quit command, writing
+// their results to out. A program the session paused runs again when it
+// ends. With a token set, the first line read must be the token.
+func (in *Inspector) Session(r io.Reader, out io.Writer) {
+	scanner := bufio.NewScanner(r)
+	if in.token != "" {
+		fmt.Fprint(out, TOKEN_PROMPT)
+		if !scanner.Scan() {
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(scanner.Text())), []byte(in.token)) != 1 {
+			fmt.Fprintln(out, "invalid token")
+			return
+		}
+	}
+	paused := false
+	defer func() {
+		if paused {
+			in.resume(false)
+		}
+	}()
+
+	for {
+		fmt.Fprint(out, PROMPT)
+		if !scanner.Scan() {
+			return
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		cmd, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+		if cmd == "" {
+			continue
+		}
+
+		switch cmd {
+		case "pause":
+			in.pause()
+			paused = true
+			in.printLocation(out)
+
+		case "continue", "c":
+			in.resume(false)
+			paused = false
+
+		case "step", "s":
+			in.resume(true)
+			paused = true
+			in.printLocation(out)
+
+		case "where", "bt", "locals", "globals", "eval", "p":
+			// Holding the lock keeps other sessions from resuming the
+			// program while the command reads its state.
+			in.mu.Lock()
+			if in.stopped == nil {
+				fmt.Fprintln(out, "the program is not paused; try pause")
+			} else {
+				in.inspectStop(out, in.stopped, cmd, arg)
+			}
+			in.mu.Unlock()
+
+		case "help":
+			io.WriteString(out, help)
+
+		case "quit", "q":
+			return
+
+		default:
+			fmt.Fprintf(out, "unknown command %q; try help\n", cmd)
+		}
+	}
+}
+
+// inspectStop runs cmd, a command that reads the state of the program
+// paused at s, with its argument arg.
+func (in *Inspector) inspectStop(out io.Writer, s *stop, cmd, arg string) {
+	switch cmd {
+	case "where", "bt":
+		pos := s.node.Pos()
+		for i := len(s.calls) - 1; i >= -1; i-- {
+			name := "<program>"
+			if i >= 0 {
+				name = s.calls[i].Function
+			}
+			fmt.Fprintf(out, "#%d %s in %s\n", len(s.calls)-1-i, pos, name)
+			if i >= 0 {
+				pos = s.calls[i].Pos
+			}
+		}
+
+	case "locals":
+		env := s.env
+		if arg != "" {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 0 || n > len(s.calls) {
+				fmt.Fprintf(out, "locals: no call %q; try where\n", arg)
+				return
+			}
+			if n > 0 {
+				env = s.calls[len(s.calls)-n].Env
+			}
+		}
+		printVariables(out, env, false)
+
+	case "globals":
+		printVariables(out, s.env, true)
+
+	case "eval", "p":
+		if arg == "" {
+			fmt.Fprintf(out, "%s: want an expression\n", cmd)
+			return
+		}
+		fmt.Fprintln(out, in.eval(arg, s.env))
+	}
+}
+
+// printLocation writes where the program is paused, or that it finished.
+func (in *Inspector) printLocation(out io.Writer) {
+	in.mu.Lock()
+	s, finished := in.stopped, in.finished
+	in.mu.Unlock()
+
+	switch {
+	case s != nil:
+		pos := s.node.Pos()
+		text := ""
+		if pos.Line >= 1 && pos.Line <= len(in.lines) {
+			text = strings.TrimSpace(in.lines[pos.Line-1])
+		}
+		fmt.Fprintf(out, "%s: %s\n", pos, text)
+	case finished:
+		fmt.Fprintln(out, "the program has finished")
+	}
+}
+
+// printVariables writes the variables env sees, innermost first, except
+// those shadowed. With global, it writes only the top-level variables,
+// and otherwise those of the call only, unless env is the top level.
+func printVariables(out io.Writer, env *object.Enviroment, global bool) {
+	seen := map[string]bool{}
+	top := env.Outer() == nil
+	for ; env != nil; env = env.Outer() {
+		if global != (env.Outer() == nil) && !top {
+			continue
+		}
+		names := env.Names()
+		sort.Strings(names)
+		for _, name := range names {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			value, _ := env.Get(name)
+			// Functions inspect as several lines.
+			fmt.Fprintf(out, "%s = %s\n", name, strings.ReplaceAll(value.Inspect(), "\n", " "))
+		}
+	}
+}
+
+// eval evaluates the expression src in env under the program's limits,
+// returning its value or error.
+func (in *Inspector) eval(src string, env *object.Enviroment) string {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		return "parse error: " + strings.Join(errs, "; ")
+	}
+
+	e := evaluator.New()
+	limits := in.limits
+	limits.MaxSteps = evalSteps
+	e.SetLimits(limits)
+	result := e.Eval(program, env)
+	if result == nil {
+		return "null"
+	}
+	return result.Inspect()
+}
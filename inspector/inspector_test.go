@@ -0,0 +1,145 @@
+package inspector
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/parser"
+)
+
+// inspect runs src with an inspector that pauses it at its first node and
+// a session reading commands, and returns what the session wrote.
+func inspect(t *testing.T, src string, commands ...string) string {
+	t.Helper()
+	return inspectLimited(t, evaluator.Limits{}, src, commands...)
+}
+
+// inspectLimited is inspect running src under limits.
+func inspectLimited(t *testing.T, limits evaluator.Limits, src string, commands ...string) string {
+	t.Helper()
+	program := parser.New(lexer.New(src)).ParseProgram()
+	in := New(src)
+	in.pausing.Store(true)
+
+	var out strings.Builder
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		in.Session(strings.NewReader(strings.Join(commands, "\n")+"\n"), &out)
+	}()
+
+	e := evaluator.New()
+	e.SetLimits(limits)
+	in.Attach(e)
+	e.Eval(program, object.NewEnvironment())
+	in.Finish()
+	<-done
+	return strings.ReplaceAll(out.String(), PROMPT, "")
+}
+
+func TestSession(t *testing.T) {
+	src := "let x = 1;\nlet add = fn(a, b) { a + b };\nadd(x, 2);\n"
+	steps := make([]string, 12)
+	for i := range steps {
+		steps[i] = "step"
+	}
+
+	tests := []struct {
+		commands []string
+		expected string
+	}{
+		{[]string{"pause", "where", "locals", "quit"}, "1:1: let x = 1;\n#0 1:1 in <program>\n"},
+		{[]string{"pause", "s", "s", "s", "globals", "p x"}, "1:1: let x = 1;\n1:1: let x = 1;\n1:9: let x = 1;\n2:1: let add = fn(a, b) { a + b };\nx = 1\n1\n"},
+		{append(append([]string{"pause"}, steps...), "where", "locals", "locals 1", "globals", "p a * 10 + x"), "" +
+			"1:1: let x = 1;\n1:1: let x = 1;\n1:9: let x = 1;\n2:1: let add = fn(a, b) { a + b };\n2:11: let add = fn(a, b) { a + b };\n" +
+			"3:1: add(x, 2);\n3:1: add(x, 2);\n3:1: add(x, 2);\n3:5: add(x, 2);\n3:8: add(x, 2);\n" +
+			"2:20: let add = fn(a, b) { a + b };\n2:22: let add = fn(a, b) { a + b };\n2:22: let add = fn(a, b) { a + b };\n" +
+			"#0 2:22 in add\n#1 3:1 in <program>\n" +
+			"a = 1\nb = 2\n" +
+			"add = fn(a, b) { (a + b) }\nx = 1\n" +
+			"add = fn(a, b) { (a + b) }\nx = 1\n" +
+			"11\n"},
+		{[]string{"pause", "p nope", "p 1 +", "p", "locals 1", "frobnicate"}, "1:1: let x = 1;\n" +
+			"ERROR: identifier not found: nope\n" +
+			"parse error: no prefix parse function for token 'EOF' found\n" +
+			"p: want an expression\n" +
+			"locals: no call \"1\"; try where\n" +
+			"unknown command \"frobnicate\"; try help\n"},
+		{[]string{"pause", "p let y = 5; y", "continue", "where"}, "1:1: let x = 1;\n5\n" +
+			"the program is not paused; try pause\n"},
+	}
+
+	for _, tt := range tests {
+		if got := inspect(t, src, tt.commands...); got != tt.expected {
+			t.Errorf("%q: wrong output.\nwant=%q\ngot= %q", tt.commands, tt.expected, got)
+		}
+	}
+}
+
+func TestServe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %s", err)
+	}
+	defer l.Close()
+	in := New("")
+	in.Finish()
+	go in.Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("pause\nquit\n"))
+
+	r := bufio.NewReader(conn)
+	got, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := PROMPT + "the program has finished\n"; got != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, got)
+	}
+}
+
+func TestEvalLimits(t *testing.T) {
+	// Expressions clients evaluate cannot do what the program may not.
+	limits := evaluator.Limits{Sandbox: &evaluator.Sandbox{}}
+	got := inspectLimited(t, limits, "1", "pause", `p exec("id")`, `p getenv("HOME")`, "p len([1])")
+	expected := "1:1: 1\n" +
+		"ERROR: exec is not available: the process capability is not granted\n" +
+		"ERROR: getenv is not available: the env capability is not granted\n" +
+		"1\n"
+	if got != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", expected, got)
+	}
+}
+
+func TestToken(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"secret\npause\n", TOKEN_PROMPT + PROMPT + "the program has finished\n" + PROMPT},
+		{"guess\npause\n", TOKEN_PROMPT + "invalid token\n"},
+		{"", TOKEN_PROMPT},
+	}
+
+	for _, tt := range tests {
+		in := New("")
+		in.SetToken("secret")
+		in.Finish()
+
+		var out strings.Builder
+		in.Session(strings.NewReader(tt.input), &out)
+		if out.String() != tt.expected {
+			t.Errorf("%q: wrong output. want=%q, got=%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// addLangFlag registers --lang, the language version programs are read as,
+// storing it in lang. It defaults to the latest version.
+func addLangFlag(flags *flag.FlagSet, lang *token.Lang) {
+	*lang = token.LangLatest
+	usage := fmt.Sprintf("read programs as language `version` %s to %s; keywords added after it are identifiers", token.Lang1, token.LangLatest)
+	flags.Var((*langFlag)(lang), "lang", usage)
+}
+
+// langFlag is the value of --lang.
+type langFlag token.Lang
+
+func (l *langFlag) String() string {
+	return token.Lang(*l).String()
+}
+
+func (l *langFlag) Set(value string) error {
+	lang, err := token.ParseLang(value)
+	if err != nil {
+		return err
+	}
+	*l = langFlag(lang)
+	return nil
+}
@@ -1,16 +1,42 @@
 package lexer
 
-import "github.com/frankie-mur/monkeylang/token"
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// Error is malformed input the lexer skipped, such as an unterminated
+// block comment.
+type Error struct {
+	Pos     token.Position
+	Message string
+}
 
 type Lexer struct {
 	input        string
 	position     int  // current position in input (points to current char)
 	readPosition int  // current reading position in input (after current char)
 	ch           byte // current char under examination
+	line         int  // line of the current char, counting from 1
+	lineStart    int  // offset of the first char of the current line
+
+	comments []token.Token // comments skipped so far, in source order
+	errors   []Error       // malformed input skipped so far, in source order
+	interner *token.Interner
+	lang     token.Lang // the language version whose keywords and operators are read
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewWithInterner(input, token.NewInterner())
+}
+
+// NewWithInterner returns a lexer interning literals in in, which lexers
+// of related sources, such as the lines of a REPL session, may share.
+func NewWithInterner(input string, in *token.Interner) *Lexer {
+	l := &Lexer{input: input, line: 1, interner: in, lang: token.LangLatest}
 	//Call readChar() so our lexer is in working state
 	l.readChar()
 	return l
@@ -18,6 +44,10 @@ func New(input string) *Lexer {
 
 // readChar reads the next character from the input string and updates the Lexer's state accordingly.
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.lineStart = l.readPosition
+	}
 	if l.readPosition >= len(l.input) {
 		//ASCII code for the NUL character
 		l.ch = 0
@@ -32,82 +62,121 @@ func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
+	for l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*') {
+		if l.peekChar() == '/' {
+			l.skipComment()
+		} else {
+			l.skipBlockComment()
+		}
+		l.skipWhitespace()
+	}
+	start := l.pos()
 
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
-			ch := l.ch
+			tok = token.Token{Type: token.EQ, Literal: token.EQ}
+			l.readChar()
+		} else if l.peekChar() == '>' && token.Since(token.ARROW) <= l.lang {
+			tok = token.Token{Type: token.ARROW, Literal: token.ARROW}
 			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.EQ, Literal: literal}
 		} else {
-			tok = newToken(token.ASSIGN, l.ch)
+			tok = l.newToken(token.ASSIGN)
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '+' && token.Since(token.INCREMENT) <= l.lang {
+			tok = token.Token{Type: token.INCREMENT, Literal: token.INCREMENT}
+			l.readChar()
+		} else {
+			tok = l.operator(token.PLUS, token.PLUS_ASSIGN)
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '-' && token.Since(token.DECREMENT) <= l.lang {
+			tok = token.Token{Type: token.DECREMENT, Literal: token.DECREMENT}
+			l.readChar()
+		} else {
+			tok = l.operator(token.MINUS, token.MINUS_ASSIGN)
+		}
 	case '!':
 		if l.peekChar() == '=' {
-			ch := l.ch
+			tok = token.Token{Type: token.NOT_EQ, Literal: token.NOT_EQ}
 			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.NOT_EQ, Literal: literal}
 		} else {
-			tok = newToken(token.BANG, l.ch)
+			tok = l.newToken(token.BANG)
 		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		tok = l.operator(token.SLASH, token.SLASH_ASSIGN)
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		tok = l.operator(token.ASTERISK, token.ASTERISK_ASSIGN)
+	case '&':
+		tok = l.pair(token.AND, token.AMPERSAND)
+	case '|':
+		tok = l.pair(token.OR, token.PIPE)
+	case '^':
+		tok = l.single(token.CARET)
+	case '~':
+		tok = l.single(token.TILDE)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		tok = l.pair(token.SHIFT_LEFT, token.LT)
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		tok = l.pair(token.SHIFT_RIGHT, token.GT)
 	case ';':
-		tok = newToken(token.SEMICOLON, l.ch)
+		tok = l.newToken(token.SEMICOLON)
 	case ':':
-		tok = newToken(token.COLON, l.ch)
+		tok = l.newToken(token.COLON)
 	case ',':
-		tok = newToken(token.COMMA, l.ch)
+		tok = l.newToken(token.COMMA)
 	case '{':
-		tok = newToken(token.LBRACE, l.ch)
+		tok = l.newToken(token.LBRACE)
 	case '}':
-		tok = newToken(token.RBRACE, l.ch)
+		tok = l.newToken(token.RBRACE)
 	case '(':
-		tok = newToken(token.LPAREN, l.ch)
+		tok = l.newToken(token.LPAREN)
 	case ')':
-		tok = newToken(token.RPAREN, l.ch)
+		tok = l.newToken(token.RPAREN)
 	case '[':
-		tok = newToken(token.LBRACKET, l.ch)
+		tok = l.newToken(token.LBRACKET)
 	case ']':
-		tok = newToken(token.RBRACKET, l.ch)
+		tok = l.newToken(token.RBRACKET)
 	case '"':
 		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok.Literal = l.interner.Intern(l.readString())
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
 	default:
 		if isLetter(l.ch) {
-			tok.Literal = l.readIdentifier()
-			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Literal = l.interner.Intern(l.readIdentifier())
+			tok.Type = token.LookupIdentIn(tok.Literal, l.lang)
+			tok.Pos, tok.End = start, l.pos()
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			var literal string
+			literal, tok.Type = l.readNumber()
+			tok.Literal = l.interner.Intern(literal)
+			tok.Pos, tok.End = start, l.pos()
 			return tok
 		} else {
-			tok = newToken(token.ILLEGAL, l.ch)
+			tok = l.newToken(token.ILLEGAL)
 		}
 	}
 
 	//Move position pointers to the next character
 	l.readChar()
+	tok.Pos, tok.End = start, l.pos()
 	return tok
 
 }
 
+// pos returns the source position of the current char.
+func (l *Lexer) pos() token.Position {
+	return token.Position{
+		Offset: l.position,
+		Line:   l.line,
+		Column: l.position - l.lineStart + 1,
+	}
+}
+
 // readIdentifier returns the identifier unitl the next non-letter character is encountered.
 func (l *Lexer) readIdentifier() string {
 	initialPosition := l.position
@@ -126,24 +195,167 @@ func (l *Lexer) peekChar() byte {
 	}
 }
 
-// readNumber returns the number literal until the next non-digit character is encountered.
-func (l *Lexer) readNumber() string {
+// readNumber returns the number literal until the next non-digit character is encountered,
+// and whether it is an integer or a float. Hexadecimal literals start with
+// 0x or 0X. Floats have a fractional part: a point followed by digits.
+// Underscores may separate the digits; the parser reports those that do
+// not.
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	initialPosition := l.position
-	for isDigit(l.ch) {
+	hex := l.ch == '0' && (l.peekChar() == 'x' || l.peekChar() == 'X')
+	digit := isDigit
+	if hex {
+		l.readChar()
 		l.readChar()
+		digit = isHexDigit
 	}
-	return l.input[initialPosition:l.position]
+	for digit(l.ch) || l.ch == '_' {
+		l.readChar()
+	}
+
+	if hex || l.ch != '.' || !isDigit(l.peekChar()) || token.Since(token.FLOAT) > l.lang {
+		return l.input[initialPosition:l.position], token.INT
+	}
+	l.readChar()
+	for isDigit(l.ch) || l.ch == '_' {
+		l.readChar()
+	}
+	return l.input[initialPosition:l.position], token.FLOAT
 }
 
+// readString returns the value of the string literal at the current char,
+// decoding its escape sequences: \n, \t, \", \\ and \u{XXXX}, a Unicode
+// code point in hex. Invalid escapes are errors. Language version 1 has no
+// escapes, so a backslash there is an ordinary char.
 func (l *Lexer) readString() string {
 	initialPosition := l.position + 1
-	for {
+	var value []byte // the value decoded so far, once an escape needs decoding
+	l.readChar()
+	for l.ch != '"' && l.ch != 0 {
+		if l.ch == '\\' && l.lang >= token.Lang2 {
+			if value == nil {
+				value = append([]byte{}, l.input[initialPosition:l.position]...)
+			}
+			value = l.readEscape(value)
+			continue
+		}
+		if value != nil {
+			value = append(value, l.ch)
+		}
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
+	}
+	if value == nil {
+		return l.input[initialPosition:l.position]
+	}
+	return string(value)
+}
+
+// readEscape appends the char the escape sequence at the current char
+// stands for to value, and moves past the sequence. An invalid sequence is
+// an error and appends nothing.
+func (l *Lexer) readEscape(value []byte) []byte {
+	start := l.pos()
+	l.readChar()
+	switch l.ch {
+	case 'n':
+		value = append(value, '\n')
+	case 't':
+		value = append(value, '\t')
+	case '"', '\\':
+		value = append(value, l.ch)
+	case 'u':
+		return l.readUnicodeEscape(value, start)
+	case 0:
+		l.errors = append(l.errors, Error{Pos: start, Message: "invalid escape sequence at end of input"})
+		return value
+	default:
+		msg := fmt.Sprintf("invalid escape sequence \\%c", l.ch)
+		l.errors = append(l.errors, Error{Pos: start, Message: msg})
+	}
+	l.readChar()
+	return value
+}
+
+// readUnicodeEscape reads the rest of a \u{XXXX} escape, which starts at
+// start, and appends the UTF-8 encoding of its code point to value.
+func (l *Lexer) readUnicodeEscape(value []byte, start token.Position) []byte {
+	l.readChar()
+	if l.ch != '{' {
+		l.errors = append(l.errors, Error{Pos: start, Message: `invalid Unicode escape \u: want \u{XXXX}`})
+		return value
+	}
+	l.readChar()
+	digits := l.position
+	for isHexDigit(l.ch) {
+		l.readChar()
+	}
+	hex := l.input[digits:l.position]
+	if l.ch != '}' || hex == "" || len(hex) > 6 {
+		msg := fmt.Sprintf("invalid Unicode escape \\u{%s: want \\u{XXXX} with 1 to 6 hex digits", hex)
+		l.errors = append(l.errors, Error{Pos: start, Message: msg})
+		return value
+	}
+	l.readChar()
+
+	r, _ := strconv.ParseUint(hex, 16, 32)
+	if !utf8.ValidRune(rune(r)) {
+		msg := fmt.Sprintf("invalid Unicode escape \\u{%s}: not a code point", hex)
+		l.errors = append(l.errors, Error{Pos: start, Message: msg})
+		return value
+	}
+	return utf8.AppendRune(value, rune(r))
+}
+
+// Comments returns the comments the lexer has skipped so far. They are not
+// part of the token stream, but tools such as the formatter and the doc
+// extractor need them.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
+// skipComment consumes a // comment up to the end of the line and records it.
+func (l *Lexer) skipComment() {
+	start := l.pos()
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+	l.comments = append(l.comments, token.Token{
+		Type:    token.COMMENT,
+		Literal: l.input[start.Offset:l.position],
+		Pos:     start,
+		End:     l.pos(),
+	})
+}
+
+// skipBlockComment consumes a /* */ comment, which may span lines, and
+// records it. Block comments do not nest. An unterminated one runs to the
+// end of the input and is an error.
+func (l *Lexer) skipBlockComment() {
+	start := l.pos()
+	l.readChar()
+	l.readChar()
+	for !(l.ch == '*' && l.peekChar() == '/') {
+		if l.ch == 0 {
+			l.errors = append(l.errors, Error{Pos: start, Message: "unterminated block comment"})
 			break
 		}
+		l.readChar()
 	}
-	return l.input[initialPosition:l.position]
+	if l.ch != 0 {
+		l.readChar()
+		l.readChar()
+	}
+	l.comments = append(l.comments, token.Token{
+		Type:    token.COMMENT,
+		Literal: l.input[start.Offset:l.position],
+		Pos:     start,
+		End:     l.pos(),
+	})
+}
+
+// Errors returns the malformed input the lexer has skipped so far.
+func (l *Lexer) Errors() []Error {
+	return l.errors
 }
 
 func (l *Lexer) skipWhitespace() {
@@ -160,6 +372,66 @@ func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
-	return token.Token{Type: tokenType, Literal: string(ch)}
+func isHexDigit(ch byte) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+// newToken returns a token of the current char. The types of operators and
+// delimiters are their literals, so only the literals of illegal chars
+// are slices of the input.
+func (l *Lexer) newToken(tokenType token.TokenType) token.Token {
+	if tokenType == token.ILLEGAL {
+		return token.Token{Type: tokenType, Literal: l.input[l.position:l.readPosition]}
+	}
+	return token.Token{Type: tokenType, Literal: string(tokenType)}
+}
+
+// operator returns the token of the operator op at the current char, or of
+// its compound assignment if an = follows and the language version has it.
+func (l *Lexer) operator(op, assign token.TokenType) token.Token {
+	if l.peekChar() == '=' && token.Since(assign) <= l.lang {
+		l.readChar()
+		return token.Token{Type: assign, Literal: string(assign)}
+	}
+	return l.newToken(op)
+}
+
+// pair returns the token of the operator double, spelled as the current
+// char twice, if the char follows and the language version has it.
+// Otherwise it returns the operator single, the current char alone.
+func (l *Lexer) pair(double, single token.TokenType) token.Token {
+	if l.peekChar() == l.ch && token.Since(double) <= l.lang {
+		l.readChar()
+		return token.Token{Type: double, Literal: string(double)}
+	}
+	return l.single(single)
+}
+
+// single returns the token of the operator t at the current char if the
+// language version has it. Otherwise the current char is illegal.
+func (l *Lexer) single(t token.TokenType) token.Token {
+	if token.Since(t) <= l.lang {
+		return l.newToken(t)
+	}
+	return l.newToken(token.ILLEGAL)
+}
+
+// SetLang makes the lexer read the source as language version lang, which
+// defaults to the latest, as does the zero Lang. It must be called before
+// the first token is read, that is before the lexer is handed to a parser.
+func (l *Lexer) SetLang(lang token.Lang) {
+	if lang == 0 {
+		lang = token.LangLatest
+	}
+	l.lang = lang
+}
+
+// Lang returns the language version the lexer reads.
+func (l *Lexer) Lang() token.Lang {
+	return l.lang
+}
+
+// Interner returns the interner of the lexer's literals.
+func (l *Lexer) Interner() *token.Interner {
+	return l.interner
 }
@@ -1,7 +1,9 @@
 package lexer
 
 import (
+	"strings"
 	"testing"
+	"unsafe"
 
 	"github.com/frankie-mur/monkeylang/token"
 )
@@ -13,7 +15,7 @@ func TestNextToken(t *testing.T) {
 	     x + y;
 		};
    		let result = add(five, ten);
-		!-/*5;
+		!-/ *5;
 		5 < 10 > 5;
 
 		if (5 < 10) {
@@ -27,6 +29,7 @@ func TestNextToken(t *testing.T) {
 		"foo bar"
 		[1, 2];
 		{"foo": "bar"}
+		1_000 0xFF_ff 0x1g 2_x
 	 `
 
 	tests := []struct {
@@ -119,6 +122,12 @@ func TestNextToken(t *testing.T) {
 		{token.COLON, ":"},
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
+		{token.INT, "1_000"},
+		{token.INT, "0xFF_ff"},
+		{token.INT, "0x1"},
+		{token.IDENT, "g"},
+		{token.INT, "2_"},
+		{token.IDENT, "x"},
 		{token.EOF, ""},
 	}
 
@@ -138,3 +147,347 @@ func TestNextToken(t *testing.T) {
 	}
 
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x + \"ab\";"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedPos     string
+		expectedEnd     string
+	}{
+		{"let", "1:1", "1:4"},
+		{"x", "1:5", "1:6"},
+		{"=", "1:7", "1:8"},
+		{"5", "1:9", "1:10"},
+		{";", "1:10", "1:11"},
+		{"x", "2:3", "2:4"},
+		{"+", "2:5", "2:6"},
+		{"ab", "2:7", "2:11"},
+		{";", "2:11", "2:12"},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos.String() != tt.expectedPos {
+			t.Errorf("tests[%d] - pos wrong. expected=%s, got=%s", i, tt.expectedPos, tok.Pos)
+		}
+		if tok.End.String() != tt.expectedEnd {
+			t.Errorf("tests[%d] - end wrong. expected=%s, got=%s", i, tt.expectedEnd, tok.End)
+		}
+	}
+}
+
+func TestCompoundAssignments(t *testing.T) {
+	input := "x += 1; x -= 2; x *= 3; x /= 4"
+
+	tests := []struct {
+		lang     token.Lang
+		expected []token.TokenType
+	}{
+		{token.LangLatest, []token.TokenType{token.PLUS_ASSIGN, token.MINUS_ASSIGN, token.ASTERISK_ASSIGN, token.SLASH_ASSIGN}},
+		{token.Lang1, []token.TokenType{token.PLUS, token.MINUS, token.ASTERISK, token.SLASH}},
+	}
+
+	for _, tt := range tests {
+		l := New(input)
+		l.SetLang(tt.lang)
+		var got []token.TokenType
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			if tok.Type != token.IDENT && tok.Type != token.INT && tok.Type != token.SEMICOLON && tok.Type != token.ASSIGN {
+				got = append(got, tok.Type)
+			}
+		}
+		if len(got) != len(tt.expected) {
+			t.Fatalf("lang %v: wrong operators. expected=%v, got=%v", tt.lang, tt.expected, got)
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("lang %v: operator %d wrong. expected=%q, got=%q", tt.lang, i, tt.expected[i], got[i])
+			}
+		}
+	}
+}
+
+func TestIncrementDecrement(t *testing.T) {
+	tests := []struct {
+		lang     token.Lang
+		expected []token.TokenType
+	}{
+		{token.LangLatest, []token.TokenType{token.IDENT, token.INCREMENT, token.IDENT, token.DECREMENT, token.PLUS, token.INT, token.MINUS, token.MINUS, token.INT, token.EOF}},
+		{token.Lang1, []token.TokenType{token.IDENT, token.PLUS, token.PLUS, token.IDENT, token.MINUS, token.MINUS, token.PLUS, token.INT, token.MINUS, token.MINUS, token.INT, token.EOF}},
+	}
+
+	for _, tt := range tests {
+		l := New("a++ b-- +1 - -1")
+		l.SetLang(tt.lang)
+		for i, expected := range tt.expected {
+			tok := l.NextToken()
+			if tok.Type != expected {
+				t.Fatalf("lang %v: tests[%d] - tokentype wrong. expected=%q, got=%q", tt.lang, i, expected, tok.Type)
+			}
+		}
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		lang     token.Lang
+		expected []token.TokenType
+	}{
+		{token.LangLatest, []token.TokenType{token.IDENT, token.AND, token.IDENT, token.OR, token.IDENT, token.AMPERSAND, token.PIPE, token.EOF}},
+		{token.Lang1, []token.TokenType{token.IDENT, token.ILLEGAL, token.ILLEGAL, token.IDENT, token.ILLEGAL, token.ILLEGAL, token.IDENT, token.ILLEGAL, token.ILLEGAL, token.EOF}},
+	}
+
+	for _, tt := range tests {
+		l := New("a && b || c & |")
+		l.SetLang(tt.lang)
+		for i, expected := range tt.expected {
+			tok := l.NextToken()
+			if tok.Type != expected {
+				t.Fatalf("lang %v: tests[%d] - tokentype wrong. expected=%q, got=%q", tt.lang, i, expected, tok.Type)
+			}
+		}
+	}
+}
+
+func TestFloats(t *testing.T) {
+	input := "3.14 1_000.5 0x1.5 2.x"
+
+	tests := []struct {
+		lang     token.Lang
+		expected []token.Token
+	}{
+		{token.LangLatest, []token.Token{
+			{Type: token.FLOAT, Literal: "3.14"},
+			{Type: token.FLOAT, Literal: "1_000.5"},
+			{Type: token.INT, Literal: "0x1"},
+			{Type: token.ILLEGAL, Literal: "."},
+			{Type: token.INT, Literal: "5"},
+			{Type: token.INT, Literal: "2"},
+			{Type: token.ILLEGAL, Literal: "."},
+			{Type: token.IDENT, Literal: "x"},
+		}},
+		{token.Lang1, []token.Token{
+			{Type: token.INT, Literal: "3"},
+			{Type: token.ILLEGAL, Literal: "."},
+			{Type: token.INT, Literal: "14"},
+		}},
+	}
+
+	for _, tt := range tests {
+		l := New(input)
+		l.SetLang(tt.lang)
+		for i, expected := range tt.expected {
+			tok := l.NextToken()
+			if tok.Type != expected.Type || tok.Literal != expected.Literal {
+				t.Fatalf("lang %v: tests[%d] - wrong token. expected=%q %q, got=%q %q",
+					tt.lang, i, expected.Type, expected.Literal, tok.Type, tok.Literal)
+			}
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		lang     token.Lang
+		expected string
+		err      string
+	}{
+		{`"a\nb\tc"`, token.LangLatest, "a\nb\tc", ""},
+		{`"say \"hi\" \\o/"`, token.LangLatest, `say "hi" \o/`, ""},
+		{`"caf\u{e9} \u{1F600}"`, token.LangLatest, "caf\u00e9 \U0001F600", ""},
+		{`"a\nb"`, token.Lang1, `a\nb`, ""},
+		{`"a\qb"`, token.LangLatest, "ab", `1:3: invalid escape sequence \q`},
+		{`"\u41"`, token.LangLatest, "41", `1:2: invalid Unicode escape \u: want \u{XXXX}`},
+		{`"\u{}"`, token.LangLatest, "}", `1:2: invalid Unicode escape \u{: want \u{XXXX} with 1 to 6 hex digits`},
+		{`"\u{110000}"`, token.LangLatest, "", `1:2: invalid Unicode escape \u{110000}: not a code point`},
+		{`"\u{d800}"`, token.LangLatest, "", `1:2: invalid Unicode escape \u{d800}: not a code point`},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		l.SetLang(tt.lang)
+		tok := l.NextToken()
+		if tok.Type != token.STRING || tok.Literal != tt.expected {
+			t.Errorf("%s: wrong token. expected=%q, got=%q %q", tt.input, tt.expected, tok.Type, tok.Literal)
+		}
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("%s: string did not end at its closing quote. next=%q", tt.input, next.Literal)
+		}
+
+		var err string
+		if errs := l.Errors(); len(errs) > 0 {
+			err = errs[0].Pos.String() + ": " + errs[0].Message
+		}
+		if err != tt.err {
+			t.Errorf("%s: wrong error. expected=%q, got=%q", tt.input, tt.err, err)
+		}
+	}
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	tests := []struct {
+		lang     token.Lang
+		expected []token.TokenType
+	}{
+		{token.LangLatest, []token.TokenType{token.TILDE, token.IDENT, token.CARET, token.IDENT, token.SHIFT_LEFT, token.INT, token.SHIFT_RIGHT, token.INT, token.LT, token.GT, token.EOF}},
+		{token.Lang1, []token.TokenType{token.ILLEGAL, token.IDENT, token.ILLEGAL, token.IDENT, token.LT, token.LT, token.INT, token.GT, token.GT, token.INT, token.LT, token.GT, token.EOF}},
+	}
+
+	for _, tt := range tests {
+		l := New("~a ^ b << 1 >> 2 < >")
+		l.SetLang(tt.lang)
+		for i, expected := range tt.expected {
+			tok := l.NextToken()
+			if tok.Type != expected {
+				t.Fatalf("lang %v: tests[%d] - tokentype wrong. expected=%q, got=%q", tt.lang, i, expected, tok.Type)
+			}
+		}
+	}
+}
+
+func TestLineComments(t *testing.T) {
+	input := `// leading comment
+let x = 5; // trailing comment
+//
+x / 2;`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	expectedComments := []string{"// leading comment", "// trailing comment", "//"}
+	comments := l.Comments()
+	if len(comments) != len(expectedComments) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(expectedComments), len(comments))
+	}
+	for i, c := range comments {
+		if c.Literal != expectedComments[i] {
+			t.Errorf("comments[%d] wrong. expected=%q, got=%q", i, expectedComments[i], c.Literal)
+		}
+	}
+	if comments[1].Pos.String() != "2:12" {
+		t.Errorf("comments[1] position wrong. got=%s", comments[1].Pos)
+	}
+}
+
+func TestBlockComments(t *testing.T) {
+	input := `/* leading
+comment */ let x = /* inline */ 5;
+x /**/ / 2; /* unterminated`
+
+	expectedTypes := []token.TokenType{
+		token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.SLASH, token.INT, token.SEMICOLON, token.EOF,
+	}
+
+	l := New(input)
+	for i, expected := range expectedTypes {
+		tok := l.NextToken()
+		if tok.Type != expected {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, expected, tok.Type)
+		}
+	}
+
+	expectedComments := []string{"/* leading\ncomment */", "/* inline */", "/**/", "/* unterminated"}
+	comments := l.Comments()
+	if len(comments) != len(expectedComments) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(expectedComments), len(comments))
+	}
+	for i, c := range comments {
+		if c.Literal != expectedComments[i] {
+			t.Errorf("comments[%d] wrong. expected=%q, got=%q", i, expectedComments[i], c.Literal)
+		}
+	}
+	if comments[0].End.String() != "2:11" {
+		t.Errorf("comments[0] end wrong. got=%s", comments[0].End)
+	}
+
+	errs := l.Errors()
+	if len(errs) != 1 || errs[0].Pos.String() != "3:13" || errs[0].Message != "unterminated block comment" {
+		t.Errorf("wrong errors. got=%v", errs)
+	}
+}
+
+// benchmarkSource is a program exercising every kind of token, repeated
+// to the size of a large file.
+var benchmarkSource = strings.Repeat(`// Sorts xs by merging sorted halves.
+let merge = fn(a, b, acc) {
+	if (len(a) == 0) { return acc + b; };
+	if (first(b) < first(a)) { merge(a, rest(b), push(acc, first(b))) } else { merge(rest(a), b, push(acc, first(a))) }
+};
+let config = {"name": "monkey", "depth": 10, true: [1, 2, 3], "ok": !false != true};
+let result = merge([1, 4, 9], [2, 3, 10], []) * -1 / 2 > 5;
+`, 2000)
+
+func BenchmarkNextToken(b *testing.B) {
+	b.SetBytes(int64(len(benchmarkSource)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l := New(benchmarkSource)
+		for l.NextToken().Type != token.EOF {
+		}
+	}
+}
+
+func TestInterning(t *testing.T) {
+	in := token.NewInterner()
+	var literals []string
+	for _, src := range []string{`let foo = "bar"; foo`, `foo + "bar"`} {
+		l := NewWithInterner(src, in)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			if tok.Literal == "foo" || tok.Literal == "bar" {
+				literals = append(literals, tok.Literal)
+			}
+		}
+	}
+
+	if len(literals) != 5 {
+		t.Fatalf("wrong literals %q", literals)
+	}
+	for _, lit := range literals {
+		want := literals[0]
+		if lit == "bar" {
+			want = literals[1]
+		}
+		if unsafe.StringData(lit) != unsafe.StringData(want) {
+			t.Errorf("%q is not interned", lit)
+		}
+	}
+	if in.Len() != 3 {
+		t.Errorf("wrong number of interned strings. want=3 (let, foo and bar), got=%d", in.Len())
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/object"
+)
+
+// addLimitFlags registers the flags that restrict a program's resources,
+// --timeout, --max-steps, --max-depth, --no-io and --sandbox, storing them
+// in opts.
+func addLimitFlags(flags *flag.FlagSet, opts *runOptions) {
+	flags.DurationVar(&opts.timeout, "timeout", 0, "stop the program after this long (0 means no limit)")
+	flags.Var((*countFlag)(&opts.limits.MaxSteps), "max-steps", "stop the program after evaluating `n` syntax nodes, e.g. 1e8 (0 means no limit)")
+	flags.IntVar(&opts.limits.MaxDepth, "max-depth", 0, "maximum `depth` of nested function calls (0 means the engine's default)")
+	flags.BoolVar(&opts.limits.NoIO, "no-io", false, "disable builtins that perform I/O, such as puts")
+	flags.Var(sandboxFlag{&opts.limits.Sandbox}, "sandbox", "grant the program only the `capabilities` fs, net, process, env, time, runtime and signal in this comma-separated list, or none")
+}
+
+// sandboxFlag is the value of --sandbox, a list of the capabilities to
+// grant. Giving the flag at all sandboxes the program.
+type sandboxFlag struct {
+	sandbox **evaluator.Sandbox
+}
+
+func (s sandboxFlag) String() string {
+	if s.sandbox == nil || *s.sandbox == nil {
+		return ""
+	}
+	var granted []string
+	for _, c := range []object.Capability{object.CapFilesystem, object.CapNetwork, object.CapProcess, object.CapEnvironment, object.CapTime, object.CapRuntime, object.CapSignal} {
+		if (*s.sandbox).Grants(c) {
+			granted = append(granted, string(c))
+		}
+	}
+	if len(granted) == 0 {
+		return "none"
+	}
+	return strings.Join(granted, ",")
+}
+
+func (s sandboxFlag) Set(value string) error {
+	sandbox := &evaluator.Sandbox{}
+	if value != "none" && value != "" {
+		for _, name := range strings.Split(value, ",") {
+			if err := sandbox.Grant(object.Capability(strings.TrimSpace(name))); err != nil {
+				return err
+			}
+		}
+	}
+	*s.sandbox = sandbox
+	return nil
+}
+
+// countFlag is an int64 flag that also accepts exponent notation such as
+// 1e8, which is easier to read for large counts.
+type countFlag int64
+
+func (c *countFlag) String() string {
+	return strconv.FormatInt(int64(*c), 10)
+}
+
+func (c *countFlag) Set(value string) error {
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		*c = countFlag(n)
+		return nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 || f > math.MaxInt64 || f != math.Trunc(f) {
+		return fmt.Errorf("invalid count %q", value)
+	}
+	*c = countFlag(f)
+	return nil
+}
@@ -0,0 +1,298 @@
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// Diagnostic is a single problem found in a program.
+type Diagnostic struct {
+	Pos     token.Position
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return d.Pos.String() + ": " + d.Message
+}
+
+// Check runs every lint check over program and returns the diagnostics
+// ordered by position. It reports
+//
+//   - let bindings inside functions that are never used,
+//   - bindings that shadow a binding of an enclosing scope,
+//   - statements following a return in the same block,
+//   - == and != between values that can never be equal,
+//   - empty if, else and function bodies.
+func Check(program *ast.Program) []Diagnostic {
+	l := &linter{}
+	global := &scope{linter: l, bindings: map[string]*binding{}}
+	ast.Walk(global, program)
+	global.close()
+
+	sort.SliceStable(l.diagnostics, func(i, j int) bool {
+		return l.diagnostics[i].Pos.Offset < l.diagnostics[j].Pos.Offset
+	})
+	return l.diagnostics
+}
+
+type linter struct {
+	diagnostics []Diagnostic
+}
+
+func (l *linter) report(pos token.Position, format string, args ...interface{}) {
+	l.diagnostics = append(l.diagnostics, Diagnostic{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+type binding struct {
+	name *ast.Identifier
+	used bool
+	// local bindings are let statements inside a function body; those are
+	// the only ones reported when unused.
+	local bool
+}
+
+// scope is the ast.Visitor for one function body, or for the program at
+// the top level. Blocks do not open a scope in Monkey; only functions do.
+type scope struct {
+	linter   *linter
+	outer    *scope
+	bindings map[string]*binding
+	// pending holds names used by nested functions that were not bound yet
+	// when the function was visited. They are resolved when the scope ends
+	// so a closure may refer to a binding declared after it.
+	pending []string
+}
+
+func (s *scope) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case nil:
+		return nil
+
+	case *ast.Program:
+		s.checkUnreachable(node.Statements)
+
+	case *ast.BlockStatement:
+		s.checkUnreachable(node.Statements)
+
+	case *ast.LetStatement:
+		// A function may call itself, so its name is bound before the body
+		// is visited. Any other value is evaluated before the binding exists.
+		if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+			s.define(node.Name, s.outer != nil)
+			ast.Walk(s, node.Value)
+		} else {
+			if node.Value != nil {
+				ast.Walk(s, node.Value)
+			}
+			s.define(node.Name, s.outer != nil)
+		}
+		return nil
+
+	case *ast.EnumStatement:
+		for _, variant := range node.Variants {
+			s.define(variant.Name, false)
+		}
+		return nil
+
+	case *ast.MatchArm:
+		if node.Pattern.Value != "_" {
+			s.use(node.Pattern.Value)
+		}
+		for _, f := range node.Fields {
+			if f.Value != "_" {
+				s.define(f, s.outer != nil)
+			}
+		}
+		ast.Walk(s, node.Body)
+		return nil
+
+	case *ast.ForExpression:
+		if node.Iterable != nil {
+			ast.Walk(s, node.Iterable)
+		}
+		for _, v := range []*ast.Identifier{node.Key, node.Value} {
+			if v != nil && v.Value != "_" {
+				s.define(v, s.outer != nil)
+			}
+		}
+		if node.Body != nil {
+			ast.Walk(s, node.Body)
+		}
+		return nil
+
+	case *ast.Identifier:
+		s.use(node.Value)
+
+	case *ast.InfixExpression:
+		s.checkComparison(node)
+
+	case *ast.IfExpression:
+		if node.Consequence != nil && len(node.Consequence.Statements) == 0 {
+			s.linter.report(node.Consequence.Pos(), "empty if block")
+		}
+		if node.Alternative != nil && len(node.Alternative.Statements) == 0 {
+			s.linter.report(node.Alternative.Pos(), "empty else block")
+		}
+
+	case *ast.FunctionLiteral:
+		if node.Body != nil && len(node.Body.Statements) == 0 {
+			s.linter.report(node.Body.Pos(), "empty function body")
+		}
+
+		inner := &scope{linter: s.linter, outer: s, bindings: map[string]*binding{}}
+		for _, param := range node.Parameters {
+			inner.define(param, false)
+		}
+		if node.Body != nil {
+			ast.Walk(inner, node.Body)
+		}
+		inner.close()
+		return nil
+	}
+
+	return s
+}
+
+func (s *scope) define(name *ast.Identifier, local bool) {
+	if name == nil {
+		return
+	}
+
+	for outer := s.outer; outer != nil; outer = outer.outer {
+		if prev, ok := outer.bindings[name.Value]; ok {
+			s.linter.report(name.Pos(), "%s shadows declaration at %s", name.Value, prev.name.Pos())
+			break
+		}
+	}
+
+	s.bindings[name.Value] = &binding{name: name, local: local}
+}
+
+func (s *scope) use(name string) {
+	for sc := s; sc != nil; sc = sc.outer {
+		if b, ok := sc.bindings[name]; ok {
+			b.used = true
+			return
+		}
+	}
+	s.pending = append(s.pending, name)
+}
+
+// close resolves forward references and reports the scope's unused
+// bindings. Names still unresolved are handed to the enclosing scope.
+func (s *scope) close() {
+	for _, name := range s.pending {
+		if b, ok := s.bindings[name]; ok {
+			b.used = true
+		} else if s.outer != nil {
+			s.outer.pending = append(s.outer.pending, name)
+		}
+	}
+	s.pending = nil
+
+	for _, b := range s.bindings {
+		if b.local && !b.used && !strings.HasPrefix(b.name.Value, "_") {
+			s.linter.report(b.name.Pos(), "%s declared and not used", b.name.Value)
+		}
+	}
+}
+
+// checkUnreachable reports the first statement following a return.
+func (s *scope) checkUnreachable(stmts []ast.Statement) {
+	for i, stmt := range stmts {
+		if _, ok := stmt.(*ast.ReturnStatement); ok && i+1 < len(stmts) {
+			s.linter.report(stmts[i+1].Pos(), "unreachable code")
+			return
+		}
+	}
+}
+
+// checkComparison reports equality checks whose result is known statically:
+// operands of different types never compare equal, and array, hash and
+// function literals are fresh objects compared by identity.
+func (s *scope) checkComparison(ie *ast.InfixExpression) {
+	if ie.Operator != "==" && ie.Operator != "!=" {
+		return
+	}
+
+	left, right := StaticType(ie.Left), StaticType(ie.Right)
+	result := ie.Operator == "!="
+
+	switch {
+	case left != "" && right != "" && left != right && !(isNumeric(left) && isNumeric(right)):
+		s.linter.report(ie.Pos(), "comparison of %s %s %s is always %t", left, ie.Operator, right, result)
+	case isIdentityCompared(left) || isIdentityCompared(right):
+		kind := left
+		if !isIdentityCompared(kind) {
+			kind = right
+		}
+		s.linter.report(ie.Pos(), "comparison with %s literal is always %t", strings.ToLower(kind), result)
+	}
+}
+
+// isNumeric reports whether t is a number type. Integers and floats
+// compare by value, so 1 == 1.0.
+func isNumeric(t string) bool {
+	return t == "INTEGER" || t == "FLOAT"
+}
+
+func isIdentityCompared(t string) bool {
+	return t == "ARRAY" || t == "HASH" || t == "FUNCTION"
+}
+
+// StaticType returns the object type an expression is known to produce
+// without evaluating it, or "" when it depends on runtime values.
+func StaticType(exp ast.Expression) string {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return "INTEGER"
+	case *ast.FloatLiteral:
+		return "FLOAT"
+	case *ast.StringLiteral:
+		return "STRING"
+	case *ast.Boolean:
+		return "BOOLEAN"
+	case *ast.ArrayLiteral:
+		return "ARRAY"
+	case *ast.HashLiteral:
+		return "HASH"
+	case *ast.FunctionLiteral:
+		return "FUNCTION"
+	case *ast.SliceExpression:
+		if t := StaticType(exp.Left); t == "ARRAY" || t == "STRING" {
+			return t
+		}
+	case *ast.PrefixExpression:
+		if exp.Operator == "!" {
+			return "BOOLEAN"
+		}
+		if t := StaticType(exp.Right); t == "INTEGER" || t == "FLOAT" && exp.Operator == "-" {
+			return t
+		}
+	case *ast.InfixExpression:
+		switch exp.Operator {
+		case "==", "!=", "<", ">", "&&", "||":
+			return "BOOLEAN"
+		case "&", "|", "^", "<<", ">>":
+			if StaticType(exp.Left) == "INTEGER" && StaticType(exp.Right) == "INTEGER" {
+				return "INTEGER"
+			}
+			return ""
+		}
+		left, right := StaticType(exp.Left), StaticType(exp.Right)
+		if left == right && (left == "INTEGER" || left == "FLOAT" || left == "STRING" && exp.Operator == "+") {
+			return left
+		}
+		if left == "FLOAT" && right == "INTEGER" || left == "INTEGER" && right == "FLOAT" {
+			return "FLOAT"
+		}
+		if left == "ARRAY" && (right == "ARRAY" && exp.Operator == "+" || right == "INTEGER" && exp.Operator == "*") {
+			return left
+		}
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+package lint
+
+import (
+	"testing"
+
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/parser"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let f = fn(x) { let y = 1; x }; f(1);", []string{"1:21: y declared and not used"}},
+		{"let f = fn(x) { let _y = 1; x }; f(1);", nil},
+		{"let unused = 1;", nil},
+		{"let x = 1; let f = fn(x) { x }; f(x);", []string{"1:23: x shadows declaration at 1:5"}},
+		{"let f = fn() { let g = fn() { h() }; let h = fn() { 1 }; g() }; f();", nil},
+		{"let f = fn() { return 1; 2 }; f();", []string{"1:26: unreachable code"}},
+		{`if (x == "1") { 1 }`, nil},
+		{`if (1 == "1") { 1 }`, []string{"1:5: comparison of INTEGER == STRING is always false"}},
+		{`if (1 == 1.0) { 1 }`, nil},
+		{`if (-1.5 * 2 == "3") { 1 }`, []string{"1:5: comparison of FLOAT == STRING is always false"}},
+		{`if (~1 & 6 == "3") { 1 }`, []string{"1:5: comparison of INTEGER == STRING is always false"}},
+		{`if (1.5 & 2 == "3") { 1 }`, nil},
+		{`if (!x != 2) { 1 }`, []string{"1:5: comparison of BOOLEAN != INTEGER is always true"}},
+		{`a == [1]`, []string{"1:1: comparison with array literal is always false"}},
+		{`"abc"[1:] == 1`, []string{"1:1: comparison of STRING == INTEGER is always false"}},
+		{`([1] * 3) == 3`, []string{"1:2: comparison of ARRAY == INTEGER is always false"}},
+		{"if (x) {} else {}", []string{"1:8: empty if block", "1:16: empty else block"}},
+		{"let f = fn() {};", []string{"1:14: empty function body"}},
+		{"let f = fn(s) { enum E { A(x), B } match (s) { A(y) => { 1 } B => { 2 } } }; f(1);", []string{"1:50: y declared and not used"}},
+		{"let f = fn(s) { enum E { A(x) } match (s) { A(_) => { 1 } } }; f(1);", nil},
+		{"let f = fn(xs) { for (i, x in xs) { puts(x) } }; f([1]);", []string{"1:23: i declared and not used"}},
+		{"let f = fn(xs) { for (_, x in xs) { puts(x) } }; f([1]);", nil},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, p.Errors())
+		}
+
+		diagnostics := Check(program)
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("wrong number of diagnostics for %q. expected=%v, got=%v", tt.input, tt.expected, diagnostics)
+			continue
+		}
+		for i, d := range diagnostics {
+			if d.String() != tt.expected[i] {
+				t.Errorf("diagnostic %d for %q wrong. expected=%q, got=%q", i, tt.input, tt.expected[i], d.String())
+			}
+		}
+	}
+}
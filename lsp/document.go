@@ -0,0 +1,531 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/doc"
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/highlight"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/lint"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/parser"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// document is an open source file and what the server worked out about
+// it. It is rebuilt from scratch whenever the text changes.
+type document struct {
+	uri   string
+	text  string
+	lines []int // byte offsets at which the lines start
+
+	program     *ast.Program
+	parseErrors []*parser.ParseError
+
+	// refs are the identifiers of the program in source order, each with
+	// the binding it refers to. Definitions refer to themselves.
+	refs   []*reference
+	scopes []*scope
+
+	// braces maps the offset of each { to the offset just past the }
+	// closing it.
+	braces map[int]int
+
+	// docs are the doc comments of top-level functions by the offset of
+	// their let statement.
+	docs map[int]string
+}
+
+// symbol is a binding: a let statement, a function parameter, an enum
+// variant or a field bound by a match arm.
+type symbol struct {
+	name *ast.Identifier
+	let  *ast.LetStatement // nil for the other bindings
+	// detail describes a binding other than a let statement or a
+	// parameter, such as "(variant of Shape) Rect(w, h)".
+	detail string
+}
+
+type reference struct {
+	ident  *ast.Identifier
+	symbol *symbol // nil for builtins and names bound nowhere
+}
+
+// scope is a function body, or the whole program at the top level. Blocks
+// do not open a scope in Monkey.
+type scope struct {
+	start, end int // the byte offsets spanned
+	outer      *scope
+	bindings   map[string]*symbol
+	symbols    []*symbol // in source order
+	// pending are the references of nested functions to names not bound
+	// yet when the function was visited, as in the lint package.
+	pending []*reference
+	doc     *document
+}
+
+func newDocument(uri, text string) *document {
+	d := &document{uri: uri, text: text, lines: []int{0}, braces: map[int]int{}, docs: map[int]string{}}
+	for i, c := range text {
+		if c == '\n' {
+			d.lines = append(d.lines, i+1)
+		}
+	}
+
+	var open []int
+	l := lexer.New(text)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch {
+		case tok.Type == token.LBRACE:
+			open = append(open, tok.Pos.Offset)
+		case tok.Type == token.RBRACE && len(open) > 0:
+			d.braces[open[len(open)-1]] = tok.End.Offset
+			open = open[:len(open)-1]
+		}
+	}
+
+	p := parser.New(lexer.New(text))
+	d.program = p.ParseProgram()
+	d.parseErrors = p.ParseErrors()
+
+	global := d.newScope(nil, 0, len(text))
+	ast.Walk(global, d.program)
+	global.close()
+	sort.SliceStable(d.refs, func(i, j int) bool {
+		return d.refs[i].ident.Pos().Offset < d.refs[j].ident.Pos().Offset
+	})
+
+	if file, err := doc.Extract(uri, text); err == nil {
+		for _, f := range file.Funcs {
+			d.docs[f.Pos.Offset] = f.Doc
+		}
+	}
+	return d
+}
+
+func (d *document) newScope(outer *scope, start, end int) *scope {
+	s := &scope{start: start, end: end, outer: outer, bindings: map[string]*symbol{}, doc: d}
+	d.scopes = append(d.scopes, s)
+	return s
+}
+
+func (s *scope) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case nil:
+		return nil
+
+	// The parser leaves nil statements where it failed to parse one.
+	case *ast.ReturnStatement:
+		if node == nil {
+			return nil
+		}
+	case *ast.ExpressionStatement:
+		if node == nil {
+			return nil
+		}
+
+	case *ast.LetStatement:
+		if node == nil {
+			return nil
+		}
+		// A function may call itself, so its name is bound before the body
+		// is visited. Any other value is evaluated before the binding exists.
+		if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+			s.define(node.Name, node)
+			ast.Walk(s, node.Value)
+		} else {
+			if node.Value != nil {
+				ast.Walk(s, node.Value)
+			}
+			s.define(node.Name, node)
+		}
+		return nil
+
+	case *ast.EnumStatement:
+		for _, variant := range node.Variants {
+			s.define(variant.Name, nil).detail = "(variant of " + node.Name.Value + ") " + variant.String()
+		}
+		return nil
+
+	case *ast.MatchArm:
+		if node.Pattern.Value != "_" {
+			s.use(node.Pattern)
+		}
+		for _, f := range node.Fields {
+			s.define(f, nil).detail = "(field of " + node.Pattern.Value + ") " + f.Value
+		}
+		ast.Walk(s, node.Body)
+		return nil
+
+	case *ast.ForExpression:
+		if node.Iterable != nil {
+			ast.Walk(s, node.Iterable)
+		}
+		for _, v := range []*ast.Identifier{node.Key, node.Value} {
+			if v != nil {
+				s.define(v, nil).detail = "(loop variable) " + v.Value
+			}
+		}
+		if node.Body != nil {
+			ast.Walk(s, node.Body)
+		}
+		return nil
+
+	case *ast.Identifier:
+		s.use(node)
+
+	case *ast.FunctionLiteral:
+		end := len(s.doc.text)
+		if node.Body != nil {
+			end = s.doc.closingBrace(node.Body.Pos().Offset)
+		}
+		inner := s.doc.newScope(s, node.Pos().Offset, end)
+		for _, param := range node.Parameters {
+			inner.define(param, nil)
+		}
+		if node.Body != nil {
+			ast.Walk(inner, node.Body)
+		}
+		inner.close()
+		return nil
+	}
+
+	return s
+}
+
+func (s *scope) define(name *ast.Identifier, let *ast.LetStatement) *symbol {
+	sym := &symbol{name: name, let: let}
+	if name == nil {
+		return sym
+	}
+	s.bindings[name.Value] = sym
+	s.symbols = append(s.symbols, sym)
+	s.doc.refs = append(s.doc.refs, &reference{ident: name, symbol: sym})
+	return sym
+}
+
+func (s *scope) use(ident *ast.Identifier) {
+	ref := &reference{ident: ident}
+	s.doc.refs = append(s.doc.refs, ref)
+	if ref.symbol = s.lookup(ident.Value); ref.symbol == nil {
+		s.pending = append(s.pending, ref)
+	}
+}
+
+func (s *scope) lookup(name string) *symbol {
+	for sc := s; sc != nil; sc = sc.outer {
+		if sym, ok := sc.bindings[name]; ok {
+			return sym
+		}
+	}
+	return nil
+}
+
+// close resolves the forward references of nested functions. Names still
+// unresolved are handed to the enclosing scope.
+func (s *scope) close() {
+	for _, ref := range s.pending {
+		if sym, ok := s.bindings[ref.ident.Value]; ok {
+			ref.symbol = sym
+		} else if s.outer != nil {
+			s.outer.pending = append(s.outer.pending, ref)
+		}
+	}
+	s.pending = nil
+}
+
+// closingBrace returns the offset just past the brace closing the one at
+// open, or the end of the text if it is not closed.
+func (d *document) closingBrace(open int) int {
+	if end, ok := d.braces[open]; ok {
+		return end
+	}
+	return len(d.text)
+}
+
+// position converts a byte offset into an LSP position.
+func (d *document) position(offset int) Position {
+	offset = max(0, min(offset, len(d.text)))
+	line := sort.Search(len(d.lines), func(i int) bool { return d.lines[i] > offset }) - 1
+	start := d.lines[line]
+	return Position{Line: line, Character: utf16Len(d.text[start:offset])}
+}
+
+// offset converts an LSP position into a byte offset, clamped to the
+// document.
+func (d *document) offset(pos Position) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(d.lines) {
+		return len(d.text)
+	}
+	start := d.lines[pos.Line]
+	units := 0
+	for i, r := range d.text[start:] {
+		if units >= pos.Character || r == '\n' {
+			return start + i
+		}
+		units += utf16Len(string(r))
+	}
+	return len(d.text)
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+func (d *document) identRange(ident *ast.Identifier) Range {
+	return Range{Start: d.position(ident.Token.Pos.Offset), End: d.position(ident.Token.End.Offset)}
+}
+
+// wordRange returns the range of the word starting at pos, or of the
+// character there if there is no word, for diagnostics that only know
+// where the problem starts.
+func (d *document) wordRange(pos token.Position) Range {
+	start := max(0, min(pos.Offset, len(d.text)))
+	end := start
+	for i, r := range d.text[start:] {
+		if !(r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if i == 0 && r != '\n' {
+				end += len(string(r))
+			}
+			break
+		}
+		end = start + i + len(string(r))
+	}
+	return Range{Start: d.position(start), End: d.position(end)}
+}
+
+// diagnostics returns the parse errors of the document or, if it parses,
+// what the linter reports about it.
+func (d *document) diagnostics() []Diagnostic {
+	diagnostics := []Diagnostic{}
+	for _, err := range d.parseErrors {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    d.wordRange(err.Pos),
+			Severity: SeverityError,
+			Source:   "monkey",
+			Message:  err.Message,
+		})
+	}
+	if len(diagnostics) > 0 {
+		return diagnostics
+	}
+
+	for _, diag := range lint.Check(d.program) {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    d.wordRange(diag.Pos),
+			Severity: SeverityWarning,
+			Source:   "monkey lint",
+			Message:  diag.Message,
+		})
+	}
+	return diagnostics
+}
+
+// referenceAt returns the identifier at offset, also matching a cursor
+// just after it.
+func (d *document) referenceAt(offset int) *reference {
+	for _, ref := range d.refs {
+		if ref.ident.Token.Pos.Offset <= offset && offset <= ref.ident.Token.End.Offset {
+			return ref
+		}
+	}
+	return nil
+}
+
+func (d *document) definition(pos Position) *Location {
+	ref := d.referenceAt(d.offset(pos))
+	if ref == nil || ref.symbol == nil {
+		return nil
+	}
+	return &Location{URI: d.uri, Range: d.identRange(ref.symbol.name)}
+}
+
+func (d *document) hover(pos Position) *Hover {
+	ref := d.referenceAt(d.offset(pos))
+	if ref == nil {
+		return nil
+	}
+
+	var text string
+	if ref.symbol != nil {
+		text = d.describe(ref.symbol)
+	} else if b, ok := evaluator.LookupBuiltin(ref.ident.Value); ok {
+		text = describeFunc(doc.Func{Name: ref.ident.Value, Params: b.Params, Doc: b.Doc}, "builtin ")
+	} else {
+		return nil
+	}
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: text},
+		Range:    d.identRange(ref.ident),
+	}
+}
+
+// describe renders what is known about a binding without running the
+// program: the signature and doc comment of a function, and the type and
+// value of a constant.
+func (d *document) describe(sym *symbol) string {
+	name := sym.name.Value
+	if sym.let == nil && sym.detail != "" {
+		return codeBlock(sym.detail)
+	}
+	if sym.let == nil {
+		return codeBlock("(parameter) " + name)
+	}
+
+	value := sym.let.Value
+	if fn, ok := value.(*ast.FunctionLiteral); ok {
+		f := doc.Func{Name: name, Doc: d.docs[sym.let.Pos().Offset]}
+		for _, p := range fn.Parameters {
+			f.Params = append(f.Params, p.Value)
+		}
+		return describeFunc(f, "let ")
+	}
+
+	text := codeBlock("let " + name)
+	if obj, ok := constant(value); ok {
+		text += fmt.Sprintf("\n%s `%s`", obj.Type(), obj.Inspect())
+	} else if t := lint.StaticType(value); t != "" {
+		text += "\n" + t
+	}
+	return text
+}
+
+func describeFunc(f doc.Func, prefix string) string {
+	text := codeBlock(prefix + f.Signature())
+	if f.Doc != "" {
+		text += "\n" + f.Doc
+	}
+	return text
+}
+
+func codeBlock(code string) string {
+	return "```monkey\n" + code + "\n```\n"
+}
+
+// constant evaluates exp if it is built from literals and operators alone.
+func constant(exp ast.Expression) (object.Object, bool) {
+	if exp == nil {
+		return nil, false
+	}
+	pure := true
+	ast.Inspect(exp, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.Identifier, *ast.CallExpression, *ast.FunctionLiteral, *ast.IfExpression, *ast.IndexExpression,
+			*ast.SliceExpression, *ast.WhileExpression:
+			// A loop with a constant condition may never end.
+			pure = false
+		}
+		return pure
+	})
+	if !pure {
+		return nil, false
+	}
+
+	obj := evaluator.Eval(exp, object.NewEnvironment())
+	if obj == nil || obj.Type() == object.ERROR_OBJ {
+		return nil, false
+	}
+	return obj, true
+}
+
+var keywords = []string{"fn", "let", "true", "false", "if", "else", "return", "enum", "match", "while", "for", "in", "switch", "case", "default"}
+
+// completion proposes the keywords, the builtins and the bindings in scope
+// at pos, inner ones first.
+func (d *document) completion(pos Position) []CompletionItem {
+	offset := d.offset(pos)
+	items := []CompletionItem{}
+	seen := map[string]bool{}
+
+	var innermost *scope
+	for _, s := range d.scopes {
+		if s.start <= offset && offset <= s.end && (innermost == nil || s.start >= innermost.start) {
+			innermost = s
+		}
+	}
+	for s := innermost; s != nil; s = s.outer {
+		for i := len(s.symbols) - 1; i >= 0; i-- {
+			sym := s.symbols[i]
+			if seen[sym.name.Value] || sym.name.Token.End.Offset >= offset {
+				continue
+			}
+			seen[sym.name.Value] = true
+
+			item := CompletionItem{Label: sym.name.Value, Kind: CompletionVariable}
+			if sym.let != nil {
+				if _, ok := sym.let.Value.(*ast.FunctionLiteral); ok {
+					item.Kind = CompletionFunction
+				}
+			}
+			item.Documentation = &MarkupContent{Kind: "markdown", Value: d.describe(sym)}
+			items = append(items, item)
+		}
+	}
+
+	for _, f := range doc.Builtins() {
+		if seen[f.Name] {
+			continue
+		}
+		items = append(items, CompletionItem{
+			Label:         f.Name,
+			Kind:          CompletionFunction,
+			Detail:        f.Signature(),
+			Documentation: &MarkupContent{Kind: "markdown", Value: f.Doc},
+		})
+	}
+	for _, kw := range keywords {
+		items = append(items, CompletionItem{Label: kw, Kind: CompletionKeyword})
+	}
+	return items
+}
+
+// semanticTokens classifies the tokens of the document. Tokens spanning
+// lines, such as multi-line strings, are split into one token per line, as
+// clients need not support tokens that span lines.
+func (d *document) semanticTokens() *SemanticTokens {
+	tokens := &SemanticTokens{Data: []int{}}
+	var last Position
+	emit := func(start, end int, class highlight.Class) {
+		pos := d.position(start)
+		length := utf16Len(d.text[start:end])
+		if length == 0 {
+			return
+		}
+		char := pos.Character
+		if pos.Line == last.Line {
+			char -= last.Character
+		}
+		tokens.Data = append(tokens.Data, pos.Line-last.Line, char, length, int(class), 0)
+		last = pos
+	}
+
+	for _, span := range highlight.Classify(d.text) {
+		start, end := span.Pos.Offset, min(span.End.Offset, len(d.text))
+		for start < end {
+			lineEnd := strings.IndexByte(d.text[start:end], '\n')
+			if lineEnd < 0 {
+				emit(start, end, span.Class)
+				break
+			}
+			emit(start, start+lineEnd, span.Class)
+			start += lineEnd + 1
+		}
+	}
+	return tokens
+}
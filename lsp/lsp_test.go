@@ -0,0 +1,365 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const uri = "file:///test.monkey"
+
+const source = `// add sums its arguments.
+let add = fn(x, y) {
+  let sum = x + y;
+  sum
+};
+let answer = 6 * 7;
+puts(add(answer, 1));
+`
+
+// session writes the messages of a client to the server and returns what
+// the server wrote back, decoded.
+func session(t *testing.T, messages ...interface{}) ([]map[string]interface{}, error) {
+	t.Helper()
+
+	var in bytes.Buffer
+	for i, msg := range messages {
+		if err := writeMessage(&in, msg); err != nil {
+			t.Fatalf("message %d: %s", i, err)
+		}
+	}
+
+	var out bytes.Buffer
+	err := Serve(&in, &out)
+
+	var replies []map[string]interface{}
+	r := bufio.NewReader(&out)
+	for {
+		body, rerr := readMessage(r)
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			t.Fatalf("reading the replies: %s", rerr)
+		}
+		var reply map[string]interface{}
+		if err := json.Unmarshal(body, &reply); err != nil {
+			t.Fatalf("reply is not JSON: %s", body)
+		}
+		replies = append(replies, reply)
+	}
+	return replies, err
+}
+
+func call(id int, method string, params interface{}) map[string]interface{} {
+	return map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params}
+}
+
+func notify(method string, params interface{}) map[string]interface{} {
+	return map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+}
+
+func open(text string) map[string]interface{} {
+	return notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: uri, LanguageID: "monkey", Version: 1, Text: text},
+	})
+}
+
+func at(line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Position:     Position{Line: line, Character: character},
+	}
+}
+
+// result returns the result of the reply to the request with id, as JSON.
+func result(t *testing.T, replies []map[string]interface{}, id int) string {
+	t.Helper()
+	for _, reply := range replies {
+		if reply["id"] == float64(id) {
+			if reply["error"] != nil {
+				t.Fatalf("request %d failed: %v", id, reply["error"])
+			}
+			b, _ := json.Marshal(reply["result"])
+			return string(b)
+		}
+	}
+	t.Fatalf("no reply to request %d", id)
+	return ""
+}
+
+func diagnostics(replies []map[string]interface{}) []PublishDiagnosticsParams {
+	var got []PublishDiagnosticsParams
+	for _, reply := range replies {
+		if reply["method"] != "textDocument/publishDiagnostics" {
+			continue
+		}
+		b, _ := json.Marshal(reply["params"])
+		var params PublishDiagnosticsParams
+		json.Unmarshal(b, &params)
+		got = append(got, params)
+	}
+	return got
+}
+
+func span(line, start, end int) Range {
+	return Range{Start: Position{line, start}, End: Position{line, end}}
+}
+
+func TestLifecycle(t *testing.T) {
+	replies, err := session(t,
+		call(1, "initialize", map[string]interface{}{}),
+		notify("initialized", map[string]interface{}{}),
+		call(2, "workspace/symbol", map[string]interface{}{}),
+		call(3, "shutdown", nil),
+		notify("exit", nil),
+	)
+	if err != nil {
+		t.Fatalf("Serve failed: %s", err)
+	}
+
+	init := result(t, replies, 1)
+	for _, want := range []string{`"textDocumentSync":1`, `"hoverProvider":true`, `"definitionProvider":true`, `"completionProvider"`, `"tokenTypes":["keyword","variable"`} {
+		if !strings.Contains(init, want) {
+			t.Errorf("capabilities lack %s: %s", want, init)
+		}
+	}
+	if code := replies[1]["error"].(map[string]interface{})["code"]; code != float64(codeMethodNotFound) {
+		t.Errorf("unknown method should fail with %d. got=%v", codeMethodNotFound, code)
+	}
+	if got := result(t, replies, 3); got != "null" {
+		t.Errorf("wrong shutdown result. got=%s", got)
+	}
+
+	if _, err := session(t, notify("exit", nil)); err != ErrNoShutdown {
+		t.Errorf("exit without shutdown should fail. got=%v", err)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	change := notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+		"contentChanges": []map[string]string{{"text": "let f = fn() { let x = 1; 2 };\nf();"}},
+	})
+	replies, _ := session(t,
+		open("let x = ;\nlet = 5;"),
+		change,
+		notify("textDocument/didClose", DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}}),
+	)
+
+	got := diagnostics(replies)
+	want := []PublishDiagnosticsParams{
+		{URI: uri, Diagnostics: []Diagnostic{
+			{span(0, 8, 9), SeverityError, "monkey", "no prefix parse function for token ';' found"},
+			{span(1, 4, 5), SeverityError, "monkey", "expected next token to be IDENT, got = instead"},
+			{span(1, 4, 5), SeverityError, "monkey", "no prefix parse function for token '=' found"},
+		}},
+		{URI: uri, Diagnostics: []Diagnostic{
+			{span(0, 19, 20), SeverityWarning, "monkey lint", "x declared and not used"},
+		}},
+		{URI: uri, Diagnostics: []Diagnostic{}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("wrong number of diagnostics notifications. want=%d, got=%d: %v", len(want), len(got), got)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("notification %d wrong.\nwant=%+v\ngot =%+v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestHover(t *testing.T) {
+	tests := []struct {
+		line, character int
+		expected        string
+	}{
+		{1, 5, "```monkey\nlet add(x, y)\n```\n\nadd sums its arguments."},
+		{6, 6, "```monkey\nlet add(x, y)\n```\n\nadd sums its arguments."},
+		{6, 11, "```monkey\nlet answer\n```\n\nINTEGER `42`"},
+		{2, 16, "```monkey\n(parameter) y\n```\n"},
+		{2, 7, "```monkey\nlet sum\n```\n"},
+		{6, 1, "```monkey\nbuiltin puts(values...)\n```\n\nPrints each argument"},
+		{5, 13, ""},
+	}
+
+	for _, tt := range tests {
+		replies, _ := session(t, open(source), call(1, "textDocument/hover", at(tt.line, tt.character)))
+		got := result(t, replies, 1)
+		if tt.expected == "" {
+			if got != "null" {
+				t.Errorf("%d:%d: expected no hover. got=%s", tt.line, tt.character, got)
+			}
+			continue
+		}
+
+		var hover Hover
+		if err := json.Unmarshal([]byte(got), &hover); err != nil {
+			t.Fatalf("%d:%d: invalid hover %s", tt.line, tt.character, got)
+		}
+		if !strings.HasPrefix(hover.Contents.Value, tt.expected) {
+			t.Errorf("%d:%d: wrong hover.\nwant=%q\ngot =%q", tt.line, tt.character, tt.expected, hover.Contents.Value)
+		}
+	}
+}
+
+func TestHoverEnum(t *testing.T) {
+	text := "enum Shape { Circle(r), Empty }\nmatch (Circle(1)) { Circle(radius) => { radius } }\n"
+	tests := []struct {
+		line, character int
+		expected        string
+	}{
+		{1, 8, "```monkey\n(variant of Shape) Circle(r)\n```\n"},
+		{0, 25, "```monkey\n(variant of Shape) Empty\n```\n"},
+		{1, 41, "```monkey\n(field of Circle) radius\n```\n"},
+	}
+
+	for _, tt := range tests {
+		replies, _ := session(t, open(text), call(1, "textDocument/hover", at(tt.line, tt.character)))
+		var hover Hover
+		if err := json.Unmarshal([]byte(result(t, replies, 1)), &hover); err != nil {
+			t.Fatalf("%d:%d: invalid hover", tt.line, tt.character)
+		}
+		if hover.Contents.Value != tt.expected {
+			t.Errorf("%d:%d: wrong hover.\nwant=%q\ngot =%q", tt.line, tt.character, tt.expected, hover.Contents.Value)
+		}
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	tests := []struct {
+		line, character int
+		expected        *Range
+	}{
+		{6, 7, &Range{Position{1, 4}, Position{1, 7}}},
+		{6, 12, &Range{Position{5, 4}, Position{5, 10}}},
+		{3, 2, &Range{Position{2, 6}, Position{2, 9}}},
+		{2, 12, &Range{Position{1, 13}, Position{1, 14}}},
+		{6, 2, nil},
+	}
+
+	for _, tt := range tests {
+		replies, _ := session(t, open(source), call(1, "textDocument/definition", at(tt.line, tt.character)))
+		var loc *Location
+		json.Unmarshal([]byte(result(t, replies, 1)), &loc)
+
+		switch {
+		case tt.expected == nil && loc != nil:
+			t.Errorf("%d:%d: expected no definition. got=%+v", tt.line, tt.character, loc)
+		case tt.expected != nil && (loc == nil || loc.URI != uri || loc.Range != *tt.expected):
+			t.Errorf("%d:%d: wrong definition. want=%+v, got=%+v", tt.line, tt.character, tt.expected, loc)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	tests := []struct {
+		line, character int
+		present         []string
+		absent          []string
+	}{
+		{3, 2, []string{"sum", "x", "y", "add", "len", "puts", "let"}, []string{"answer"}},
+		{6, 0, []string{"add", "answer", "fn"}, []string{"sum", "x"}},
+		{0, 0, []string{"len"}, []string{"add"}},
+	}
+
+	for _, tt := range tests {
+		replies, _ := session(t, open(source), call(1, "textDocument/completion", at(tt.line, tt.character)))
+		var items []CompletionItem
+		json.Unmarshal([]byte(result(t, replies, 1)), &items)
+
+		labels := map[string]bool{}
+		for _, item := range items {
+			labels[item.Label] = true
+		}
+		for _, name := range tt.present {
+			if !labels[name] {
+				t.Errorf("%d:%d: %s should be proposed", tt.line, tt.character, name)
+			}
+		}
+		for _, name := range tt.absent {
+			if labels[name] {
+				t.Errorf("%d:%d: %s should not be proposed", tt.line, tt.character, name)
+			}
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	d := newDocument(uri, "let s = \"é😀\";\nlen(s)")
+
+	tests := []struct {
+		offset int
+		pos    Position
+	}{
+		{0, Position{0, 0}},
+		{9, Position{0, 9}},
+		{11, Position{0, 10}},
+		{15, Position{0, 12}},
+		{18, Position{1, 0}},
+		{24, Position{1, 6}},
+	}
+	for _, tt := range tests {
+		if got := d.position(tt.offset); got != tt.pos {
+			t.Errorf("position(%d) wrong. want=%v, got=%v", tt.offset, tt.pos, got)
+		}
+		if got := d.offset(tt.pos); got != tt.offset {
+			t.Errorf("offset(%v) wrong. want=%d, got=%d", tt.pos, tt.offset, got)
+		}
+	}
+
+	if got := d.offset(Position{0, 100}); got != 17 {
+		t.Errorf("a position past the end of a line should clamp to it. got=%d", got)
+	}
+}
+
+func TestSemanticTokens(t *testing.T) {
+	text := "let s = \"a\nb\";\nlen(s)"
+	replies, _ := session(t, open(text),
+		call(1, "textDocument/semanticTokens/full", SemanticTokensParams{TextDocument: TextDocumentIdentifier{URI: uri}}))
+
+	var tokens SemanticTokens
+	json.Unmarshal([]byte(result(t, replies, 1)), &tokens)
+	expected := []int{
+		0, 0, 3, 0, 0, // let
+		0, 4, 1, 1, 0, // s
+		0, 2, 1, 4, 0, // =
+		0, 2, 2, 2, 0, // "a
+		1, 0, 2, 2, 0, // b"
+		1, 0, 3, 6, 0, // len
+		0, 4, 1, 1, 0, // s
+	}
+	if !reflect.DeepEqual(tokens.Data, expected) {
+		t.Errorf("wrong tokens.\nwant=%v\ngot =%v", expected, tokens.Data)
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{"Content-Length: 2\r\n\r\n{}", "{}", ""},
+		{"Content-Type: application/vscode-jsonrpc\r\ncontent-length: 4\r\n\r\nnull", "null", ""},
+		{"", "", "EOF"},
+		{"Content-Length: 10\r\n\r\n{}", "", "unexpected EOF"},
+		{"\r\n{}", "", "message without Content-Length"},
+		{"Content-Length: x\r\n\r\n", "", `invalid Content-Length "x"`},
+	}
+
+	for _, tt := range tests {
+		body, err := readMessage(bufio.NewReader(strings.NewReader(tt.input)))
+		if fmt.Sprint(err) != tt.err && !(err == nil && tt.err == "") {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.err, err)
+		}
+		if string(body) != tt.expected {
+			t.Errorf("%q: wrong body. want=%q, got=%q", tt.input, tt.expected, body)
+		}
+	}
+}
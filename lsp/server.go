@@ -0,0 +1,199 @@
+// Package lsp implements a Language Server Protocol server for Monkey. It
+// speaks JSON-RPC over a pair of streams, usually stdin and stdout, and
+// offers diagnostics from the parser and the linter, hover information,
+// go-to-definition, completion and semantic highlighting for the documents
+// the editor opens.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/frankie-mur/monkeylang/highlight"
+)
+
+// ErrNoShutdown is returned by Serve when the client asks the server to
+// exit without shutting it down first, or the connection ends.
+var ErrNoShutdown = errors.New("exit without shutdown")
+
+type server struct {
+	in   *bufio.Reader
+	out  io.Writer
+	docs map[string]*document
+
+	shutdown bool
+}
+
+// Serve answers the requests read from in, writing responses and
+// notifications to out, until the client sends the exit notification. It
+// returns nil if the client shut the server down first.
+func Serve(in io.Reader, out io.Writer) error {
+	s := &server{in: bufio.NewReader(in), out: out, docs: map[string]*document{}}
+
+	for {
+		body, err := readMessage(s.in)
+		if err == io.EOF {
+			return ErrNoShutdown
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			if err := s.reply(json.RawMessage("null"), nil, &responseError{codeParseError, err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return ErrNoShutdown
+			}
+			return nil
+		}
+
+		result, rerr := s.handle(&req)
+		if req.isNotification() {
+			continue
+		}
+		if err := s.reply(req.ID, result, rerr); err != nil {
+			return err
+		}
+	}
+}
+
+// handle runs the method of req. Notifications have no result; errors of
+// notifications are dropped as the protocol has no way to report them.
+func (s *server) handle(req *request) (interface{}, *responseError) {
+	if s.shutdown && !req.isNotification() {
+		return nil, &responseError{codeInvalidRequest, "the server is shut down"}
+	}
+
+	switch req.Method {
+	case "initialize":
+		var result initializeResult
+		result.Capabilities.TextDocumentSync = syncFull
+		result.Capabilities.HoverProvider = true
+		result.Capabilities.DefinitionProvider = true
+		result.Capabilities.CompletionProvider.TriggerCharacters = []string{}
+		for _, class := range highlight.Classes() {
+			legend := &result.Capabilities.SemanticTokensProvider.Legend
+			legend.TokenTypes = append(legend.TokenTypes, class.String())
+		}
+		result.Capabilities.SemanticTokensProvider.Legend.TokenModifiers = []string{}
+		result.Capabilities.SemanticTokensProvider.Full = true
+		result.ServerInfo.Name = "monkey"
+		return result, nil
+
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := unmarshalParams(req, &params); err != nil {
+			return nil, err
+		}
+		s.update(params.TextDocument.URI, params.TextDocument.Text)
+
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := unmarshalParams(req, &params); err != nil {
+			return nil, err
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := unmarshalParams(req, &params); err != nil {
+			return nil, err
+		}
+		delete(s.docs, params.TextDocument.URI)
+		s.publish(params.TextDocument.URI, []Diagnostic{})
+
+	case "textDocument/hover", "textDocument/definition", "textDocument/completion":
+		var params TextDocumentPositionParams
+		if err := unmarshalParams(req, &params); err != nil {
+			return nil, err
+		}
+		d, ok := s.docs[params.TextDocument.URI]
+		if !ok {
+			return nil, &responseError{codeInvalidParams, fmt.Sprintf("unknown document %s", params.TextDocument.URI)}
+		}
+		switch req.Method {
+		case "textDocument/hover":
+			if h := d.hover(params.Position); h != nil {
+				return h, nil
+			}
+		case "textDocument/definition":
+			if loc := d.definition(params.Position); loc != nil {
+				return loc, nil
+			}
+		default:
+			return d.completion(params.Position), nil
+		}
+
+	case "textDocument/semanticTokens/full":
+		var params SemanticTokensParams
+		if err := unmarshalParams(req, &params); err != nil {
+			return nil, err
+		}
+		d, ok := s.docs[params.TextDocument.URI]
+		if !ok {
+			return nil, &responseError{codeInvalidParams, fmt.Sprintf("unknown document %s", params.TextDocument.URI)}
+		}
+		return d.semanticTokens(), nil
+
+	default:
+		if !req.isNotification() {
+			return nil, &responseError{codeMethodNotFound, "method not supported: " + req.Method}
+		}
+	}
+
+	return nil, nil
+}
+
+func unmarshalParams(req *request, params interface{}) *responseError {
+	if err := json.Unmarshal(req.Params, params); err != nil {
+		return &responseError{codeInvalidParams, err.Error()}
+	}
+	return nil
+}
+
+// update analyzes the new text of a document and publishes its
+// diagnostics.
+func (s *server) update(uri, text string) {
+	d := newDocument(uri, text)
+	s.docs[uri] = d
+	s.publish(uri, d.diagnostics())
+}
+
+func (s *server) publish(uri string, diagnostics []Diagnostic) {
+	writeMessage(s.out, notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics},
+	})
+}
+
+func (s *server) reply(id json.RawMessage, result interface{}, rerr *responseError) error {
+	resp := response{JSONRPC: "2.0", ID: id}
+	if rerr != nil {
+		resp.Error = rerr
+	} else {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		msg := json.RawMessage(raw)
+		resp.Result = &msg
+	}
+	return writeMessage(s.out, resp)
+}
@@ -1,21 +1,163 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"os/user"
+	"time"
 
+	"github.com/frankie-mur/monkeylang/compiler"
 	"github.com/frankie-mur/monkeylang/repl"
+	"github.com/frankie-mur/monkeylang/token"
 )
 
 func main() {
-	user, err := user.Current()
+	if err := loadPlugins(os.Getenv("MONKEY_PLUGINS")); err != nil {
+		fmt.Fprintf(os.Stderr, "monkey: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	os.Exit(execute(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// replCommand implements `monkey repl [--engine=eval|vm]`.
+func replCommand(inv *invocation) int {
+	var trace traceFlag
+	var engine engineFlag
+	inv.flags.Var(&trace, "trace", "trace `stages` to stderr: parser, eval or parser,eval")
+	inv.flags.Var(&engine, "engine", "evaluate lines on the tree-walking evaluator (eval) or the bytecode VM (vm)")
+	var lang token.Lang
+	addLangFlag(inv.flags, &lang)
+	if _, err := inv.parse(); err != nil {
+		return exitUsage
+	}
+	if engine == engineVM && trace.eval {
+		fmt.Fprintf(inv.stderr, "monkey repl: --trace=eval is not supported by the vm engine\n")
+		return exitUsage
+	}
+
+	name := "there"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+
+	fmt.Fprintf(inv.stdout, "Welcome, %q!\n, this is the REPL for monkeylang\n", name)
+	fmt.Fprintf(inv.stdout, "Feel free to type in commands\n")
+
+	repl.StartWithOptions(inv.stdin, inv.stdout, repl.Options{
+		Trace:       inv.stderr,
+		TraceParser: trace.parser,
+		TraceEval:   trace.eval,
+		Engine:      string(engine),
+		Lang:        lang,
+	})
+	return exitOK
+}
+
+// runCommand implements `monkey run [--watch] [--engine=eval|vm] [--inspect address] [file]`.
+// Without a file, or with "-", the program is read from stdin. Programs
+// compiled with `monkey compile` are recognised by their header and always
+// run on the VM. Source run on the VM is compiled once and its bytecode
+// cached, see cache.go.
+func runCommand(inv *invocation) int {
+	watchFile := inv.flags.Bool("watch", false, "run the file again whenever it changes")
+	interval := inv.flags.Duration("interval", 300*time.Millisecond, "how often --watch checks the file for changes")
+	profile := addProfileFlags(inv.flags)
+	var opts runOptions
+	inv.flags.Var(&opts.engine, "engine", "run the program on the tree-walking evaluator (eval) or the bytecode VM (vm)")
+	addLangFlag(inv.flags, &opts.lang)
+	inv.flags.BoolVar(&opts.strict, "strict-warnings", false, "fail a program that has warnings, such as calls of deprecated builtins, with a nonzero exit code")
+	inv.flags.BoolVar(&opts.optimize, "O", false, "optimize the bytecode; implies --engine=vm")
+	inv.flags.BoolVar(&opts.dump, "dump", false, "on a runtime error, dump the VM's stack, frames and instructions to stderr; implies --engine=vm")
+	noCache := inv.flags.Bool("no-cache", false, "do not read or write the bytecode cache of the vm engine")
+	clearCache := inv.flags.Bool("clear-cache", false, "empty the bytecode cache first; without a file, just empty it")
+	inv.flags.Var(&opts.trace, "trace", "trace `stages` to stderr: parser, eval or parser,eval")
+	inv.flags.StringVar(&opts.inspect, "inspect", "", "serve an inspector on `address`, such as :4000 for port 4000 of localhost, that can pause the program and show its calls and variables; clients must send the token printed to stderr first")
+	addLimitFlags(inv.flags, &opts)
+	coverage := addCoverFlags(inv.flags)
+	args, err := inv.parse()
+	if err != nil {
+		return exitUsage
+	}
+	opts.cover = coverage.newProfile()
+	if !*noCache {
+		opts.cacheDir = bytecodeCacheDir()
+	}
+	if *clearCache {
+		if dir := bytecodeCacheDir(); dir != "" {
+			if err := os.RemoveAll(dir); err != nil {
+				fmt.Fprintf(inv.stderr, "monkey run: %s\n", err)
+				return exitUsage
+			}
+		}
+		if len(args) == 0 {
+			return exitOK
+		}
+	}
+	if len(args) > 1 || *watchFile && (len(args) == 0 || args[0] == "-") {
+		inv.flags.Usage()
+		return exitUsage
+	}
+	if *watchFile && opts.cover != nil {
+		fmt.Fprintf(inv.stderr, "monkey run: --cover cannot be used with --watch\n")
+		return exitUsage
+	}
+	if flag := opts.vmOnly(); flag != "" {
+		if opts.engine == engineEval {
+			fmt.Fprintf(inv.stderr, "monkey run: %s requires the vm engine\n", flag)
+			return exitUsage
+		}
+		opts.engine = engineVM
+	}
+	if opts.engine == engineVM && opts.vmUnsupported() != "" {
+		fmt.Fprintf(inv.stderr, "monkey run: %s is not supported by the vm engine\n", opts.vmUnsupported())
+		return exitUsage
+	}
+
+	if *watchFile {
+		stopProfile, ok := profile.start(inv.stderr)
+		if !ok {
+			return exitUsage
+		}
+		defer stopProfile()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		return watch(ctx, args[0], *interval, opts, inv.stdout, inv.stderr)
+	}
+
+	var src []byte
+	if len(args) == 0 || args[0] == "-" {
+		src, err = io.ReadAll(inv.stdin)
+		opts.name = "<stdin>"
+	} else {
+		src, err = os.ReadFile(args[0])
+		opts.name = args[0]
+	}
 	if err != nil {
-		panic(err)
+		fmt.Fprintf(inv.stderr, "monkey: %s\n", err)
+		return exitUsage
 	}
 
-	fmt.Printf("Welcome, %q!\n, this is the REPL for monkeylang\n", user.Username)
-	fmt.Printf("Feel free to type in commands\n")
+	stopProfile, ok := profile.start(inv.stderr)
+	if !ok {
+		return exitUsage
+	}
+	defer stopProfile()
 
-	repl.Start(os.Stdin, os.Stdout)
+	if compiler.IsBytecode(src) {
+		if opts.vmUnsupported() != "" {
+			fmt.Fprintf(inv.stderr, "monkey run: %s is not supported for compiled programs\n", opts.vmUnsupported())
+			return exitUsage
+		}
+		return runBytecode(context.Background(), src, opts, inv.stderr)
+	}
+
+	code := run(context.Background(), string(src), opts, inv.stderr)
+	if opts.cover != nil && !coverage.report(opts.cover, inv.stderr, inv.stderr) && code == exitOK {
+		code = exitUsage
+	}
+	return code
 }
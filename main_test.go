@@ -0,0 +1,605 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/frankie-mur/monkeylang/compiler"
+)
+
+func TestMain(m *testing.M) {
+	// Keep the tests out of the user's bytecode cache.
+	os.Setenv("MONKEY_CACHE", "off")
+	os.Exit(m.Run())
+}
+
+func TestStripShebang(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"#!/usr/bin/env monkey\nputs(1);", "\nputs(1);"},
+		{"#!/usr/bin/env monkey", ""},
+		{"puts(1);", "puts(1);"},
+		{"puts(1);\n#!not a shebang", "puts(1);\n#!not a shebang"},
+	}
+
+	for _, tt := range tests {
+		got := stripShebang(tt.input)
+		if got != tt.expected {
+			t.Errorf("stripShebang(%q) wrong. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestFmtCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	code := execute([]string{"fmt"}, strings.NewReader("let x=1+2"), &stdout, &stderr)
+	if code != 1 {
+		t.Errorf("unformatted input should exit 1. got=%d", code)
+	}
+	if stdout.String() != "let x = 1 + 2;\n" {
+		t.Errorf("wrong formatted output. got=%q", stdout.String())
+	}
+
+	stdout.Reset()
+	code = execute([]string{"fmt", "-d"}, strings.NewReader("let x = 1 + 2;\n"), &stdout, &stderr)
+	if code != exitOK {
+		t.Errorf("formatted input should exit 0. got=%d", code)
+	}
+	if stdout.String() != "" {
+		t.Errorf("expected no diff. got=%q", stdout.String())
+	}
+
+	code = execute([]string{"fmt"}, strings.NewReader("let = 1"), &stdout, &stderr)
+	if code != exitParseError {
+		t.Errorf("invalid input should exit %d. got=%d", exitParseError, code)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	got := unifiedDiff("a.monkey", "a\nb\nc\n", "a\nB\nc\n")
+	expected := "--- a.monkey\n+++ a.monkey (formatted)\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"
+	if got != expected {
+		t.Errorf("wrong diff.\nexpected=%q\ngot=%q", expected, got)
+	}
+}
+
+func TestLintCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	code := execute([]string{"lint"}, strings.NewReader("let f = fn() { return 1; 2 };\nf();"), &stdout, &stderr)
+	if code != 1 {
+		t.Errorf("lint findings should exit 1. got=%d", code)
+	}
+	if stdout.String() != "<stdin>:1:26: unreachable code\n" {
+		t.Errorf("wrong lint output. got=%q", stdout.String())
+	}
+}
+
+func TestLexCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	code := execute([]string{"lex"}, strings.NewReader("let x = 5;"), &stdout, &stderr)
+	if code != exitOK {
+		t.Errorf("lex should exit 0. got=%d", code)
+	}
+
+	expected := "1:1\tLET\t\"let\"\n" +
+		"1:5\tIDENT\t\"x\"\n" +
+		"1:7\t=\t\"=\"\n" +
+		"1:9\tINT\t\"5\"\n" +
+		"1:10\t;\t\";\"\n" +
+		"1:11\tEOF\t\"\"\n"
+	if stdout.String() != expected {
+		t.Errorf("wrong lex output.\nexpected=%q\ngot=%q", expected, stdout.String())
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	code := execute([]string{"check"}, strings.NewReader("let x = 5;\nlet y 3;"), &stdout, &stderr)
+	if code != exitParseError {
+		t.Errorf("syntax errors should exit %d. got=%d", exitParseError, code)
+	}
+	expected := "<stdin>:2:7: expected next token to be =, got INT instead\n"
+	if stdout.String() != expected {
+		t.Errorf("wrong check output.\nexpected=%q\ngot=%q", expected, stdout.String())
+	}
+
+	stdout.Reset()
+	code = execute([]string{"check"}, strings.NewReader("let x = 5;"), &stdout, &stderr)
+	if code != exitOK || stdout.String() != "" {
+		t.Errorf("valid input should exit 0 silently. got=%d %q", code, stdout.String())
+	}
+}
+
+func TestTestCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	code := execute([]string{"test", "testdata"}, nil, &stdout, &stderr)
+	if code != 1 {
+		t.Errorf("a failing test should exit 1. got=%d", code)
+	}
+
+	expected := "--- FAIL: test_broken (testdata/math_test.monkey:12:5)\n" +
+		"    assertion failed: expected 5, got 4\n" +
+		"FAIL\t2 passed, 1 failed\n"
+	if stdout.String() != expected {
+		t.Errorf("wrong test output.\nexpected=%q\ngot=%q", expected, stdout.String())
+	}
+
+	stdout.Reset()
+	code = execute([]string{"test", "-run", "double", "testdata"}, nil, &stdout, &stderr)
+	if code != exitOK {
+		t.Errorf("passing tests should exit 0. got=%d (%s)", code, stdout.String())
+	}
+
+	stdout.Reset()
+	profile := filepath.Join(t.TempDir(), "cover.lcov")
+	code = execute([]string{"test", "-run", "double", "-coverprofile", profile, "testdata"}, nil, &stdout, &stderr)
+	expected = "testdata/math_test.monkey\tcoverage: 81.8% of statements\nok\t2 passed\n"
+	if code != exitOK || stdout.String() != expected {
+		t.Errorf("wrong coverage output. got=%d %q", code, stdout.String())
+	}
+	lcov, err := os.ReadFile(profile)
+	if err != nil || !strings.Contains(string(lcov), "SF:testdata/math_test.monkey\nDA:1,2\nDA:3,2\nDA:4,1\n") {
+		t.Errorf("wrong LCOV profile. got=%q, %v", lcov, err)
+	}
+}
+
+func TestRunCover(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	src := "let f = fn(x) {\n  if (x) { 1 } else { 2 }\n};\nf(true);\n"
+	code := execute([]string{"run", "--cover"}, strings.NewReader(src), &stdout, &stderr)
+	if code != exitOK || stderr.String() != "<stdin>\tcoverage: 80.0% of statements\n" {
+		t.Errorf("wrong coverage output. got=%d %q", code, stderr.String())
+	}
+
+	stderr.Reset()
+	code = execute([]string{"run", "--cover", "--engine=vm"}, strings.NewReader(src), &stdout, &stderr)
+	if code != exitUsage || !strings.Contains(stderr.String(), "--cover is not supported by the vm engine") {
+		t.Errorf("coverage should need the evaluator. got=%d %q", code, stderr.String())
+	}
+}
+
+func TestBenchCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	code := execute([]string{"bench", "-time", "1ms", "testdata"}, nil, &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("bench should exit 0. got=%d (%s)", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "bench_double\t") || !strings.Contains(stdout.String(), "ops/s") {
+		t.Errorf("wrong bench output. got=%q", stdout.String())
+	}
+
+	stdout.Reset()
+	code = execute([]string{"bench", "-time", "1ms", "-e", "len(1)"}, nil, &stdout, &stderr)
+	if code != exitRuntimeError {
+		t.Errorf("a failing expression should exit %d. got=%d", exitRuntimeError, code)
+	}
+
+	for _, args := range [][]string{{"testdata"}, {"-e", "1 + 2"}} {
+		stdout.Reset()
+		code = execute(append([]string{"bench", "-time", "1ms", "--engine=vm"}, args...), nil, &stdout, &stderr)
+		if code != exitOK || !strings.Contains(stdout.String(), "ops/s") {
+			t.Errorf("%v: bench on the vm should succeed. got=%d %q (%s)", args, code, stdout.String(), stderr.String())
+		}
+	}
+
+	code = execute([]string{"bench", "-time", "1ms", "--engine=vm", "-e", "len(1)"}, nil, &stdout, &stderr)
+	if code != exitRuntimeError {
+		t.Errorf("a failing expression should exit %d on the vm. got=%d", exitRuntimeError, code)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		args   []string
+		stdin  string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{[]string{"run"}, "let x = 1 + 2;", exitOK, "", ""},
+		{[]string{"run"}, "exit(3);", 3, "", ""},
+		{[]string{"run"}, "1 + true;", exitRuntimeError, "", "ERROR: 1:1: type mismatch: INTEGER + BOOLEAN\n"},
+		{[]string{"repl"}, "let x = 2;\nx + z\n", exitOK, ">> >> ERROR: 1:5: identifier not found: z\n", ""},
+		{[]string{"run", "a", "b"}, "", exitUsage, "", "usage: monkey run [--watch] [file]"},
+		{[]string{"check", "-nope"}, "", exitUsage, "", "flag provided but not defined: -nope"},
+		{[]string{"--frobnicate"}, "", exitUsage, "", "monkey: unknown flag --frobnicate"},
+		{[]string{"help"}, "", exitOK, "\tlint       report suspicious constructs\n", ""},
+		{[]string{"playground", "file.monkey"}, "", exitUsage, "", "usage: monkey playground [--addr :8080]"},
+		{[]string{"help", "fmt"}, "", exitOK, "usage: monkey fmt [-w] [-d] [files...]", ""},
+		{[]string{"help", "nope"}, "", exitUsage, "", "monkey help: unknown command \"nope\""},
+		{[]string{"repl"}, "let x = 2;\nx * 21\n", exitOK, ">> 42\n>> ", ""},
+		{[]string{"run", "--trace=eval"}, "1", exitOK, "", "BEGIN IntegerLiteral 1:1 1\n    END IntegerLiteral => 1\n"},
+		{[]string{"run", "--trace=parser"}, "1", exitOK, "", "BEGIN parseIntegerLiteral 1:1 INT \"1\"\n"},
+		{[]string{"run", "--max-steps=1e1"}, "len([1, 2, 3, 4, 5, 6, 7, 8, 9, 10])", exitRuntimeError, "", "step limit exceeded: evaluated more than 10 nodes"},
+		{[]string{"run", "--no-io"}, "puts(1)", exitRuntimeError, "", "puts is not available: I/O is disabled"},
+		{[]string{"run", "--max-steps=1.5"}, "", exitUsage, "", "invalid count \"1.5\""},
+		{[]string{"run", "--sandbox=fs,env"}, "now()", exitRuntimeError, "", "now is not available: the time capability is not granted"},
+		{[]string{"run", "--sandbox=time"}, "exit(if (now() > 0) { 4 })", 4, "", ""},
+		{[]string{"run", "--sandbox=runtime"}, `gc(); exit(if (runtime_stats()["num_gc"] > 0) { 7 })`, 7, "", ""},
+		{[]string{"run", "--sandbox=none"}, "read_file(\"go.mod\")", exitRuntimeError, "", "read_file is not available: the fs capability is not granted"},
+		{[]string{"run", "--sandbox=time"}, `on_signal("INT", fn() { exit(1) })`, exitRuntimeError, "", "on_signal is not available: the signal capability is not granted"},
+		{[]string{"run", "--sandbox=signal"}, `on_signal("INT", fn() { exit(1) }); exit(5)`, 5, "", ""},
+		{[]string{"run", "--sandbox=disk"}, "", exitUsage, "", "unknown capability \"disk\""},
+		{[]string{"run", "--engine=vm", "--sandbox=fs"}, "1", exitUsage, "", "--sandbox is not supported by the vm engine"},
+		{[]string{"run", "--trace=lexer"}, "1", exitUsage, "", "unknown trace stage \"lexer\""},
+		{[]string{"run"}, "puts();\nputs()", exitOK, "", "warning: 1:1: puts without arguments prints nothing\nwarning: 2:1: puts without arguments prints nothing\n"},
+		{[]string{"run", "--strict-warnings"}, "puts()", exitRuntimeError, "", "warning: 1:1: puts without arguments prints nothing\n"},
+		{[]string{"run", "--strict-warnings"}, "exit(3)", 3, "", ""},
+		{[]string{"run", "--lang=1"}, "let f = fn(x) { x * 2 }; exit(f(3));", 6, "", ""},
+		{[]string{"run", "--lang=3"}, "1", exitUsage, "", "unknown language version \"3\" (want 1 to 2)"},
+		{[]string{"run", "--lang=1"}, "let enum = 4; exit(enum);", 4, "", "warning: 1:5: enum is a keyword in language version 2 and later\n"},
+		{[]string{"run"}, "enum Bit { On, Off } exit(match (Off) { On => { 1 } Off => { 2 } })", 2, "", ""},
+		{[]string{"run", "--engine=vm"}, "enum Bit { On, Off }", exitParseError, "", "1:1: enum is not supported by the vm engine"},
+		{[]string{"run", "--engine=vm"}, "for (x in [1]) { x }", exitParseError, "", "1:1: for is not supported by the vm engine"},
+		{[]string{"run", "--engine=vm"}, "switch (1) { default: { 1 } }", exitParseError, "", "1:1: switch is not supported by the vm engine"},
+		{[]string{"run", "--engine=vm"}, "let a = [1, 2]; a[1:]", exitParseError, "", "1:17: slicing is not supported by the vm engine"},
+		{[]string{"run", "--engine=vm"}, "let a = [1]; a[0]++", exitParseError, "", "1:14: ++ on an element is not supported by the vm engine"},
+		{[]string{"check", "--lang=x"}, "", exitUsage, "", "unknown language version \"x\" (want 1 to 2)"},
+		{[]string{"run", "--engine=vm"}, "let f = fn(x) { exit(x * 2) }; f(3);", 6, "", ""},
+		{[]string{"run", "--engine=vm"}, "1 + true;", exitRuntimeError, "", "ERROR: 1:1: type mismatch: INTEGER + BOOLEAN\n"},
+		{[]string{"run", "--engine=vm"}, "puts(y);", exitParseError, "", "compile errors:\n\t1:6: identifier not found: y\n"},
+		{[]string{"run", "--engine=vm", "--max-depth=3"}, "let f = fn() { 1 + f() }; f();", exitRuntimeError, "", "stack overflow at call depth 4: more than 3 nested calls"},
+		{[]string{"run", "--engine=vm", "--max-steps=10"}, "1", exitUsage, "", "--max-steps is not supported by the vm engine"},
+		{[]string{"run", "--inspect=127.0.0.1:0"}, "exit(4)", 4, "", "inspector listening on 127.0.0.1:"},
+		{[]string{"run", "--inspect=:0"}, "exit(4)", 4, "", "inspector listening on 127.0.0.1:"},
+		{[]string{"run", "--inspect=nowhere"}, "1", exitUsage, "", "monkey run: listen tcp: address nowhere: missing port in address"},
+		{[]string{"run", "--engine=vm", "--inspect=:4000"}, "1", exitUsage, "", "--inspect is not supported by the vm engine"},
+		{[]string{"run", "-O"}, "let f = fn(x) { if (x > 1 + 1) { return x * (2 + 3); }; 0 }; exit(f(3));", 15, "", ""},
+		{[]string{"run", "-O", "--engine=eval"}, "1", exitUsage, "", "-O requires the vm engine"},
+		{[]string{"run", "--dump"}, "1 + true;", exitRuntimeError, "", "frames (1):\n  #0 main ip=4 base=0 at 1:1\n     0000 OpConstant 0\n     0003 OpTrue\n  -> 0004 OpAdd\n"},
+		{[]string{"run", "--dump", "--engine=eval"}, "1", exitUsage, "", "--dump requires the vm engine"},
+		{[]string{"run", "--engine=jit"}, "1", exitUsage, "", "unknown engine \"jit\" (want eval or vm)"},
+		{[]string{"repl", "--engine=vm"}, "let x = 2;\nlet f = fn(y) { x * y };\nf(21)\nz\n", exitOK, ">> >> >> 42\n>> ERROR: identifier not found: z\n", ""},
+		{[]string{"repl", "--engine=vm", "--trace=eval"}, "", exitUsage, "", "--trace=eval is not supported by the vm engine"},
+		{[]string{"repl"}, ":trace eval\n1\n:trace off\n2\n", exitOK, ">> trace: parser off, eval on\n>> 1\n>> trace: parser off, eval off\n>> 2\n", "END Program => 1\n"},
+		{[]string{"repl"}, "let half = fn(n) { \"Halves n.\"; n / 2 };\n:help half\n:help nope\n", exitOK, ">> >> half(n)\n    Halves n.\n>> nope is not defined\n>> ", ""},
+		{[]string{"repl", "--engine=vm"}, "let half = fn(n) { \"Halves n.\"; n / 2 };\n:help half\n:help first\n", exitOK, ">> >> half(n)\n    Halves n.\n>> first(array)\n    Returns the first element of an array, or null if it is empty.\n>> ", ""},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := execute(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+		if code != tt.code {
+			t.Errorf("%v: exit code wrong. expected=%d, got=%d (stderr %q)", tt.args, tt.code, code, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), tt.stdout) {
+			t.Errorf("%v: stdout wrong. expected to contain %q, got=%q", tt.args, tt.stdout, stdout.String())
+		}
+		if !strings.Contains(stderr.String(), tt.stderr) {
+			t.Errorf("%v: stderr wrong. expected to contain %q, got=%q", tt.args, tt.stderr, stderr.String())
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "script.monkey")
+
+	// Replace the file atomically, as most editors do, so the watcher never
+	// sees it half written.
+	write := func(src string) {
+		t.Helper()
+		tmp := filepath.Join(dir, "tmp")
+		if err := os.WriteFile(tmp, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("exit(1);")
+
+	var stdout, stderr syncBuffer
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+	go func() { done <- watch(ctx, file, time.Millisecond, runOptions{}, &stdout, &stderr) }()
+
+	waitFor := func(s string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !strings.Contains(stdout.String(), s) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %q. got=%q", s, stdout.String())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	waitFor("exit status 1; watching for changes\n")
+
+	// Same size as before, so only the modification time tells them apart.
+	write("exit(2);")
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("exit status 2; watching for changes\n")
+
+	write("let x = ;")
+	waitFor("exit status 65; watching for changes\n")
+
+	// A change stops a run that would not end by itself.
+	waitForRuns := func(n int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for strings.Count(stdout.String(), clearScreen) < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for run %d. got=%q", n, stdout.String())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	write("while (true) {}")
+	waitForRuns(4)
+	write("exit(3);")
+	waitFor("stopped\n")
+	waitFor("exit status 3; watching for changes\n")
+
+	// So does ctx being done.
+	write("let n = 0; while (true) { n += 1 }")
+	waitForRuns(6)
+	cancel()
+	if code := <-done; code != exitOK {
+		t.Errorf("watch exit code wrong. expected=%d, got=%d", exitOK, code)
+	}
+	if !strings.Contains(stderr.String(), "parser errors:") {
+		t.Errorf("parse errors not reported. stderr=%q", stderr.String())
+	}
+	if n := strings.Count(stdout.String(), clearScreen); n != 6 {
+		t.Errorf("wrong number of runs. expected=6, got=%d", n)
+	}
+	if n := strings.Count(stdout.String(), "stopped\n"); n != 2 {
+		t.Errorf("wrong number of stopped runs. expected=2, got=%d", n)
+	}
+}
+
+func TestWatchMissingFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "missing.monkey")
+	var stdout, stderr syncBuffer
+	if code := watch(context.Background(), file, time.Millisecond, runOptions{}, &stdout, &stderr); code != exitUsage {
+		t.Errorf("wrong exit code. expected=%d, got=%d", exitUsage, code)
+	}
+	if !strings.Contains(stderr.String(), "no such file or directory") {
+		t.Errorf("missing file not reported. stderr=%q", stderr.String())
+	}
+}
+
+// syncBuffer is a bytes.Buffer that may be written and read concurrently.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestProfileFlags(t *testing.T) {
+	dir := t.TempDir()
+	cpu, mem := filepath.Join(dir, "cpu.pprof"), filepath.Join(dir, "mem.pprof")
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"run", "--cpuprofile", cpu, "--memprofile", mem}
+	code := execute(args, strings.NewReader("let f = fn(x) { x * 2 }; f(21);"), &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("exit code wrong. expected=%d, got=%d (stderr %q)", exitOK, code, stderr.String())
+	}
+
+	for _, name := range []string{cpu, mem} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Errorf("profile not written: %s", err)
+			continue
+		}
+		if info.Size() == 0 {
+			t.Errorf("profile %s is empty", name)
+		}
+	}
+
+	code = execute([]string{"run", "--cpuprofile", filepath.Join(dir, "missing", "cpu.pprof")}, strings.NewReader("1"), &stdout, &stderr)
+	if code != exitUsage {
+		t.Errorf("exit code wrong for unwritable profile. expected=%d, got=%d", exitUsage, code)
+	}
+}
+
+func TestBytecodeCache(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("MONKEY_CACHE", cache)
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "prog.monkey")
+	program := "let double = fn(x) { x * 2 };\nexit(double(21));\n"
+	if err := os.WriteFile(src, []byte(program), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := execute([]string{"run", "--engine=vm", src}, nil, &stdout, &stderr); code != 42 {
+		t.Fatalf("first run should exit 42. got=%d (%s)", code, stderr.String())
+	}
+	entries, _ := filepath.Glob(filepath.Join(cache, "*.mbc"))
+	if len(entries) != 1 {
+		t.Fatalf("expected one cache entry. got=%v", entries)
+	}
+
+	// Replace the entry, so that running the program again shows whether
+	// it came from the cache.
+	var buf bytes.Buffer
+	bytecode, _ := compileSource("other", "exit(7);", &stderr)
+	if err := compiler.Save(&buf, bytecode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(entries[0], buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := execute([]string{"run", "--engine=vm", src}, nil, &stdout, &stderr); code != 7 {
+		t.Errorf("second run should use the cache and exit 7. got=%d (%s)", code, stderr.String())
+	}
+	if code := execute([]string{"run", "--engine=vm", "--no-cache", src}, nil, &stdout, &stderr); code != 42 {
+		t.Errorf("--no-cache should compile the program again. got=%d (%s)", code, stderr.String())
+	}
+	if code := execute([]string{"run", src}, nil, &stdout, &stderr); code != 42 {
+		t.Errorf("the evaluator should not use the cache. got=%d (%s)", code, stderr.String())
+	}
+
+	if code := execute([]string{"run", "--clear-cache"}, nil, &stdout, &stderr); code != exitOK {
+		t.Fatalf("--clear-cache should exit 0. got=%d (%s)", code, stderr.String())
+	}
+	if _, err := os.Stat(cache); !os.IsNotExist(err) {
+		t.Errorf("--clear-cache should remove the cache. got=%v", err)
+	}
+}
+
+func TestDebugCommand(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "prog.monkey")
+	if err := os.WriteFile(src, []byte("let f = fn(x) {\n  x * 2\n};\nexit(f(21));\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := execute([]string{"debug", src}, strings.NewReader("b 2\nc\nlocals\nc\n"), &stdout, &stderr)
+	expected := "1:9: let f = fn(x) {\n(mdb) (mdb) 2:3: x * 2\n(mdb) x = 21\n(mdb) the program exited with code 42\n(mdb) "
+	if code != exitOK || stdout.String() != expected {
+		t.Errorf("wrong debug session. got=%d\n%s\nwant:\n%s", code, stdout.String(), expected)
+	}
+}
+
+func TestCompileCommand(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "prog.monkey")
+	program := "let add = fn(a) { fn(b) { a + b } };\nexit(add(3)(4));\n"
+	if err := os.WriteFile(src, []byte(program), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := execute([]string{"compile", src}, nil, &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("compile should exit 0. got=%d (%s)", code, stderr.String())
+	}
+
+	code = execute([]string{"run", filepath.Join(dir, "prog.mbc")}, nil, &stdout, &stderr)
+	if code != 7 {
+		t.Errorf("running the bytecode should exit 7. got=%d (%s)", code, stderr.String())
+	}
+
+	stderr.Reset()
+	code = execute([]string{"run", "--max-steps", "10", filepath.Join(dir, "prog.mbc")}, nil, &stdout, &stderr)
+	if code != exitUsage || !strings.Contains(stderr.String(), "not supported for compiled programs") {
+		t.Errorf("evaluator options should be rejected for bytecode. got=%d (%s)", code, stderr.String())
+	}
+
+	out := filepath.Join(dir, "other.mbc")
+	if code := execute([]string{"compile", "-o", out, src}, nil, &stdout, &stderr); code != exitOK {
+		t.Fatalf("compile -o should exit 0. got=%d (%s)", code, stderr.String())
+	}
+	if _, err := os.Stat(out); err != nil {
+		t.Errorf("compile -o did not write the output: %s", err)
+	}
+
+	stdout.Reset()
+	code = execute([]string{"compile", "-S", src}, nil, &stdout, &stderr)
+	if code != exitOK || !strings.HasPrefix(stdout.String(), "main:\n") || !strings.Contains(stdout.String(), "OpClosure") {
+		t.Errorf("wrong disassembly. got=%d %q", code, stdout.String())
+	}
+
+	if err := os.WriteFile(src, []byte("puts(y);"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	code = execute([]string{"compile", src}, nil, &stdout, &stderr)
+	if code != exitParseError || !strings.HasSuffix(stderr.String(), ":1:6: identifier not found: y\n") {
+		t.Errorf("wrong compile error. got=%d %q", code, stderr.String())
+	}
+
+	if err := os.WriteFile(src, []byte("let f = fn() { let x = 1; 2 };"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	code = execute([]string{"compile", src}, nil, &stdout, &stderr)
+	if code != exitOK || !strings.HasSuffix(stderr.String(), ":1:20: warning: x declared and not used\n") {
+		t.Errorf("wrong compile warning. got=%d %q", code, stderr.String())
+	}
+}
+
+func TestBuildCommand(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "prog.monkey")
+	program := "let add = fn(a) { fn(b) { a + b } };\nputs(add(3)(4));\nexit(add(1)(2));\n"
+	if err := os.WriteFile(src, []byte(program), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := execute([]string{"build", "-go", src}, nil, &stdout, &stderr)
+	if code != exitOK || !strings.Contains(stdout.String(), "func program() Value {") {
+		t.Fatalf("build -go should print the Go program. got=%d %q", code, stderr.String())
+	}
+
+	stdout.Reset()
+	code = execute([]string{"build", "-js", src}, nil, &stdout, &stderr)
+	if code != exitOK || !strings.Contains(stdout.String(), "function program() {") {
+		t.Fatalf("build -js should print the script. got=%d %q", code, stderr.String())
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "bad.monkey"), []byte("puts(y);"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	code = execute([]string{"build", filepath.Join(dir, "bad.monkey")}, nil, &stdout, &stderr)
+	if code != exitParseError || !strings.HasSuffix(stderr.String(), "bad.monkey:1:6: identifier not found: y\n") {
+		t.Errorf("wrong build error. got=%d %q", code, stderr.String())
+	}
+
+	if testing.Short() {
+		return
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+	stderr.Reset()
+	if code := execute([]string{"build", src}, nil, &stdout, &stderr); code != exitOK {
+		t.Fatalf("build should exit 0. got=%d (%s)", code, stderr.String())
+	}
+	out, err := exec.Command(filepath.Join(dir, "prog")).Output()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 || string(out) != "7\n" {
+		t.Errorf("the executable should print 7 and exit 3. got=%q, %v", out, err)
+	}
+}
+
+func TestLoadPlugins(t *testing.T) {
+	if err := loadPlugins(""); err != nil {
+		t.Errorf("an empty list should load nothing. got=%v", err)
+	}
+	path := filepath.Join(t.TempDir(), "nope.so")
+	err := loadPlugins(string(filepath.ListSeparator) + path)
+	if err == nil || !strings.HasPrefix(err.Error(), "plugin "+path+": ") {
+		t.Errorf("a missing plugin should fail. got=%v", err)
+	}
+}
@@ -0,0 +1,381 @@
+package monkey
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/object"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// maxBindDepth bounds how deeply Bind follows nested values, so a struct
+// pointing back at itself fails instead of recursing forever.
+const maxBindDepth = 64
+
+// Bind binds the global name to the Go value v. Unlike Set it accepts
+// values of any type Monkey has a counterpart for, found by reflection:
+//
+//   - Functions become builtins. Their arguments are converted to the
+//     parameter types and fail the call if they do not fit; a last result
+//     of type error fails the call when it is not nil. The other results
+//     become null, the result or an array of the results. A panic fails
+//     the call instead of the host program.
+//
+//   - Structs and pointers to structs become hashes from the names of
+//     their exported fields to the fields' values at the time of binding,
+//     and of their exported methods to builtins. Fields Monkey has no
+//     values for are left out.
+//
+//   - Other values convert as Set converts them, extended to all integer,
+//     slice and map types.
+//
+//     interp.Bind("log", func(msg string) { log.Print(msg) })
+//     interp.Bind("server", srv) // server["Addr"], server["Shutdown"]()
+func (interp *Interpreter) Bind(name string, v interface{}) error {
+	obj, err := fromGo(name, reflect.ValueOf(v), 0)
+	if err != nil {
+		return fmt.Errorf("monkey: %s: %s", name, err)
+	}
+
+	interp.mu.Lock()
+	defer interp.mu.Unlock()
+	interp.env.Set(name, obj)
+	return nil
+}
+
+// fromGo converts rv to a Monkey value. name names the functions it
+// wraps in error messages.
+func fromGo(name string, rv reflect.Value, depth int) (object.Object, error) {
+	if depth > maxBindDepth {
+		return nil, fmt.Errorf("value nested more than %d levels deep", maxBindDepth)
+	}
+	if !rv.IsValid() {
+		return evaluator.NULL, nil
+	}
+	if rv.CanInterface() {
+		if f, ok := rv.Interface().(*Function); ok {
+			return f.obj, nil
+		}
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.String:
+		// Named types such as time.Duration convert like their kind.
+		return toObject(rv.Convert(basicTypes[rv.Kind()]).Interface())
+
+	case reflect.Slice, reflect.Array:
+		elements := make([]object.Object, rv.Len())
+		for i := range elements {
+			el, err := fromGo(name, rv.Index(i), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = el
+		}
+		return &object.Array{Elements: elements}, nil
+
+	case reflect.Map:
+		hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair, rv.Len())}
+		iter := rv.MapRange()
+		for iter.Next() {
+			key, err := fromGo(name, iter.Key(), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			hashable, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			value, err := fromGo(name, iter.Value(), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			hash.Pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: value}
+		}
+		return hash, nil
+
+	case reflect.Interface:
+		if rv.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return fromGo(name, rv.Elem(), depth)
+
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return evaluator.NULL, nil
+		}
+		if rv.Elem().Kind() == reflect.Struct {
+			return fromStruct(rv, depth)
+		}
+		return fromGo(name, rv.Elem(), depth+1)
+
+	case reflect.Struct:
+		return fromStruct(rv, depth)
+
+	case reflect.Func:
+		if rv.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return wrapFunc(name, rv), nil
+	}
+
+	return nil, fmt.Errorf("cannot convert %s to a Monkey value", rv.Type())
+}
+
+var basicTypes = map[reflect.Kind]reflect.Type{
+	reflect.Bool:    reflect.TypeOf(false),
+	reflect.Int:     reflect.TypeOf(int(0)),
+	reflect.Int8:    reflect.TypeOf(int8(0)),
+	reflect.Int16:   reflect.TypeOf(int16(0)),
+	reflect.Int32:   reflect.TypeOf(int32(0)),
+	reflect.Int64:   reflect.TypeOf(int64(0)),
+	reflect.Uint:    reflect.TypeOf(uint(0)),
+	reflect.Uint8:   reflect.TypeOf(uint8(0)),
+	reflect.Uint16:  reflect.TypeOf(uint16(0)),
+	reflect.Uint32:  reflect.TypeOf(uint32(0)),
+	reflect.Uint64:  reflect.TypeOf(uint64(0)),
+	reflect.Float32: reflect.TypeOf(float32(0)),
+	reflect.Float64: reflect.TypeOf(float64(0)),
+	reflect.String:  reflect.TypeOf(""),
+}
+
+// fromStruct converts a struct, or a pointer to one, to a hash of its
+// exported fields and methods.
+func fromStruct(rv reflect.Value, depth int) (object.Object, error) {
+	hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair)}
+	set := func(key string, value object.Object) {
+		k := &object.String{Value: key}
+		hash.Pairs[k.HashKey()] = object.HashPair{Key: k, Value: value}
+	}
+
+	for i := 0; i < rv.NumMethod(); i++ {
+		method := rv.Type().Method(i)
+		set(method.Name, wrapFunc(method.Name, rv.Method(i)))
+	}
+
+	s := reflect.Indirect(rv)
+	for i := 0; i < s.NumField(); i++ {
+		field := s.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		value, err := fromGo(field.Name, s.Field(i), depth+1)
+		if err != nil {
+			continue
+		}
+		set(field.Name, value)
+	}
+	return hash, nil
+}
+
+// wrapFunc wraps the Go function fn in a builtin named name.
+func wrapFunc(name string, fn reflect.Value) *object.Builtin {
+	t := fn.Type()
+	params := make([]string, t.NumIn())
+	for i := range params {
+		params[i] = t.In(i).String()
+	}
+	if t.IsVariadic() {
+		params[len(params)-1] = "..." + t.In(t.NumIn()-1).Elem().String()
+	}
+
+	return &object.Builtin{
+		Params: params,
+		Fn: func(args ...object.Object) (result object.Object) {
+			defer func() {
+				if r := recover(); r != nil {
+					result = &object.Error{Message: fmt.Sprintf("panic in `%s`: %v", name, r)}
+				}
+			}()
+
+			if t.IsVariadic() && len(args) < t.NumIn()-1 {
+				return &object.Error{Message: fmt.Sprintf("wrong number of arguments. got=%d, want at least %d", len(args), t.NumIn()-1)}
+			}
+			if !t.IsVariadic() && len(args) != t.NumIn() {
+				return &object.Error{Message: fmt.Sprintf("wrong number of arguments. got=%d, want=%d", len(args), t.NumIn())}
+			}
+
+			in := make([]reflect.Value, len(args))
+			for i, arg := range args {
+				paramType := t.In(min(i, t.NumIn()-1))
+				if t.IsVariadic() && i >= t.NumIn()-1 {
+					paramType = paramType.Elem()
+				}
+				v, err := toType(arg, paramType)
+				if err != nil {
+					return &object.Error{Message: fmt.Sprintf("argument %d to `%s`: %s", i+1, name, err)}
+				}
+				in[i] = v
+			}
+
+			out := fn.Call(in)
+			if len(out) > 0 && t.Out(len(out)-1) == errorType {
+				if err, _ := out[len(out)-1].Interface().(error); err != nil {
+					return &object.Error{Message: err.Error()}
+				}
+				out = out[:len(out)-1]
+			}
+
+			results := make([]object.Object, len(out))
+			for i, v := range out {
+				obj, err := fromGo(name, v, 0)
+				if err != nil {
+					return &object.Error{Message: fmt.Sprintf("result of `%s`: %s", name, err)}
+				}
+				results[i] = obj
+			}
+			switch len(results) {
+			case 0:
+				return evaluator.NULL
+			case 1:
+				return results[0]
+			default:
+				return &object.Array{Elements: results}
+			}
+		},
+	}
+}
+
+// toType converts the Monkey value obj to a Go value of type t.
+func toType(obj object.Object, t reflect.Type) (reflect.Value, error) {
+	fail := func() (reflect.Value, error) {
+		return reflect.Value{}, fmt.Errorf("cannot use %s as %s", obj.Type(), t)
+	}
+
+	// Values Get would return, such as *Function, are used as they are.
+	if v := toGo(obj); v != nil && reflect.TypeOf(v).AssignableTo(t) {
+		return reflect.ValueOf(v), nil
+	}
+	if obj == evaluator.NULL && t.Kind() == reflect.Interface {
+		return reflect.Zero(t), nil
+	}
+
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Bool:
+		b, ok := obj.(*object.Boolean)
+		if !ok {
+			return fail()
+		}
+		v.SetBool(b.Value)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := obj.(*object.Integer)
+		if !ok {
+			return fail()
+		}
+		if v.OverflowInt(i.Value) {
+			return reflect.Value{}, fmt.Errorf("%d overflows %s", i.Value, t)
+		}
+		v.SetInt(i.Value)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, ok := obj.(*object.Integer)
+		if !ok {
+			return fail()
+		}
+		if i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+			return reflect.Value{}, fmt.Errorf("%d overflows %s", i.Value, t)
+		}
+		v.SetUint(uint64(i.Value))
+
+	case reflect.Float32, reflect.Float64:
+		switch n := obj.(type) {
+		case *object.Float:
+			v.SetFloat(n.Value)
+		case *object.Integer:
+			v.SetFloat(float64(n.Value))
+		default:
+			return fail()
+		}
+
+	case reflect.String:
+		s, ok := obj.(*object.String)
+		if !ok {
+			return fail()
+		}
+		v.SetString(s.Value)
+
+	case reflect.Slice, reflect.Array:
+		if obj == evaluator.NULL && t.Kind() == reflect.Slice {
+			return v, nil
+		}
+		arr, ok := obj.(*object.Array)
+		if !ok {
+			return fail()
+		}
+		if t.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(t, len(arr.Elements), len(arr.Elements)))
+		} else if len(arr.Elements) != t.Len() {
+			return reflect.Value{}, fmt.Errorf("cannot use an array of %d elements as %s", len(arr.Elements), t)
+		}
+		for i, el := range arr.Elements {
+			ev, err := toType(el, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v.Index(i).Set(ev)
+		}
+
+	case reflect.Map:
+		if obj == evaluator.NULL {
+			return v, nil
+		}
+		hash, ok := obj.(*object.Hash)
+		if !ok {
+			return fail()
+		}
+		v.Set(reflect.MakeMapWithSize(t, len(hash.Pairs)))
+		for _, pair := range hash.Pairs {
+			key, err := toType(pair.Key, t.Key())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			value, err := toType(pair.Value, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v.SetMapIndex(key, value)
+		}
+
+	case reflect.Pointer:
+		if obj == evaluator.NULL {
+			return v, nil
+		}
+		elem, err := toType(obj, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.Set(reflect.New(t.Elem()))
+		v.Elem().Set(elem)
+
+	case reflect.Struct:
+		hash, ok := obj.(*object.Hash)
+		if !ok {
+			return fail()
+		}
+		for _, pair := range hash.Pairs {
+			key, ok := pair.Key.(*object.String)
+			if !ok {
+				return reflect.Value{}, fmt.Errorf("cannot use %s key as a field of %s", pair.Key.Type(), t)
+			}
+			field, ok := t.FieldByName(key.Value)
+			if !ok || !field.IsExported() {
+				continue
+			}
+			fv, err := toType(pair.Value, field.Type)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("field %s: %s", key.Value, err)
+			}
+			v.FieldByIndex(field.Index).Set(fv)
+		}
+
+	default:
+		return fail()
+	}
+	return v, nil
+}
@@ -0,0 +1,142 @@
+package monkey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type counter struct {
+	Name  string
+	Step  uint8
+	Tags  []string
+	count int
+}
+
+func (c *counter) Add(n int) int {
+	c.count += n * int(c.Step)
+	return c.count
+}
+
+func (c *counter) Reset() { c.count = 0 }
+
+func TestBind(t *testing.T) {
+	interp := New(Options{})
+	ctx := context.Background()
+
+	var logged []string
+	binds := map[string]interface{}{
+		"log": func(msg string) { logged = append(logged, msg) },
+		"sum": func(base int32, ns ...int) int64 {
+			total := int64(base)
+			for _, n := range ns {
+				total += int64(n)
+			}
+			return total
+		},
+		"divmod": func(a, b int) (int, int, error) {
+			if b == 0 {
+				return 0, 0, errors.New("divmod: division by zero")
+			}
+			return a / b, a % b, nil
+		},
+		"boom":    func() { panic("oops") },
+		"keys":    func(m map[string]bool) int { return len(m) },
+		"pointer": func(p *int) bool { return p == nil },
+		"counter": &counter{Name: "c", Step: 2, Tags: []string{"x"}},
+		"limits":  [2]uint16{1, 2},
+	}
+	for name, v := range binds {
+		if err := interp.Bind(name, v); err != nil {
+			t.Fatalf("Bind(%q): %s", name, err)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`log("hi")`, nil},
+		{"sum(1)", int64(1)},
+		{"sum(1, 2, 3)", int64(6)},
+		{"divmod(7, 2)", []interface{}{int64(3), int64(1)}},
+		{`keys({"a": true, "b": false})`, int64(2)},
+		{"pointer(first([]))", true},
+		{"pointer(1)", false},
+		{`counter["Name"]`, "c"},
+		{`counter["Tags"]`, []interface{}{"x"}},
+		{`counter["count"]`, nil},
+		{`counter["Add"](3); counter["Add"](1)`, int64(8)},
+		{`counter["Reset"](); counter["Add"](1)`, int64(2)},
+		{"limits", []interface{}{int64(1), int64(2)}},
+	}
+	for _, tt := range tests {
+		got, err := interp.Eval(ctx, tt.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%q: wrong value. want=%#v, got=%#v", tt.input, tt.expected, got)
+		}
+	}
+	if !reflect.DeepEqual(logged, []string{"hi"}) {
+		t.Errorf("log was not called with its argument. got=%q", logged)
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	interp := New(Options{})
+	ctx := context.Background()
+
+	interp.Bind("log", func(msg string) {})
+	interp.Bind("small", func(n int8) {})
+	interp.Bind("sum", func(ns ...int) {})
+	interp.Bind("fail", func() error { return errors.New("it failed") })
+	interp.Bind("boom", func() { panic("oops") })
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"log(1)", "argument 1 to `log`: cannot use INTEGER as string"},
+		{"log()", "wrong number of arguments. got=0, want=1"},
+		{"small(200)", "argument 1 to `small`: 200 overflows int8"},
+		{`sum(1, "2")`, "argument 2 to `sum`: cannot use STRING as int"},
+		{"fail()", "it failed"},
+		{"boom()", "panic in `boom`: oops"},
+	}
+	for _, tt := range tests {
+		_, err := interp.Eval(ctx, tt.input)
+		var runtimeErr *RuntimeError
+		if !errors.As(err, &runtimeErr) || runtimeErr.Message != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	err := interp.Bind("ch", make(chan int))
+	if err == nil || !strings.Contains(err.Error(), "cannot convert chan int") {
+		t.Errorf("binding a channel should fail. got=%v", err)
+	}
+}
+
+func TestBindFunction(t *testing.T) {
+	interp := New(Options{})
+	ctx := context.Background()
+
+	// Monkey functions passed to Go come back unchanged.
+	interp.Bind("apply", func(f *Function, x int) *Function { return f })
+	got, err := interp.Eval(ctx, "apply(fn(x) { x }, 1)(5)")
+	if err != nil || got != int64(5) {
+		t.Errorf("wrong result. got=%v, %v", got, err)
+	}
+
+	interp.Bind("describe", func(v interface{}) string { return fmt.Sprintf("%T", v) })
+	got, err = interp.Eval(ctx, `describe([1, "a"])`)
+	if err != nil || got != "[]interface {}" {
+		t.Errorf("wrong result. got=%v, %v", got, err)
+	}
+}
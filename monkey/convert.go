@@ -0,0 +1,150 @@
+package monkey
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/object"
+)
+
+// Function is a Monkey function or builtin held by Go code. It can be
+// handed back to Monkey, e.g. with Set.
+type Function struct {
+	obj object.Object
+}
+
+// String returns the function as Monkey prints it.
+func (f *Function) String() string {
+	return f.obj.Inspect()
+}
+
+// Inspect returns v, a value returned by Eval, Call or Get, as Monkey
+// prints it, e.g. "hi" with its quotes. Values Set does not accept are
+// formatted with fmt.
+func Inspect(v interface{}) string {
+	obj, err := toObject(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return obj.Inspect()
+}
+
+// toGo converts a Monkey value to a Go value as documented by Get.
+func toGo(obj object.Object) interface{} {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value
+	case *object.Float:
+		return obj.Value
+	case *object.String:
+		return obj.Value
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return nil
+	case *object.Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			elements[i] = toGo(el)
+		}
+		return elements
+	case *object.Hash:
+		m := make(map[interface{}]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			m[toGo(pair.Key)] = toGo(pair.Value)
+		}
+		return m
+	default:
+		return &Function{obj: obj}
+	}
+}
+
+// toObject converts a Go value to a Monkey value as documented by Set.
+func toObject(v interface{}) (object.Object, error) {
+	switch v := v.(type) {
+	case nil:
+		return evaluator.NULL, nil
+	case bool:
+		if v {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+	case int:
+		return &object.Integer{Value: int64(v)}, nil
+	case int8:
+		return &object.Integer{Value: int64(v)}, nil
+	case int16:
+		return &object.Integer{Value: int64(v)}, nil
+	case int32:
+		return &object.Integer{Value: int64(v)}, nil
+	case int64:
+		return &object.Integer{Value: v}, nil
+	case uint8:
+		return &object.Integer{Value: int64(v)}, nil
+	case uint16:
+		return &object.Integer{Value: int64(v)}, nil
+	case uint32:
+		return &object.Integer{Value: int64(v)}, nil
+	case uint:
+		return toObject(uint64(v))
+	case uint64:
+		if v > math.MaxInt64 {
+			return nil, fmt.Errorf("%d overflows a Monkey integer", v)
+		}
+		return &object.Integer{Value: int64(v)}, nil
+	case float32:
+		return &object.Float{Value: float64(v)}, nil
+	case float64:
+		return &object.Float{Value: v}, nil
+	case string:
+		return &object.String{Value: v}, nil
+	case []interface{}:
+		elements := make([]object.Object, len(v))
+		for i, el := range v {
+			obj, err := toObject(el)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = obj
+		}
+		return &object.Array{Elements: elements}, nil
+	case map[string]interface{}:
+		hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair, len(v))}
+		for key, value := range v {
+			if err := setPair(hash, key, value); err != nil {
+				return nil, err
+			}
+		}
+		return hash, nil
+	case map[interface{}]interface{}:
+		hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair, len(v))}
+		for key, value := range v {
+			if err := setPair(hash, key, value); err != nil {
+				return nil, err
+			}
+		}
+		return hash, nil
+	case *Function:
+		return v.obj, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %T to a Monkey value", v)
+	}
+}
+
+func setPair(hash *object.Hash, key, value interface{}) error {
+	k, err := toObject(key)
+	if err != nil {
+		return err
+	}
+	hashable, ok := k.(object.Hashable)
+	if !ok {
+		return fmt.Errorf("unusable as hash key: %s", k.Type())
+	}
+	val, err := toObject(value)
+	if err != nil {
+		return err
+	}
+	hash.Pairs[hashable.HashKey()] = object.HashPair{Key: k, Value: val}
+	return nil
+}
@@ -0,0 +1,94 @@
+package monkey
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// maxLoggedArg limits how much of each argument of a builtin call is
+// logged, as programs may write whole files.
+const maxLoggedArg = 64
+
+// log logs an event if interp has a logger.
+func (interp *Interpreter) log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if interp.logger == nil {
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	interp.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// logError logs err, which stopped an evaluation by e, as a limit being
+// exceeded or as a runtime error.
+func (interp *Interpreter) logError(e *evaluator.Evaluator, err *object.Error) {
+	if interp.logger == nil {
+		return
+	}
+	attrs := []slog.Attr{slog.String("error", err.Message)}
+	if pos, ok := e.ErrorPos(err); ok && pos.IsValid() {
+		attrs = append(attrs, slog.Int("line", pos.Line), slog.Int("column", pos.Column))
+	}
+	if evaluator.IsLimitError(err) {
+		interp.log(interp.ctx, slog.LevelWarn, "limit exceeded", attrs...)
+		return
+	}
+	interp.log(interp.ctx, slog.LevelError, "eval error", attrs...)
+}
+
+// logWarning logs a warning about the source at pos.
+func (interp *Interpreter) logWarning(ctx context.Context, pos token.Position, msg string) {
+	attrs := []slog.Attr{slog.String("warning", msg)}
+	if pos.IsValid() {
+		attrs = append(attrs, slog.Int("line", pos.Line), slog.Int("column", pos.Column))
+	}
+	interp.log(ctx, slog.LevelWarn, "warning", attrs...)
+}
+
+// logBuiltins binds every builtin performing I/O that the interpreter's
+// programs may call to a wrapper logging its calls. Like the puts of
+// Options.Stdout, the wrappers are globals shadowing the builtins.
+func (interp *Interpreter) logBuiltins() {
+	for _, name := range evaluator.BuiltinNames() {
+		builtin, _ := evaluator.LookupBuiltin(name)
+		if !builtin.IO || interp.limits.Unavailable(builtin) != "" {
+			continue
+		}
+		fn := builtin.Fn
+		if global, ok := interp.env.Get(name); ok {
+			fn = global.(*object.Builtin).Fn
+		}
+
+		wrapped := *builtin
+		wrapped.Fn = func(args ...object.Object) object.Object {
+			result := fn(args...)
+
+			logged := make([]string, len(args))
+			for i, arg := range args {
+				logged[i] = truncate(arg.Inspect(), maxLoggedArg)
+			}
+			attrs := []slog.Attr{slog.String("builtin", name), slog.Any("args", logged)}
+			if builtin.Capability != "" {
+				attrs = append(attrs, slog.String("capability", string(builtin.Capability)))
+			}
+			if err, ok := result.(*object.Error); ok {
+				attrs = append(attrs, slog.String("error", err.Message))
+			}
+			interp.log(interp.ctx, slog.LevelInfo, "builtin call", attrs...)
+			return result
+		}
+		interp.env.Set(name, &wrapped)
+	}
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max-3] + "..."
+}
@@ -0,0 +1,329 @@
+// Package monkey embeds the Monkey interpreter in Go programs, e.g. as a
+// scripting or configuration language:
+//
+//	interp := monkey.New(monkey.Options{MaxSteps: 1e6})
+//	interp.Set("name", "world")
+//	val, err := interp.Eval(ctx, `"hello " + name`)
+//
+// Values cross between Go and Monkey as Go values: see Set for what Go
+// values become and Get for what Monkey values become. Bind exposes Go
+// functions and structs to programs.
+package monkey
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/parser"
+	"github.com/frankie-mur/monkeylang/resolver"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// Options configure an Interpreter. The zero value runs programs without
+// limits other than the default call depth, printing to the standard output.
+type Options struct {
+	// Stdout is where puts writes. Nil means os.Stdout.
+	Stdout io.Writer
+	// MaxSteps is the number of syntax tree nodes one evaluation may
+	// evaluate, and MaxDepth the number of nested function calls it may
+	// make. Zero means no limit for MaxSteps and evaluator.DefaultMaxDepth
+	// for MaxDepth.
+	MaxSteps int64
+	MaxDepth int
+	// MaxNesting is the number of syntax tree nodes whose evaluation may
+	// be in progress at once, across calls. Zero means
+	// evaluator.DefaultMaxNesting.
+	MaxNesting int
+	// MaxAlloc is the number of bytes the strings, arrays and hashes one
+	// evaluation creates may take up, counting those it has since
+	// dropped. Zero means no limit.
+	MaxAlloc int64
+	// NoIO disables the builtins that perform input or output.
+	NoIO bool
+	// Sandbox, if not nil, disables the builtins that reach parts of the
+	// outside world it does not grant, such as the filesystem.
+	Sandbox *Sandbox
+	// Logger, if not nil, receives events of the interpreter's work:
+	// parsing at debug level, each call of a builtin performing I/O at
+	// info level, limits being exceeded and warnings, such as calls of
+	// deprecated builtins, at warn level and runtime errors, with their
+	// positions, at error level.
+	Logger *slog.Logger
+	// Lang is the language version sources are read as, so scripts
+	// written for an older one keep working. Zero means the latest.
+	Lang Lang
+}
+
+// Lang is a version of the Monkey language.
+type Lang = token.Lang
+
+// Sandbox grants the capabilities a sandboxed interpreter's programs may
+// use; see Options.Sandbox.
+type Sandbox = evaluator.Sandbox
+
+// Interpreter evaluates Monkey sources in global bindings that persist
+// from one evaluation to the next, as in a REPL. It is safe for concurrent
+// use; evaluations run one at a time.
+type Interpreter struct {
+	mu     sync.Mutex
+	env    *object.Enviroment
+	limits evaluator.Limits
+	lang   Lang
+
+	stdout io.Writer // where puts writes
+
+	logger *slog.Logger
+	ctx    context.Context // of the running evaluation, for logging
+
+	stats Stats
+
+	// pool is the Pool interp belongs to, if any, and base the bindings
+	// its programs see after each reset. baseValues holds the values the
+	// setup bound there, which each reset binds copies of again.
+	pool       *Pool
+	base       *object.Enviroment
+	baseValues map[string]object.Object
+}
+
+// Stats are counters of the work of an evaluation; see Interpreter.Stats.
+type Stats = evaluator.Stats
+
+// Stats returns the counters of the most recent Eval or Call: the nodes it
+// evaluated, the calls it made, its deepest nesting of calls, the values it
+// created by type and the bytes the process allocated meanwhile. Programs
+// get the same counters as a hash from the stats builtin.
+func (interp *Interpreter) Stats() Stats {
+	interp.mu.Lock()
+	defer interp.mu.Unlock()
+	return interp.stats
+}
+
+// New returns an Interpreter without global bindings.
+func New(opts Options) *Interpreter {
+	interp := &Interpreter{
+		env: object.NewEnvironment(),
+		limits: evaluator.Limits{
+			MaxSteps:   opts.MaxSteps,
+			MaxDepth:   opts.MaxDepth,
+			MaxNesting: opts.MaxNesting,
+			MaxAlloc:   opts.MaxAlloc,
+			NoIO:       opts.NoIO,
+			Sandbox:    opts.Sandbox,
+		},
+		logger: opts.Logger,
+		lang:   opts.Lang,
+	}
+
+	// puts writes to the process-wide evaluator.Output, so it is replaced
+	// by one writing to this interpreter's output. Global bindings shadow
+	// builtins.
+	if !opts.NoIO {
+		interp.stdout = opts.Stdout
+		if interp.stdout == nil {
+			interp.stdout = os.Stdout
+		}
+		puts, _ := evaluator.LookupBuiltin("puts")
+		interp.env.Set("puts", &object.Builtin{
+			Params: puts.Params,
+			Doc:    puts.Doc,
+			IO:     true,
+			Warn:   puts.Warn,
+			Fn: func(args ...object.Object) object.Object {
+				for _, arg := range args {
+					fmt.Fprintln(interp.stdout, arg.Inspect())
+				}
+				return evaluator.NULL
+			},
+		})
+	}
+	if interp.logger != nil {
+		interp.logBuiltins()
+	}
+	return interp
+}
+
+// SetOutput makes puts write to w, until the next SetOutput.
+func (interp *Interpreter) SetOutput(w io.Writer) {
+	interp.mu.Lock()
+	defer interp.mu.Unlock()
+	interp.stdout = w
+}
+
+// ParseError reports the syntax errors of a source, one per line as
+// line:col: message.
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string {
+	return strings.Join(e.Errors, "\n")
+}
+
+// RuntimeError is an error a program ran into, such as a type mismatch or
+// an exceeded limit, at Line and Column of the source when they are known.
+type RuntimeError struct {
+	Message      string
+	Line, Column int // zero when unknown
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// ExitError reports that a program called exit with Code.
+type ExitError struct {
+	Code int64
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// Eval evaluates src and returns the value of its last expression
+// statement, converted as Get converts values. Its let statements bind
+// globals that later calls see. Evaluation stops with a RuntimeError once
+// ctx is done.
+func (interp *Interpreter) Eval(ctx context.Context, src string) (interface{}, error) {
+	interp.log(ctx, slog.LevelDebug, "parse started", slog.Int("bytes", len(src)))
+	start := time.Now()
+	l := lexer.New(src)
+	l.SetLang(interp.lang)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	interp.log(ctx, slog.LevelDebug, "parse finished",
+		slog.Int("statements", len(program.Statements)),
+		slog.Int("errors", len(p.ParseErrors())),
+		slog.Duration("duration", time.Since(start)))
+	if errs := p.ParseErrors(); len(errs) != 0 {
+		err := &ParseError{}
+		for _, e := range errs {
+			err.Errors = append(err.Errors, e.Error())
+		}
+		return nil, err
+	}
+	for _, w := range p.Warnings() {
+		interp.logWarning(ctx, w.Pos, w.Message)
+	}
+	resolver.Resolve(program)
+
+	interp.mu.Lock()
+	defer interp.mu.Unlock()
+	return interp.run(ctx, func(e *evaluator.Evaluator) object.Object {
+		return e.Eval(program, interp.env)
+	})
+}
+
+// Call calls the function bound to the global name with args, converted
+// as Set converts values, and returns its result.
+func (interp *Interpreter) Call(ctx context.Context, name string, args ...interface{}) (interface{}, error) {
+	interp.mu.Lock()
+	defer interp.mu.Unlock()
+
+	fn, ok := interp.lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("monkey: no global %s", name)
+	}
+	objs := make([]object.Object, len(args))
+	for i, arg := range args {
+		obj, err := toObject(arg)
+		if err != nil {
+			return nil, fmt.Errorf("monkey: argument %d: %s", i+1, err)
+		}
+		objs[i] = obj
+	}
+	return interp.run(ctx, func(e *evaluator.Evaluator) object.Object {
+		return e.Apply(fn, objs)
+	})
+}
+
+// run evaluates with a new evaluator, so each evaluation has the full
+// step limit, and turns the result into a Go value or an error.
+func (interp *Interpreter) run(ctx context.Context, eval func(*evaluator.Evaluator) object.Object) (val interface{}, err error) {
+	e := evaluator.New()
+	e.SetLimits(interp.limits)
+	e.SetContext(ctx)
+	interp.ctx = ctx
+	if interp.logger != nil {
+		e.SetWarn(func(w evaluator.Warning) { interp.logWarning(ctx, w.Pos, w.Message) })
+	}
+	defer func() { interp.stats = e.Stats() }()
+
+	// A panic in the evaluator or in a builtin registered by a plugin
+	// must not take the host program down.
+	defer func() {
+		if r := recover(); r != nil {
+			interp.log(ctx, slog.LevelError, "eval panic", slog.Any("panic", r))
+			val, err = nil, &RuntimeError{Message: fmt.Sprint(r)}
+		}
+	}()
+
+	switch result := eval(e).(type) {
+	case nil:
+		return nil, nil
+	case *object.Error:
+		interp.logError(e, result)
+		runtimeErr := &RuntimeError{Message: result.Message}
+		if pos, ok := e.ErrorPos(result); ok && pos.IsValid() {
+			runtimeErr.Line, runtimeErr.Column = pos.Line, pos.Column
+		}
+		return nil, runtimeErr
+	case *object.Exit:
+		return nil, &ExitError{Code: result.Code}
+	default:
+		return toGo(result), nil
+	}
+}
+
+// Get returns the value of the global name, or false if there is none.
+// Monkey integers become int64, floats float64, strings, booleans and
+// null their Go counterparts, arrays []interface{} and hashes map[interface{}]interface{}.
+// Functions become *Function.
+func (interp *Interpreter) Get(name string) (interface{}, bool) {
+	interp.mu.Lock()
+	defer interp.mu.Unlock()
+
+	obj, ok := interp.env.Get(name)
+	if !ok {
+		return nil, false
+	}
+	return toGo(obj), true
+}
+
+// Set binds the global name to value, converted to a Monkey value. It
+// accepts nil, bools, integers that fit in an int64, floats, strings,
+// []interface{}, maps with string keys or with interface{} keys holding
+// integers, strings or bools, and *Function, and fails for other values.
+func (interp *Interpreter) Set(name string, value interface{}) error {
+	obj, err := toObject(value)
+	if err != nil {
+		return fmt.Errorf("monkey: %s: %s", name, err)
+	}
+
+	interp.mu.Lock()
+	defer interp.mu.Unlock()
+	interp.env.Set(name, obj)
+	return nil
+}
+
+// lookup finds a global or builtin by name.
+func (interp *Interpreter) lookup(name string) (object.Object, bool) {
+	if obj, ok := interp.env.Get(name); ok {
+		return obj, true
+	}
+	if builtin, ok := evaluator.LookupBuiltin(name); ok && interp.limits.Unavailable(builtin) == "" {
+		return builtin, true
+	}
+	return nil, false
+}
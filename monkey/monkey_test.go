@@ -0,0 +1,273 @@
+package monkey
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEval(t *testing.T) {
+	interp := New(Options{})
+	ctx := context.Background()
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 + 2", int64(3)},
+		{`"a" + "b"`, "ab"},
+		{"1 < 2", true},
+		{"if (false) { 1 }", nil},
+		{"let x = 5;", nil},
+		{"x * 2", int64(10)},
+		{`[1, "two", [true]]`, []interface{}{int64(1), "two", []interface{}{true}}},
+		{`{"a": 1, 2: false}`, map[interface{}]interface{}{"a": int64(1), int64(2): false}},
+	}
+
+	for _, tt := range tests {
+		got, err := interp.Eval(ctx, tt.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%q: wrong value. want=%#v, got=%#v", tt.input, tt.expected, got)
+		}
+	}
+
+	got, err := interp.Eval(ctx, "fn(a) { a }")
+	fn, ok := got.(*Function)
+	if err != nil || !ok || fn.String() != "fn(a) {\na\n}" {
+		t.Errorf("functions should come back as *Function. got=%#v, %v", got, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	interp := New(Options{MaxSteps: 1000})
+	ctx := context.Background()
+
+	_, err := interp.Eval(ctx, "let x = ;")
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Errors[0] != "1:9: no prefix parse function for token ';' found" {
+		t.Errorf("expected a parse error. got=%v", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + true", "type mismatch: INTEGER + BOOLEAN"},
+		{"nope", "identifier not found: nope"},
+		{"1 / 0", "division by zero"},
+		{"let f = fn(n) { f(n + 1) }; f(0)", "step limit exceeded: evaluated more than 1000 nodes"},
+	}
+	for _, tt := range tests {
+		_, err := interp.Eval(ctx, tt.input)
+		var runtimeErr *RuntimeError
+		if !errors.As(err, &runtimeErr) || runtimeErr.Message != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	_, err = interp.Eval(ctx, "let x = 1;\nx + true")
+	if err == nil || err.Error() != "2:1: type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong error. want the position, got=%v", err)
+	}
+
+	// The step limit applies to each evaluation on its own.
+	for i := 0; i < 3; i++ {
+		if _, err := interp.Eval(ctx, "let g = fn(n) { if (n > 0) { g(n - 1) } }; g(50)"); err != nil {
+			t.Fatalf("evaluation %d: unexpected error %s", i, err)
+		}
+	}
+
+	_, err = interp.Eval(ctx, "exit(3)")
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 3 {
+		t.Errorf("expected exit 3. got=%v", err)
+	}
+}
+
+func TestContext(t *testing.T) {
+	interp := New(Options{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := interp.Eval(ctx, "let loop = fn() { loop() }; loop()")
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.Message != "timeout exceeded" {
+		t.Errorf("expected a timeout. got=%v", err)
+	}
+}
+
+func TestGetSet(t *testing.T) {
+	interp := New(Options{})
+	ctx := context.Background()
+
+	values := map[string]interface{}{
+		"n":     42,
+		"half":  0.5,
+		"big":   uint64(1 << 40),
+		"s":     "hi",
+		"b":     true,
+		"null":  nil,
+		"list":  []interface{}{1, "x"},
+		"conf":  map[string]interface{}{"port": 8080, "debug": false},
+		"mixed": map[interface{}]interface{}{1: "one", true: "yes"},
+	}
+	for name, value := range values {
+		if err := interp.Set(name, value); err != nil {
+			t.Fatalf("Set(%q): %s", name, err)
+		}
+	}
+
+	got, err := interp.Eval(ctx, `[n + 1, big / 1024, len(s), !b, null, list[1], conf["port"], mixed[true], b == true, n * half]`)
+	want := []interface{}{int64(43), int64(1 << 30), int64(2), false, nil, "x", int64(8080), "yes", true, 21.0}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong values seen by Monkey. want=%#v, got=%#v (%v)", want, got, err)
+	}
+
+	interp.Eval(ctx, `let greeting = "hello"; let double = fn(x) { x * 2 };`)
+	if v, ok := interp.Get("greeting"); !ok || v != "hello" {
+		t.Errorf("Get(greeting) wrong. got=%#v, %t", v, ok)
+	}
+	if _, ok := interp.Get("missing"); ok {
+		t.Errorf("Get(missing) should fail")
+	}
+
+	fn, _ := interp.Get("double")
+	if err := interp.Set("twice", fn); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := interp.Call(ctx, "twice", 21); err != nil || v != int64(42) {
+		t.Errorf("Call(twice, 21) wrong. got=%#v, %v", v, err)
+	}
+	if v, err := interp.Call(ctx, "len", "four"); err != nil || v != int64(4) {
+		t.Errorf("Call(len) wrong. got=%#v, %v", v, err)
+	}
+	if _, err := interp.Call(ctx, "missing"); err == nil {
+		t.Errorf("Call(missing) should fail")
+	}
+
+	errs := []interface{}{uint64(1 << 63), 1i, map[interface{}]interface{}{nil: 1}, []interface{}{struct{}{}}}
+	for _, v := range errs {
+		if err := interp.Set("bad", v); err == nil {
+			t.Errorf("Set(%#v) should fail", v)
+		}
+	}
+}
+
+func TestOutput(t *testing.T) {
+	var out1, out2 bytes.Buffer
+	one, two := New(Options{Stdout: &out1}), New(Options{Stdout: &out2})
+
+	var wg sync.WaitGroup
+	for _, interp := range []*Interpreter{one, two, one, two} {
+		wg.Add(1)
+		go func(interp *Interpreter) {
+			defer wg.Done()
+			interp.Eval(context.Background(), `puts("x")`)
+		}(interp)
+	}
+	wg.Wait()
+	if out1.String() != "\"x\"\n\"x\"\n" || out2.String() != out1.String() {
+		t.Errorf("each interpreter should print to its own output. got=%q, %q", out1.String(), out2.String())
+	}
+
+	quiet := New(Options{NoIO: true})
+	_, err := quiet.Eval(context.Background(), `puts("x")`)
+	if err == nil || !strings.Contains(err.Error(), "I/O is disabled") {
+		t.Errorf("puts should be disabled. got=%v", err)
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	interp := New(Options{Sandbox: &Sandbox{Environment: true}})
+	ctx := context.Background()
+
+	if _, err := interp.Eval(ctx, `getenv("HOME")`); err != nil {
+		t.Errorf("getenv should be granted. got=%v", err)
+	}
+	_, err := interp.Eval(ctx, "now()")
+	if err == nil || err.Error() != "1:1: now is not available: the time capability is not granted" {
+		t.Errorf("now should not be granted. got=%v", err)
+	}
+	_, err = interp.Call(ctx, "read_file", "/etc/passwd")
+	if err == nil || err.Error() != "monkey: no global read_file" {
+		t.Errorf("read_file should not be callable. got=%v", err)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey || a.Key == "duration" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	interp := New(Options{Stdout: io.Discard, MaxDepth: 10, Sandbox: &Sandbox{Environment: true}, Logger: logger})
+	ctx := context.Background()
+
+	interp.Eval(ctx, `puts("hi", 1); getenv("MONKEY_TEST_UNSET")`)
+	interp.Eval(ctx, "let x = 1;\nx + true")
+	interp.Eval(ctx, "let f = fn() { 1 + f() }; f()")
+	interp.Eval(ctx, "let y = ;")
+	interp.Eval(ctx, "puts()")
+
+	want := `level=DEBUG msg="parse started" bytes=42
+level=DEBUG msg="parse finished" statements=2 errors=0
+level=INFO msg="builtin call" builtin=puts args="[\"hi\" 1]"
+level=INFO msg="builtin call" builtin=getenv args="[\"MONKEY_TEST_UNSET\"]" capability=env
+level=DEBUG msg="parse started" bytes=19
+level=DEBUG msg="parse finished" statements=2 errors=0
+level=ERROR msg="eval error" error="type mismatch: INTEGER + BOOLEAN" line=2 column=1
+level=DEBUG msg="parse started" bytes=29
+level=DEBUG msg="parse finished" statements=2 errors=0
+level=WARN msg="limit exceeded" error="maximum call depth of 10 exceeded" line=1 column=20
+level=DEBUG msg="parse started" bytes=9
+level=DEBUG msg="parse finished" statements=1 errors=1
+level=DEBUG msg="parse started" bytes=6
+level=DEBUG msg="parse finished" statements=1 errors=0
+level=WARN msg=warning warning="puts without arguments prints nothing" line=1 column=1
+level=INFO msg="builtin call" builtin=puts args=[]
+`
+	if logs.String() != want {
+		t.Errorf("wrong logs.\nwant:\n%s\ngot:\n%s", want, logs.String())
+	}
+
+	// The sandbox still applies to programs of an interpreter with a
+	// logger, which must not bind the builtins it denies.
+	if _, err := interp.Eval(ctx, "now()"); err == nil {
+		t.Errorf("now should not be granted")
+	}
+}
+
+func TestStats(t *testing.T) {
+	interp := New(Options{})
+	ctx := context.Background()
+
+	if _, err := interp.Eval(ctx, "let f = fn(n) { if (n > 0) { 1 + f(n - 1) } else { 0 } }; f(3)"); err != nil {
+		t.Fatal(err)
+	}
+	stats := interp.Stats()
+	if stats.Calls != 4 || stats.MaxDepth != 4 || stats.Steps == 0 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+
+	// Each evaluation has counters of its own.
+	interp.Eval(ctx, "1")
+	if stats := interp.Stats(); stats.Calls != 0 || stats.Allocs["INTEGER"] != 1 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+}
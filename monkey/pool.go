@@ -0,0 +1,130 @@
+package monkey
+
+import (
+	"context"
+	"io"
+
+	"github.com/frankie-mur/monkeylang/object"
+)
+
+// Pool keeps interpreters ready for servers running many small programs
+// concurrently, each in bindings of its own:
+//
+//	pool, err := monkey.NewPool(8, monkey.Options{MaxSteps: 1e6}, nil)
+//	interp, err := pool.Get(ctx)
+//	defer pool.Put(interp)
+//	val, err := interp.Eval(ctx, src)
+//
+// A checked out interpreter starts with the globals its setup bound, and
+// Put discards the globals its programs bound. The limits of the pool's
+// Options apply to each evaluation: its steps, its call depth and, with
+// MaxAlloc, the memory its values take up, so one program cannot exhaust
+// the memory of the host. A deadline on the context of Eval limits its
+// time.
+type Pool struct {
+	stdout io.Writer // of the interpreters after a reset
+	idle   chan *Interpreter
+}
+
+// NewPool returns a Pool of n interpreters created with opts. setup, if
+// not nil, is called with each of them to bind the globals every program
+// should see, such as host functions bound with Bind.
+func NewPool(n int, opts Options, setup func(*Interpreter) error) (*Pool, error) {
+	p := &Pool{idle: make(chan *Interpreter, n)}
+	for i := 0; i < n; i++ {
+		interp := New(opts)
+		p.stdout = interp.stdout
+		if setup != nil {
+			if err := setup(interp); err != nil {
+				return nil, err
+			}
+		}
+		interp.pool = p
+		interp.base = interp.env
+		interp.baseValues = map[string]object.Object{}
+		for _, name := range interp.base.Names() {
+			value, _ := interp.base.Get(name)
+			interp.baseValues[name] = value
+		}
+		interp.reset()
+		p.idle <- interp
+	}
+	return p, nil
+}
+
+// Get checks out an idle interpreter, waiting for one until ctx is done.
+func (p *Pool) Get(ctx context.Context) (*Interpreter, error) {
+	select {
+	case interp := <-p.idle:
+		return interp, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Put resets interp, which Get returned, and checks it back in. Its output
+// is restored to the one of the pool's Options.
+func (p *Pool) Put(interp *Interpreter) {
+	if interp.pool != p {
+		panic("monkey: Put of an interpreter not from this pool")
+	}
+	interp.mu.Lock()
+	interp.reset()
+	interp.mu.Unlock()
+
+	select {
+	case p.idle <- interp:
+	default:
+		panic("monkey: Put of an interpreter not checked out")
+	}
+}
+
+// reset discards the globals bound since interp joined its pool, and binds
+// the globals of the setup to copies of their values again, undoing the
+// assignments to them and the changes to the arrays and hashes they hold.
+// State a function of the setup keeps in variables of its own closure is
+// not reset.
+func (interp *Interpreter) reset() {
+	copies := map[object.Object]object.Object{}
+	for name, value := range interp.baseValues {
+		interp.base.Set(name, copyValue(value, copies))
+	}
+	interp.env = object.NewEnclosedEnvironment(interp.base)
+	interp.stdout = interp.pool.stdout
+	interp.stats = Stats{}
+	interp.ctx = nil
+}
+
+// copyValue returns a copy of the arrays, hashes and variants in value,
+// which programs can change in place, sharing everything else. copies maps
+// the values copied already to their copies, so values the setup bound
+// to several names, or nested in several others, stay shared.
+func copyValue(value object.Object, copies map[object.Object]object.Object) object.Object {
+	if c, ok := copies[value]; ok {
+		return c
+	}
+	switch value := value.(type) {
+	case *object.Array:
+		c := &object.Array{Elements: make([]object.Object, len(value.Elements))}
+		copies[value] = c
+		for i, element := range value.Elements {
+			c.Elements[i] = copyValue(element, copies)
+		}
+		return c
+	case *object.Hash:
+		c := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair, len(value.Pairs)), Default: value.Default}
+		copies[value] = c
+		for key, pair := range value.Pairs {
+			c.Pairs[key] = object.HashPair{Key: pair.Key, Value: copyValue(pair.Value, copies)}
+		}
+		return c
+	case *object.Variant:
+		c := &object.Variant{Enum: value.Enum, Tag: value.Tag, Fields: value.Fields, Values: make([]object.Object, len(value.Values))}
+		copies[value] = c
+		for i, v := range value.Values {
+			c.Values[i] = copyValue(v, copies)
+		}
+		return c
+	}
+	return value
+}
@@ -0,0 +1,159 @@
+package monkey
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	ctx := context.Background()
+	pool, err := NewPool(2, Options{MaxSteps: 1000}, func(interp *Interpreter) error {
+		_, err := interp.Eval(ctx, `let greet = fn(name) { "hello " + name };`)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	interp, _ := pool.Get(ctx)
+	var out bytes.Buffer
+	interp.SetOutput(&out)
+	if _, err := interp.Eval(ctx, `let name = "a"; puts(greet(name))`); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "\"hello a\"\n" {
+		t.Errorf("wrong output %q", out.String())
+	}
+	pool.Put(interp)
+
+	// The globals of a previous program are gone, those of the setup
+	// are not.
+	interp, _ = pool.Get(ctx)
+	if _, ok := interp.Get("name"); ok {
+		t.Errorf("name should have been reset")
+	}
+	if _, err := interp.Eval(ctx, `greet("b")`); err != nil {
+		t.Errorf("greet should be bound: %s", err)
+	}
+
+	// Limits apply to each evaluation.
+	_, err = interp.Eval(ctx, "let f = fn() { f() }; f()")
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.Message != "step limit exceeded: evaluated more than 1000 nodes" {
+		t.Errorf("expected the step limit. got=%v", err)
+	}
+
+	// With both interpreters checked out, Get waits until ctx is done.
+	other, _ := pool.Get(ctx)
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Get(timeout); err != context.DeadlineExceeded {
+		t.Errorf("expected a timeout. got=%v", err)
+	}
+	pool.Put(interp)
+	pool.Put(other)
+}
+
+func TestPoolReset(t *testing.T) {
+	tests := []struct {
+		setup    string
+		program  string
+		check    string
+		expected interface{}
+	}{
+		{"let limit = 10;", "limit = 99", "limit", int64(10)},
+		{"let limit = 10;", "limit += 1; limit++", "limit", int64(10)},
+		{"let limit = 10; let get = fn() { limit };", "limit = 99", "get()", int64(10)},
+		{"let limit = 10; let set = fn(n) { limit = n };", "set(99)", "limit", int64(10)},
+		{`let cfg = [1, 2]; let h = {"n": 1};`, `cfg[0]++; h["n"]++`, `[cfg, h["n"]]`, []interface{}{[]interface{}{int64(1), int64(2)}, int64(1)}},
+		{"let inner = [1]; let outer = [inner, inner];", "outer[0][0]++", "outer[0][0]++; [outer, inner]", []interface{}{
+			[]interface{}{[]interface{}{int64(2)}, []interface{}{int64(2)}}, []interface{}{int64(2)},
+		}},
+	}
+
+	ctx := context.Background()
+	for _, tt := range tests {
+		pool, err := NewPool(1, Options{}, func(interp *Interpreter) error {
+			_, err := interp.Eval(ctx, tt.setup)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		interp, _ := pool.Get(ctx)
+		if _, err := interp.Eval(ctx, tt.program); err != nil {
+			t.Fatalf("%q: %s", tt.program, err)
+		}
+		pool.Put(interp)
+
+		interp, _ = pool.Get(ctx)
+		val, err := interp.Eval(ctx, tt.check)
+		if err != nil || !reflect.DeepEqual(val, tt.expected) {
+			t.Errorf("%q after %q: want=%v, got=%v, %v", tt.check, tt.program, tt.expected, val, err)
+		}
+		pool.Put(interp)
+	}
+}
+
+func TestPoolMaxAlloc(t *testing.T) {
+	ctx := context.Background()
+	pool, err := NewPool(1, Options{MaxAlloc: 1 << 16}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The allocations of one evaluation do not count against the next.
+	interp, _ := pool.Get(ctx)
+	for i := 0; i < 3; i++ {
+		if _, err := interp.Eval(ctx, "len([0] * 3000)"); err != nil {
+			t.Fatalf("run %d: %s", i, err)
+		}
+	}
+	pool.Put(interp)
+
+	interp, _ = pool.Get(ctx)
+	defer pool.Put(interp)
+	_, err = interp.Eval(ctx, `let s = "ab"; while (true) { s = s + s }`)
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.Message != "allocation limit exceeded: created more than 65536 bytes of values" {
+		t.Errorf("expected the allocation limit. got=%v", err)
+	}
+}
+
+func TestPoolConcurrent(t *testing.T) {
+	ctx := context.Background()
+	pool, err := NewPool(4, Options{NoIO: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			interp, err := pool.Get(ctx)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer pool.Put(interp)
+
+			if _, ok := interp.Get("x"); ok {
+				t.Errorf("x of a previous program is bound")
+			}
+			val, err := interp.Eval(ctx, fmt.Sprintf("let x = %d; x * 2", i))
+			if err != nil || val != int64(i*2) {
+				t.Errorf("wrong result %v, %v", val, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
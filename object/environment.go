@@ -1,5 +1,18 @@
 package object
 
+import "sync/atomic"
+
+// generation counts the bindings by name of every environment, so that a
+// cache of a lookup by name can tell that no binding has changed since.
+var generation atomic.Uint64
+
+// Generation returns a number that changes whenever any environment binds
+// a name, rather than a slot. Programs bind names only with their top-level
+// let statements and those of unresolved functions.
+func Generation() uint64 {
+	return generation.Load()
+}
+
 // NewEnclosedEnvironment creates a new environment that is enclosed within the given outer environment.
 // The new environment will have access to the variables and functions defined in the outer environment.
 func NewEnclosedEnvironment(outer *Enviroment) *Enviroment {
@@ -13,9 +26,21 @@ func NewEnvironment() *Enviroment {
 	return &Enviroment{store: s, outer: nil}
 }
 
+// NewSlotEnvironment creates an environment enclosed within outer for a
+// call of a resolved function, which keeps the variables named by locals
+// in slots rather than by name.
+func NewSlotEnvironment(outer *Enviroment, locals []string) *Enviroment {
+	return &Enviroment{outer: outer, locals: locals, slots: make([]Object, len(locals))}
+}
+
 type Enviroment struct {
 	store map[string]Object
 	outer *Enviroment
+
+	// locals names slots, the variables of a slot environment. A nil slot
+	// is a variable not bound yet.
+	locals []string
+	slots  []Object
 }
 
 // Get retrieves an Object from the Environment by name. If the Object is not found in the
@@ -23,13 +48,119 @@ type Enviroment struct {
 // Returns the Object and a boolean indicating whether the Object was found.
 func (e *Enviroment) Get(name string) (Object, bool) {
 	obj, ok := e.store[name]
+	if !ok {
+		obj, ok = e.local(name)
+	}
 	if !ok && e.outer != nil {
 		obj, ok = e.outer.Get(name)
 	}
 	return obj, ok
 }
 
+// local retrieves the bound slot named name.
+func (e *Enviroment) local(name string) (Object, bool) {
+	for i, local := range e.locals {
+		if local == name && e.slots[i] != nil {
+			return e.slots[i], true
+		}
+	}
+	return nil, false
+}
+
 func (e *Enviroment) Set(name string, value Object) Object {
+	for i, local := range e.locals {
+		if local == name {
+			e.slots[i] = value
+			return value
+		}
+	}
+	if e.store == nil {
+		e.store = make(map[string]Object)
+	}
 	e.store[name] = value
+	generation.Add(1)
 	return value
 }
+
+// Assign rebinds the variable name to value in the innermost environment
+// binding it, e or one enclosing it. It reports whether any did; Assign
+// binds no new variable.
+func (e *Enviroment) Assign(name string, value Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			env.store[name] = value
+			generation.Add(1)
+			return true
+		}
+		for i, local := range env.locals {
+			if local == name && env.slots[i] != nil {
+				env.slots[i] = value
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Lookup retrieves the variable name in the index-th slot of the
+// environment depth levels out from e. If the slot is not bound yet, it
+// searches the environments enclosing the slot's by name, as Get would, so
+// that name refers to an outer variable until the let statement binding it
+// runs.
+func (e *Enviroment) Lookup(depth, index int, name string) (Object, bool) {
+	env := e
+	for i := 0; i < depth && env != nil; i++ {
+		env = env.outer
+	}
+	if env == nil || index >= len(env.slots) {
+		// Not the environments the slot was resolved for.
+		return e.Get(name)
+	}
+	if obj := env.slots[index]; obj != nil {
+		return obj, true
+	}
+	if env.outer == nil {
+		return nil, false
+	}
+	return env.outer.Get(name)
+}
+
+// Named returns e if it binds variables by name, or else the innermost
+// environment enclosing e that does, skipping slot environments.
+func (e *Enviroment) Named() *Enviroment {
+	for e.slots != nil && len(e.store) == 0 && e.outer != nil {
+		e = e.outer
+	}
+	return e
+}
+
+// SetSlot binds the variable name in the i-th slot of e.
+func (e *Enviroment) SetSlot(i int, name string, value Object) Object {
+	if i >= len(e.slots) {
+		// Not the environment the slot was resolved for.
+		return e.Set(name, value)
+	}
+	e.slots[i] = value
+	return value
+}
+
+// Outer returns the environment e is enclosed within, or nil for a
+// top-level environment.
+func (e *Enviroment) Outer() *Enviroment {
+	return e.outer
+}
+
+// Names returns the names of the variables bound in e itself, not in the
+// environments enclosing it, in no particular order.
+func (e *Enviroment) Names() []string {
+	names := make([]string, 0, len(e.store)+len(e.slots))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	for i, local := range e.locals {
+		if e.slots[i] != nil {
+			names = append(names, local)
+		}
+	}
+	return names
+}
@@ -0,0 +1,76 @@
+package object
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+// Iterable is a collection a for loop can iterate over: an array, a hash
+// or a string.
+type Iterable interface {
+	Object
+
+	// Iterate calls f with the key and the value of each element in turn,
+	// until f returns false. The key of an array element or a character of
+	// a string is its index.
+	Iterate(f func(key, value Object) bool)
+}
+
+// Iterate calls f with the index and the value of each element of a.
+func (a *Array) Iterate(f func(key, value Object) bool) {
+	for i, el := range a.Elements {
+		if !f(&Integer{Value: int64(i)}, el) {
+			return
+		}
+	}
+}
+
+// Iterate calls f with each key of h and its value. The keys come in a
+// stable order, so that loops over the same hash behave the same from
+// one run to the next: booleans, then integers, then strings, each in
+// ascending order.
+func (h *Hash) Iterate(f func(key, value Object) bool) {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return keyLess(pairs[i].Key, pairs[j].Key)
+	})
+
+	for _, pair := range pairs {
+		if !f(pair.Key, pair.Value) {
+			return
+		}
+	}
+}
+
+// keyLess reports whether the hash key a sorts before b.
+func keyLess(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	switch a := a.(type) {
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *String:
+		return a.Value < b.(*String).Value
+	}
+	return false
+}
+
+// Iterate calls f with the index and the value of each character of s, a
+// string of one character. Characters are Unicode code points, so their
+// indexes count characters, not bytes.
+func (s *String) Iterate(f func(key, value Object) bool) {
+	i := 0
+	for offset := 0; offset < len(s.Value); i++ {
+		_, size := utf8.DecodeRuneInString(s.Value[offset:])
+		if !f(&Integer{Value: int64(i)}, &String{Value: s.Value[offset : offset+size]}) {
+			return
+		}
+		offset += size
+	}
+}
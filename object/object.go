@@ -4,15 +4,19 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/code"
 )
 
 type ObjectType string
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	STRING_OBJ       = "STRING"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
@@ -22,6 +26,11 @@ const (
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	EXIT_OBJ         = "EXIT"
+	VARIANT_OBJ      = "VARIANT"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CLOSURE_OBJ           = "CLOSURE"
 )
 
 type Object interface {
@@ -36,8 +45,28 @@ type Integer struct {
 func (i *Integer) Inspect() string  { return fmt.Sprint(i.Value) }
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 
+// Float is a floating point number. It inspects with a fractional part even
+// when it is whole, 2.0 rather than 2, to tell it from an integer.
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
 type String struct {
 	Value string
+
+	// buf, if not nil, holds the bytes of Value; see Concat.
+	buf *stringBuffer
+	// hash caches the value of HashKey, or is 0 before it is computed.
+	hash atomic.Uint64
 }
 
 func (s *String) Inspect() string  { return fmt.Sprintf("%q", s.Value) }
@@ -69,10 +98,21 @@ type Error struct {
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
+// Exit is produced by the exit builtin. Like an Error it unwinds the whole
+// evaluation, carrying the status code the host process should exit with.
+type Exit struct {
+	Code int64
+}
+
+func (e *Exit) Type() ObjectType { return EXIT_OBJ }
+func (e *Exit) Inspect() string  { return fmt.Sprintf("exit(%d)", e.Code) }
+
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Enviroment
+	Doc        string   // the docstring of the function literal
+	Locals     []string // the slots of the function literal, if resolved
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -94,12 +134,74 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
+// CompiledFunction is a function literal compiled to bytecode, as run by the
+// virtual machine. NumLocals counts its parameters and let bindings, which
+// the VM reserves stack slots for. SourceMap leads from its instructions
+// back to the source and LocalNames names the locals by slot.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	SourceMap     code.SourceMap
+	LocalNames    []string
+	Doc           string // the docstring of the function literal
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Closure is a compiled function together with the free variables it
+// captured when it was created. The VM only ever calls closures.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
 type BuiltinFunction func(args ...Object) Object
 
+// Capability names a group of builtins that reach a part of the outside
+// world, which a sandboxed evaluation may only call if it is granted.
+type Capability string
+
+const (
+	CapFilesystem  Capability = "fs"      // reading and writing files
+	CapNetwork     Capability = "net"     // making network requests
+	CapProcess     Capability = "process" // starting other programs
+	CapEnvironment Capability = "env"     // reading environment variables
+	CapTime        Capability = "time"    // reading the clock
+	CapRuntime     Capability = "runtime" // inspecting and driving the Go runtime
+	CapSignal      Capability = "signal"  // handling signals sent to the process
+)
+
 // Builtin represents a built-in function in the programming language.
-// The Fn field is a function that implements the built-in behavior.
+// The Fn field is a function that implements the built-in behavior; Params
+// and Doc describe it for documentation and editor tooling. IO marks
+// builtins that reach outside the program, which sandboxed evaluations may
+// not call, and Capability the group of those a sandbox must grant.
 type Builtin struct {
-	Fn BuiltinFunction
+	Fn         BuiltinFunction
+	Params     []string
+	Doc        string
+	IO         bool
+	Capability Capability
+
+	// Deprecated, if not empty, says what to use instead of the builtin;
+	// evaluations warn about each call site. Warn, if not nil, returns a
+	// warning about a call with args that works but is likely a mistake,
+	// or "" if there is nothing to warn about.
+	Deprecated string
+	Warn       func(args ...Object) string
+
+	// Variant, if not nil, is the variant of an enum the builtin
+	// constructs, without the values of its fields.
+	Variant *Variant
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -126,6 +228,39 @@ func (a *Array) Inspect() string {
 	return out.String()
 }
 
+// MaxArrayLen bounds the length of the arrays Concat and Repeat build, so
+// that a mistaken count or a runaway loop fails rather than exhausting
+// memory.
+const MaxArrayLen = 1 << 27
+
+// Concat returns a new array of the elements of a followed by those of b.
+// It fails if the array would be longer than MaxArrayLen.
+func (a *Array) Concat(b *Array) (*Array, error) {
+	n := len(a.Elements) + len(b.Elements)
+	if n > MaxArrayLen {
+		return nil, fmt.Errorf("concatenated array too long: %d elements", n)
+	}
+	elements := make([]Object, 0, n)
+	elements = append(elements, a.Elements...)
+	return &Array{Elements: append(elements, b.Elements...)}, nil
+}
+
+// Repeat returns a new array of the elements of a repeated n times. It
+// fails if n is negative or the array would be longer than MaxArrayLen.
+func (a *Array) Repeat(n int64) (*Array, error) {
+	switch {
+	case n < 0:
+		return nil, fmt.Errorf("negative repeat count: %d", n)
+	case len(a.Elements) != 0 && n > MaxArrayLen/int64(len(a.Elements)):
+		return nil, fmt.Errorf("repeated array too long: %d elements repeated %d times", len(a.Elements), n)
+	}
+	elements := make([]Object, 0, len(a.Elements)*int(n))
+	for i := int64(0); i < n; i++ {
+		elements = append(elements, a.Elements...)
+	}
+	return &Array{Elements: elements}, nil
+}
+
 // HashKey represents a unique identifier for an Object. The Type field
 // indicates the type of the Object, and the Value field contains a
 // hash value derived from the Object's contents.
@@ -158,10 +293,15 @@ func (i *Integer) HashKey() HashKey {
 // indicates the type of the object, and the Value field contains a hash value
 // derived from the string value.
 func (s *String) HashKey() HashKey {
+	if hash := s.hash.Load(); hash != 0 {
+		return HashKey{Type: s.Type(), Value: hash}
+	}
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
+	hash := h.Sum64()
+	s.hash.Store(hash)
 
-	return HashKey{Type: s.Type(), Value: h.Sum64()}
+	return HashKey{Type: s.Type(), Value: hash}
 }
 
 // HashPair represents a key-value pair in a hash object. The Key field
@@ -173,6 +313,10 @@ type HashPair struct {
 
 type Hash struct {
 	Pairs map[HashKey]HashPair
+
+	// Default, if not nil, is the function index expressions call with a
+	// key the hash lacks, whose result they return instead of null.
+	Default Object
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
@@ -190,6 +334,40 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
+// Variant is a value of an enum declared with an enum statement: one of
+// its variants, tagged with the variant's name, with the values of the
+// variant's fields.
+type Variant struct {
+	Enum   string   // the name of the enum
+	Tag    string   // the name of the variant
+	Fields []string // the names of the variant's fields, nil if it has none
+	Values []Object // the values of the fields
+}
+
+func (v *Variant) Type() ObjectType { return VARIANT_OBJ }
+func (v *Variant) Inspect() string {
+	if v.Fields == nil {
+		return v.Tag
+	}
+
+	values := []string{}
+	for _, value := range v.Values {
+		values = append(values, value.Inspect())
+	}
+	return v.Tag + "(" + strings.Join(values, ", ") + ")"
+}
+
+// Field returns the value of the field name, or false if the variant has
+// no such field.
+func (v *Variant) Field(name string) (Object, bool) {
+	for i, field := range v.Fields {
+		if field == name {
+			return v.Values[i], true
+		}
+	}
+	return nil, false
+}
+
 type Hashable interface {
 	HashKey() HashKey
 }
@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello"}
@@ -21,3 +24,52 @@ func TestStringHashKey(t *testing.T) {
 	}
 
 }
+
+func TestStringConcat(t *testing.T) {
+	concat := func(s *String, suffix string) *String {
+		c, err := s.Concat(suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	long := strings.Repeat("a", minBuffered)
+	s := concat(&String{Value: "x"}, long)
+
+	// Both b and c extend s: only the first appends in place, and
+	// neither changes the other or s.
+	b := concat(s, "b")
+	c := concat(s, "c")
+	if s.Value != "x"+long || b.Value != "x"+long+"b" || c.Value != "x"+long+"c" {
+		t.Fatalf("wrong values %q, %q, %q", s.Value, b.Value, c.Value)
+	}
+	if b.buf != s.buf || c.buf == s.buf {
+		t.Errorf("b should share the buffer of s and c not")
+	}
+
+	d := concat(b, "d")
+	if d.Value != "x"+long+"bd" || b.Value != "x"+long+"b" {
+		t.Errorf("wrong values %q, %q", d.Value, b.Value)
+	}
+	if short := concat(&String{Value: "a"}, "b"); short.Value != "ab" || short.buf != nil {
+		t.Errorf("short strings should be copied, got %+v", short)
+	}
+}
+
+func TestHashIterate(t *testing.T) {
+	h := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, key := range []Object{&String{Value: "b"}, &Integer{Value: 2}, &String{Value: "a"}, &Boolean{Value: true}, &Integer{Value: -1}, &Boolean{Value: false}} {
+		h.Pairs[key.(Hashable).HashKey()] = HashPair{Key: key, Value: &Integer{Value: 0}}
+	}
+
+	var keys []string
+	h.Iterate(func(key, value Object) bool {
+		keys = append(keys, key.Inspect())
+		return len(keys) < 5
+	})
+
+	expected := []string{"false", "true", "-1", "2", `"a"`}
+	if strings.Join(keys, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong keys. expected=%v, got=%v", expected, keys)
+	}
+}
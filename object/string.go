@@ -0,0 +1,57 @@
+package object
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// MaxStringLen bounds the length in bytes of the strings Concat builds, as
+// MaxArrayLen does arrays.
+const MaxStringLen = 1 << 30
+
+// minBuffered is the length from which Concat builds strings in a
+// buffer. Shorter strings are concatenated by copying.
+const minBuffered = 256
+
+// stringBuffer holds the bytes of the strings Concat built from one
+// another. Bytes once written are never changed, so the strings can share
+// them: each is a prefix of the buffer.
+type stringBuffer struct {
+	mu sync.Mutex // strings are shared between goroutines by pooled interpreters
+	b  []byte
+}
+
+// Concat returns the concatenation of s and t. It fails if the string
+// would be longer than MaxStringLen.
+//
+// Programs build strings by repeatedly concatenating pieces to a growing
+// string, which copying would make quadratic. So when s is the longest
+// string of its buffer, t is appended to the buffer in place, growing it
+// as append does, and the result shares the bytes of s.
+func (s *String) Concat(t string) (*String, error) {
+	n := len(s.Value) + len(t)
+	switch {
+	case n > MaxStringLen:
+		return nil, fmt.Errorf("concatenated string too long: %d bytes", n)
+	case n < minBuffered:
+		return &String{Value: s.Value + t}, nil
+	}
+
+	if buf := s.buf; buf != nil {
+		var b []byte
+		buf.mu.Lock()
+		if len(buf.b) == len(s.Value) {
+			buf.b = append(buf.b, t...)
+			b = buf.b
+		}
+		buf.mu.Unlock()
+		if b != nil {
+			return &String{Value: unsafe.String(&b[0], n), buf: buf}, nil
+		}
+	}
+
+	b := make([]byte, 0, 2*n)
+	b = append(append(b, s.Value...), t...)
+	return &String{Value: unsafe.String(&b[0], n), buf: &stringBuffer{b: b}}, nil
+}
@@ -0,0 +1,202 @@
+package parser
+
+import "github.com/frankie-mur/monkeylang/ast"
+
+// Block sizes of an arena: the first block of each node type is small, so
+// that short sources such as REPL lines do not pay for an arena, and each
+// further block doubles up to the largest.
+const (
+	minBlock = 16
+	maxBlock = 1024
+)
+
+// arena allocates the nodes of a parse in blocks, one slice of structs per
+// node type, instead of each node on its own. Parsing a large source then
+// allocates a few hundred blocks rather than a hundred thousand nodes, and
+// the garbage collector frees the blocks together once the program is no
+// longer used. A node kept alive keeps its whole block alive, so the arena
+// suits programs that are discarded as a whole; see Parser.SetArena.
+//
+// The methods of a nil arena allocate nodes on their own.
+type arena struct {
+	identifiers          slab[ast.Identifier]
+	integers             slab[ast.IntegerLiteral]
+	strings              slab[ast.StringLiteral]
+	booleans             slab[ast.Boolean]
+	prefixes             slab[ast.PrefixExpression]
+	infixes              slab[ast.InfixExpression]
+	ifs                  slab[ast.IfExpression]
+	functions            slab[ast.FunctionLiteral]
+	calls                slab[ast.CallExpression]
+	indexes              slab[ast.IndexExpression]
+	arrays               slab[ast.ArrayLiteral]
+	hashes               slab[ast.HashLiteral]
+	lets                 slab[ast.LetStatement]
+	returns              slab[ast.ReturnStatement]
+	expressionStatements slab[ast.ExpressionStatement]
+	blocks               slab[ast.BlockStatement]
+}
+
+// slab is the current block of an arena for nodes of type T. Blocks are
+// never grown in place, so nodes never move.
+type slab[T interface{}] struct {
+	block []T
+}
+
+func (s *slab[T]) add(node T) *T {
+	if len(s.block) == cap(s.block) {
+		size := 2 * cap(s.block)
+		if size < minBlock {
+			size = minBlock
+		} else if size > maxBlock {
+			size = maxBlock
+		}
+		s.block = make([]T, 0, size)
+	}
+	s.block = append(s.block, node)
+	return &s.block[len(s.block)-1]
+}
+
+func (a *arena) identifier(node ast.Identifier) *ast.Identifier {
+	if a == nil {
+		n := new(ast.Identifier)
+		*n = node
+		return n
+	}
+	return a.identifiers.add(node)
+}
+
+func (a *arena) integerLiteral(node ast.IntegerLiteral) *ast.IntegerLiteral {
+	if a == nil {
+		n := new(ast.IntegerLiteral)
+		*n = node
+		return n
+	}
+	return a.integers.add(node)
+}
+
+func (a *arena) stringLiteral(node ast.StringLiteral) *ast.StringLiteral {
+	if a == nil {
+		n := new(ast.StringLiteral)
+		*n = node
+		return n
+	}
+	return a.strings.add(node)
+}
+
+func (a *arena) boolean(node ast.Boolean) *ast.Boolean {
+	if a == nil {
+		n := new(ast.Boolean)
+		*n = node
+		return n
+	}
+	return a.booleans.add(node)
+}
+
+func (a *arena) prefixExpression(node ast.PrefixExpression) *ast.PrefixExpression {
+	if a == nil {
+		n := new(ast.PrefixExpression)
+		*n = node
+		return n
+	}
+	return a.prefixes.add(node)
+}
+
+func (a *arena) infixExpression(node ast.InfixExpression) *ast.InfixExpression {
+	if a == nil {
+		n := new(ast.InfixExpression)
+		*n = node
+		return n
+	}
+	return a.infixes.add(node)
+}
+
+func (a *arena) ifExpression(node ast.IfExpression) *ast.IfExpression {
+	if a == nil {
+		n := new(ast.IfExpression)
+		*n = node
+		return n
+	}
+	return a.ifs.add(node)
+}
+
+func (a *arena) functionLiteral(node ast.FunctionLiteral) *ast.FunctionLiteral {
+	if a == nil {
+		n := new(ast.FunctionLiteral)
+		*n = node
+		return n
+	}
+	return a.functions.add(node)
+}
+
+func (a *arena) callExpression(node ast.CallExpression) *ast.CallExpression {
+	if a == nil {
+		n := new(ast.CallExpression)
+		*n = node
+		return n
+	}
+	return a.calls.add(node)
+}
+
+func (a *arena) indexExpression(node ast.IndexExpression) *ast.IndexExpression {
+	if a == nil {
+		n := new(ast.IndexExpression)
+		*n = node
+		return n
+	}
+	return a.indexes.add(node)
+}
+
+func (a *arena) arrayLiteral(node ast.ArrayLiteral) *ast.ArrayLiteral {
+	if a == nil {
+		n := new(ast.ArrayLiteral)
+		*n = node
+		return n
+	}
+	return a.arrays.add(node)
+}
+
+func (a *arena) hashLiteral(node ast.HashLiteral) *ast.HashLiteral {
+	if a == nil {
+		n := new(ast.HashLiteral)
+		*n = node
+		return n
+	}
+	return a.hashes.add(node)
+}
+
+func (a *arena) letStatement(node ast.LetStatement) *ast.LetStatement {
+	if a == nil {
+		n := new(ast.LetStatement)
+		*n = node
+		return n
+	}
+	return a.lets.add(node)
+}
+
+func (a *arena) returnStatement(node ast.ReturnStatement) *ast.ReturnStatement {
+	if a == nil {
+		n := new(ast.ReturnStatement)
+		*n = node
+		return n
+	}
+	return a.returns.add(node)
+}
+
+func (a *arena) expressionStatement(node ast.ExpressionStatement) *ast.ExpressionStatement {
+	if a == nil {
+		n := new(ast.ExpressionStatement)
+		*n = node
+		return n
+	}
+	return a.expressionStatements.add(node)
+}
+
+func (a *arena) blockStatement(node ast.BlockStatement) *ast.BlockStatement {
+	if a == nil {
+		n := new(ast.BlockStatement)
+		*n = node
+		return n
+	}
+	return a.blocks.add(node)
+}
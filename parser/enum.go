@@ -0,0 +1,122 @@
+package parser
+
+import (
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// parseEnumStatement parses an enum declaration such as
+//
+//	enum Shape { Circle(r), Rect(w, h), Empty }
+//
+// The current token is the 'enum' keyword. A trailing comma after the last
+// variant is allowed.
+func (p *Parser) parseEnumStatement() *ast.EnumStatement {
+	stmt := &ast.EnumStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = p.arena.identifier(ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		variant := &ast.EnumVariant{Name: p.arena.identifier(ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})}
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			if variant.Fields = p.parseFieldList(); variant.Fields == nil {
+				return nil
+			}
+		}
+		stmt.Variants = append(stmt.Variants, variant)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	p.nextToken()
+
+	if len(stmt.Variants) == 0 {
+		p.addError(stmt.Token.Pos, "enum "+stmt.Name.Value+" has no variants")
+		return nil
+	}
+
+	for p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseMatchExpression parses a match expression such as
+//
+//	match (shape) {
+//	    Circle(r) => { 3 * r * r }
+//	    Rect(w, h) => { w * h }
+//	    _ => { 0 }
+//	}
+//
+// The current token is the 'match' keyword.
+func (p *Parser) parseMatchExpression() ast.Expression {
+	exp := &ast.MatchExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	exp.Subject = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		arm := &ast.MatchArm{Pattern: p.arena.identifier(ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})}
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			if arm.Fields = p.parseFieldList(); arm.Fields == nil {
+				return nil
+			}
+		}
+
+		if !p.expectPeek(token.ARROW) || !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		arm.Body = p.parseBlockStatement()
+		exp.Arms = append(exp.Arms, arm)
+	}
+	p.nextToken()
+
+	return exp
+}
+
+// parseFieldList parses the parenthesized field names of an enum variant
+// or a match pattern. The current token is the '('. It returns nil after
+// a syntax error and an empty list for "()".
+func (p *Parser) parseFieldList() []*ast.Identifier {
+	fields := []*ast.Identifier{}
+
+	for !p.peekTokenIs(token.RPAREN) {
+		if len(fields) > 0 && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		fields = append(fields, p.arena.identifier(ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}))
+	}
+	p.nextToken()
+
+	return fields
+}
@@ -2,7 +2,9 @@ package parser
 
 import (
 	"fmt"
+	"io"
 	"strconv"
+	"strings"
 
 	"github.com/frankie-mur/monkeylang/ast"
 	"github.com/frankie-mur/monkeylang/lexer"
@@ -12,26 +14,48 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGNMENT  // x = y or x += y
+	OR          // ||
+	AND         // &&
 	EQUALS      // ==
 	LESSGREATER // > or <
+	BITOR       // |
+	BITXOR      // ^
+	BITAND      // &
+	SHIFT       // << or >>
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or!X
+	POSTFIX     // X++
 	CALL        // myFunction(X)
 	INDEX       // array[index]
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.ASTERISK: PRODUCT,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:          ASSIGNMENT,
+	token.PLUS_ASSIGN:     ASSIGNMENT,
+	token.MINUS_ASSIGN:    ASSIGNMENT,
+	token.ASTERISK_ASSIGN: ASSIGNMENT,
+	token.SLASH_ASSIGN:    ASSIGNMENT,
+	token.OR:              OR,
+	token.AND:             AND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.PIPE:            BITOR,
+	token.CARET:           BITXOR,
+	token.AMPERSAND:       BITAND,
+	token.SHIFT_LEFT:      SHIFT,
+	token.SHIFT_RIGHT:     SHIFT,
+	token.PLUS:            SUM,
+	token.ASTERISK:        PRODUCT,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.INCREMENT:       POSTFIX,
+	token.DECREMENT:       POSTFIX,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
 }
 
 // Parser is a struct that holds the lexer and the current and peek tokens.
@@ -39,15 +63,31 @@ var precedences = map[token.TokenType]int{
 type Parser struct {
 	l *lexer.Lexer
 
-	errors []string // errors encountered during parsing
+	errors   []*ParseError // errors encountered during parsing
+	warnings []Warning
+	lexed    int // how many of the lexer's errors are in errors
 
 	curToken  token.Token
 	peekToken token.Token
 
 	prefixParseFns map[token.TokenType]prefixParseFn // maps token type to prefix parse function
 	infixParseFns  map[token.TokenType]infixParseFn  // maps token type to infix parse function
+
+	traceOut   io.Writer // where trace output goes; nil disables tracing
+	traceLevel int
+
+	arena *arena // where nodes are allocated; nil allocates each on its own
+
+	nesting   int  // how deeply the expression being parsed nests
+	abandoned bool // whether the input nested too deeply to parse the rest
 }
 
+// maxNesting bounds how deeply expressions may nest. The parser and every
+// pass over the tree it builds, down to the evaluator, recurse on its
+// nesting, so a deeper tree could exhaust the Go stack and crash the
+// process rather than fail with an error.
+const maxNesting = 100_000
+
 type (
 	prefixParseFn func() ast.Expression
 	infixParseFn  func(ast.Expression) ast.Expression
@@ -56,7 +96,7 @@ type (
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []*ParseError{},
 	}
 
 	// Read two tokens, so curToken and peekToken are both set
@@ -66,9 +106,11 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TILDE, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
@@ -76,8 +118,26 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
+	p.registerPrefix(token.WHILE, p.parseWhileExpression)
+	p.registerPrefix(token.FOR, p.parseForExpression)
+	p.registerPrefix(token.SWITCH, p.parseSwitchExpression)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.INCREMENT, p.parsePostfixExpression)
+	p.registerInfix(token.DECREMENT, p.parsePostfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.CARET, p.parseInfixExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_LEFT, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_RIGHT, p.parseInfixExpression)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
@@ -96,10 +156,10 @@ func New(l *lexer.Lexer) *Parser {
 // followed by an expression. It creates a new PrefixExpression AST node with the
 // operator and then moves to the next token where it then parses that expression as the right operand.
 func (p *Parser) parsePrefixExpression() ast.Expression {
-	defer untrace(trace("parsePrefixExpression"))
-	expression := &ast.PrefixExpression{
+	defer p.untrace(p.trace("parsePrefixExpression"))
+	expression := p.arena.prefixExpression(ast.PrefixExpression{
 		Token: p.curToken, Operator: p.curToken.Literal,
-	}
+	})
 	p.nextToken()
 
 	expression.Right = p.parseExpression(PREFIX)
@@ -111,12 +171,12 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 // an operator, and a right operand. It returns an ast.InfixExpression with the
 // operator, left operand, and right operand set.
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
-	defer untrace(trace("parseInfixExpression"))
-	expression := &ast.InfixExpression{
+	defer p.untrace(p.trace("parseInfixExpression"))
+	expression := p.arena.infixExpression(ast.InfixExpression{
 		Token:    p.curToken,
 		Operator: p.curToken.Literal,
 		Left:     left,
-	}
+	})
 	precedence := p.curPrecedence()
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
@@ -124,12 +184,61 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// parseAssignExpression parses an assignment to the variable left. The
+// current token is the '=' or a compound assignment such as '+='.
+// Assignment is right associative, so that a = b = 1 assigns 1 to both.
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parseAssignExpression"))
+	if left == nil {
+		// The error parsing left was reported already.
+		return nil
+	}
+	name, ok := left.(*ast.Identifier)
+	if !ok {
+		// An error in left may have left parts of it missing, which
+		// String cannot print.
+		if len(p.errors) == 0 {
+			p.addError(p.curToken.Pos, fmt.Sprintf("cannot assign to %s", left.String()))
+		}
+		return nil
+	}
+	expression := &ast.AssignExpression{Token: p.curToken, Name: name}
+	if !p.curTokenIs(token.ASSIGN) {
+		expression.Operator = strings.TrimSuffix(p.curToken.Literal, "=")
+	}
+	p.nextToken()
+	expression.Value = p.parseExpression(ASSIGNMENT - 1)
+
+	return expression
+}
+
+// parsePostfixExpression parses x++ or x--. The operand must be a variable
+// or an index expression.
+func (p *Parser) parsePostfixExpression(left ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parsePostfixExpression"))
+	if left == nil {
+		// The error parsing left was reported already.
+		return nil
+	}
+	switch left.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		// An error in left may have left parts of it missing, which
+		// String cannot print.
+		if len(p.errors) == 0 {
+			p.addError(p.curToken.Pos, fmt.Sprintf("cannot apply %s to %s", p.curToken.Literal, left.String()))
+		}
+		return nil
+	}
+	return &ast.PostfixExpression{Token: p.curToken, Target: left, Operator: p.curToken.Literal}
+}
+
 // parseBoolean parses a boolean literal expression. It returns an ast.Boolean
 // expression with the value set to true if the current token is the "true"
 // keyword, and false if the current token is the "false" keyword.
 func (p *Parser) parseBoolean() ast.Expression {
-	defer untrace(trace("parseBoolean"))
-	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
+	defer p.untrace(p.trace("parseBoolean"))
+	return p.arena.boolean(ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)})
 }
 
 // parseGroupedExpression parses a grouped expression, which is an expression
@@ -149,7 +258,7 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 // executed if the condition is truthy. The if expression returns the value of
 // the executed block statement.
 func (p *Parser) parseIfExpression() ast.Expression {
-	expression := &ast.IfExpression{Token: p.curToken}
+	expression := p.arena.ifExpression(ast.IfExpression{Token: p.curToken})
 
 	// If should be followed by a '('
 	if !p.expectPeek(token.LPAREN) {
@@ -188,16 +297,126 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+// parseWhileExpression parses a while loop: a condition enclosed in
+// parentheses followed by the block statement to evaluate while it is
+// truthy.
+func (p *Parser) parseWhileExpression() ast.Expression {
+	expression := &ast.WhileExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Body = p.parseBlockStatement()
+
+	return expression
+}
+
+// parseForExpression parses a for loop: one or two loop variables, the
+// keyword in and the collection to iterate over, enclosed in parentheses,
+// followed by the block statement to evaluate for each element.
+func (p *Parser) parseForExpression() ast.Expression {
+	expression := &ast.ForExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) || !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	expression.Value = p.arena.identifier(ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		expression.Key = expression.Value
+		expression.Value = p.arena.identifier(ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	expression.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Body = p.parseBlockStatement()
+
+	return expression
+}
+
+// parseSwitchExpression parses a switch expression: a subject enclosed in
+// parentheses followed by braces around its cases, each the keyword case,
+// a value, a colon and a block statement. A default case, the keyword
+// default, a colon and a block statement, may come last.
+func (p *Parser) parseSwitchExpression() ast.Expression {
+	expression := &ast.SwitchExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	expression.Subject = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if expression.Default != nil {
+			p.addError(p.peekToken.Pos, "the default case must be the last case of a switch")
+			return nil
+		}
+		if p.peekTokenIs(token.DEFAULT) {
+			p.nextToken()
+			if !p.expectPeek(token.COLON) || !p.expectPeek(token.LBRACE) {
+				return nil
+			}
+			expression.Default = p.parseBlockStatement()
+			continue
+		}
+
+		if !p.expectPeek(token.CASE) {
+			return nil
+		}
+		c := &ast.SwitchCase{Token: p.curToken}
+		p.nextToken()
+		c.Value = p.parseExpression(LOWEST)
+		if !p.expectPeek(token.COLON) || !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		c.Body = p.parseBlockStatement()
+		expression.Cases = append(expression.Cases, c)
+	}
+	p.nextToken()
+
+	return expression
+}
+
 // parseBlockStatement parses a block statement, which is a sequence of statements
 // enclosed in curly braces. It returns an ast.BlockStatement node, which contains
 // the statements within the block.
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
-	block := &ast.BlockStatement{Token: p.curToken}
+	block := p.arena.blockStatement(ast.BlockStatement{Token: p.curToken})
 	block.Statements = []ast.Statement{}
 
 	p.nextToken()
 
-	if !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
 		stmt := p.parseStatement()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
@@ -214,7 +433,8 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 // the function parameters, body, and return the complete FunctionLiteral
 // expression.
 func (p *Parser) parseFunctionLiteral() ast.Expression {
-	lit := &ast.FunctionLiteral{Token: p.curToken}
+	lit := p.arena.functionLiteral(ast.FunctionLiteral{Token: p.curToken})
+	errs := len(p.errors)
 
 	if !p.expectPeek(token.LPAREN) {
 		return nil
@@ -227,10 +447,64 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	}
 
 	lit.Body = p.parseBlockStatement()
+	if len(p.errors) == errs {
+		markTailCalls(lit)
+	}
 
 	return lit
 }
 
+// markTailCalls marks the calls in tail position of lit, whose values it
+// returns directly: the values of its return statements and of the last
+// expression of its body, looking into the branches of if and match
+// expressions there. Function literals in lit mark their own.
+func markTailCalls(lit *ast.FunctionLiteral) {
+	markTail(lastExpression(lit.Body))
+	ast.Inspect(lit.Body, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.FunctionLiteral:
+			return false
+		case *ast.ReturnStatement:
+			markTail(n.ReturnValue)
+		}
+		return true
+	})
+}
+
+// markTail marks the call exp, or the calls in tail position of its
+// branches, as tail calls.
+func markTail(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.CallExpression:
+		exp.Tail = true
+	case *ast.IfExpression:
+		markTail(lastExpression(exp.Consequence))
+		markTail(lastExpression(exp.Alternative))
+	case *ast.MatchExpression:
+		for _, arm := range exp.Arms {
+			markTail(lastExpression(arm.Body))
+		}
+	case *ast.SwitchExpression:
+		for _, c := range exp.Cases {
+			markTail(lastExpression(c.Body))
+		}
+		markTail(lastExpression(exp.Default))
+	}
+}
+
+// lastExpression returns the expression of the last statement of block,
+// which is the block's value, or nil if that is not an expression
+// statement.
+func lastExpression(block *ast.BlockStatement) ast.Expression {
+	if block == nil || len(block.Statements) == 0 {
+		return nil
+	}
+	if stmt, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement); ok {
+		return stmt.Expression
+	}
+	return nil
+}
+
 // parseArrayLiteral parses an array literal expression. It returns an
 // ast.ArrayLiteral representing the parsed array.
 //
@@ -238,7 +512,7 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 // array literal. It will parse the comma-separated list of expressions within
 // the brackets and return the complete ArrayLiteral expression.
 func (p *Parser) parseArrayLiteral() ast.Expression {
-	array := &ast.ArrayLiteral{Token: p.curToken}
+	array := p.arena.arrayLiteral(ast.ArrayLiteral{Token: p.curToken})
 	array.Elements = p.parseExpressionList(token.RBRACKET)
 
 	return array
@@ -251,7 +525,7 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 // hash literal. It will parse the comma-separated list of key-value pairs
 // within the braces and return the complete HashLiteral expression.
 func (p *Parser) parseHashLiteral() ast.Expression {
-	hash := &ast.HashLiteral{Token: p.curToken}
+	hash := p.arena.hashLiteral(ast.HashLiteral{Token: p.curToken})
 	hash.Pairs = make(map[ast.Expression]ast.Expression)
 
 	for !p.peekTokenIs(token.RBRACE) {
@@ -266,6 +540,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		value := p.parseExpression(LOWEST)
 
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
@@ -323,7 +598,7 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 
 	p.nextToken()
 
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	ident := p.arena.identifier(ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
 	identifiers = append(identifiers, ident)
 
 	//Loop through all of the parameters
@@ -331,7 +606,7 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		p.nextToken()
 		p.nextToken()
 
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		ident := p.arena.identifier(ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
 		identifiers = append(identifiers, ident)
 	}
 
@@ -345,7 +620,7 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 // parseCallExpression parses a function call expression, including the function name and its arguments.
 // It returns an ast.CallExpression node representing the parsed function call.
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
-	exp := &ast.CallExpression{Token: p.curToken, Function: function}
+	exp := p.arena.callExpression(ast.CallExpression{Token: p.curToken, Function: function})
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
 	return exp
 }
@@ -354,10 +629,35 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 // of an array, slice, or map by an index value. It takes the left-hand side
 // expression as input and returns an ast.IndexExpression node representing the
 // parsed index expression.
+// parseIndexExpression parses left[index], or the slice left[low:high] if
+// a colon follows the index or opens the brackets.
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+	tok := p.curToken
 	p.nextToken()
-	exp.Index = p.parseExpression(LOWEST)
+	if p.curTokenIs(token.COLON) {
+		return p.parseSliceExpression(tok, left, nil)
+	}
+
+	index := p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(tok, left, index)
+	}
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return p.arena.indexExpression(ast.IndexExpression{Token: tok, Left: left, Index: index})
+}
+
+// parseSliceExpression parses the rest of a slice after its colon, an
+// optional high bound and the closing bracket.
+func (p *Parser) parseSliceExpression(tok token.Token, left, low ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{Token: tok, Left: left, Low: low}
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		exp.High = p.parseExpression(LOWEST)
+	}
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
@@ -380,16 +680,41 @@ func (p *Parser) curPrecedence() int {
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
-	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	return p.arena.identifier(ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
 }
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
-	defer untrace(trace("parseIntegerLiteral"))
-	lit := &ast.IntegerLiteral{Token: p.curToken}
-	val, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	defer p.untrace(p.trace("parseIntegerLiteral"))
+	lit := p.arena.integerLiteral(ast.IntegerLiteral{Token: p.curToken})
+	if misplacedUnderscore(p.curToken.Literal) {
+		msg := fmt.Sprintf("misplaced underscore in %q: underscores must separate digits", p.curToken.Literal)
+		p.addError(p.curToken.Pos, msg)
+		return nil
+	}
+	val, err := strconv.ParseInt(strings.ReplaceAll(p.curToken.Literal, "_", ""), 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.curToken.Pos, msg)
+		return nil
+	}
+
+	lit.Value = val
+	return lit
+}
+
+// parseFloatLiteral parses a floating point literal such as 3.14.
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	defer p.untrace(p.trace("parseFloatLiteral"))
+	lit := &ast.FloatLiteral{Token: p.curToken}
+	if misplacedUnderscore(p.curToken.Literal) {
+		msg := fmt.Sprintf("misplaced underscore in %q: underscores must separate digits", p.curToken.Literal)
+		p.addError(p.curToken.Pos, msg)
+		return nil
+	}
+	val, err := strconv.ParseFloat(strings.ReplaceAll(p.curToken.Literal, "_", ""), 64)
+	if err != nil {
+		msg := fmt.Sprintf("could not parse %q as float", p.curToken.Literal)
+		p.addError(p.curToken.Pos, msg)
 		return nil
 	}
 
@@ -397,14 +722,90 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+// misplacedUnderscore reports whether an underscore in the number literal
+// lit, as the lexer reads it, does not come between two digits.
+func misplacedUnderscore(lit string) bool {
+	for i := 1; i < len(lit); i++ {
+		if lit[i] == '_' && (i == len(lit)-1 || lit[i+1] == '_' || lit[i+1] == '.' || lit[i-1] == 'x' || lit[i-1] == 'X') {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *Parser) parseStringLiteral() ast.Expression {
-	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	return p.arena.stringLiteral(ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+}
+
+// ParseError is a syntax error found at a position in the source.
+type ParseError struct {
+	Pos     token.Position
+	Message string
 }
 
+func (e *ParseError) Error() string {
+	return e.Pos.String() + ": " + e.Message
+}
+
+// Errors returns the messages of all errors encountered while parsing.
 func (p *Parser) Errors() []string {
+	msgs := make([]string, len(p.errors))
+	for i, err := range p.errors {
+		msgs[i] = err.Message
+	}
+	return msgs
+}
+
+// ParseErrors returns the errors encountered while parsing together with
+// their source positions.
+func (p *Parser) ParseErrors() []*ParseError {
 	return p.errors
 }
 
+// Warning is a problem found while parsing that does not make the source
+// invalid, such as an identifier that a later language version reserves.
+type Warning struct {
+	Pos     token.Position
+	Message string
+}
+
+func (w Warning) String() string {
+	return w.Pos.String() + ": " + w.Message
+}
+
+// Warnings returns the warnings found while parsing, in source order.
+func (p *Parser) Warnings() []Warning {
+	return p.warnings
+}
+
+// SetArena makes the parser allocate the nodes of the programs it parses
+// from now on in blocks, if on, rather than each on its own. This takes
+// less time and garbage collection for large sources, but a node keeps its
+// whole block alive, so it is for programs that are discarded as a whole
+// rather than ones whose functions outlive the rest, such as those of a
+// REPL session.
+func (p *Parser) SetArena(on bool) {
+	if !on {
+		p.arena = nil
+	} else if p.arena == nil {
+		p.arena = &arena{}
+	}
+}
+
+// SetTrace makes the parser write an indented BEGIN/END line for each
+// parsing function it enters and leaves to w. A nil w turns tracing off.
+func (p *Parser) SetTrace(w io.Writer) {
+	p.traceOut = w
+}
+
+func (p *Parser) addError(pos token.Position, msg string) {
+	if p.abandoned {
+		// What follows is the fallout of giving up.
+		return
+	}
+	p.errors = append(p.errors, &ParseError{Pos: pos, Message: msg})
+}
+
 // registerPrefix registers a prefix parse function for the given token type.
 // The prefix parse function is responsible for parsing expressions that begin
 // with the given token type.
@@ -423,6 +824,21 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	for errs := p.l.Errors(); p.lexed < len(errs); p.lexed++ {
+		p.addError(errs[p.lexed].Pos, errs[p.lexed].Message)
+	}
+	if p.peekToken.Type == token.IDENT && p.l.Lang() < token.LangLatest {
+		p.warnKeyword(p.peekToken)
+	}
+}
+
+// warnKeyword warns if the identifier tok is a keyword in a later language
+// version, so the source needs changes to move to it.
+func (p *Parser) warnKeyword(tok token.Token) {
+	if kw := token.LookupIdent(tok.Literal); kw != token.IDENT {
+		msg := fmt.Sprintf("%s is a keyword in language version %s and later", tok.Literal, token.Since(kw))
+		p.warnings = append(p.warnings, Warning{Pos: tok.Pos, Message: msg})
+	}
 }
 
 // ParseProgram parses the input tokens and returns an AST representation of the program.
@@ -452,6 +868,13 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.ENUM:
+		// Unlike the others, a failed enum statement is left out of the
+		// program, rather than leaving a nil statement behind.
+		if stmt := p.parseEnumStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	//default case will always be a expression statement if not a let or return statement
 	default:
 		return p.parseExpressionStatement()
@@ -460,11 +883,19 @@ func (p *Parser) parseStatement() ast.Statement {
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for token '%s' found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(p.curToken.Pos, msg)
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
-	defer untrace(trace("parseExpression"))
+	defer p.untrace(p.trace("parseExpression"))
+	// Each operator applied deepens the tree by a level, although the
+	// loop below does not recurse for it.
+	levels := 0
+	defer func() { p.nesting -= levels }()
+	if p.nest(&levels) {
+		return nil
+	}
+
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
 		p.noPrefixParseFnError(p.curToken.Type)
@@ -477,6 +908,9 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		if infix == nil {
 			return leftExp
 		}
+		if p.nest(&levels) {
+			return nil
+		}
 		p.nextToken()
 		leftExp = infix(leftExp)
 	}
@@ -484,16 +918,36 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	return leftExp
 }
 
+// nest accounts for one more level of nesting, counting it in levels too.
+// Once the nesting exceeds maxNesting, it reports the error, skips the
+// rest of the input and returns true.
+func (p *Parser) nest(levels *int) bool {
+	p.nesting++
+	*levels++
+	if p.nesting <= maxNesting {
+		return false
+	}
+	if !p.abandoned {
+		msg := fmt.Sprintf("expression nested too deeply: more than %d levels", maxNesting)
+		p.addError(p.curToken.Pos, msg)
+		p.abandoned = true
+		for !p.peekTokenIs(token.EOF) {
+			p.nextToken()
+		}
+	}
+	return true
+}
+
 // parseLetStatement parses a let statement, which declares a new variable
 // with a name and an initial value. It returns an ast.LetStatement node.
 func (p *Parser) parseLetStatement() *ast.LetStatement {
-	stmt := &ast.LetStatement{Token: p.curToken}
+	stmt := p.arena.letStatement(ast.LetStatement{Token: p.curToken})
 
 	if !p.expectPeek(token.IDENT) {
 		return nil
 	}
 
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	stmt.Name = p.arena.identifier(ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
 
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
@@ -514,7 +968,7 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 // node with the current token as the token, and then consumes tokens until it reaches
 // a semicolon. The return statement is returned.
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
-	stmt := &ast.ReturnStatement{Token: p.curToken}
+	stmt := p.arena.returnStatement(ast.ReturnStatement{Token: p.curToken})
 
 	p.nextToken()
 
@@ -528,8 +982,8 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 }
 
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
-	defer untrace(trace("parseExpressionStatement"))
-	stmt := &ast.ExpressionStatement{Token: p.curToken}
+	defer p.untrace(p.trace("parseExpressionStatement"))
+	stmt := p.arena.expressionStatement(ast.ExpressionStatement{Token: p.curToken})
 
 	stmt.Expression = p.parseExpression(LOWEST)
 
@@ -569,5 +1023,5 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 func (p *Parser) peekError(t token.TokenType) {
 	msg := "expected next token to be %s, got %s instead"
 	msg = fmt.Sprintf(msg, t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(p.peekToken.Pos, msg)
 }
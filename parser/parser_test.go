@@ -1,11 +1,16 @@
 package parser
 
 import (
+	"bytes"
 	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/frankie-mur/monkeylang/ast"
 	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/token"
 )
 
 func TestLetStatements(t *testing.T) {
@@ -158,6 +163,137 @@ func TestIntergerLiteralExpression(t *testing.T) {
 
 }
 
+func TestIntegerLiteralUnderscores(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"1_000_000", 1000000},
+		{"0xFF_FF", 0xFFFF},
+		{"0x1f", 31},
+		{"0X10", 16},
+		{"9_2", 92},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		literal := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IntegerLiteral)
+		if literal.Value != tt.expected || literal.String() != tt.input {
+			t.Errorf("%q: wrong literal. want=%d, got=%d (%s)", tt.input, tt.expected, literal.Value, literal)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"1_", `1:1: misplaced underscore in "1_": underscores must separate digits`},
+		{"1__000", `1:1: misplaced underscore in "1__000": underscores must separate digits`},
+		{"0x_FF", `1:1: misplaced underscore in "0x_FF": underscores must separate digits`},
+		{"0x", `1:1: could not parse "0x" as integer`},
+	}
+
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errs := p.ParseErrors(); len(errs) == 0 || errs[0].Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, errs)
+		}
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"0.5", 0.5},
+		{"1_000.000_1", 1000.0001},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		literal, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("%q: not an *ast.FloatLiteral. got=%T", tt.input, program.Statements[0].(*ast.ExpressionStatement).Expression)
+		}
+		if literal.Value != tt.expected || literal.String() != tt.input {
+			t.Errorf("%q: wrong literal. want=%g, got=%g (%s)", tt.input, tt.expected, literal.Value, literal)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"1_.5", `1:1: misplaced underscore in "1_.5": underscores must separate digits`},
+		{"1.5_", `1:1: misplaced underscore in "1.5_": underscores must separate digits`},
+	}
+
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errs := p.ParseErrors(); len(errs) == 0 || errs[0].Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, errs)
+		}
+	}
+}
+
+func TestNestingLimit(t *testing.T) {
+	tests := []struct {
+		input string
+		ok    bool
+	}{
+		{strings.Repeat("(", maxNesting/2) + "1" + strings.Repeat(")", maxNesting/2), true},
+		{strings.Repeat("(", maxNesting) + "1" + strings.Repeat(")", maxNesting), false},
+		{"1" + strings.Repeat(" + 1", maxNesting/2), true},
+		{"1" + strings.Repeat(" + 1", maxNesting) + "; let x = ", false},
+		{strings.Repeat("- ", maxNesting) + "1", false},
+	}
+
+	for i, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.Errors()
+		if tt.ok {
+			if len(errs) != 0 {
+				t.Errorf("tests[%d]: unexpected errors: %v", i, errs)
+			}
+			continue
+		}
+		want := fmt.Sprintf("expression nested too deeply: more than %d levels", maxNesting)
+		if len(errs) != 1 || !strings.HasSuffix(errs[0], want) {
+			t.Errorf("tests[%d]: want the single error %q, got %v", i, want, errs)
+		}
+	}
+}
+
+func TestTailCallMarking(t *testing.T) {
+	input := `fn() { a(); if (x) { return b(); } c(d()) }; e();
+fn() { if (x) { f() } else { g(fn() { h() }) } }`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	tail := map[string]bool{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if call, ok := node.(*ast.CallExpression); ok {
+			tail[call.Function.String()] = call.Tail
+		}
+		return true
+	})
+	expected := map[string]bool{"a": false, "b": true, "c": true, "d": false, "e": false, "f": true, "g": true, "h": true}
+	if !reflect.DeepEqual(tail, expected) {
+		t.Errorf("wrong tail calls.\nwant=%v\ngot= %v", expected, tail)
+	}
+}
+
 func TestParsingPrefixExpression(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -271,7 +407,15 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		{"a * b * c", "((a * b) * c)"},
 		{"a * b / c", "((a * b) / c)"},
 		{"a + b / c", "(a + (b / c))"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a && b || c && d", "((a && b) || (c && d))"},
+		{"a == b && c < d", "((a == b) && (c < d))"},
+		{"!a && b", "((!a) && b)"},
+		{"x = a || b", "(x = (a || b))"},
 		{"a + b * c + d / e - f", "(((a + (b * c)) + (d / e)) - f)"},
+		{"a | b ^ c & d << 1 + 2", "(a | (b ^ (c & (d << (1 + 2)))))"},
+		{"1 < 2 | 3", "(1 < (2 | 3))"},
+		{"~a >> 1", "((~a) >> 1)"},
 		{"3 + 4; -5 * 5", "(3 + 4)((-5) * 5)"},
 		{"5 > 4 == 3 < 4", "((5 > 4) == (3 < 4))"},
 		{"5 < 4!= 3 > 4", "((5 < 4) != (3 > 4))"},
@@ -423,6 +567,186 @@ func TestIfExpressions(t *testing.T) {
 
 }
 
+func TestWhileExpression(t *testing.T) {
+	input := "while (x < y) { x }"
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program has not enough statements. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.WhileExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.WhileExpression. got=%T", stmt.Expression)
+	}
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+	if len(exp.Body.Statements) != 1 {
+		t.Fatalf("body should contain one statement, got %d", len(exp.Body.Statements))
+	}
+	body, ok := exp.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("body is not an expression, got %T", exp.Body.Statements[0])
+	}
+	testIdentifier(t, body.Expression, "x")
+
+	for _, input := range []string{"while x { x }", "while (x) x"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected parser errors", input)
+		}
+	}
+}
+
+func TestAssignExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5;", "(x = 5)"},
+		{"x = y = 1", "(x = (y = 1))"},
+		{"x = 1 + 2 * 3", "(x = (1 + (2 * 3)))"},
+		{"x = y == z", "(x = (y == z))"},
+		{"f(x = 1)", "f((x = 1))"},
+		{"x += 1", "(x += 1)"},
+		{"x -= y *= 2 + 3", "(x -= (y *= (2 + 3)))"},
+		{"x /= 2 - 1", "(x /= (2 - 1))"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+		if _, ok := stmt.Expression.(*ast.AssignExpression); !ok && !strings.HasPrefix(tt.input, "f(") {
+			t.Errorf("%q: stmt.Expression is not ast.AssignExpression. got=%T", tt.input, stmt.Expression)
+		}
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"1 = 2", "1:3: cannot assign to 1"},
+		{"f() = 2", "1:5: cannot assign to f()"},
+		{"x == y = 1", "1:8: cannot assign to (x == y)"},
+		{"a[0] += 1", "1:6: cannot assign to (a[0])"},
+		{"!# = 1", "1:2: no prefix parse function for token 'ILLEGAL' found"},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errs := p.ParseErrors(); len(errs) == 0 || errs[0].Error() != tt.expected {
+			t.Errorf("%q: wrong errors. expected %q first, got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestPostfixExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x++", "(x++)"},
+		{"x--;", "(x--)"},
+		{"a[i + 1]++", "((a[(i + 1)])++)"},
+		{"-x++", "(-(x++))"},
+		{"x++ * 2", "((x++) * 2)"},
+		{"y = x--", "(y = (x--))"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("%q: wrong program. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"1++", "1:2: cannot apply ++ to 1"},
+		{"f()--", "1:4: cannot apply -- to f()"},
+		{"(x + 1)++", "1:8: cannot apply ++ to (x + 1)"},
+		{"!# ++", "1:2: no prefix parse function for token 'ILLEGAL' found"},
+	}
+
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errs := p.ParseErrors(); len(errs) == 0 || errs[0].Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, errs)
+		}
+	}
+}
+
+func TestForExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		key      string
+		value    string
+		iterable string
+	}{
+		{"for (x in xs) { x }", "", "x", "xs"},
+		{"for (k, v in h) { v }", "k", "v", "h"},
+		{"for (c in \"abc\") { c }", "", "c", "abc"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if len(program.Statements) != 1 {
+			t.Fatalf("program has not enough statements. got=%d", len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+		exp, ok := stmt.Expression.(*ast.ForExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.ForExpression. got=%T", stmt.Expression)
+		}
+		if tt.key == "" {
+			if exp.Key != nil {
+				t.Errorf("%q: exp.Key is not nil. got=%s", tt.input, exp.Key)
+			}
+		} else if exp.Key == nil || exp.Key.Value != tt.key {
+			t.Errorf("%q: exp.Key is not %s. got=%v", tt.input, tt.key, exp.Key)
+		}
+		testIdentifier(t, exp.Value, tt.value)
+		if exp.Iterable.TokenLiteral() != tt.iterable {
+			t.Errorf("%q: exp.Iterable is not %s. got=%s", tt.input, tt.iterable, exp.Iterable.TokenLiteral())
+		}
+		if len(exp.Body.Statements) != 1 {
+			t.Fatalf("body should contain one statement, got %d", len(exp.Body.Statements))
+		}
+	}
+
+	for _, input := range []string{"for x in xs { x }", "for (x xs) { x }", "for (1 in xs) { x }", "for (k, in h) { k }", "for (x in xs) x"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected parser errors", input)
+		}
+	}
+}
+
 func TestIfElseExpression(t *testing.T) {
 	input := "if (x < y) { x } else { y }"
 	l := lexer.New(input)
@@ -724,6 +1048,48 @@ func TestParsingIndexExpression(t *testing.T) {
 	}
 }
 
+func TestParsingSliceExpression(t *testing.T) {
+	p := New(lexer.New("myArray[1:n]"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	slice, ok := stmt.Expression.(*ast.SliceExpression)
+	if !ok {
+		t.Fatalf("exp not ast.SliceExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, slice.Left, "myArray") || !testIntegerLiteral(t, slice.Low, 1) || !testIdentifier(t, slice.High, "n") {
+		return
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a[1:3]", "(a[1:3])"},
+		{"a[:n - 1]", "(a[:(n - 1)])"},
+		{"a[-2:]", "(a[(-2):])"},
+		{"a[:]", "(a[:])"},
+		{"f()[1:][0]", "((f()[1:])[0])"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	p = New(lexer.New("a[1:2:3]"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("a[1:2:3] parsed without errors")
+	}
+}
+
 func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 
@@ -892,3 +1258,323 @@ func testIdentifier(t *testing.T, exp ast.Expression, value string) bool {
 
 	return true
 }
+
+func TestBlockStatementParsing(t *testing.T) {
+	input := `fn(x) { let y = x * 2; let z = y + 1; z }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(function.Body.Statements) != 3 {
+		t.Fatalf("function.Body.Statements has not 3 statements. got=%d",
+			len(function.Body.Statements))
+	}
+
+	if !testLetStatement(t, function.Body.Statements[0], "y") {
+		return
+	}
+	if !testLetStatement(t, function.Body.Statements[1], "z") {
+		return
+	}
+}
+
+func TestBlockStatementLengths(t *testing.T) {
+	tests := []struct {
+		input      string
+		statements int
+		blocks     []int
+	}{
+		{"fn() {}", 1, []int{0}},
+		{"fn() { 1 }", 1, []int{1}},
+		{"fn() { 1; 2; 3 }", 1, []int{3}},
+		{"fn() { 1; 2 }; 3", 2, []int{2}},
+		{"fn() { if (x) { 1; 2 }; 3 }", 1, []int{2, 2}},
+		{"if (x) { let a = 1; a } else { 1; 2; 3 }", 1, []int{2, 3}},
+		{"while (x) { x = x - 1; y = y + 1 }; y", 2, []int{2}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != tt.statements {
+			t.Errorf("%q: program has wrong number of statements. want=%d, got=%d", tt.input, tt.statements, len(program.Statements))
+		}
+		var blocks []int
+		ast.Inspect(program, func(node ast.Node) bool {
+			if block, ok := node.(*ast.BlockStatement); ok {
+				blocks = append(blocks, len(block.Statements))
+			}
+			return true
+		})
+		if !reflect.DeepEqual(blocks, tt.blocks) {
+			t.Errorf("%q: wrong block lengths. want=%v, got=%v", tt.input, tt.blocks, blocks)
+		}
+	}
+}
+
+func TestParsingHashLiteralKeyOrder(t *testing.T) {
+	input := `{"c": 1, "a": 2, "b": 3}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	expected := []string{"c", "a", "b"}
+	if len(hash.Keys) != len(expected) {
+		t.Fatalf("hash.Keys has wrong length. got=%d", len(hash.Keys))
+	}
+	for i, key := range hash.Keys {
+		if key.String() != expected[i] {
+			t.Errorf("hash.Keys[%d] wrong. expected=%q, got=%q", i, expected[i], key.String())
+		}
+	}
+}
+
+func TestEnumAndMatchParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"enum Shape { Circle(r), Rect(w, h), Empty, }", "enum Shape { Circle(r), Rect(w, h), Empty }"},
+		{"enum Unit { One() };", "enum Unit { One() }"},
+		{"match (s) { Circle(r) => { r * r } _ => { 0 } }", "match (s) { Circle(r) => (r * r) _ => 0 }"},
+		{"let a = match (s) { Rect(w, h) => { w * h } };", "let a = match (s) { Rect(w, h) => (w * h) };"},
+		{"match (x) { }", "match (x) { }"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("%q: wrong program. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"enum Shape { }", "1:1: enum Shape has no variants"},
+		{"enum { A }", "1:6: expected next token to be IDENT, got { instead"},
+		{"enum E { A(1) }", "1:12: expected next token to be IDENT, got INT instead"},
+		{"enum E { A B }", "1:12: expected next token to be ,, got IDENT instead"},
+		{"match (s) { A => 1 }", "1:18: expected next token to be {, got INT instead"},
+		{"match (s) { A(x y) => { 1 } }", "1:17: expected next token to be ,, got IDENT instead"},
+		{"match s { }", "1:7: expected next token to be (, got IDENT instead"},
+	}
+
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errs := p.ParseErrors(); len(errs) == 0 || errs[0].Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, errs)
+		}
+	}
+}
+
+func TestSwitchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"switch (x) { case 1: { \"one\" } case 1 + 1: { \"two\" } }", "switch (x) { case 1: one case (1 + 1): two }"},
+		{"let a = switch (x) { case y: { 1 } default: { 2 } };", "let a = switch (x) { case y: 1 default: 2 };"},
+		{"switch (x) { default: { } }", "switch (x) { default:  }"},
+		{"switch (x) { }", "switch (x) { }"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("%q: wrong program. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"switch (x) { case 1: 2 }", "1:22: expected next token to be {, got INT instead"},
+		{"switch (x) { case 1 { 2 } }", "1:21: expected next token to be :, got { instead"},
+		{"switch (x) { 1: { 2 } }", "1:14: expected next token to be CASE, got INT instead"},
+		{"switch (x) { default: { 1 } case 2: { 2 } }", "1:29: the default case must be the last case of a switch"},
+		{"switch x { }", "1:8: expected next token to be (, got IDENT instead"},
+	}
+
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errs := p.ParseErrors(); len(errs) == 0 || errs[0].Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, errs)
+		}
+	}
+}
+
+func TestKeywordWarnings(t *testing.T) {
+	input := "let enum = 1;\nlet f = fn(match) { match };\nf(enum, while, in)"
+
+	l := lexer.New(input)
+	l.SetLang(token.Lang1)
+	p := New(l)
+	p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := []string{
+		"1:5: enum is a keyword in language version 2 and later",
+		"2:12: match is a keyword in language version 2 and later",
+		"2:21: match is a keyword in language version 2 and later",
+		"3:3: enum is a keyword in language version 2 and later",
+		"3:9: while is a keyword in language version 2 and later",
+		"3:16: in is a keyword in language version 2 and later",
+	}
+	warnings := p.Warnings()
+	if len(warnings) != len(expected) {
+		t.Fatalf("wrong number of warnings. expected=%d, got=%d (%v)", len(expected), len(warnings), warnings)
+	}
+	for i, w := range warnings {
+		if w.String() != expected[i] {
+			t.Errorf("warnings[%d] wrong. expected=%q, got=%q", i, expected[i], w.String())
+		}
+	}
+
+	p = New(lexer.New(input))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected errors parsing %q as the latest language version", input)
+	}
+}
+
+func TestParseErrorPositions(t *testing.T) {
+	input := "let x = 5;\nlet = 10;\nlet y 3;"
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	expected := []string{
+		"2:5: expected next token to be IDENT, got = instead",
+		"2:5: no prefix parse function for token '=' found",
+		"3:7: expected next token to be =, got INT instead",
+	}
+
+	errors := p.ParseErrors()
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. expected=%d, got=%d (%v)", len(expected), len(errors), p.Errors())
+	}
+	for i, err := range errors {
+		if err.Error() != expected[i] {
+			t.Errorf("errors[%d] wrong. expected=%q, got=%q", i, expected[i], err.Error())
+		}
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	p := New(lexer.New("let x = 5; /* let y = x;\nputs(y);"))
+	program := p.ParseProgram()
+
+	errors := p.ParseErrors()
+	if len(errors) != 1 || errors[0].Error() != "1:12: unterminated block comment" {
+		t.Fatalf("wrong errors. got=%v", p.Errors())
+	}
+	if len(program.Statements) != 1 {
+		t.Errorf("wrong number of statements. expected=1, got=%d", len(program.Statements))
+	}
+}
+
+func TestTrace(t *testing.T) {
+	var out bytes.Buffer
+
+	l := lexer.New("-a")
+	p := New(l)
+	p.SetTrace(&out)
+	p.ParseProgram()
+
+	expected := `BEGIN parseExpressionStatement 1:1 - "-"
+  BEGIN parseExpression 1:1 - "-"
+    BEGIN parsePrefixExpression 1:1 - "-"
+      BEGIN parseExpression 1:2 IDENT "a"
+      END parseExpression
+    END parsePrefixExpression
+  END parseExpression
+END parseExpressionStatement
+`
+	if out.String() != expected {
+		t.Errorf("wrong trace.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+
+	out.Reset()
+	p = New(lexer.New("-a"))
+	p.ParseProgram()
+	if out.Len() != 0 {
+		t.Errorf("parser traced without SetTrace. got=%q", out.String())
+	}
+}
+
+func TestArena(t *testing.T) {
+	var dumps [2]bytes.Buffer
+	for i, arena := range []bool{false, true} {
+		p := New(lexer.New(benchmarkSource))
+		p.SetArena(arena)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		ast.Fprint(&dumps[i], program)
+	}
+	if dumps[0].String() != dumps[1].String() {
+		t.Errorf("the arena changes the syntax tree")
+	}
+}
+
+// benchmarkSource is a program of every kind of node, repeated to several
+// thousand lines.
+var benchmarkSource = strings.Repeat(`let merge = fn(a, b, acc) {
+	if (len(a) == 0) { return acc + b; };
+	if (first(b) < first(a)) {
+		merge(a, rest(b), push(acc, first(b)))
+	} else {
+		merge(rest(a), b, push(acc, first(a)))
+	}
+};
+let config = {"name": "monkey", "depth": 10, true: [1, 2, 3], "ok": !false != true};
+let result = merge([1, 4, 9], [2, 3, 10], [])[0] * -1 / 2 > 5;
+`, 500)
+
+func benchmarkParse(b *testing.B, arena bool) {
+	b.SetBytes(int64(len(benchmarkSource)))
+	b.ReportAllocs()
+	var gcs uint32
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	gcs = stats.NumGC
+
+	for i := 0; i < b.N; i++ {
+		p := New(lexer.New(benchmarkSource))
+		p.SetArena(arena)
+		p.ParseProgram()
+	}
+
+	runtime.ReadMemStats(&stats)
+	b.ReportMetric(float64(stats.NumGC-gcs)/float64(b.N), "gcs/op")
+}
+
+func BenchmarkParse(b *testing.B)      { benchmarkParse(b, false) }
+func BenchmarkParseArena(b *testing.B) { benchmarkParse(b, true) }
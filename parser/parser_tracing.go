@@ -5,28 +5,36 @@ import (
 	"strings"
 )
 
-var traceLevel int = 0
+const traceIdentPlaceholder string = "  "
 
-const traceIdentPlaceholder string = "\t"
-
-func identLevel() string {
-	return strings.Repeat(traceIdentPlaceholder, traceLevel-1)
+func (p *Parser) identLevel() string {
+	return strings.Repeat(traceIdentPlaceholder, p.traceLevel-1)
 }
 
-func tracePrint(fs string) {
-	fmt.Printf("%s%s\n", identLevel(), fs)
+func (p *Parser) tracePrint(fs string) {
+	if p.traceOut == nil {
+		return
+	}
+	fmt.Fprintf(p.traceOut, "%s%s\n", p.identLevel(), fs)
 }
 
-func incIdent() { traceLevel = traceLevel + 1 }
-func decIdent() { traceLevel = traceLevel - 1 }
-
-func trace(msg string) string {
-	incIdent()
-	tracePrint("BEGIN " + msg)
+func (p *Parser) incIdent() { p.traceLevel = p.traceLevel + 1 }
+func (p *Parser) decIdent() { p.traceLevel = p.traceLevel - 1 }
+
+// trace and untrace bracket a parsing function: `defer p.untrace(p.trace(name))`.
+// Each BEGIN line also shows the token the function starts at. The lines
+// are only formatted while tracing, as parsing calls them for every node.
+func (p *Parser) trace(msg string) string {
+	p.incIdent()
+	if p.traceOut != nil {
+		p.tracePrint(fmt.Sprintf("BEGIN %s %s %s %q", msg, p.curToken.Pos, p.curToken.Type, p.curToken.Literal))
+	}
 	return msg
 }
 
-func untrace(msg string) {
-	tracePrint("END " + msg)
-	decIdent()
+func (p *Parser) untrace(msg string) {
+	if p.traceOut != nil {
+		p.tracePrint("END " + msg)
+	}
+	p.decIdent()
 }
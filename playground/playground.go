@@ -0,0 +1,205 @@
+// Package playground serves a web page where visitors write and run Monkey
+// programs, and the HTTP API behind it. Every request runs in a fresh
+// interpreter that grants no access to the outside world and stops after
+// a time, step and allocation limit, and only a few run at once, so the
+// server can be exposed to strangers:
+//
+//	POST /run  {"source": "puts(1 + 2)"}
+//
+// answers with the program's output, its errors, the value of its last
+// expression and its exit code:
+//
+//	{"output": "3\n", "errors": [], "value": "", "exitCode": 0}
+package playground
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/frankie-mur/monkeylang/monkey"
+)
+
+//go:embed index.html
+var indexHTML []byte
+
+// Options limit what one program may use. Zero fields use the defaults.
+type Options struct {
+	// Timeout stops a program that runs longer. The default is 5 seconds.
+	Timeout time.Duration
+	// MaxSteps and MaxDepth bound the syntax nodes a program evaluates
+	// and its nested calls. The defaults are 1e7 and 1000.
+	MaxSteps int64
+	MaxDepth int
+	// MaxNesting bounds the nodes whose evaluation is in progress at once,
+	// and so the stack a request takes up. The default is 50000.
+	MaxNesting int
+	// MaxAlloc bounds the bytes of the strings, arrays and hashes a
+	// program creates. The default is 256 MiB.
+	MaxAlloc int64
+	// MaxSource is the size of the largest program accepted, in bytes.
+	// The default is 64 KiB.
+	MaxSource int64
+	// MaxOutput is how many bytes of output are kept. The default is
+	// 64 KiB; a program printing more has the rest dropped.
+	MaxOutput int
+	// MaxRuns bounds the programs running at once, and with MaxAlloc the
+	// memory they take up together. A request arriving while as many run
+	// is answered with 503 Service Unavailable. The default is 4.
+	MaxRuns int
+}
+
+func (o Options) withDefaults() Options {
+	if o.Timeout <= 0 {
+		o.Timeout = 5 * time.Second
+	}
+	if o.MaxSteps <= 0 {
+		o.MaxSteps = 10_000_000
+	}
+	if o.MaxDepth <= 0 {
+		o.MaxDepth = 1000
+	}
+	if o.MaxNesting <= 0 {
+		o.MaxNesting = 50_000
+	}
+	if o.MaxAlloc <= 0 {
+		o.MaxAlloc = 256 << 20
+	}
+	if o.MaxSource <= 0 {
+		o.MaxSource = 64 << 10
+	}
+	if o.MaxOutput <= 0 {
+		o.MaxOutput = 64 << 10
+	}
+	if o.MaxRuns <= 0 {
+		o.MaxRuns = 4
+	}
+	return o
+}
+
+// Request is the body of a POST to /run.
+type Request struct {
+	Source string `json:"source"`
+}
+
+// Response is the answer to a POST to /run. Errors holds the syntax errors
+// of a program that does not parse, or the runtime error that stopped it.
+// Value is the last expression's value as Monkey prints it, "" if there is
+// none.
+type Response struct {
+	Output    string   `json:"output"`
+	Truncated bool     `json:"truncated,omitempty"`
+	Errors    []string `json:"errors"`
+	Value     string   `json:"value"`
+	ExitCode  int64    `json:"exitCode"`
+}
+
+// Handler returns the playground's HTTP handler, serving the page at / and
+// the API at /run.
+func Handler(opts Options) http.Handler {
+	opts = opts.withDefaults()
+	running := make(chan struct{}, opts.MaxRuns)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(indexHTML)
+	})
+	mux.HandleFunc("/run", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+
+		var req Request
+		body := http.MaxBytesReader(w, r.Body, opts.MaxSource)
+		if err := json.NewDecoder(body).Decode(&req); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(w, http.StatusRequestEntityTooLarge, "program too large")
+				return
+			}
+			writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+			return
+		}
+
+		select {
+		case running <- struct{}{}:
+			defer func() { <-running }()
+		default:
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusServiceUnavailable, "too many programs running, try again")
+			return
+		}
+		writeJSON(w, http.StatusOK, run(r.Context(), req.Source, opts))
+	})
+	return mux
+}
+
+// run evaluates source in an interpreter of its own.
+func run(ctx context.Context, source string, opts Options) Response {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	out := &limitedBuffer{max: opts.MaxOutput}
+	interp := monkey.New(monkey.Options{
+		Stdout:     out,
+		MaxSteps:   opts.MaxSteps,
+		MaxDepth:   opts.MaxDepth,
+		MaxNesting: opts.MaxNesting,
+		MaxAlloc:   opts.MaxAlloc,
+		Sandbox:    &monkey.Sandbox{},
+	})
+
+	resp := Response{Errors: []string{}}
+	value, err := interp.Eval(ctx, source)
+	var parseErr *monkey.ParseError
+	var exitErr *monkey.ExitError
+	switch {
+	case errors.As(err, &parseErr):
+		resp.Errors = parseErr.Errors
+	case errors.As(err, &exitErr):
+		resp.ExitCode = exitErr.Code
+	case err != nil:
+		resp.Errors = []string{err.Error()}
+	case value != nil:
+		resp.Value = monkey.Inspect(value)
+	}
+	resp.Output, resp.Truncated = string(out.buf), out.truncated
+	return resp
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// limitedBuffer keeps the first max bytes written to it and drops the
+// rest, so a program printing in a loop cannot exhaust the server's memory.
+type limitedBuffer struct {
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - len(b.buf); len(p) > room {
+		b.buf = append(b.buf, p[:room]...)
+		b.truncated = true
+		return len(p), nil
+	}
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
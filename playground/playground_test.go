@@ -0,0 +1,150 @@
+package playground
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func post(t *testing.T, h http.Handler, body string) (*httptest.ResponseRecorder, Response) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/run", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var resp Response
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid response %q: %s", rec.Body.String(), err)
+		}
+	}
+	return rec, resp
+}
+
+func TestRun(t *testing.T) {
+	h := Handler(Options{MaxSteps: 10000, MaxDepth: 50, MaxOutput: 8})
+
+	tests := []struct {
+		source   string
+		expected Response
+	}{
+		{`puts("hi"); 1 + 2`, Response{Output: "\"hi\"\n", Errors: []string{}, Value: "3"}},
+		{`[1, "two"]`, Response{Errors: []string{}, Value: `[1, "two"]`}},
+		{"let x = ;", Response{Errors: []string{"1:9: no prefix parse function for token ';' found"}}},
+		{"puts(1); 1 + true", Response{Output: "1\n", Errors: []string{"1:10: type mismatch: INTEGER + BOOLEAN"}}},
+		{"puts(1); exit(3)", Response{Output: "1\n", Errors: []string{}, ExitCode: 3}},
+		{`getenv("HOME")`, Response{Errors: []string{"1:1: getenv is not available: the env capability is not granted"}}},
+		{"let f = fn(n) { 1 + f(n + 1) }; f(0)", Response{Errors: []string{"1:21: maximum call depth of 50 exceeded"}}},
+		{`puts("abcdefgh")`, Response{Output: "\"abcdefg", Truncated: true, Errors: []string{}}},
+	}
+
+	for _, tt := range tests {
+		body, _ := json.Marshal(Request{Source: tt.source})
+		rec, got := post(t, h, string(body))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%q: wrong status %d", tt.source, rec.Code)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%q: wrong response. want=%+v, got=%+v", tt.source, tt.expected, got)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	h := Handler(Options{Timeout: 10 * time.Millisecond})
+
+	// The loop makes tail calls, so only the timeout stops it, wherever
+	// it happens to be.
+	_, got := post(t, h, `{"source": "let loop = fn(n) { if (n > 0) { loop(n - 1) } else { 0 } }; loop(100000000)"}`)
+	if len(got.Errors) != 1 || !strings.HasSuffix(got.Errors[0], ": timeout exceeded") {
+		t.Errorf("wrong errors. want a timeout, got=%q", got.Errors)
+	}
+}
+
+func TestMaxRuns(t *testing.T) {
+	h := Handler(Options{Timeout: time.Second, MaxRuns: 1})
+
+	// Only the timeout stops the first program, which takes the only run.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		post(t, h, `{"source": "while (true) { 0 }"}`)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		rec, _ := post(t, h, `{"source": "1"}`)
+		if rec.Code == http.StatusServiceUnavailable {
+			if rec.Header().Get("Retry-After") == "" {
+				t.Errorf("missing Retry-After")
+			}
+			break
+		}
+		if rec.Code != http.StatusOK || time.Now().After(deadline) {
+			t.Fatalf("wrong status. want=%d, got=%d", http.StatusServiceUnavailable, rec.Code)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Once it stops, programs run again.
+	<-done
+	if rec, got := post(t, h, `{"source": "1 + 1"}`); rec.Code != http.StatusOK || got.Value != "2" {
+		t.Errorf("wrong response %d %+v", rec.Code, got)
+	}
+}
+
+func TestResourceLimits(t *testing.T) {
+	tests := []struct {
+		opts     Options
+		source   string
+		expected string
+	}{
+		// Deep enough to overflow the stack if the nesting were not
+		// bounded, yet within the source and call depth limits.
+		{Options{}, strings.Repeat("!", 60000) + "true", "maximum nesting of 50000 exceeded"},
+		{Options{}, "let f = fn(n) { if (n > 0) { " + strings.Repeat("!", 2000) + "f(n - 1) } }; f(900)", "maximum nesting of 50000 exceeded"},
+		{Options{MaxAlloc: 1 << 20}, `let s = "ab"; while (true) { s = s + s }`, "allocation limit exceeded: created more than 1048576 bytes of values"},
+		{Options{MaxAlloc: 1 << 20}, "[0] * 1000000", "allocation limit exceeded: created more than 1048576 bytes of values"},
+	}
+
+	for _, tt := range tests {
+		body, _ := json.Marshal(Request{Source: tt.source})
+		rec, got := post(t, Handler(tt.opts), string(body))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%.40q: wrong status %d", tt.source, rec.Code)
+			continue
+		}
+		if len(got.Errors) != 1 || !strings.HasSuffix(got.Errors[0], ": "+tt.expected) {
+			t.Errorf("%.40q: wrong errors. want %q, got=%q", tt.source, tt.expected, got.Errors)
+		}
+	}
+}
+
+func TestRequests(t *testing.T) {
+	h := Handler(Options{MaxSource: 32})
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "/", "", http.StatusOK},
+		{http.MethodGet, "/missing", "", http.StatusNotFound},
+		{http.MethodGet, "/run", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/run", "{", http.StatusBadRequest},
+		{http.MethodPost, "/run", `{"source": "` + strings.Repeat("1", 64) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: wrong status. want=%d, got=%d (%s)", tt.method, tt.path, tt.status, rec.Code, rec.Body)
+		}
+	}
+}
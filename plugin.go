@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"plugin"
+
+	"github.com/frankie-mur/monkeylang/evaluator"
+)
+
+// Plugins add builtins to monkey without rebuilding it. A plugin is a Go
+// package main built with `go build -buildmode=plugin` against the same
+// version of this module, exporting
+//
+//	func Register(r evaluator.Registry) error
+//
+// which registers its builtins with r. Before running any command monkey
+// loads the plugins in $MONKEY_PLUGINS, a list of paths separated like
+// $PATH entries. Plugins only load on the platforms Go supports them on.
+
+// loadPlugins loads the plugins in list, a $MONKEY_PLUGINS value.
+func loadPlugins(list string) error {
+	for _, path := range filepath.SplitList(list) {
+		if path == "" {
+			continue
+		}
+		if err := loadPlugin(path); err != nil {
+			return fmt.Errorf("plugin %s: %s", path, err)
+		}
+	}
+	return nil
+}
+
+func loadPlugin(path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return err
+	}
+	sym, err := p.Lookup("Register")
+	if err != nil {
+		return err
+	}
+	register, ok := sym.(func(evaluator.Registry) error)
+	if !ok {
+		return fmt.Errorf("Register is a %T, want func(evaluator.Registry) error", sym)
+	}
+	return register(evaluator.DefaultRegistry)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// profileFlags are the --cpuprofile and --memprofile flags shared by the
+// commands that evaluate programs.
+type profileFlags struct {
+	cpu string
+	mem string
+}
+
+func addProfileFlags(flags *flag.FlagSet) *profileFlags {
+	p := &profileFlags{}
+	flags.StringVar(&p.cpu, "cpuprofile", "", "write a CPU profile to `file`")
+	flags.StringVar(&p.mem, "memprofile", "", "write a heap profile to `file` when done")
+	return p
+}
+
+// start begins CPU profiling if requested. The returned function stops it
+// and writes the heap profile; it must be called once evaluation is done.
+// Errors are reported to stderr and make start return false.
+func (p *profileFlags) start(stderr io.Writer) (stop func(), ok bool) {
+	var cpu *os.File
+	if p.cpu != "" {
+		f, err := os.Create(p.cpu)
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey: %s\n", err)
+			return nil, false
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			fmt.Fprintf(stderr, "monkey: cpu profile: %s\n", err)
+			f.Close()
+			return nil, false
+		}
+		cpu = f
+	}
+
+	return func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				fmt.Fprintf(stderr, "monkey: %s\n", err)
+			}
+		}
+		if p.mem != "" {
+			p.writeHeapProfile(stderr)
+		}
+	}, true
+}
+
+func (p *profileFlags) writeHeapProfile(stderr io.Writer) {
+	f, err := os.Create(p.mem)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return
+	}
+	defer f.Close()
+
+	// Collect garbage first so the profile shows live data only.
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		fmt.Fprintf(stderr, "monkey: heap profile: %s\n", err)
+	}
+}
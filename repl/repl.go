@@ -2,26 +2,68 @@ package repl
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/compiler"
 	"github.com/frankie-mur/monkeylang/evaluator"
 	"github.com/frankie-mur/monkeylang/lexer"
 	"github.com/frankie-mur/monkeylang/object"
 	"github.com/frankie-mur/monkeylang/parser"
+	"github.com/frankie-mur/monkeylang/resolver"
+	"github.com/frankie-mur/monkeylang/token"
+	"github.com/frankie-mur/monkeylang/vm"
 )
 
 const PROMPT = ">> "
 
+// Options configure a REPL session.
+type Options struct {
+	// Trace receives parser and evaluator traces. The :trace command is
+	// only available when it is set.
+	Trace io.Writer
+
+	// TraceParser and TraceEval turn tracing on from the start.
+	TraceParser bool
+	TraceEval   bool
+
+	// Engine is "vm" to compile each line and run it on the bytecode VM
+	// instead of the tree-walking evaluator. The VM cannot trace evaluation.
+	Engine string
+
+	// Lang is the language version lines are read as. The zero Lang is
+	// the latest.
+	Lang token.Lang
+}
+
 // Start is the main entry point for the REPL (Read-Eval-Print Loop). It reads input from the provided io.Reader,
 // tokenizes the input using the lexer, and prints the resulting tokens to the provided io.Writer.
 // The REPL runs in an infinite loop, prompting the user for input and processing it until an error or EOF is encountered.
 func Start(in io.Reader, out io.Writer) {
+	StartWithOptions(in, out, Options{})
+}
+
+// StartWithOptions is like Start with the given options.
+func StartWithOptions(in io.Reader, out io.Writer, opts Options) {
 	scanner := bufio.NewScanner(in)
 	env := object.NewEnvironment()
+	e := evaluator.New()
+	e.SetWarn(func(w evaluator.Warning) { fmt.Fprintf(out, "warning: %s\n", w) })
+	// Names repeat from line to line, so the lines share their literals.
+	interner := token.NewInterner()
+
+	// The VM keeps the session's globals by compiling every line against
+	// the same symbol table and constants and running it on the same
+	// globals store.
+	symbolTable := compiler.New().SymbolTable()
+	constants := []object.Object{}
+	globals := make([]object.Object, vm.GlobalSize)
 
 	for {
-		fmt.Print(PROMPT)
+		fmt.Fprint(out, PROMPT)
 		scanned := scanner.Scan()
 
 		if !scanned {
@@ -30,16 +72,57 @@ func Start(in io.Reader, out io.Writer) {
 
 		line := scanner.Text()
 
-		l := lexer.New(line)
+		if strings.HasPrefix(strings.TrimSpace(line), ":trace") {
+			setTrace(out, &opts, strings.TrimPrefix(strings.TrimSpace(line), ":trace"))
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), ":help") {
+			name := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), ":help"))
+			var value object.Object
+			if opts.Engine == "vm" {
+				value = lookupGlobal(name, symbolTable, globals)
+			} else {
+				value, _ = env.Get(name)
+			}
+			help(out, name, value)
+			continue
+		}
+
+		l := lexer.NewWithInterner(line, interner)
+		l.SetLang(opts.Lang)
 		p := parser.New(l)
+		if opts.TraceParser {
+			p.SetTrace(opts.Trace)
+		}
 
 		program := p.ParseProgram()
 		if len(p.Errors()) != 0 {
 			printParserErrors(out, p.Errors())
 			continue
 		}
+		for _, w := range p.Warnings() {
+			fmt.Fprintf(out, "warning: %s\n", w)
+		}
+
+		var evauluated object.Object
+		if opts.Engine == "vm" {
+			evauluated = runVM(program, symbolTable, &constants, globals)
+		} else {
+			if opts.TraceEval {
+				e.SetTrace(opts.Trace)
+			} else {
+				e.SetTrace(nil)
+			}
+			resolver.Resolve(program)
+			evauluated = e.Eval(program, env)
+			if err, ok := evauluated.(*object.Error); ok {
+				evauluated = e.Located(err)
+			}
+		}
 
-		evauluated := evaluator.Eval(program, env)
+		if _, ok := evauluated.(*object.Exit); ok {
+			return
+		}
 		if evauluated != nil {
 			io.WriteString(out, evauluated.Inspect())
 			io.WriteString(out, "\n")
@@ -48,6 +131,128 @@ func Start(in io.Reader, out io.Writer) {
 	}
 }
 
+// runVM compiles program against the session's symbol table and constants
+// and runs it on the globals. Like the evaluator it returns the value of a
+// final expression statement, an error or exit object, or nil.
+func runVM(program *ast.Program, symbolTable *compiler.SymbolTable, constants *[]object.Object, globals []object.Object) object.Object {
+	comp := compiler.NewWithState(symbolTable, *constants)
+	if err := comp.Compile(program); err != nil {
+		var compileErr *compiler.Error
+		if errors.As(err, &compileErr) {
+			return &object.Error{Message: compileErr.Message}
+		}
+		return &object.Error{Message: err.Error()}
+	}
+
+	bytecode := comp.Bytecode()
+	*constants = bytecode.Constants
+
+	machine := vm.NewWithGlobalsStore(bytecode, globals)
+	if err := machine.Run(); err != nil {
+		var exit *vm.ExitError
+		if errors.As(err, &exit) {
+			return &object.Exit{Code: exit.Code}
+		}
+		return &object.Error{Message: err.Error()}
+	}
+
+	n := len(program.Statements)
+	if n == 0 {
+		return nil
+	}
+	if _, ok := program.Statements[n-1].(*ast.ExpressionStatement); !ok {
+		return nil
+	}
+	return machine.LastPoppedStackElem()
+}
+
+// lookupGlobal returns the value of the VM session's global or builtin
+// name, or nil if it has none.
+func lookupGlobal(name string, symbolTable *compiler.SymbolTable, globals []object.Object) object.Object {
+	symbol, ok := symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope || symbol.Index >= len(globals) {
+		return nil
+	}
+	return globals[symbol.Index]
+}
+
+// help implements the :help command, printing the signature and docstring
+// of the function value bound to name, or of the builtin name if value is
+// nil.
+func help(out io.Writer, name string, value object.Object) {
+	if name == "" {
+		io.WriteString(out, "usage: :help name\n")
+		return
+	}
+	if value == nil {
+		if b, ok := evaluator.LookupBuiltin(name); ok {
+			value = b
+		}
+	}
+	if value == nil {
+		fmt.Fprintf(out, "%s is not defined\n", name)
+		return
+	}
+
+	params, doc, ok := evaluator.Describe(value)
+	if !ok {
+		fmt.Fprintf(out, "%s is not a function\n", name)
+		return
+	}
+	fmt.Fprintf(out, "%s(%s)\n", name, strings.Join(params, ", "))
+	if doc == "" {
+		doc = "No documentation."
+	}
+	for _, line := range strings.Split(doc, "\n") {
+		fmt.Fprintf(out, "    %s\n", line)
+	}
+}
+
+// setTrace implements the :trace command. Its argument is "on" or "off",
+// or the stages to trace: "parser", "eval" or "parser,eval".
+func setTrace(out io.Writer, opts *Options, arg string) {
+	if opts.Trace == nil {
+		io.WriteString(out, "tracing is not available\n")
+		return
+	}
+
+	switch arg = strings.TrimSpace(arg); arg {
+	case "":
+	case "on":
+		opts.TraceParser, opts.TraceEval = true, true
+	case "off":
+		opts.TraceParser, opts.TraceEval = false, false
+	default:
+		parser, eval := false, false
+		for _, stage := range strings.Split(arg, ",") {
+			switch strings.TrimSpace(stage) {
+			case "parser":
+				parser = true
+			case "eval":
+				eval = true
+			default:
+				io.WriteString(out, "usage: :trace [on|off|parser|eval|parser,eval]\n")
+				return
+			}
+		}
+		opts.TraceParser, opts.TraceEval = parser, eval
+	}
+
+	if opts.Engine == "vm" && opts.TraceEval {
+		opts.TraceEval = false
+		io.WriteString(out, "eval tracing is not available on the vm engine\n")
+	}
+
+	fmt.Fprintf(out, "trace: parser %s, eval %s\n", onOff(opts.TraceParser), onOff(opts.TraceEval))
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
 const MONKEY_FACE = `            __,__
    .--.  .-"     "-.  .--.
   / .. \/  .-. .-.  \/ .. \
@@ -0,0 +1,123 @@
+// Package resolver resolves the local variables of Monkey programs ahead
+// of evaluation. It annotates each identifier naming a parameter or a let
+// binding of an enclosing function with the variable's slot, so that the
+// evaluator reaches it by index instead of looking its name up in a map
+// at every step out through the enclosing scopes.
+//
+// Globals, builtins and the variables of unresolved functions stay looked
+// up by name, but the resolver gives calls of globals and builtins a cache
+// of the function called.
+package resolver
+
+import "github.com/frankie-mur/monkeylang/ast"
+
+// Resolve annotates the identifiers of node and sets the Locals of its
+// function literals and match arms. Resolving a node again is harmless.
+func Resolve(node ast.Node) {
+	ast.Walk(&scope{}, node)
+}
+
+// scope holds the locals of a function literal or a match arm, or of none
+// at the top level, where variables are globals.
+type scope struct {
+	outer  *scope
+	locals *[]string
+	slots  map[string]int
+}
+
+func (s *scope) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.FunctionLiteral:
+		return newScope(s, n)
+	case *ast.MatchArm:
+		return newArmScope(s, n)
+	case *ast.Identifier:
+		n.Slot = s.resolve(n.Value)
+	case *ast.CallExpression:
+		// Calls of globals and builtins get a cache of the function the
+		// name refers to; see the evaluator's callee.
+		if ident, ok := n.Function.(*ast.Identifier); ok && s.resolve(ident.Value) == nil && n.Cache == nil {
+			n.Cache = &ast.Cache{}
+		}
+	}
+	return s
+}
+
+// newScope returns the scope of fn, enclosed within outer. Its locals are
+// the parameters and every name the body binds with let, an enum statement
+// or a for loop, wherever in the body the binding is: the evaluator falls
+// back to the enclosing scopes for a variable whose slot is not bound yet.
+func newScope(outer *scope, fn *ast.FunctionLiteral) *scope {
+	fn.Locals = []string{}
+	s := &scope{outer: outer, locals: &fn.Locals, slots: make(map[string]int)}
+	for _, param := range fn.Parameters {
+		s.declare(param.Value)
+	}
+	if fn.Body != nil {
+		s.declareBindings(fn.Body)
+	}
+	return s
+}
+
+// newArmScope returns the scope of arm, enclosed within outer. Its locals
+// are the fields and the names the body binds, as for a function. The
+// pattern is not one, so it resolves to the variant the enclosing scopes
+// bind.
+func newArmScope(outer *scope, arm *ast.MatchArm) *scope {
+	arm.Locals = []string{}
+	s := &scope{outer: outer, locals: &arm.Locals, slots: make(map[string]int)}
+	for _, f := range arm.Fields {
+		s.declare(f.Value)
+	}
+	if arm.Body != nil {
+		s.declareBindings(arm.Body)
+	}
+	return s
+}
+
+// declareBindings declares the names body binds, but not those bound in
+// the nested functions and match arms, which are scopes of their own.
+func (s *scope) declareBindings(body *ast.BlockStatement) {
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.FunctionLiteral, *ast.MatchArm:
+			return false
+		case *ast.LetStatement:
+			if n.Name != nil {
+				s.declare(n.Name.Value)
+			}
+		case *ast.EnumStatement:
+			for _, variant := range n.Variants {
+				s.declare(variant.Name.Value)
+			}
+		case *ast.ForExpression:
+			if n.Key != nil {
+				s.declare(n.Key.Value)
+			}
+			if n.Value != nil {
+				s.declare(n.Value.Value)
+			}
+		}
+		return true
+	})
+}
+
+func (s *scope) declare(name string) {
+	if _, ok := s.slots[name]; ok {
+		return
+	}
+	s.slots[name] = len(*s.locals)
+	*s.locals = append(*s.locals, name)
+}
+
+// resolve returns the slot of the local name, or nil for a global.
+func (s *scope) resolve(name string) *ast.Slot {
+	depth := 0
+	for ; s.locals != nil; s = s.outer {
+		if index, ok := s.slots[name]; ok {
+			return &ast.Slot{Depth: depth, Index: index}
+		}
+		depth++
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package resolver_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/parser"
+	"github.com/frankie-mur/monkeylang/resolver"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parse errors: %v", p.Errors())
+	}
+	return program
+}
+
+func slot(depth, index int) *ast.Slot {
+	return &ast.Slot{Depth: depth, Index: index}
+}
+
+func TestResolve(t *testing.T) {
+	program := parse(t, `let g = 1; let f = fn(a, b) { let c = fn(d) { a + d + g }; if (a) { let e = c(b); } c };`)
+	resolver.Resolve(program)
+
+	var fns []*ast.FunctionLiteral
+	slots := map[string][]*ast.Slot{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.FunctionLiteral:
+			fns = append(fns, n)
+		case *ast.Identifier:
+			slots[n.Value] = append(slots[n.Value], n.Slot)
+		}
+		return true
+	})
+
+	if want := []string{"a", "b", "c", "e"}; !reflect.DeepEqual(fns[0].Locals, want) {
+		t.Errorf("wrong locals of f. want=%v, got=%v", want, fns[0].Locals)
+	}
+	if want := []string{"d"}; !reflect.DeepEqual(fns[1].Locals, want) {
+		t.Errorf("wrong locals of c. want=%v, got=%v", want, fns[1].Locals)
+	}
+
+	want := map[string][]*ast.Slot{
+		"g": {nil, nil},
+		"f": {nil},
+		"a": {slot(0, 0), slot(1, 0), slot(0, 0)},
+		"b": {slot(0, 1), slot(0, 1)},
+		"c": {slot(0, 2), slot(0, 2), slot(0, 2)},
+		"d": {slot(0, 0), slot(0, 0)},
+		"e": {slot(0, 3)},
+	}
+	if !reflect.DeepEqual(slots, want) {
+		for name, got := range slots {
+			if !reflect.DeepEqual(got, want[name]) {
+				t.Errorf("wrong slots of %s. want=%v, got=%v", name, want[name], got)
+			}
+		}
+	}
+}
+
+func TestResolveMatchArms(t *testing.T) {
+	program := parse(t, `enum Shape { Circle(r) } let f = fn(s, k) { match (s) { Circle(r) => { let d = r * k; d } } };`)
+	resolver.Resolve(program)
+
+	var arms []*ast.MatchArm
+	slots := map[string][]*ast.Slot{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.MatchArm:
+			arms = append(arms, n)
+		case *ast.Identifier:
+			slots[n.Value] = append(slots[n.Value], n.Slot)
+		}
+		return true
+	})
+
+	if want := []string{"r", "d"}; !reflect.DeepEqual(arms[0].Locals, want) {
+		t.Errorf("wrong locals of the arm. want=%v, got=%v", want, arms[0].Locals)
+	}
+
+	// The fields and lets of the arm are not locals of f, and the pattern
+	// and the variables of f are one scope out from the arm.
+	want := map[string][]*ast.Slot{
+		"Shape":  {nil},
+		"Circle": {nil, nil},
+		"r":      {nil, slot(0, 0), slot(0, 0)},
+		"f":      {nil},
+		"s":      {slot(0, 0), slot(0, 0)},
+		"k":      {slot(0, 1), slot(1, 1)},
+		"d":      {slot(0, 1), slot(0, 1)},
+	}
+	if !reflect.DeepEqual(slots, want) {
+		for name, got := range slots {
+			if !reflect.DeepEqual(got, want[name]) {
+				t.Errorf("wrong slots of %s. want=%v, got=%v", name, want[name], got)
+			}
+		}
+	}
+}
+
+func TestResolvedEvaluation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn(x) { let x = x + 1; x }; f(1)", "2"},
+		{"let adder = fn(x) { fn(y) { fn(z) { x + y + z } } }; adder(1)(2)(3)", "6"},
+		// A variable refers to the outer one until its let statement runs.
+		{"let x = 1; let f = fn() { let y = x; let x = 2; y + x }; f()", "3"},
+		{"let x = 1; let f = fn(c) { if (c) { let x = 2; } x }; [f(true), f(false)]", "[2, 1]"},
+		{"let f = fn() { let g = fn(n) { if (n == 0) { 0 } else { g(n - 1) } }; g(3) }; f()", "0"},
+		{"let f = fn(a, a) { a }; f(1, 2)", "2"},
+		{"let f = fn() { len }; f()", "builtin function"},
+		{"let f = fn() { y }; f()", "ERROR: identifier not found: y"},
+		// Binding a global invalidates the calls cached of it.
+		{"let f = fn() { 1 }; let g = fn() { f() }; let a = g(); let f = fn() { 2 }; [a, g()]", "[1, 2]"},
+		{`let g = fn() { len("ab") }; let a = g(); let len = fn(x) { 0 }; [a, g()]`, "[2, 0]"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		resolver.Resolve(program)
+		result := evaluator.Eval(program, object.NewEnvironment())
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. want=%s, got=%s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestCallCache(t *testing.T) {
+	program := parse(t, "let g = fn(n) { if (n == 0) { f() } else { g(n - 1) } }; g(3)")
+	resolver.Resolve(program)
+
+	// Scopes binding f differently do not share the function cached.
+	e := evaluator.New()
+	for i, src := range []string{"fn() { 1 }", "fn() { 2 }"} {
+		env := object.NewEnvironment()
+		evaluator.Eval(parse(t, "let f = "+src), env)
+		if got := e.Eval(program, env).Inspect(); got != src[7:8] {
+			t.Errorf("%d: wrong result %s", i, got)
+		}
+	}
+
+	// Cached calls count as the steps they save.
+	input := "let f = fn() { 1 }; let g = fn(n) { if (n == 0) { f() } else { g(n - 1) } }; g(3) + g(3)"
+	unresolved, resolved := parse(t, input), parse(t, input)
+	resolver.Resolve(resolved)
+	var steps [2]int64
+	for i, p := range []*ast.Program{unresolved, resolved} {
+		e := evaluator.New()
+		e.Eval(p, object.NewEnvironment())
+		steps[i] = e.Stats().Steps
+	}
+	if steps[0] != steps[1] {
+		t.Errorf("resolving changes the steps. unresolved=%d, resolved=%d", steps[0], steps[1])
+	}
+}
+
+func TestConcurrentEvaluation(t *testing.T) {
+	// Evaluators share the caches of a program's call sites.
+	program := parse(t, "let g = fn(n) { if (n == 0) { len([1]) } else { g(n - 1) + 1 } }; g(50)")
+	resolver.Resolve(program)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := evaluator.Eval(program, object.NewEnvironment()).Inspect(); got != "51" {
+				t.Errorf("wrong result %s", got)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/frankie-mur/monkeylang/compiler"
+	"github.com/frankie-mur/monkeylang/cover"
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/inspector"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/parser"
+	"github.com/frankie-mur/monkeylang/resolver"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// Process exit codes. They follow the BSD sysexits convention so they do not
+// collide with the small codes scripts typically pass to exit().
+const (
+	exitOK           = 0
+	exitUsage        = 64 // bad command line or unreadable input
+	exitParseError   = 65 // the program failed to parse
+	exitRuntimeError = 70 // evaluation produced an error
+)
+
+// runOptions are the settings of `monkey run` that affect how a program is
+// parsed and evaluated.
+type runOptions struct {
+	engine   engineFlag
+	lang     token.Lang // the language version the program is read as; zero is the latest
+	strict   bool       // fail programs that have warnings
+	optimize bool
+	dump     bool
+	cacheDir string // where to cache the bytecode of VM programs; "" disables the cache
+	trace    traceFlag
+	limits   evaluator.Limits
+	timeout  time.Duration
+	cover    *cover.Profile // records the statements the program runs, if not nil
+	name     string         // the program's file name in coverage reports
+	inspect  string         // the address to serve an inspector on, or ""
+}
+
+// run parses and evaluates a complete program, on the engine selected in
+// opts, and returns the process exit code. Parser errors, runtime errors and
+// traces are written to errOut; the program's own output goes to stdout
+// through the builtins. The program stops with an error once ctx is done.
+func run(ctx context.Context, src string, opts runOptions, errOut io.Writer) int {
+	useCache := opts.engine == engineVM && opts.cacheDir != "" && !opts.trace.parser
+	if useCache {
+		if bytecode, ok := loadCached(opts.cacheDir, src, opts.lang); ok {
+			return runVM(ctx, bytecode, opts, errOut)
+		}
+	}
+
+	l := lexer.New(stripShebang(src))
+	l.SetLang(opts.lang)
+	p := parser.New(l)
+	if opts.trace.parser {
+		p.SetTrace(errOut)
+	}
+	// The program lives as long as the run, so its nodes may as well be
+	// allocated together.
+	p.SetArena(true)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		io.WriteString(errOut, "parser errors:\n")
+		for _, msg := range p.Errors() {
+			io.WriteString(errOut, "\t"+msg+"\n")
+		}
+		return exitParseError
+	}
+	for _, w := range p.Warnings() {
+		fmt.Fprintf(errOut, "warning: %s\n", w)
+	}
+	if opts.strict && len(p.Warnings()) != 0 {
+		return exitParseError
+	}
+
+	if opts.engine == engineVM {
+		bytecode, ok := compileProgram(program, errOut)
+		if !ok {
+			return exitParseError
+		}
+		// A cached program is not parsed, so one with warnings is not
+		// cached for them to be reported every time.
+		if useCache && len(p.Warnings()) == 0 {
+			storeCached(opts.cacheDir, src, opts.lang, bytecode)
+		}
+		return runVM(ctx, bytecode, opts, errOut)
+	}
+
+	resolver.Resolve(program)
+	e := evaluator.New()
+	if opts.trace.eval {
+		e.SetTrace(errOut)
+	}
+	e.SetLimits(opts.limits)
+	warnings := 0
+	e.SetWarn(func(w evaluator.Warning) {
+		warnings++
+		fmt.Fprintf(errOut, "warning: %s\n", w)
+	})
+	if opts.cover != nil {
+		opts.cover.Add(opts.name, src, program)
+		e.SetHook(opts.cover.Hook)
+	}
+	if opts.inspect != "" {
+		l, err := net.Listen("tcp", inspectAddr(opts.inspect))
+		if err != nil {
+			fmt.Fprintf(errOut, "monkey run: %s\n", err)
+			return exitUsage
+		}
+		defer l.Close()
+		token, err := newToken()
+		if err != nil {
+			fmt.Fprintf(errOut, "monkey run: %s\n", err)
+			return exitUsage
+		}
+		fmt.Fprintf(errOut, "inspector listening on %s with token %s\n", l.Addr(), token)
+		in := inspector.New(src)
+		in.SetToken(token)
+		in.Attach(e)
+		defer in.Finish()
+		go in.Serve(l)
+	}
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+	e.SetContext(ctx)
+
+	env := object.NewEnvironment()
+	evaluated := e.Eval(program, env)
+
+	code := exitOK
+	switch evaluated := evaluated.(type) {
+	case *object.Error:
+		io.WriteString(errOut, e.Located(evaluated).Inspect())
+		io.WriteString(errOut, "\n")
+		code = exitRuntimeError
+	case *object.Exit:
+		code = int(evaluated.Code)
+	}
+	if code == exitOK && opts.strict && warnings != 0 {
+		code = exitRuntimeError
+	}
+	return code
+}
+
+// inspectAddr returns the address --inspect serves on: addr, on the
+// loopback interface if it names no host, so that only local clients can
+// connect unless asked otherwise.
+func inspectAddr(addr string) string {
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		return net.JoinHostPort("127.0.0.1", port)
+	}
+	return addr
+}
+
+// newToken returns a random token for inspector clients to authenticate
+// with.
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// runBytecode runs a program compiled by `monkey compile` on the VM and
+// returns the process exit code. Load and runtime errors are written to
+// errOut.
+func runBytecode(ctx context.Context, data []byte, opts runOptions, errOut io.Writer) int {
+	bytecode, err := compiler.Load(bytes.NewReader(data))
+	if err != nil {
+		fmt.Fprintf(errOut, "monkey: %s\n", err)
+		return exitUsage
+	}
+	return runVM(ctx, bytecode, opts, errOut)
+}
+
+// stripShebang blanks out a leading "#!" interpreter line so executable
+// scripts starting with "#!/usr/bin/env monkey" can be run directly. The
+// newline is kept so line numbers in the rest of the file are unchanged.
+func stripShebang(src string) string {
+	if !strings.HasPrefix(src, "#!") {
+		return src
+	}
+	if i := strings.IndexByte(src, '\n'); i >= 0 {
+		return src[i:]
+	}
+	return ""
+}
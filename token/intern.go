@@ -0,0 +1,31 @@
+package token
+
+import "strings"
+
+// Interner makes equal strings share one copy. The lexer interns the
+// literals of identifiers, numbers and strings, so that names repeated
+// throughout a program are stored once, compare equal at the first
+// pointer check and do not keep the source they were read from alive.
+type Interner struct {
+	strings map[string]string
+}
+
+// NewInterner returns an empty Interner.
+func NewInterner() *Interner {
+	return &Interner{strings: make(map[string]string)}
+}
+
+// Intern returns the copy of s shared by every string equal to it.
+func (in *Interner) Intern(s string) string {
+	if interned, ok := in.strings[s]; ok {
+		return interned
+	}
+	s = strings.Clone(s)
+	in.strings[s] = s
+	return s
+}
+
+// Len returns the number of distinct strings interned.
+func (in *Interner) Len() int {
+	return len(in.strings)
+}
@@ -0,0 +1,72 @@
+package token
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Lang is a version of the Monkey language. Later versions add keywords and
+// operators. Lexing for an earlier version reads their spellings as it always
+// has, so a script that uses a newer keyword as an identifier keeps working
+// when it is run as the version it was written for.
+type Lang int
+
+const (
+	Lang1 Lang = 1 // the language of the book
+	Lang2 Lang = 2 // the language with the syntax added since
+
+	LangLatest = Lang2
+)
+
+// since holds the version that introduced each keyword and operator added
+// after Lang1.
+var since = map[TokenType]Lang{
+	ENUM:    Lang2,
+	MATCH:   Lang2,
+	ARROW:   Lang2,
+	WHILE:   Lang2,
+	FOR:     Lang2,
+	IN:      Lang2,
+	SWITCH:  Lang2,
+	CASE:    Lang2,
+	DEFAULT: Lang2,
+	FLOAT:   Lang2,
+	AND:     Lang2,
+	OR:      Lang2,
+
+	PLUS_ASSIGN:     Lang2,
+	MINUS_ASSIGN:    Lang2,
+	ASTERISK_ASSIGN: Lang2,
+	SLASH_ASSIGN:    Lang2,
+
+	INCREMENT: Lang2,
+	DECREMENT: Lang2,
+
+	AMPERSAND:   Lang2,
+	PIPE:        Lang2,
+	CARET:       Lang2,
+	TILDE:       Lang2,
+	SHIFT_LEFT:  Lang2,
+	SHIFT_RIGHT: Lang2,
+}
+
+// Since returns the language version that introduced tokens of type t.
+func Since(t TokenType) Lang {
+	if lang, ok := since[t]; ok {
+		return lang
+	}
+	return Lang1
+}
+
+// ParseLang parses a language version such as "1".
+func ParseLang(s string) (Lang, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < int(Lang1) || n > int(LangLatest) {
+		return 0, fmt.Errorf("unknown language version %q (want %d to %d)", s, Lang1, LangLatest)
+	}
+	return Lang(n), nil
+}
+
+func (l Lang) String() string {
+	return strconv.Itoa(int(l))
+}
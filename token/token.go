@@ -1,14 +1,18 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT" // collected by the lexer, never returned by NextToken
 
 	// Identifiers + literals
 	IDENT  = "IDENT"  // add, foobar, x, y, ...
 	INT    = "INT"    // 1343456
+	FLOAT  = "FLOAT"  // 3.14
 	STRING = "STRING" // "foobar"
 
 	// Operators
@@ -25,6 +29,26 @@ const (
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	AND = "&&"
+	OR  = "||"
+
+	ARROW = "=>"
+
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+
+	INCREMENT = "++"
+	DECREMENT = "--"
+
+	AMPERSAND   = "&"
+	PIPE        = "|"
+	CARET       = "^"
+	TILDE       = "~"
+	SHIFT_LEFT  = "<<"
+	SHIFT_RIGHT = ">>"
+
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
@@ -45,25 +69,71 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	ENUM     = "ENUM"
+	MATCH    = "MATCH"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	SWITCH   = "SWITCH"
+	CASE     = "CASE"
+	DEFAULT  = "DEFAULT"
 )
 
+// Position is a location in the source. Offset counts bytes from the start
+// of the input, Line and Column count from 1.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// IsValid reports whether the position was set by the lexer.
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Token is a lexical token. Pos and End span the token's text in the source:
+// Pos is its first character and End the position just after its last one.
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
+	End     Position
 }
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":      FUNCTION,
+	"let":     LET,
+	"true":    TRUE,
+	"false":   FALSE,
+	"if":      IF,
+	"else":    ELSE,
+	"return":  RETURN,
+	"enum":    ENUM,
+	"match":   MATCH,
+	"while":   WHILE,
+	"for":     FOR,
+	"in":      IN,
+	"switch":  SWITCH,
+	"case":    CASE,
+	"default": DEFAULT,
 }
 
+// LookupIdent returns the keyword type of ident in the latest language
+// version, or IDENT if it is not a keyword.
 func LookupIdent(ident string) TokenType {
-	if tok, ok := keywords[ident]; ok {
+	return LookupIdentIn(ident, LangLatest)
+}
+
+// LookupIdentIn is like LookupIdent for version lang, in which keywords
+// introduced later are identifiers.
+func LookupIdentIn(ident string, lang Lang) TokenType {
+	if tok, ok := keywords[ident]; ok && Since(tok) <= lang {
 		return tok
 	}
 	return IDENT
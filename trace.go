@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// traceFlag is the value of --trace: a comma-separated list of the stages
+// to trace, "parser" and "eval".
+type traceFlag struct {
+	parser bool
+	eval   bool
+}
+
+func (t *traceFlag) String() string {
+	var stages []string
+	if t.parser {
+		stages = append(stages, "parser")
+	}
+	if t.eval {
+		stages = append(stages, "eval")
+	}
+	return strings.Join(stages, ",")
+}
+
+func (t *traceFlag) Set(value string) error {
+	*t = traceFlag{}
+	for _, stage := range strings.Split(value, ",") {
+		switch strings.TrimSpace(stage) {
+		case "parser":
+			t.parser = true
+		case "eval":
+			t.eval = true
+		default:
+			return fmt.Errorf("unknown trace stage %q (want parser or eval)", stage)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,567 @@
+// Package transpile translates Monkey programs into the source code of
+// other languages, so they can be built with those languages' tools.
+//
+// Translation follows the compiler's rules for names: identifiers are
+// resolved where they appear, so a program the compiler rejects for an
+// unknown identifier is rejected here too.
+package transpile
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// Error is a construct that cannot be translated, at the position of the
+// offending node.
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Message
+}
+
+func errorf(node ast.Node, format string, args ...interface{}) error {
+	return &Error{Pos: node.Pos(), Message: fmt.Sprintf(format, args...)}
+}
+
+// operators maps the infix operators to the runtime functions applying
+// them, which every runtime names the same.
+var operators = map[string]string{
+	"+":  "add",
+	"-":  "sub",
+	"*":  "mul",
+	"/":  "div",
+	"<":  "lt",
+	">":  "gt",
+	"==": "eq",
+	"!=": "neq",
+	"&":  "bitAnd",
+	"|":  "bitOr",
+	"^":  "bitXor",
+	"<<": "shiftLeft",
+	">>": "shiftRight",
+}
+
+// dialect is how a target language spells the statements and values the
+// generator emits. The fields ending in a format are fmt formats; their
+// comments list the operands.
+type dialect struct {
+	indent string
+	null   string
+	quote  func(s string) string
+	// builtins maps the builtins the runtime implements to the variables
+	// that hold them.
+	builtins map[string]string
+
+	integerFormat  string // the int64
+	arrayFormat    string // the elements, separated by commas
+	functionFormat string // the arity, the quoted source, the body and the indentation of its end
+	defineFormat   string // a new temporary and its value
+	declareFormat  string // a variable for a let or if expression, which starts as null
+	paramFormat    string // the variable of a parameter and its index
+	assignFormat   string // a variable and its value
+	discardFormat  string // a value that is not used, or empty if it need not be mentioned
+	returnFormat   string // the value
+	ifFormat       string // the condition
+	elseLine       string
+	endLine        string
+	loopLine       string // the start of an endless loop
+	unlessFormat   string // the condition, of an if statement taken when it is not truthy
+	breakLine      string
+}
+
+// generator translates Monkey in A-normal form: every expression that does
+// more than name a value is stored in a temporary first, so the program
+// evaluates expressions in the same order as the interpreter even when an
+// if expression has to become an if statement.
+type generator struct {
+	*dialect
+	out   *bytes.Buffer // the body of the function being translated
+	depth int           // the indentation of the next line
+	scope *scope
+	names int // variables and temporaries so far, to number them
+}
+
+// scope maps the names a Monkey function defines to variables. Like the
+// compiler, a let binding a name again within the same function reuses its
+// variable.
+type scope struct {
+	outer *scope
+	vars  map[string]string
+	// decls are the variables of lets, declared at the top of the function
+	// as a let may be nested in an if block yet visible after it.
+	decls []string
+}
+
+// line writes a line of the given format at the current indentation.
+func (g *generator) line(format string, args ...interface{}) {
+	g.out.WriteString(strings.Repeat(g.indent, g.depth))
+	fmt.Fprintf(g.out, format, args...)
+	g.out.WriteByte('\n')
+}
+
+func (g *generator) temp() string {
+	g.names++
+	return "t" + strconv.Itoa(g.names)
+}
+
+// define returns the variable of name in the current function, adding one
+// if the function has none yet.
+func (g *generator) define(name string, let bool) string {
+	if v, ok := g.scope.vars[name]; ok {
+		return v
+	}
+	g.names++
+	v := name + "_" + strconv.Itoa(g.names)
+	g.scope.vars[name] = v
+	if let {
+		g.scope.decls = append(g.scope.decls, v)
+	}
+	return v
+}
+
+func (g *generator) resolve(ident *ast.Identifier) (string, error) {
+	for s := g.scope; s != nil; s = s.outer {
+		if v, ok := s.vars[ident.Value]; ok {
+			return v, nil
+		}
+	}
+	if v, ok := g.builtins[ident.Value]; ok {
+		return v, nil
+	}
+	return "", errorf(ident, "identifier not found: %s", ident.Value)
+}
+
+// function translates the parameters and body of a function to the body
+// of a function of the target language taking its arguments as args.
+func (g *generator) function(params []*ast.Identifier, body []ast.Statement) (string, error) {
+	out := g.out
+	g.out = &bytes.Buffer{}
+	g.scope = &scope{outer: g.scope, vars: make(map[string]string)}
+	g.depth++
+	defer func() { g.out, g.scope = out, g.scope.outer; g.depth-- }()
+
+	// The parameters are defined before the body is translated, but the
+	// variables of its lets are only known after.
+	for i, param := range params {
+		if v, ok := g.scope.vars[param.Value]; ok {
+			// The last of several parameters with the same name wins.
+			g.line(g.assignFormat, v, "args["+strconv.Itoa(i)+"]")
+			continue
+		}
+		g.line(g.paramFormat, g.define(param.Value, false), i)
+	}
+	prologue := g.out
+
+	g.out = &bytes.Buffer{}
+	value, err := g.block(body)
+	if err != nil {
+		return "", err
+	}
+	g.line(g.returnFormat, value)
+
+	code := g.out
+	g.out = prologue
+	for _, v := range g.scope.decls {
+		g.line(g.declareFormat, v)
+	}
+	return prologue.String() + code.String(), nil
+}
+
+// block translates statements and returns the expression holding their
+// value: that of the last statement if it is an expression, else null.
+func (g *generator) block(stmts []ast.Statement) (string, error) {
+	for i, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			if err := g.let(stmt); err != nil {
+				return "", err
+			}
+
+		case *ast.ReturnStatement:
+			value, err := g.expr(stmt.ReturnValue)
+			if err != nil {
+				return "", err
+			}
+			// Whatever follows a return never runs.
+			g.line(g.returnFormat, value)
+			return g.null, nil
+
+		case *ast.ExpressionStatement:
+			value, err := g.expr(stmt.Expression)
+			if err != nil {
+				return "", err
+			}
+			if i == len(stmts)-1 {
+				return value, nil
+			}
+			if g.discardFormat != "" && value != g.null {
+				g.line(g.discardFormat, value)
+			}
+
+		default:
+			return "", errorf(stmt, "cannot translate %s", construct(stmt))
+		}
+	}
+	return g.null, nil
+}
+
+func (g *generator) let(stmt *ast.LetStatement) error {
+	// A function may call itself by the name it is bound to, so the name
+	// is defined before the function is translated.
+	if _, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		v := g.define(stmt.Name.Value, true)
+		value, err := g.expr(stmt.Value)
+		if err != nil {
+			return err
+		}
+		g.line(g.assignFormat, v, value)
+		return nil
+	}
+
+	value, err := g.expr(stmt.Value)
+	if err != nil {
+		return err
+	}
+	g.line(g.assignFormat, g.define(stmt.Name.Value, true), value)
+	return nil
+}
+
+// expr translates an expression and returns an expression for its value
+// that has no side effects: a literal, a variable, a temporary or a
+// function literal.
+func (g *generator) expr(node ast.Expression) (string, error) {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return fmt.Sprintf(g.integerFormat, node.Value), nil
+
+	case *ast.StringLiteral:
+		return g.quote(node.Value), nil
+
+	case *ast.Boolean:
+		return strconv.FormatBool(node.Value), nil
+
+	case *ast.Identifier:
+		return g.resolve(node)
+
+	case *ast.AssignExpression:
+		return g.assignExpr(node)
+
+	case *ast.PostfixExpression:
+		return g.postfixExpr(node)
+
+	case *ast.PrefixExpression:
+		right, err := g.expr(node.Right)
+		if err != nil {
+			return "", err
+		}
+		switch node.Operator {
+		case "!":
+			return g.assign("not(%s)", right), nil
+		case "-":
+			if lit, ok := node.Right.(*ast.IntegerLiteral); ok {
+				return fmt.Sprintf(g.integerFormat, -lit.Value), nil
+			}
+			return g.assign("neg(%s)", right), nil
+		case "~":
+			return g.assign("bitNot(%s)", right), nil
+		}
+		return "", errorf(node, "unknown operator: %s", node.Operator)
+
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return g.logicalExpr(node)
+		}
+		op, ok := operators[node.Operator]
+		if !ok {
+			return "", errorf(node, "unknown operator: %s", node.Operator)
+		}
+		left, err := g.expr(node.Left)
+		if err != nil {
+			return "", err
+		}
+		right, err := g.expr(node.Right)
+		if err != nil {
+			return "", err
+		}
+		return g.assign("%s(%s, %s)", op, left, right), nil
+
+	case *ast.IfExpression:
+		return g.ifExpr(node)
+
+	case *ast.WhileExpression:
+		return g.whileExpr(node)
+
+	case *ast.FunctionLiteral:
+		body, err := g.function(node.Parameters, node.Body.Statements)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(g.functionFormat, len(node.Parameters), g.quote(functionSource(node)),
+			body, strings.Repeat(g.indent, g.depth)), nil
+
+	case *ast.CallExpression:
+		fn, err := g.expr(node.Function)
+		if err != nil {
+			return "", err
+		}
+		args, err := g.exprs(node.Arguments)
+		if err != nil {
+			return "", err
+		}
+		return g.assign("call(%s)", strings.Join(append([]string{fn}, args...), ", ")), nil
+
+	case *ast.ArrayLiteral:
+		elements, err := g.exprs(node.Elements)
+		if err != nil {
+			return "", err
+		}
+		return g.assign(g.arrayFormat, strings.Join(elements, ", ")), nil
+
+	case *ast.HashLiteral:
+		var pairs []string
+		for _, keyNode := range node.Keys {
+			key, err := g.expr(keyNode)
+			if err != nil {
+				return "", err
+			}
+			key = g.assign("checkKey(%s)", key)
+			value, err := g.expr(node.Pairs[keyNode])
+			if err != nil {
+				return "", err
+			}
+			pairs = append(pairs, key, value)
+		}
+		return g.assign("newHash(%s)", strings.Join(pairs, ", ")), nil
+
+	case *ast.IndexExpression:
+		left, err := g.expr(node.Left)
+		if err != nil {
+			return "", err
+		}
+		index, err := g.expr(node.Index)
+		if err != nil {
+			return "", err
+		}
+		return g.assign("index(%s, %s)", left, index), nil
+
+	default:
+		return "", errorf(node, "cannot translate %s", construct(node))
+	}
+}
+
+func (g *generator) exprs(nodes []ast.Expression) ([]string, error) {
+	values := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		value, err := g.expr(node)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// assign stores the expression format describes in a new temporary and
+// returns the temporary.
+func (g *generator) assign(format string, args ...interface{}) string {
+	t := g.temp()
+	g.line(g.defineFormat, t, fmt.Sprintf(format, args...))
+	return t
+}
+
+// assignExpr translates an assignment to a variable of the current function
+// or an enclosing one. The variables of the target language's closures are
+// shared with the enclosing function, like the interpreter's.
+func (g *generator) assignExpr(node *ast.AssignExpression) (string, error) {
+	var v string
+	for s := g.scope; s != nil && v == ""; s = s.outer {
+		v = s.vars[node.Name.Value]
+	}
+
+	// A compound assignment reads the variable before evaluating the value,
+	// which may assign it too.
+	var current string
+	if node.Operator != "" {
+		if v == "" {
+			return "", errorf(node, "identifier not found: %s", node.Name.Value)
+		}
+		current = g.assign("%s", v)
+	}
+	value, err := g.expr(node.Value)
+	if err != nil {
+		return "", err
+	}
+	if node.Operator != "" {
+		op, ok := operators[node.Operator]
+		if !ok {
+			return "", errorf(node, "unknown operator: %s", node.Operator)
+		}
+		value = g.assign("%s(%s, %s)", op, current, value)
+	}
+
+	if v == "" {
+		return "", errorf(node, "identifier not found: %s", node.Name.Value)
+	}
+	g.line(g.assignFormat, v, value)
+	return v, nil
+}
+
+// postfixExpr translates x++ or x-- on a variable, whose value before the
+// change it snapshots into a temporary.
+func (g *generator) postfixExpr(node *ast.PostfixExpression) (string, error) {
+	name, ok := node.Target.(*ast.Identifier)
+	if !ok {
+		return "", errorf(node, "cannot translate %s on an element", node.Operator)
+	}
+	var v string
+	for s := g.scope; s != nil && v == ""; s = s.outer {
+		v = s.vars[name.Value]
+	}
+	if v == "" {
+		return "", errorf(node, "identifier not found: %s", name.Value)
+	}
+
+	current := g.assign("%s", v)
+	g.line(g.assignFormat, v, fmt.Sprintf("%s(%s, %s)", operators[node.Operator[:1]], current, fmt.Sprintf(g.integerFormat, 1)))
+	return current, nil
+}
+
+// logicalExpr translates a && or || expression to an if statement that
+// evaluates the right operand only when the left one does not decide the
+// result, which is a boolean.
+func (g *generator) logicalExpr(node *ast.InfixExpression) (string, error) {
+	left, err := g.expr(node.Left)
+	if err != nil {
+		return "", err
+	}
+	t := g.temp()
+	g.line(g.declareFormat, t)
+	if node.Operator == "&&" {
+		g.line(g.assignFormat, t, "false")
+		g.line(g.ifFormat, left)
+	} else {
+		g.line(g.assignFormat, t, "true")
+		g.line(g.unlessFormat, left)
+	}
+
+	g.depth++
+	right, err := g.expr(node.Right)
+	if err != nil {
+		return "", err
+	}
+	g.line(g.assignFormat, t, "truthy("+right+")")
+	g.depth--
+	g.line(g.endLine)
+	return t, nil
+}
+
+// ifExpr translates an if expression to an if statement that stores the
+// value of the branch taken in a temporary. Return statements in the
+// branches return from the enclosing function, as they should.
+func (g *generator) ifExpr(node *ast.IfExpression) (string, error) {
+	cond, err := g.expr(node.Condition)
+	if err != nil {
+		return "", err
+	}
+	t := g.temp()
+	g.line(g.declareFormat, t)
+	g.line(g.ifFormat, cond)
+
+	branch := func(block *ast.BlockStatement) error {
+		g.depth++
+		defer func() { g.depth-- }()
+		value, err := g.block(block.Statements)
+		if err != nil {
+			return err
+		}
+		if value != g.null {
+			g.line(g.assignFormat, t, value)
+		}
+		return nil
+	}
+	if err := branch(node.Consequence); err != nil {
+		return "", err
+	}
+	if node.Alternative != nil {
+		g.line(g.elseLine)
+		if err := branch(node.Alternative); err != nil {
+			return "", err
+		}
+	}
+	g.line(g.endLine)
+	return t, nil
+}
+
+// whileExpr translates a while loop to an endless loop that breaks once its
+// condition is not truthy. The condition is translated inside the loop, so
+// that it is evaluated again on every iteration. The loop's value is null.
+func (g *generator) whileExpr(node *ast.WhileExpression) (string, error) {
+	body := func() error {
+		g.depth++
+		defer func() { g.depth-- }()
+
+		cond, err := g.expr(node.Condition)
+		if err != nil {
+			return err
+		}
+		g.line(g.unlessFormat, cond)
+		g.depth++
+		g.line(g.breakLine)
+		g.depth--
+		g.line(g.endLine)
+
+		value, err := g.block(node.Body.Statements)
+		if err != nil {
+			return err
+		}
+		if value != g.null && g.discardFormat != "" {
+			g.line(g.discardFormat, value)
+		}
+		return nil
+	}
+
+	g.line(g.loopLine)
+	if err := body(); err != nil {
+		return "", err
+	}
+	g.line(g.endLine)
+	return g.null, nil
+}
+
+// construct names a node the generator cannot translate as the language
+// documentation does.
+func construct(node ast.Node) string {
+	switch node.(type) {
+	case *ast.FloatLiteral:
+		return "float literal"
+	case *ast.ForExpression:
+		return "for loop"
+	case *ast.SwitchExpression:
+		return "switch expression"
+	case *ast.SliceExpression:
+		return "slice expression"
+	case *ast.MatchExpression:
+		return "match expression"
+	case *ast.EnumStatement:
+		return "enum statement"
+	default:
+		return node.TokenLiteral() + " expression"
+	}
+}
+
+// functionSource is what the interpreter prints for a function value.
+func functionSource(fn *ast.FunctionLiteral) string {
+	params := make([]string, len(fn.Parameters))
+	for i, p := range fn.Parameters {
+		params[i] = p.String()
+	}
+	return "fn(" + strings.Join(params, ", ") + ") {\n" + fn.Body.String() + "\n}"
+}
@@ -0,0 +1,119 @@
+package transpile
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/frankie-mur/monkeylang/ast"
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.ParseErrors(); len(errs) != 0 {
+		t.Fatalf("%q: parse errors: %v", input, errs)
+	}
+	return program
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"puts(y);", "1:6: identifier not found: y"},
+		{"let f = fn() { g() };\nlet g = fn() { 1 };", "1:16: identifier not found: g"},
+		{"let f = fn(x) { x };\nx", "2:1: identifier not found: x"},
+		{"enum E { A }", "1:1: cannot translate enum statement"},
+		{"match (1) { _ => { 1 } }", "1:1: cannot translate match expression"},
+		{"puts(1.5);", "1:6: cannot translate float literal"},
+		{"for (x in [1]) { puts(x) }", "1:1: cannot translate for loop"},
+		{"switch (1) { case 1: { 2 } }", "1:1: cannot translate switch expression"},
+		{"let a = [1, 2]; a[0:1]", "1:17: cannot translate slice expression"},
+	}
+
+	for _, tt := range tests {
+		for name, translate := range map[string]func(*ast.Program) ([]byte, error){"Go": Go, "JS": JS} {
+			_, err := translate(parse(t, tt.input))
+			var transpileErr *Error
+			if !errors.As(err, &transpileErr) || err.Error() != tt.expected {
+				t.Errorf("%s %q: wrong error. want=%q, got=%v", name, tt.input, tt.expected, err)
+			}
+		}
+	}
+}
+
+// programs are run both by the evaluator and translated, and the
+// translations must print the same and fail the same way.
+var programs = []string{
+	`let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; puts(fib(20));`,
+	`let map = fn(arr, f) {
+	   if (len(arr) == 0) { [] } else { let h = f(first(arr)); push(map(rest(arr), f), h) }
+	 };
+	 puts(map([1, 2, 3], fn(x) { x * 2 }));`,
+	`let adder = fn(a) { fn(b) { a + b } }; let addTwo = adder(2); puts(addTwo(3), adder(10)(-4));`,
+	`let h = {"a": 1, 2: true, false: "no"}; puts(h["a"], h[2], h[false], h["zz"]);`,
+	`puts(fn(x, y) { x + y }, len, -5, !true, !5, !!0, "s" + "t", "a" == "a", "a" != "b");`,
+	`puts(1 == 1, [1] == [1], true != false, 1 == true, 3 > 2, 3 < 2, 7 / 2, 2 * -3);`,
+	`let a = [1, 2, 3]; puts(a[0], a[3], a[-1], last(a), rest(a), rest([]), first([]));`,
+	`puts(if (false) { 1 }, if (1) { "yes" } else { "no" }, if (!true) { 1 } else { 2 });`,
+	`let a = [1, 2]; puts(a + [3], [] + a, a * 2, a * 0, [] * 3, a);`,
+	`[1] * -1;`,
+	`[1] + 1;`,
+	`[1] * [1];`,
+	`let f = fn() { let x = 1; if (x > 0) { return "early"; } "late" }; puts(f());`,
+	`if (true) { let z = 9; } puts(z);`,
+	`let x = 1; let get = fn() { x }; let x = 2; puts(get());`,
+	`let r = fn(x, x) { x }; puts(r(1, 2));`,
+	`assert_eq([1, {"k": 2}], [1, {"k": 2}]); assert(1 < 2, "math"); puts("ok");`,
+	`puts("before"); return 5; puts("after");`,
+	`puts(1); exit(3); puts(2);`,
+	`puts("x"); 1 + true;`,
+	`"a" - "b";`,
+	`-true;`,
+	`{[1]: 2};`,
+	`{}[fn(x) { x }];`,
+	`1[0];`,
+	`5();`,
+	`assert(false, "broken");`,
+	`assert_eq([1, 2], [1, 3]);`,
+	`len(1);`,
+	`push(1, 2);`,
+	`exit("no");`,
+	`let n = 0; let acc = []; while (n < 4) { let acc = push(acc, n * n); let n = n + 1; } puts(acc, while (false) { 1 });`,
+	`let f = fn() { let i = 0; while (true) { let i = i + 1; if (i == 3) { return i; } i } }; puts(f());`,
+	`let a = 1; let b = 2; puts(a = b = 3, a + b);`,
+	`let counter = fn() { let n = 0; fn() { n = n + 1 } }; let c = counter(); c(); puts(c(), counter()());`,
+	`let i = 0; let s = ""; while (i < 3) { s = s + "ab"; i = i + 1 } puts(s);`,
+	`let n = 0; let f = fn(v) { n += 1; v }; puts(f(false) && f(1), f(0) || f(true), f(false) || f(0), n);`,
+	`let x = 10; x += 5; x -= 3; x *= 4; x /= 6; puts(x); puts(x += x += 2);`,
+	`let i = 0; let j = i++; i++; let k = i--; let f = fn() { let n = 5; n--; n }; puts(i, j, k, f());`,
+	`let s = "a"; s++;`,
+	`let m = 12; puts(m & 10, m | 3, m ^ 5, 1 << 62, m >> 2, -m >> 1, ~m, 1 << 64, -1 >> 99);`,
+	`1 << -2;`,
+	`~"a";`,
+	`true | false;`,
+}
+
+// interpret runs input with the evaluator and returns what it printed and
+// the exit code and error message `monkey run` would report.
+func interpret(t *testing.T, input string) (string, int, string) {
+	var out bytes.Buffer
+	defer func(w io.Writer) { evaluator.Output = w }(evaluator.Output)
+	evaluator.Output = &out
+
+	switch obj := evaluator.Eval(parse(t, input), object.NewEnvironment()).(type) {
+	case *object.Error:
+		return out.String(), 70, obj.Inspect() + "\n"
+	case *object.Exit:
+		return out.String(), int(obj.Code), ""
+	}
+	return out.String(), 0, ""
+}
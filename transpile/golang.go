@@ -0,0 +1,72 @@
+package transpile
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+
+	"github.com/frankie-mur/monkeylang/ast"
+)
+
+//go:embed goruntime.go
+var goRuntime string
+
+var goDialect = &dialect{
+	indent: "\t",
+	null:   "nil",
+	quote:  strconv.Quote,
+	builtins: map[string]string{
+		"puts":      "builtinPuts",
+		"len":       "builtinLen",
+		"first":     "builtinFirst",
+		"last":      "builtinLast",
+		"rest":      "builtinRest",
+		"push":      "builtinPush",
+		"exit":      "builtinExit",
+		"assert":    "builtinAssert",
+		"assert_eq": "builtinAssertEq",
+	},
+
+	integerFormat:  "int64(%d)",
+	arrayFormat:    "&Array{Elements: []Value{%s}}",
+	functionFormat: "&Function{Arity: %d, Source: %s, Fn: func(args []Value) Value {\n%s%s}}",
+	defineFormat:   "%s := %s",
+	// Go rejects variables that are never used, hence the blank
+	// assignments.
+	declareFormat: "var %[1]s Value\n_ = %[1]s",
+	paramFormat:   "%[1]s := args[%[2]d]\n_ = %[1]s",
+	assignFormat:  "%s = %s",
+	discardFormat: "_ = %s",
+	returnFormat:  "return %s",
+	ifFormat:      "if truthy(%s) {",
+	elseLine:      "} else {",
+	endLine:       "}",
+	loopLine:      "for {",
+	unlessFormat:  "if !truthy(%s) {",
+	breakLine:     "break",
+}
+
+// Go translates program into a standalone Go program: a main package that
+// needs nothing but the standard library. The program prints what the
+// interpreter would print, and after a runtime error it prints the error to
+// standard error and exits with status 70 like `monkey run`.
+//
+// Values keep their dynamic types, so the output is only as fast as the
+// runtime checks allow, but it runs without an interpreter loop.
+func Go(program *ast.Program) ([]byte, error) {
+	g := &generator{dialect: goDialect}
+	body, err := g.function(nil, program.Statements)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.WriteString("// Code generated by monkey build. DO NOT EDIT.\n\n")
+	out.WriteString(goRuntime[strings.Index(goRuntime, "package main"):])
+	fmt.Fprintf(&out, "\nfunc program() Value {\n%s}\n", body)
+
+	return format.Source(out.Bytes())
+}
@@ -0,0 +1,62 @@
+package transpile
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestGoPrograms(t *testing.T) {
+	if testing.Short() {
+		t.Skip("building Go programs is slow")
+	}
+	gocmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command")
+	}
+
+	for _, input := range programs {
+		wantOut, wantCode, wantErr := interpret(t, input)
+
+		src, err := Go(parse(t, input))
+		if err != nil {
+			t.Errorf("%q: %s", input, err)
+			continue
+		}
+
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "main.go"), src, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			exe := filepath.Join(dir, "prog")
+			build := exec.Command(gocmd, "build", "-o", exe, filepath.Join(dir, "main.go"))
+			if out, err := build.CombinedOutput(); err != nil {
+				t.Fatalf("%q: go build failed: %s\n%s\n%s", input, err, out, src)
+			}
+
+			var stdout, stderr bytes.Buffer
+			cmd := exec.Command(exe)
+			cmd.Stdout, cmd.Stderr = &stdout, &stderr
+			code := 0
+			if err := cmd.Run(); err != nil {
+				var exitErr *exec.ExitError
+				if !errors.As(err, &exitErr) {
+					t.Fatalf("%q: %s", input, err)
+				}
+				code = exitErr.ExitCode()
+			}
+
+			if stdout.String() != wantOut {
+				t.Errorf("%q: wrong output.\nwant=%q\ngot =%q", input, wantOut, stdout.String())
+			}
+			if code != wantCode || stderr.String() != wantErr {
+				t.Errorf("%q: wrong exit. want=%d %q, got=%d %q", input, wantCode, wantErr, code, stderr.String())
+			}
+		})
+	}
+}
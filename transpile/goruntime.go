@@ -0,0 +1,570 @@
+//go:build ignore
+
+// This file is the runtime of the Go programs the Go backend emits. It is
+// not part of package transpile: the backend copies it in front of the
+// translated program, which defines the function program.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Value is a Monkey value: an int64, string or bool, nil for null, or an
+// *Array, *Hash, *Function or *Builtin.
+type Value = interface{}
+
+type Array struct {
+	Elements []Value
+}
+
+// Hash keeps its keys in insertion order so programs print hashes the same
+// way on every run.
+type Hash struct {
+	keys   []Value
+	values map[Value]Value
+}
+
+// Function is a function literal closed over the variables it uses.
+// Source is what puts prints for it.
+type Function struct {
+	Arity  int
+	Source string
+	Fn     func(args []Value) Value
+}
+
+type Builtin struct {
+	Name string
+	Fn   func(args []Value) Value
+}
+
+// monkeyError is the panic value of a runtime error.
+type monkeyError struct {
+	message string
+}
+
+// exitCode is the panic value of a call to exit.
+type exitCode int
+
+var stdout = bufio.NewWriter(os.Stdout)
+
+func main() {
+	code := run()
+	stdout.Flush()
+	os.Exit(code)
+}
+
+// run runs the program and returns the process exit code: the code passed
+// to exit, 70 after a runtime error or 0.
+func run() (code int) {
+	defer func() {
+		switch r := recover().(type) {
+		case nil:
+		case exitCode:
+			code = int(r)
+		case *monkeyError:
+			stdout.Flush()
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", r.message)
+			code = 70
+		default:
+			panic(r)
+		}
+	}()
+	program()
+	return 0
+}
+
+func fail(format string, args ...interface{}) {
+	panic(&monkeyError{fmt.Sprintf(format, args...)})
+}
+
+func typeName(v Value) string {
+	switch v.(type) {
+	case int64:
+		return "INTEGER"
+	case string:
+		return "STRING"
+	case bool:
+		return "BOOLEAN"
+	case nil:
+		return "NULL"
+	case *Array:
+		return "ARRAY"
+	case *Hash:
+		return "HASH"
+	case *Function:
+		return "FUNCTION"
+	default:
+		return "BUILTIN"
+	}
+}
+
+func inspect(v Value) string {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case string:
+		return strconv.Quote(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return "null"
+	case *Array:
+		elements := make([]string, len(v.Elements))
+		for i, el := range v.Elements {
+			elements[i] = inspect(el)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *Hash:
+		pairs := make([]string, len(v.keys))
+		for i, key := range v.keys {
+			pairs[i] = inspect(key) + ": " + inspect(v.values[key])
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case *Function:
+		return v.Source
+	default:
+		return "builtin function"
+	}
+}
+
+// truthy reports whether v counts as true in a condition: everything but
+// null and false does.
+func truthy(v Value) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	default:
+		return true
+	}
+}
+
+func hashable(v Value) bool {
+	switch v.(type) {
+	case int64, string, bool:
+		return true
+	default:
+		return false
+	}
+}
+
+// newHash builds a hash from alternating keys and values.
+func newHash(pairs ...Value) *Hash {
+	h := &Hash{values: make(map[Value]Value, len(pairs)/2)}
+	for i := 0; i < len(pairs); i += 2 {
+		key := pairs[i]
+		if _, ok := h.values[key]; !ok {
+			h.keys = append(h.keys, key)
+		}
+		h.values[key] = pairs[i+1]
+	}
+	return h
+}
+
+// checkKey fails unless key can be used as a hash key. Hash literals check
+// each key before evaluating its value.
+func checkKey(key Value) Value {
+	if !hashable(key) {
+		fail("unusable as hash key: %s", typeName(key))
+	}
+	return key
+}
+
+func not(v Value) Value {
+	return !truthy(v)
+}
+
+func neg(v Value) Value {
+	i, ok := v.(int64)
+	if !ok {
+		fail("unknown operator: -%s", typeName(v))
+	}
+	return -i
+}
+
+// The operators test for integers first and leave everything else to infix.
+
+func add(left, right Value) Value {
+	if l, ok := left.(int64); ok {
+		if r, ok := right.(int64); ok {
+			return l + r
+		}
+	}
+	return infix("+", left, right)
+}
+
+func sub(left, right Value) Value {
+	if l, ok := left.(int64); ok {
+		if r, ok := right.(int64); ok {
+			return l - r
+		}
+	}
+	return infix("-", left, right)
+}
+
+func mul(left, right Value) Value {
+	if l, ok := left.(int64); ok {
+		if r, ok := right.(int64); ok {
+			return l * r
+		}
+	}
+	return infix("*", left, right)
+}
+
+func div(left, right Value) Value {
+	return infix("/", left, right)
+}
+
+func lt(left, right Value) Value {
+	if l, ok := left.(int64); ok {
+		if r, ok := right.(int64); ok {
+			return l < r
+		}
+	}
+	return infix("<", left, right)
+}
+
+func gt(left, right Value) Value {
+	if l, ok := left.(int64); ok {
+		if r, ok := right.(int64); ok {
+			return l > r
+		}
+	}
+	return infix(">", left, right)
+}
+
+func eq(left, right Value) Value {
+	return infix("==", left, right)
+}
+
+func neq(left, right Value) Value {
+	return infix("!=", left, right)
+}
+
+func bitAnd(left, right Value) Value {
+	return infix("&", left, right)
+}
+
+func bitOr(left, right Value) Value {
+	return infix("|", left, right)
+}
+
+func bitXor(left, right Value) Value {
+	return infix("^", left, right)
+}
+
+func shiftLeft(left, right Value) Value {
+	return infix("<<", left, right)
+}
+
+func shiftRight(left, right Value) Value {
+	return infix(">>", left, right)
+}
+
+func bitNot(v Value) Value {
+	i, ok := v.(int64)
+	if !ok {
+		fail("unknown operator: ~%s", typeName(v))
+	}
+	return ^i
+}
+
+// infix applies the binary operator op. Integers and strings have their
+// own operators, arrays concatenate and repeat; other values only compare
+// by identity.
+func infix(op string, left, right Value) Value {
+	if l, ok := left.(int64); ok {
+		if r, ok := right.(int64); ok {
+			switch op {
+			case "+":
+				return l + r
+			case "-":
+				return l - r
+			case "*":
+				return l * r
+			case "/":
+				if r == 0 {
+					fail("division by zero")
+				}
+				return l / r
+			case "<":
+				return l < r
+			case ">":
+				return l > r
+			case "==":
+				return l == r
+			case "!=":
+				return l != r
+			case "&":
+				return l & r
+			case "|":
+				return l | r
+			case "^":
+				return l ^ r
+			case "<<", ">>":
+				if r < 0 {
+					fail("negative shift count: %d", r)
+				}
+				if op == "<<" {
+					return l << r
+				}
+				return l >> r
+			}
+			return nil
+		}
+	}
+	if l, ok := left.(string); ok {
+		if r, ok := right.(string); ok {
+			switch op {
+			case "+":
+				return l + r
+			case "==":
+				return l == r
+			case "!=":
+				return l != r
+			}
+			fail("unknown operator: STRING %s STRING", op)
+		}
+	}
+	if l, ok := left.(*Array); ok {
+		if r, ok := right.(*Array); ok && op == "+" {
+			elements := append(append([]Value{}, l.Elements...), r.Elements...)
+			return &Array{Elements: elements}
+		}
+		if n, ok := right.(int64); ok && op == "*" {
+			return repeat(l, n)
+		}
+	}
+
+	switch {
+	case op == "==":
+		return identical(left, right)
+	case op == "!=":
+		return !identical(left, right)
+	case typeName(left) != typeName(right):
+		fail("type mismatch: %s %s %s", typeName(left), op, typeName(right))
+	}
+	fail("unknown operator: %s %s %s", typeName(right), op, typeName(left))
+	return nil
+}
+
+// maxRepeatLen bounds the length of the arrays repeat builds, like the
+// interpreter's.
+const maxRepeatLen = 1 << 27
+
+// repeat returns the elements of a repeated n times.
+func repeat(a *Array, n int64) *Array {
+	if n < 0 {
+		fail("negative repeat count: %d", n)
+	}
+	if len(a.Elements) != 0 && n > maxRepeatLen/int64(len(a.Elements)) {
+		fail("repeated array too long: %d elements repeated %d times", len(a.Elements), n)
+	}
+	elements := make([]Value, 0, len(a.Elements)*int(n))
+	for i := int64(0); i < n; i++ {
+		elements = append(elements, a.Elements...)
+	}
+	return &Array{Elements: elements}
+}
+
+// identical compares values the way the interpreter compares objects that
+// are neither integers nor strings: booleans and null by value, everything
+// else by reference.
+func identical(a, b Value) bool {
+	switch a.(type) {
+	case bool, nil:
+		return a == b
+	case int64, string:
+		return false
+	}
+	return a == b
+}
+
+func index(left, idx Value) Value {
+	switch left := left.(type) {
+	case *Array:
+		if i, ok := idx.(int64); ok {
+			if i < 0 || i >= int64(len(left.Elements)) {
+				return nil
+			}
+			return left.Elements[i]
+		}
+	case *Hash:
+		if !hashable(idx) {
+			fail("unusable as hash key: %s", typeName(idx))
+		}
+		return left.values[idx]
+	}
+	fail("index operator not supported: %s", typeName(left))
+	return nil
+}
+
+// call calls fn with args. Like the VM, and unlike the evaluator, it
+// rejects calls with the wrong number of arguments.
+func call(fn Value, args ...Value) Value {
+	switch fn := fn.(type) {
+	case *Function:
+		if len(args) != fn.Arity {
+			fail("wrong number of arguments: want=%d, got=%d", fn.Arity, len(args))
+		}
+		return fn.Fn(args)
+	case *Builtin:
+		return fn.Fn(args)
+	}
+	fail("not a function: %s", typeName(fn))
+	return nil
+}
+
+func equal(a, b Value) bool {
+	if typeName(a) != typeName(b) {
+		return false
+	}
+	switch a := a.(type) {
+	case *Array:
+		other := b.(*Array)
+		if len(a.Elements) != len(other.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !equal(a.Elements[i], other.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		other := b.(*Hash)
+		if len(a.keys) != len(other.keys) {
+			return false
+		}
+		for key, value := range a.values {
+			otherValue, ok := other.values[key]
+			if !ok || !equal(value, otherValue) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+func arrayArgument(name string, args []Value) *Array {
+	if len(args) != 1 {
+		fail("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	arr, ok := args[0].(*Array)
+	if !ok {
+		fail("argument to `%s` must be ARRAY, got %s", name, typeName(args[0]))
+	}
+	return arr
+}
+
+var (
+	builtinPuts = &Builtin{"puts", func(args []Value) Value {
+		for _, arg := range args {
+			stdout.WriteString(inspect(arg))
+			stdout.WriteByte('\n')
+		}
+		return nil
+	}}
+
+	builtinLen = &Builtin{"len", func(args []Value) Value {
+		if len(args) != 1 {
+			fail("wrong number of arguments. got=%d, want=1", len(args))
+		}
+		switch arg := args[0].(type) {
+		case string:
+			return int64(len(arg))
+		case *Array:
+			return int64(len(arg.Elements))
+		}
+		fail("argument to `len` not supported, got %s", typeName(args[0]))
+		return nil
+	}}
+
+	builtinFirst = &Builtin{"first", func(args []Value) Value {
+		arr := arrayArgument("first", args)
+		if len(arr.Elements) == 0 {
+			return nil
+		}
+		return arr.Elements[0]
+	}}
+
+	builtinLast = &Builtin{"last", func(args []Value) Value {
+		arr := arrayArgument("last", args)
+		if len(arr.Elements) == 0 {
+			return nil
+		}
+		return arr.Elements[len(arr.Elements)-1]
+	}}
+
+	builtinRest = &Builtin{"rest", func(args []Value) Value {
+		arr := arrayArgument("rest", args)
+		if len(arr.Elements) == 0 {
+			return nil
+		}
+		elements := make([]Value, len(arr.Elements)-1)
+		copy(elements, arr.Elements[1:])
+		return &Array{elements}
+	}}
+
+	builtinPush = &Builtin{"push", func(args []Value) Value {
+		if len(args) != 2 {
+			fail("wrong number of arguments. got=%d, want=2", len(args))
+		}
+		arr, ok := args[0].(*Array)
+		if !ok {
+			fail("argument to `push` must be ARRAY, got %s", typeName(args[0]))
+		}
+		elements := make([]Value, len(arr.Elements)+1)
+		copy(elements, arr.Elements)
+		elements[len(arr.Elements)] = args[1]
+		return &Array{elements}
+	}}
+
+	builtinExit = &Builtin{"exit", func(args []Value) Value {
+		if len(args) > 1 {
+			fail("wrong number of arguments. got=%d, want=0 or 1", len(args))
+		}
+		if len(args) == 0 {
+			panic(exitCode(0))
+		}
+		code, ok := args[0].(int64)
+		if !ok {
+			fail("argument to `exit` must be INTEGER, got %s", typeName(args[0]))
+		}
+		panic(exitCode(code))
+	}}
+
+	builtinAssert = &Builtin{"assert", func(args []Value) Value {
+		if len(args) != 1 && len(args) != 2 {
+			fail("wrong number of arguments. got=%d, want=1 or 2", len(args))
+		}
+		if truthy(args[0]) {
+			return nil
+		}
+		if len(args) == 2 {
+			if msg, ok := args[1].(string); ok {
+				fail("assertion failed: %s", msg)
+			}
+			fail("assertion failed: %s", inspect(args[1]))
+		}
+		fail("assertion failed")
+		return nil
+	}}
+
+	builtinAssertEq = &Builtin{"assert_eq", func(args []Value) Value {
+		if len(args) != 2 {
+			fail("wrong number of arguments. got=%d, want=2", len(args))
+		}
+		if !equal(args[0], args[1]) {
+			fail("assertion failed: expected %s, got %s", inspect(args[1]), inspect(args[0]))
+		}
+		return nil
+	}}
+)
@@ -0,0 +1,69 @@
+package transpile
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+
+	"github.com/frankie-mur/monkeylang/ast"
+)
+
+//go:embed jsruntime.js
+var jsRuntime string
+
+var jsDialect = &dialect{
+	indent: "  ",
+	null:   "null",
+	quote: func(s string) string {
+		// JSON strings are JavaScript strings; escaping < also keeps a
+		// "</script>" in a literal from ending an inline script.
+		b, _ := json.Marshal(s)
+		return string(b)
+	},
+	builtins: map[string]string{
+		"puts":      "builtinPuts",
+		"len":       "builtinLen",
+		"first":     "builtinFirst",
+		"last":      "builtinLast",
+		"rest":      "builtinRest",
+		"push":      "builtinPush",
+		"exit":      "builtinExit",
+		"assert":    "builtinAssert",
+		"assert_eq": "builtinAssertEq",
+	},
+
+	integerFormat:  "%dn",
+	arrayFormat:    "[%s]",
+	functionFormat: "new MonkeyFunction(%d, %s, (args) => {\n%s%s})",
+	defineFormat:   "const %s = %s;",
+	declareFormat:  "let %s = null;",
+	paramFormat:    "let %s = args[%d];",
+	assignFormat:   "%s = %s;",
+	returnFormat:   "return %s;",
+	ifFormat:       "if (truthy(%s)) {",
+	elseLine:       "} else {",
+	endLine:        "}",
+	loopLine:       "for (;;) {",
+	unlessFormat:   "if (!truthy(%s)) {",
+	breakLine:      "break;",
+}
+
+// JS translates program into a JavaScript script that runs it when loaded,
+// so pages can embed Monkey programs without the WebAssembly interpreter.
+// The script defines no globals. It prints with console.log, or with
+// globalThis.monkeyOutput when a page defines that function, and reports
+// runtime errors with console.error.
+func JS(program *ast.Program) ([]byte, error) {
+	g := &generator{dialect: jsDialect}
+	body, err := g.function(nil, program.Statements)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.WriteString("// Code generated by monkey build. DO NOT EDIT.\n\n(function () {\n\"use strict\";\n\n")
+	out.WriteString(jsRuntime)
+	fmt.Fprintf(&out, "\nfunction program() {\n%s}\n\nrun(program);\n})();\n", body)
+	return out.Bytes(), nil
+}
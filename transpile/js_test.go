@@ -0,0 +1,71 @@
+package transpile
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSPrograms(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("no node command")
+	}
+
+	for _, input := range programs {
+		wantOut, wantCode, wantErr := interpret(t, input)
+
+		src, err := JS(parse(t, input))
+		if err != nil {
+			t.Errorf("%q: %s", input, err)
+			continue
+		}
+
+		script := filepath.Join(t.TempDir(), "prog.js")
+		if err := os.WriteFile(script, src, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(node, script)
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		code := 0
+		if err := cmd.Run(); err != nil {
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				t.Fatalf("%q: %s", input, err)
+			}
+			code = exitErr.ExitCode()
+		}
+
+		if stdout.String() != wantOut {
+			t.Errorf("%q: wrong output.\nwant=%q\ngot =%q", input, wantOut, stdout.String())
+		}
+		if code != wantCode || stderr.String() != wantErr {
+			t.Errorf("%q: wrong exit. want=%d %q, got=%d %q\n%s", input, wantCode, wantErr, code, stderr.String(), src)
+		}
+	}
+}
+
+func TestJSOutputHook(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("no node command")
+	}
+
+	src, err := JS(parse(t, `puts("hi", [1, 2]); "</script>"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(src, []byte("</script>")) {
+		t.Errorf("the script should not contain </script>")
+	}
+
+	hook := "const lines = []; globalThis.monkeyOutput = (line) => lines.push(line);\n" + string(src) + "console.log(JSON.stringify(lines));\n"
+	out, err := exec.Command(node, "-e", hook).CombinedOutput()
+	if err != nil || string(out) != "[\"\\\"hi\\\"\",\"[1, 2]\"]\n" {
+		t.Errorf("monkeyOutput should receive the lines. got=%q, %v", out, err)
+	}
+}
@@ -0,0 +1,487 @@
+// This file is the runtime of the JavaScript programs the JavaScript
+// backend emits. The backend wraps it, together with the translated
+// program that defines the function program, in a function so none of it
+// leaks into the global scope.
+//
+// Monkey integers are 64-bit, so they are BigInts wrapped to 64 bits after
+// every operation. Null is null, strings, booleans and arrays are their
+// JavaScript counterparts.
+//
+// puts writes each line with globalThis.monkeyOutput if the page defines
+// it, else with console.log.
+
+class MonkeyFunction {
+  constructor(arity, source, fn) {
+    this.arity = arity;
+    this.source = source;
+    this.fn = fn;
+  }
+}
+
+class Builtin {
+  constructor(name, fn) {
+    this.name = name;
+    this.fn = fn;
+  }
+}
+
+// Hash keeps its keys in insertion order, as Map does.
+class Hash {
+  constructor() {
+    this.values = new Map();
+  }
+}
+
+// MonkeyError is thrown by a runtime error.
+class MonkeyError extends Error {}
+
+// MonkeyExit is thrown by a call to exit.
+class MonkeyExit {
+  constructor(code) {
+    this.code = code;
+  }
+}
+
+const output = (line) => {
+  if (typeof globalThis.monkeyOutput === "function") {
+    globalThis.monkeyOutput(line);
+  } else {
+    console.log(line);
+  }
+};
+
+// run runs the program. After a runtime error it reports the error with
+// console.error; under Node.js it sets the exit code of the process like
+// `monkey run` would.
+function run(program) {
+  let code = 0;
+  try {
+    program();
+  } catch (e) {
+    if (e instanceof MonkeyExit) {
+      code = e.code;
+    } else if (e instanceof MonkeyError) {
+      console.error("ERROR: " + e.message);
+      code = 70;
+    } else {
+      throw e;
+    }
+  }
+  if (typeof process !== "undefined" && code !== 0) {
+    process.exitCode = code;
+  }
+}
+
+function fail(message) {
+  throw new MonkeyError(message);
+}
+
+function typeName(v) {
+  switch (typeof v) {
+    case "bigint":
+      return "INTEGER";
+    case "string":
+      return "STRING";
+    case "boolean":
+      return "BOOLEAN";
+  }
+  if (v === null) {
+    return "NULL";
+  } else if (Array.isArray(v)) {
+    return "ARRAY";
+  } else if (v instanceof Hash) {
+    return "HASH";
+  } else if (v instanceof MonkeyFunction) {
+    return "FUNCTION";
+  }
+  return "BUILTIN";
+}
+
+// quote quotes a string the way Go's %q verb does for printable text.
+function quote(s) {
+  let out = '"';
+  for (const c of s) {
+    switch (c) {
+      case '"':
+        out += '\\"';
+        break;
+      case "\\":
+        out += "\\\\";
+        break;
+      case "\n":
+        out += "\\n";
+        break;
+      case "\r":
+        out += "\\r";
+        break;
+      case "\t":
+        out += "\\t";
+        break;
+      default: {
+        const code = c.codePointAt(0);
+        if (code < 0x20 || code === 0x7f) {
+          out += "\\x" + code.toString(16).padStart(2, "0");
+        } else {
+          out += c;
+        }
+      }
+    }
+  }
+  return out + '"';
+}
+
+function inspect(v) {
+  switch (typeName(v)) {
+    case "INTEGER":
+    case "BOOLEAN":
+      return String(v);
+    case "STRING":
+      return quote(v);
+    case "NULL":
+      return "null";
+    case "ARRAY":
+      return "[" + v.map(inspect).join(", ") + "]";
+    case "HASH": {
+      const pairs = [];
+      for (const [key, value] of v.values) {
+        pairs.push(inspect(key) + ": " + inspect(value));
+      }
+      return "{" + pairs.join(", ") + "}";
+    }
+    case "FUNCTION":
+      return v.source;
+  }
+  return "builtin function";
+}
+
+// truthy reports whether v counts as true in a condition: everything but
+// null and false does.
+function truthy(v) {
+  return v !== null && v !== false;
+}
+
+function hashable(v) {
+  const type = typeof v;
+  return type === "bigint" || type === "string" || type === "boolean";
+}
+
+// newHash builds a hash from alternating keys and values.
+function newHash(...pairs) {
+  const h = new Hash();
+  for (let i = 0; i < pairs.length; i += 2) {
+    h.values.set(pairs[i], pairs[i + 1]);
+  }
+  return h;
+}
+
+// checkKey fails unless key can be used as a hash key. Hash literals check
+// each key before evaluating its value.
+function checkKey(key) {
+  if (!hashable(key)) {
+    fail("unusable as hash key: " + typeName(key));
+  }
+  return key;
+}
+
+function not(v) {
+  return !truthy(v);
+}
+
+function neg(v) {
+  if (typeof v !== "bigint") {
+    fail("unknown operator: -" + typeName(v));
+  }
+  return BigInt.asIntN(64, -v);
+}
+
+function integers(left, right) {
+  return typeof left === "bigint" && typeof right === "bigint";
+}
+
+// The operators test for integers first and leave everything else to infix.
+
+function add(left, right) {
+  if (integers(left, right)) {
+    return BigInt.asIntN(64, left + right);
+  }
+  if (typeof left === "string" && typeof right === "string") {
+    return left + right;
+  }
+  return infix("+", left, right);
+}
+
+function sub(left, right) {
+  return integers(left, right) ? BigInt.asIntN(64, left - right) : infix("-", left, right);
+}
+
+function mul(left, right) {
+  return integers(left, right) ? BigInt.asIntN(64, left * right) : infix("*", left, right);
+}
+
+function div(left, right) {
+  if (integers(left, right)) {
+    if (right === 0n) {
+      fail("division by zero");
+    }
+    return BigInt.asIntN(64, left / right);
+  }
+  return infix("/", left, right);
+}
+
+function lt(left, right) {
+  return integers(left, right) ? left < right : infix("<", left, right);
+}
+
+function gt(left, right) {
+  return integers(left, right) ? left > right : infix(">", left, right);
+}
+
+function eq(left, right) {
+  return infix("==", left, right);
+}
+
+function neq(left, right) {
+  return infix("!=", left, right);
+}
+
+function bitAnd(left, right) {
+  return integers(left, right) ? left & right : infix("&", left, right);
+}
+
+function bitOr(left, right) {
+  return integers(left, right) ? left | right : infix("|", left, right);
+}
+
+function bitXor(left, right) {
+  return integers(left, right) ? left ^ right : infix("^", left, right);
+}
+
+// Shifting by 64 bits or more leaves the same result as by 64, which keeps
+// huge counts from building huge BigInts.
+function shiftLeft(left, right) {
+  return integers(left, right) ? BigInt.asIntN(64, left << shiftCount(right)) : infix("<<", left, right);
+}
+
+function shiftRight(left, right) {
+  return integers(left, right) ? left >> shiftCount(right) : infix(">>", left, right);
+}
+
+function shiftCount(n) {
+  if (n < 0n) {
+    fail("negative shift count: " + n);
+  }
+  return n > 64n ? 64n : n;
+}
+
+function bitNot(v) {
+  if (typeof v !== "bigint") {
+    fail("unknown operator: ~" + typeName(v));
+  }
+  return ~v;
+}
+
+// infix applies the binary operator op. Integers and strings have their
+// own operators, arrays concatenate and repeat; other values only compare
+// by identity, which for booleans and null is equality.
+function infix(op, left, right) {
+  if (integers(left, right)) {
+    return op === "==" ? left === right : left !== right;
+  }
+  if (typeof left === "string" && typeof right === "string") {
+    switch (op) {
+      case "==":
+        return left === right;
+      case "!=":
+        return left !== right;
+    }
+    fail("unknown operator: STRING " + op + " STRING");
+  }
+  if (Array.isArray(left)) {
+    if (op === "+" && Array.isArray(right)) {
+      return left.concat(right);
+    } else if (op === "*" && typeof right === "bigint") {
+      return repeat(left, right);
+    }
+  }
+
+  if (op === "==") {
+    return left === right;
+  } else if (op === "!=") {
+    return left !== right;
+  } else if (typeName(left) !== typeName(right)) {
+    fail("type mismatch: " + typeName(left) + " " + op + " " + typeName(right));
+  }
+  fail("unknown operator: " + typeName(right) + " " + op + " " + typeName(left));
+}
+
+// maxRepeatLen bounds the length of the arrays repeat builds, like the
+// interpreter's.
+const maxRepeatLen = 1n << 27n;
+
+function repeat(array, n) {
+  if (n < 0n) {
+    fail("negative repeat count: " + n);
+  }
+  const length = BigInt(array.length);
+  if (length !== 0n && n > maxRepeatLen / length) {
+    fail("repeated array too long: " + length + " elements repeated " + n + " times");
+  }
+  const result = [];
+  for (let i = 0n; i < n; i++) {
+    for (const element of array) {
+      result.push(element);
+    }
+  }
+  return result;
+}
+
+function index(left, idx) {
+  if (Array.isArray(left)) {
+    if (typeof idx === "bigint") {
+      return idx < 0n || idx >= BigInt(left.length) ? null : left[Number(idx)];
+    }
+  } else if (left instanceof Hash) {
+    if (!hashable(idx)) {
+      fail("unusable as hash key: " + typeName(idx));
+    }
+    const value = left.values.get(idx);
+    return value === undefined ? null : value;
+  }
+  fail("index operator not supported: " + typeName(left));
+}
+
+// call calls fn with args. Like the VM, and unlike the evaluator, it
+// rejects calls with the wrong number of arguments.
+function call(fn, ...args) {
+  if (fn instanceof MonkeyFunction) {
+    if (args.length !== fn.arity) {
+      fail("wrong number of arguments: want=" + fn.arity + ", got=" + args.length);
+    }
+    return fn.fn(args);
+  } else if (fn instanceof Builtin) {
+    return fn.fn(args);
+  }
+  fail("not a function: " + typeName(fn));
+}
+
+function equal(a, b) {
+  if (typeName(a) !== typeName(b)) {
+    return false;
+  }
+  if (Array.isArray(a)) {
+    return a.length === b.length && a.every((el, i) => equal(el, b[i]));
+  }
+  if (a instanceof Hash) {
+    if (a.values.size !== b.values.size) {
+      return false;
+    }
+    for (const [key, value] of a.values) {
+      if (!b.values.has(key) || !equal(value, b.values.get(key))) {
+        return false;
+      }
+    }
+    return true;
+  }
+  return a === b;
+}
+
+// byteLength returns the length of s encoded as UTF-8, which is what len
+// counts.
+function byteLength(s) {
+  let n = 0;
+  for (const c of s) {
+    const code = c.codePointAt(0);
+    n += code < 0x80 ? 1 : code < 0x800 ? 2 : code < 0x10000 ? 3 : 4;
+  }
+  return n;
+}
+
+function arrayArgument(name, args) {
+  if (args.length !== 1) {
+    fail("wrong number of arguments. got=" + args.length + ", want=1");
+  }
+  if (!Array.isArray(args[0])) {
+    fail("argument to `" + name + "` must be ARRAY, got " + typeName(args[0]));
+  }
+  return args[0];
+}
+
+const builtinPuts = new Builtin("puts", (args) => {
+  for (const arg of args) {
+    output(inspect(arg));
+  }
+  return null;
+});
+
+const builtinLen = new Builtin("len", (args) => {
+  if (args.length !== 1) {
+    fail("wrong number of arguments. got=" + args.length + ", want=1");
+  }
+  if (typeof args[0] === "string") {
+    return BigInt(byteLength(args[0]));
+  } else if (Array.isArray(args[0])) {
+    return BigInt(args[0].length);
+  }
+  fail("argument to `len` not supported, got " + typeName(args[0]));
+});
+
+const builtinFirst = new Builtin("first", (args) => {
+  const arr = arrayArgument("first", args);
+  return arr.length === 0 ? null : arr[0];
+});
+
+const builtinLast = new Builtin("last", (args) => {
+  const arr = arrayArgument("last", args);
+  return arr.length === 0 ? null : arr[arr.length - 1];
+});
+
+const builtinRest = new Builtin("rest", (args) => {
+  const arr = arrayArgument("rest", args);
+  return arr.length === 0 ? null : arr.slice(1);
+});
+
+const builtinPush = new Builtin("push", (args) => {
+  if (args.length !== 2) {
+    fail("wrong number of arguments. got=" + args.length + ", want=2");
+  }
+  if (!Array.isArray(args[0])) {
+    fail("argument to `push` must be ARRAY, got " + typeName(args[0]));
+  }
+  return [...args[0], args[1]];
+});
+
+const builtinExit = new Builtin("exit", (args) => {
+  if (args.length > 1) {
+    fail("wrong number of arguments. got=" + args.length + ", want=0 or 1");
+  }
+  if (args.length === 0) {
+    throw new MonkeyExit(0);
+  }
+  if (typeof args[0] !== "bigint") {
+    fail("argument to `exit` must be INTEGER, got " + typeName(args[0]));
+  }
+  throw new MonkeyExit(Number(BigInt.asIntN(32, args[0])));
+});
+
+const builtinAssert = new Builtin("assert", (args) => {
+  if (args.length !== 1 && args.length !== 2) {
+    fail("wrong number of arguments. got=" + args.length + ", want=1 or 2");
+  }
+  if (truthy(args[0])) {
+    return null;
+  }
+  if (args.length === 2) {
+    fail("assertion failed: " + (typeof args[1] === "string" ? args[1] : inspect(args[1])));
+  }
+  fail("assertion failed");
+});
+
+const builtinAssertEq = new Builtin("assert_eq", (args) => {
+  if (args.length !== 2) {
+    fail("wrong number of arguments. got=" + args.length + ", want=2");
+  }
+  if (!equal(args[0], args[1])) {
+    fail("assertion failed: expected " + inspect(args[1]) + ", got " + inspect(args[0]));
+  }
+  return null;
+});
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build metadata. Release builds set these with
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse HEAD)"
+//
+// otherwise they are filled in from the module's embedded build info.
+var (
+	version = ""
+	commit  = ""
+)
+
+// buildVersion returns the interpreter version and the git commit it was
+// built from, falling back to debug.ReadBuildInfo when no ldflags were given.
+func buildVersion() (string, string) {
+	v, c := version, commit
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v == "" && info.Main.Version != "" {
+			v = info.Main.Version
+		}
+		for _, setting := range info.Settings {
+			if c == "" && setting.Key == "vcs.revision" {
+				c = setting.Value
+			}
+		}
+	}
+
+	if v == "" {
+		v = "(devel)"
+	}
+	if c == "" {
+		c = "unknown"
+	}
+	return v, c
+}
+
+// printVersion writes the version line shown by `monkey --version`.
+func printVersion(out io.Writer) {
+	v, c := buildVersion()
+	fmt.Fprintf(out, "monkey %s (commit %s) %s %s/%s\n", v, c, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,68 @@
+package vm
+
+import (
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// Step executes the next instruction of the program and returns what Run
+// would return if the instruction ended the program. Stepping a VM that is
+// done does nothing.
+func (vm *VM) Step() error {
+	vm.stepping, vm.stepped = true, false
+	defer func() { vm.stepping = false }()
+
+	return vm.runtimeError(vm.run())
+}
+
+// Done reports whether the program has run to its end or returned at the
+// top level.
+func (vm *VM) Done() bool {
+	return vm.done
+}
+
+// NextPos returns the source position of the instruction the VM executes
+// next.
+func (vm *VM) NextPos() (token.Position, bool) {
+	f := vm.currentFrame()
+	return f.cl.Fn.SourceMap.Lookup(f.ip + 1)
+}
+
+// CurrentFrame returns the frame of the innermost call in progress, or of
+// the main program.
+func (vm *VM) CurrentFrame() *Frame {
+	return vm.currentFrame()
+}
+
+// Frames returns the frames of the calls in progress, innermost first. The
+// last one is the main program's.
+func (vm *VM) Frames() []*Frame {
+	frames := make([]*Frame, vm.framesIndex)
+	for i := range frames {
+		frames[i] = vm.frames[vm.framesIndex-1-i]
+	}
+	return frames
+}
+
+// Locals returns the values of the locals of f by slot. The slots of locals
+// the function has not bound yet hold whatever the stack held before. The
+// main program has no locals.
+func (vm *VM) Locals(f *Frame) []object.Object {
+	if f == vm.frames[0] {
+		return nil
+	}
+	end := min(f.basePointer+f.cl.Fn.NumLocals, len(vm.stack))
+	locals := append([]object.Object(nil), vm.stack[f.basePointer:end]...)
+	for i, local := range locals {
+		if c, ok := local.(*cell); ok {
+			locals[i] = c.value
+		}
+	}
+	return locals
+}
+
+// Globals returns the values of the globals by index, nil for those not yet
+// bound. Globals defined later may be missing from the end.
+func (vm *VM) Globals() []object.Object {
+	return vm.globals
+}
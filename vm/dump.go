@@ -0,0 +1,87 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/frankie-mur/monkeylang/code"
+)
+
+// How much of the VM Dump shows: the values on top of the stack and the
+// instructions before and after the one each frame stopped at.
+const (
+	dumpStackValues  = 16
+	dumpWindowBefore = 4
+	dumpWindowAfter  = 2
+)
+
+// Dump writes the state of the VM to w for bug reports: the values on top of
+// the operand stack, the chain of call frames from the innermost out, and
+// the disassembly around the instruction each frame stopped at. It is meant
+// to be called after Run fails, when the VM is left as the error found it.
+func (vm *VM) Dump(w io.Writer) {
+	sp := min(vm.sp, len(vm.stack))
+	fmt.Fprintf(w, "stack (%d values):\n", sp)
+	for i := sp - 1; i >= 0 && i >= sp-dumpStackValues; i-- {
+		if v := vm.stack[i]; v != nil {
+			fmt.Fprintf(w, "  %4d  %s %s\n", i, v.Type(), v.Inspect())
+		} else {
+			fmt.Fprintf(w, "  %4d  <nil>\n", i)
+		}
+	}
+	if sp > dumpStackValues {
+		fmt.Fprintf(w, "  ... %d more\n", sp-dumpStackValues)
+	}
+
+	fmt.Fprintf(w, "frames (%d):\n", vm.framesIndex)
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		f := vm.frames[i]
+		fmt.Fprintf(w, "  #%d %s ip=%d base=%d", i, vm.frameName(f), f.ip, f.basePointer)
+		if pos, ok := f.Pos(); ok && f.ip >= 0 {
+			fmt.Fprintf(w, " at %s", pos)
+		}
+		fmt.Fprintln(w)
+		dumpWindow(w, f.Instructions(), f.ip)
+	}
+}
+
+// frameName names the function a frame runs: main, or the index of its
+// compiled function in the constant pool as the disassembly shows it.
+func (vm *VM) frameName(f *Frame) string {
+	if f == vm.frames[0] {
+		return "main"
+	}
+	for i, c := range vm.constants {
+		if c == f.cl.Fn {
+			return fmt.Sprintf("constant %d", i)
+		}
+	}
+	return "function"
+}
+
+// dumpWindow disassembles the instructions around the one containing the
+// byte at ip, marking it with an arrow. A frame that has not started yet has
+// an ip of -1 and shows its first instructions.
+func dumpWindow(w io.Writer, ins code.Instructions, ip int) {
+	lines := strings.SplitAfter(ins.String(), "\n")
+	current := 0
+	for i, line := range lines {
+		var offset int
+		if _, err := fmt.Sscanf(line, "%d", &offset); err != nil || offset > ip {
+			break
+		}
+		current = i
+	}
+
+	for i := max(0, current-dumpWindowBefore); i < len(lines) && i <= current+dumpWindowAfter; i++ {
+		if lines[i] == "" {
+			continue
+		}
+		marker := "     "
+		if i == current && ip >= 0 {
+			marker = "  -> "
+		}
+		io.WriteString(w, marker+lines[i])
+	}
+}
@@ -0,0 +1,40 @@
+package vm
+
+import (
+	"github.com/frankie-mur/monkeylang/code"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// Frame is the activation record of a function call: the closure being
+// run, the position in its instructions and where its locals start on the
+// stack.
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
+
+// Pos returns the source position of the instruction at the frame's
+// instruction pointer.
+func (f *Frame) Pos() (token.Position, bool) {
+	return f.cl.Fn.SourceMap.Lookup(f.ip)
+}
+
+// Function returns the compiled function the frame runs.
+func (f *Frame) Function() *object.CompiledFunction {
+	return f.cl.Fn
+}
+
+// NextOffset returns the offset of the instruction the frame executes next.
+func (f *Frame) NextOffset() int {
+	return f.ip + 1
+}
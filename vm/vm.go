@@ -0,0 +1,1025 @@
+// Package vm implements the stack-based virtual machine that executes the
+// bytecode produced by package compiler.
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/frankie-mur/monkeylang/code"
+	"github.com/frankie-mur/monkeylang/compiler"
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/token"
+)
+
+// Default sizes of a VM, used for the zero fields of Options.
+const (
+	StackSize  = 2048
+	GlobalSize = 65536
+	MaxFrames  = 1024
+)
+
+// Options sets the size of a VM's value stack, of its globals store and the
+// maximum depth of nested calls. Zero fields use StackSize, GlobalSize and
+// MaxFrames. Context, if not nil, stops the program with an error once it
+// is done, as the evaluator's context does.
+type Options struct {
+	StackSize  int
+	GlobalSize int
+	MaxFrames  int
+	Context    context.Context
+}
+
+func (o Options) withDefaults() Options {
+	if o.StackSize <= 0 {
+		o.StackSize = StackSize
+	}
+	if o.GlobalSize <= 0 {
+		o.GlobalSize = GlobalSize
+	}
+	if o.MaxFrames <= 0 {
+		o.MaxFrames = MaxFrames
+	}
+	return o
+}
+
+// The VM shares the evaluator's singletons so values produced by either
+// engine compare equal and builtins see the booleans and null they expect.
+var (
+	True  = evaluator.TRUE
+	False = evaluator.FALSE
+	Null  = evaluator.NULL
+)
+
+// ExitError is returned by Run when the program calls exit.
+type ExitError struct {
+	Code int64
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit(%d)", e.Code)
+}
+
+// RuntimeError is an error that stopped a program, with the source
+// position of the instruction that failed when the bytecode has a source
+// map.
+type RuntimeError struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e *RuntimeError) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Message
+	}
+	return e.Pos.String() + ": " + e.Message
+}
+
+// VM executes the bytecode of one program.
+type VM struct {
+	constants []object.Object
+	// builtins are indexed like the compiler's builtin symbols.
+	builtins []*object.Builtin
+
+	stack []object.Object
+	sp    int // Always points to the next value. Top of stack is stack[sp-1]
+
+	// globals grows as the program defines them, up to maxGlobals, so
+	// small programs do not pay for allocating and scanning a store sized
+	// for the largest ones.
+	globals    []object.Object
+	maxGlobals int
+	// globalNames name the globals by index, for reporting globals read
+	// before their let statement has run.
+	globalNames []string
+
+	frames      []*Frame
+	framesIndex int
+
+	// stepping makes run return after one instruction, which stepped
+	// records it has executed.
+	stepping bool
+	stepped  bool
+	done     bool
+
+	// ctx stops the program once it is done; ticks counts instructions
+	// between checks of it.
+	ctx   context.Context
+	ticks int
+}
+
+// checkContextEvery is how many instructions pass between checks of the
+// VM's context.
+const checkContextEvery = 1024
+
+// New returns a VM that runs bytecode with the default sizes.
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithOptions(bytecode, Options{})
+}
+
+// NewWithOptions returns a VM that runs bytecode with the sizes set in opts.
+// Running out of stack, frames or globals stops the program with an error.
+func NewWithOptions(bytecode *compiler.Bytecode, opts Options) *VM {
+	opts = opts.withDefaults()
+	return newVM(bytecode, opts, nil)
+}
+
+func newVM(bytecode *compiler.Bytecode, opts Options, globals []object.Object) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, SourceMap: bytecode.SourceMap}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, opts.MaxFrames)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants: bytecode.Constants,
+		builtins:  evaluator.Builtins(),
+
+		stack: make([]object.Object, opts.StackSize),
+		sp:    0,
+
+		globals:     globals,
+		maxGlobals:  opts.GlobalSize,
+		globalNames: bytecode.GlobalNames,
+
+		frames:      frames,
+		framesIndex: 1,
+
+		ctx: opts.Context,
+	}
+}
+
+// NewWithGlobalsStore returns a VM that uses s for its globals, so the
+// REPL can keep global bindings from one line to the next.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	opts := Options{GlobalSize: len(s)}.withDefaults()
+	return newVM(bytecode, opts, s)
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= len(vm.frames) {
+		return fmt.Errorf("stack overflow at call depth %d: more than %d nested calls", vm.framesIndex, len(vm.frames)-1)
+	}
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// LastPoppedStackElem returns the value most recently popped off the stack,
+// which after Run is the value of the program's last expression statement.
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+// Run executes the program until its end or a return statement at the top
+// level. It returns an *ExitError when the program calls exit and a
+// *RuntimeError when it fails.
+func (vm *VM) Run() error {
+	return vm.runtimeError(vm.run())
+}
+
+// runtimeError adds the source position to an error that stopped the
+// program.
+func (vm *VM) runtimeError(err error) error {
+	var exit *ExitError
+	if err == nil || errors.As(err, &exit) {
+		return err
+	}
+	pos, _ := vm.Pos()
+	return &RuntimeError{Pos: pos, Message: err.Error()}
+}
+
+// contextError is the error that stops a program whose context is done,
+// with the evaluator's message.
+func contextError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errors.New("timeout exceeded")
+	}
+	return errors.New("evaluation canceled")
+}
+
+// Pos returns the source position of the instruction the VM is executing,
+// or stopped at.
+func (vm *VM) Pos() (token.Position, bool) {
+	// A call that fails while setting up its frame has not started
+	// executing it, so the position is the caller's.
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		if f := vm.frames[i]; f.ip >= 0 {
+			return f.Pos()
+		}
+	}
+	return token.Position{}, false
+}
+
+func (vm *VM) run() error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		if vm.stepping {
+			if vm.stepped {
+				return nil
+			}
+			vm.stepped = true
+		}
+
+		if vm.ctx != nil {
+			if vm.ticks++; vm.ticks%checkContextEvery == 0 {
+				if err := vm.ctx.Err(); err != nil {
+					return contextError(err)
+				}
+			}
+		}
+
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			if err := vm.push(vm.constants[constIndex]); err != nil {
+				return err
+			}
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight:
+			if err := vm.executeBinaryOperation(op); err != nil {
+				return err
+			}
+
+		case code.OpTrue:
+			if err := vm.push(True); err != nil {
+				return err
+			}
+
+		case code.OpFalse:
+			if err := vm.push(False); err != nil {
+				return err
+			}
+
+		case code.OpNull:
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+
+		case code.OpBang:
+			if err := vm.executeBangOperator(); err != nil {
+				return err
+			}
+
+		case code.OpMinus:
+			if err := vm.executeMinusOperator(); err != nil {
+				return err
+			}
+
+		case code.OpBitNot:
+			if err := vm.executeBitNotOperator(); err != nil {
+				return err
+			}
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if !isTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if globalIndex >= len(vm.globals) {
+				if globalIndex >= vm.maxGlobals {
+					return vm.globalsOverflow()
+				}
+				vm.globals = append(vm.globals, make([]object.Object, globalIndex+1-len(vm.globals))...)
+			}
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if globalIndex >= len(vm.globals) || vm.globals[globalIndex] == nil {
+				return vm.undefinedGlobal(globalIndex)
+			}
+			if err := vm.push(vm.globals[globalIndex]); err != nil {
+				return err
+			}
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			if err := vm.push(array); err != nil {
+				return err
+			}
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+
+			if err := vm.push(hash); err != nil {
+				return err
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			if err := vm.executeIndexExpression(left, index); err != nil {
+				return err
+			}
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			if err := vm.executeCall(int(numArgs)); err != nil {
+				return err
+			}
+
+		case code.OpTailCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			if err := vm.executeTailCall(int(numArgs)); err != nil {
+				return err
+			}
+
+		case code.OpCallBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			numArgs := int(code.ReadUint8(ins[ip+2:]))
+			vm.currentFrame().ip += 2
+
+			result := vm.builtins[builtinIndex].Fn(vm.stack[vm.sp-numArgs : vm.sp]...)
+			vm.sp -= numArgs
+
+			if err := vm.pushBuiltinResult(result); err != nil {
+				return err
+			}
+
+		case code.OpBinaryConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			binaryOp := code.Opcode(code.ReadUint8(ins[ip+3:]))
+			vm.currentFrame().ip += 3
+
+			if err := vm.executeBinaryConstant(binaryOp, vm.constants[constIndex]); err != nil {
+				return err
+			}
+
+		case code.OpGetLocalCall:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			numArgs := code.ReadUint8(ins[ip+2:])
+			vm.currentFrame().ip += 2
+
+			if err := vm.push(vm.local(int(localIndex))); err != nil {
+				return err
+			}
+			if err := vm.executeCall(int(numArgs)); err != nil {
+				return err
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			// A return at the top level ends the program with the returned
+			// value as its result.
+			if vm.framesIndex == 1 {
+				vm.done = true
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			if err := vm.push(returnValue); err != nil {
+				return err
+			}
+
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			if err := vm.push(vm.local(int(localIndex))); err != nil {
+				return err
+			}
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			if err := vm.push(vm.builtins[builtinIndex]); err != nil {
+				return err
+			}
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			if err := vm.pushClosure(int(constIndex), int(numFree)); err != nil {
+				return err
+			}
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			if err := vm.push(currentClosure.Free[freeIndex]); err != nil {
+				return err
+			}
+
+		case code.OpCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			slot := &vm.stack[vm.currentFrame().basePointer+int(localIndex)]
+			if *slot == nil {
+				*slot = Null
+			}
+			*slot = &cell{value: *slot}
+
+		case code.OpGetCell, code.OpSetCell, code.OpGetFreeCell, code.OpSetFreeCell:
+			index := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+
+			var c object.Object
+			if op == code.OpGetCell || op == code.OpSetCell {
+				c = vm.stack[vm.currentFrame().basePointer+index]
+			} else {
+				c = vm.currentFrame().cl.Free[index]
+			}
+			cell, ok := c.(*cell)
+			if !ok {
+				return fmt.Errorf("variable %d is not in a cell", index)
+			}
+
+			if op == code.OpGetCell || op == code.OpGetFreeCell {
+				if err := vm.push(cell.value); err != nil {
+					return err
+				}
+			} else {
+				cell.value = vm.pop()
+			}
+
+		case code.OpCurrentClosure:
+			currentClosure := vm.currentFrame().cl
+			if err := vm.push(currentClosure); err != nil {
+				return err
+			}
+
+		default:
+			def, err := code.Lookup(byte(op))
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("unhandled opcode %s", def.Name)
+		}
+	}
+
+	vm.done = true
+	return nil
+}
+
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+}
+
+// local returns the current frame's local at index. A local the function
+// reads before setting it, which only a hand-made .mbc file does, is NULL.
+func (vm *VM) local(index int) object.Object {
+	if value := vm.stack[vm.currentFrame().basePointer+index]; value != nil {
+		return value
+	}
+	return Null
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs)
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
+
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	if vm.sp >= len(vm.stack) {
+		return vm.stackOverflow()
+	}
+
+	return nil
+}
+
+// executeTailCall calls a closure in the frame of the function making the
+// call, which has nothing left to do but return the result, so recursion in
+// tail position runs in constant stack space. Builtins are called as usual
+// and the caller's following instructions return their result.
+func (vm *VM) executeTailCall(numArgs int) error {
+	cl, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure)
+	if !ok {
+		return vm.executeCall(numArgs)
+	}
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	}
+
+	// Move the callee and its arguments over those of the current call.
+	basePointer := vm.currentFrame().basePointer
+	copy(vm.stack[basePointer-1:], vm.stack[vm.sp-1-numArgs:vm.sp])
+
+	vm.frames[vm.framesIndex-1] = NewFrame(cl, basePointer)
+	vm.sp = basePointer + cl.Fn.NumLocals
+	if vm.sp >= len(vm.stack) {
+		return vm.stackOverflow()
+	}
+
+	return nil
+}
+
+// pushClosure wraps the compiled function constants[constIndex] in a
+// closure capturing the numFree values on top of the stack.
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
+}
+
+// cell holds a variable that closures capture and the program assigns, so
+// the function binding it and its closures all see the assignments. It
+// only ever appears in the slots of locals and free variables, and shows
+// as its value in dumps. Its type is its own, so that operations a corrupt
+// .mbc file applies to a cell rather than its value fail with an error.
+type cell struct {
+	value object.Object
+}
+
+// cellType is the type of a cell.
+const cellType object.ObjectType = "CELL"
+
+func (c *cell) Type() object.ObjectType { return cellType }
+func (c *cell) Inspect() string         { return c.value.Inspect() }
+
+// callBuiltin calls a builtin with the arguments on the stack. Builtins
+// report failures by returning error objects, which abort the program just
+// like they do in the evaluator.
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := builtin.Fn(args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	return vm.pushBuiltinResult(result)
+}
+
+// pushBuiltinResult pushes the value a builtin returned, turning errors and
+// exits into the errors Run returns for them.
+func (vm *VM) pushBuiltinResult(result object.Object) error {
+	switch result := result.(type) {
+	case *object.Error:
+		return errors.New(result.Message)
+	case *object.Exit:
+		return &ExitError{Code: result.Code}
+	case nil:
+		return vm.push(Null)
+	default:
+		return vm.push(result)
+	}
+}
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= len(vm.stack) {
+		return vm.stackOverflow()
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) stackOverflow() error {
+	return fmt.Errorf("stack overflow at call depth %d: more than %d values on the stack", vm.framesIndex, len(vm.stack))
+}
+
+func (vm *VM) globalsOverflow() error {
+	return fmt.Errorf("too many globals: the VM has room for %d", vm.maxGlobals)
+}
+
+// undefinedGlobal reports reading a global whose let statement has not run,
+// which the compiler allows when the let is in a branch not taken.
+func (vm *VM) undefinedGlobal(index int) error {
+	if index < len(vm.globalNames) {
+		return fmt.Errorf("identifier not found: %s", vm.globalNames[index])
+	}
+	return fmt.Errorf("identifier not found: global %d", index)
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+// The operations below report errors with the same messages as the
+// evaluator, so a program fails the same way on both engines.
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	leftType := left.Type()
+	rightType := right.Type()
+
+	switch {
+	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
+		return vm.executeBinaryIntegerOperation(op, left, right)
+	case isNumber(leftType) && isNumber(rightType):
+		// One operand is a float, so the integer, if any, is promoted.
+		return vm.executeBinaryFloatOperation(op, toFloat(left), toFloat(right))
+	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
+		return vm.executeBinaryStringOperation(op, left, right)
+	case leftType == object.ARRAY_OBJ && (op == code.OpAdd || op == code.OpMul):
+		return vm.executeBinaryArrayOperation(op, left, right)
+	case op == code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(left == right))
+	case op == code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(left != right))
+	case leftType != rightType:
+		return fmt.Errorf("type mismatch: %s %s %s", leftType, operatorSymbol(op), rightType)
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", leftType, operatorSymbol(op), rightType)
+	}
+}
+
+// executeBinaryConstant applies op to the top of the stack and the constant
+// right. Integers, by far the most common operands, are computed without
+// pushing the constant first.
+func (vm *VM) executeBinaryConstant(op code.Opcode, right object.Object) error {
+	left := vm.stack[vm.sp-1]
+	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
+		vm.sp--
+		return vm.executeBinaryIntegerOperation(op, left, right)
+	}
+
+	if err := vm.push(right); err != nil {
+		return err
+	}
+	return vm.executeBinaryOperation(op)
+}
+
+func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.Integer).Value
+	rightValue := right.(*object.Integer).Value
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.Integer{Value: leftValue + rightValue})
+	case code.OpSub:
+		return vm.push(&object.Integer{Value: leftValue - rightValue})
+	case code.OpMul:
+		return vm.push(&object.Integer{Value: leftValue * rightValue})
+	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		return vm.push(&object.Integer{Value: leftValue / rightValue})
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpBitAnd:
+		return vm.push(&object.Integer{Value: leftValue & rightValue})
+	case code.OpBitOr:
+		return vm.push(&object.Integer{Value: leftValue | rightValue})
+	case code.OpBitXor:
+		return vm.push(&object.Integer{Value: leftValue ^ rightValue})
+	case code.OpShiftLeft, code.OpShiftRight:
+		if rightValue < 0 {
+			return fmt.Errorf("negative shift count: %d", rightValue)
+		}
+		if op == code.OpShiftLeft {
+			return vm.push(&object.Integer{Value: leftValue << rightValue})
+		}
+		return vm.push(&object.Integer{Value: leftValue >> rightValue})
+	default:
+		return fmt.Errorf("unknown integer operator: %d", op)
+	}
+}
+
+func (vm *VM) executeBinaryFloatOperation(op code.Opcode, left, right float64) error {
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.Float{Value: left + right})
+	case code.OpSub:
+		return vm.push(&object.Float{Value: left - right})
+	case code.OpMul:
+		return vm.push(&object.Float{Value: left * right})
+	case code.OpDiv:
+		if right == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		return vm.push(&object.Float{Value: left / right})
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(left == right))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(left != right))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(left > right))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(left < right))
+	default:
+		return fmt.Errorf("unknown operator: FLOAT %s FLOAT", operatorSymbol(op))
+	}
+}
+
+func isNumber(t object.ObjectType) bool {
+	return t == object.INTEGER_OBJ || t == object.FLOAT_OBJ
+}
+
+// toFloat returns the value of obj, an integer or a float, as a float.
+func toFloat(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
+// executeBinaryArrayOperation concatenates two arrays or repeats an array
+// a number of times.
+func (vm *VM) executeBinaryArrayOperation(op code.Opcode, left, right object.Object) error {
+	array := left.(*object.Array)
+
+	switch {
+	case op == code.OpAdd && right.Type() == object.ARRAY_OBJ:
+		concatenated, err := array.Concat(right.(*object.Array))
+		if err != nil {
+			return err
+		}
+		return vm.push(concatenated)
+	case op == code.OpMul && right.Type() == object.INTEGER_OBJ:
+		repeated, err := array.Repeat(right.(*object.Integer).Value)
+		if err != nil {
+			return err
+		}
+		return vm.push(repeated)
+	case right.Type() != object.ARRAY_OBJ:
+		return fmt.Errorf("type mismatch: %s %s %s", left.Type(), operatorSymbol(op), right.Type())
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operatorSymbol(op), right.Type())
+	}
+}
+
+func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	switch op {
+	case code.OpAdd:
+		concatenated, err := left.(*object.String).Concat(rightValue)
+		if err != nil {
+			return err
+		}
+		return vm.push(concatenated)
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operatorSymbol(op), right.Type())
+	}
+}
+
+func (vm *VM) executeBangOperator() error {
+	operand := vm.pop()
+
+	switch operand {
+	case True:
+		return vm.push(False)
+	case False:
+		return vm.push(True)
+	case Null:
+		return vm.push(True)
+	default:
+		return vm.push(False)
+	}
+}
+
+func (vm *VM) executeMinusOperator() error {
+	operand := vm.pop()
+
+	if f, ok := operand.(*object.Float); ok {
+		return vm.push(&object.Float{Value: -f.Value})
+	}
+
+	if operand.Type() != object.INTEGER_OBJ {
+		return fmt.Errorf("unknown operator: -%s", operand.Type())
+	}
+
+	value := operand.(*object.Integer).Value
+	return vm.push(&object.Integer{Value: -value})
+}
+
+func (vm *VM) executeBitNotOperator() error {
+	operand := vm.pop()
+
+	i, ok := operand.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("unknown operator: ~%s", operand.Type())
+	}
+	return vm.push(&object.Integer{Value: ^i.Value})
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hashedPairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		pair := object.HashPair{Key: key, Value: value}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+
+		hashedPairs[hashKey.HashKey()] = pair
+	}
+
+	return &object.Hash{Pairs: hashedPairs}, nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return vm.executeHashIndex(left, index)
+	default:
+		return fmt.Errorf("index operator not supported: %s", left.Type())
+	}
+}
+
+func (vm *VM) executeArrayIndex(array, index object.Object) error {
+	arrayObject := array.(*object.Array)
+	i := index.(*object.Integer).Value
+	max := int64(len(arrayObject.Elements) - 1)
+
+	if i < 0 || i > max {
+		return vm.push(Null)
+	}
+
+	return vm.push(arrayObject.Elements[i])
+}
+
+func (vm *VM) executeHashIndex(hash, index object.Object) error {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return fmt.Errorf("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok && hashObject.Default != nil {
+		// Call the default function as if the program had, with the key
+		// as its argument; its result takes the place of the callee.
+		if err := vm.push(hashObject.Default); err != nil {
+			return err
+		}
+		if err := vm.push(index); err != nil {
+			return err
+		}
+		return vm.executeCall(1)
+	}
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(pair.Value)
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case Null, False:
+		return false
+	default:
+		return true
+	}
+}
+
+func nativeBoolToBooleanObject(native bool) *object.Boolean {
+	if native {
+		return True
+	}
+	return False
+}
+
+var operatorSymbols = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+	code.OpBitAnd:      "&",
+	code.OpBitOr:       "|",
+	code.OpBitXor:      "^",
+	code.OpShiftLeft:   "<<",
+	code.OpShiftRight:  ">>",
+}
+
+func operatorSymbol(op code.Opcode) string {
+	return operatorSymbols[op]
+}
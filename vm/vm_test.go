@@ -0,0 +1,595 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frankie-mur/monkeylang/code"
+	"github.com/frankie-mur/monkeylang/compiler"
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/parser"
+	"github.com/frankie-mur/monkeylang/resolver"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"1 + 2", 3},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-50 + 100 + -50", 0},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"true == false", false},
+		{"(1 < 2) == true", true},
+		{"!true", false},
+		{"!!5", true},
+		{"!(if (false) { 5; })", true},
+		{`"a" == "a"`, true},
+		{"1 == true", false},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 > 2) { 10 }", Null},
+		{"if (false) { 10 }", Null},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (true) { let a = 1; }", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = one + one; one + two", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestReturnAtTopLevel(t *testing.T) {
+	tests := []vmTestCase{
+		{"return 10; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"if (10 > 1) { return 10; }; 1", 10},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringArrayAndHashExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"mon" + "key"`, "monkey"},
+		{"[1, 2 * 2, 3 + 3]", []int{1, 4, 6}},
+		{"[]", []int{}},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][3]", Null},
+		{"[1][-1]", Null},
+		{"{1: 1, 2: 2}[2]", 2},
+		{"{}[0]", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let fivePlusTen = fn() { 5 + 10; }; fivePlusTen();", 15},
+		{"let a = fn() { 1 }; let b = fn() { a() + 1 }; b();", 2},
+		{"let early = fn() { return 99; 100; }; early();", 99},
+		{"let noReturn = fn() { }; noReturn();", Null},
+		{"let one = fn() { let one = 1; one }; one();", 1},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);", 10},
+		{"let global = 10; let f = fn(a) { a + global }; f(5)", 15},
+		{"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)", 610},
+		{"let f = fn(x) { if (x > 0) { return x; }; -x }; f(-3) + f(4)", 7},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{"let newClosure = fn(a) { fn() { a; }; }; let closure = newClosure(99); closure();", 99},
+		{"let newAdder = fn(a, b) { fn(c) { a + b + c }; }; let adder = newAdder(1, 2); adder(8);", 11},
+		{"let newAdder = fn(a, b) { let c = a + b; fn(d) { c + d }; }; let adder = newAdder(1, 2); adder(8);", 11},
+		{`
+		let newClosure = fn(a, b) {
+			let one = fn() { a; };
+			let two = fn() { b; };
+			fn() { one() + two(); };
+		};
+		let closure = newClosure(9, 90);
+		closure();`, 99},
+		{`
+		let wrapper = fn() {
+			let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+			countDown(1);
+		};
+		wrapper();`, 0},
+		{"let map = fn(arr, f) { if (len(arr) == 0) { [] } else { let r = map(rest(arr), f); [f(first(arr))] } }; map([1], fn(x) { x * 2 })", []int{2}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosureAssignments(t *testing.T) {
+	tests := []vmTestCase{
+		{"let counter = fn() { let n = 0; fn() { n = n + 1 } }; let c = counter(); c(); c()", 2},
+		{"let counter = fn() { let n = 0; fn() { n = n + 1 } }; let c = counter(); c(); counter()()", 1},
+		{"let f = fn() { let n = 1; let g = fn() { n = 10 }; g(); n }; f()", 10},
+		{"let f = fn() { let x = 1; let g = fn() { let x = 2; x = 3 }; g(); x }; f()", 1},
+		{"let f = fn() { let n = 1; let g = fn() { n }; n = 5; g() }; f()", 5},
+		{"let f = fn() { let n = 1; let g = fn() { n }; let n = 7; g() }; f()", 7},
+		{"let f = fn() { let n = 0; let inc = fn() { n++ }; inc(); inc(); n }; f()", 2},
+		{"let f = fn() { let n = 0; let g = fn() { fn() { n += 5 } }; g()(); n }; f()", 5},
+		{"let f = fn(n) { let add = fn(d) { n = n + d }; add(2); add(3); n }; f(10)", 15},
+		{"let f = fn() { let g = fn() { 1 }; let h = fn() { g() }; g = fn() { 2 }; h() }; f()", 2},
+		{"let f = fn() { let g = fn(n) { if (n > 0) { g(n - 1) } else { 0 } }; let h = g; g = fn(n) { 9 }; h(1) }; f()", 9},
+		{"let fs = fn() { let i = 0; let fs = []; while (i < 3) { let j = i; let fs = push(fs, fn() { j }); i += 1 }; fs }; fs()[0]()", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{"let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } }; sum(100000, 0)", 5000050000},
+		{"let f = fn(n) { if (n == 0) { return 0; }; return f(n - 1); }; f(5000)", 0},
+		{"let f = fn(n) { if (n > 0) { let g = fn(x) { f(x) }; g(n - 1) } else { 7 } }; f(5000)", 7},
+		{"let f = fn(a) { len(a) }; f([1, 2]) + 1", 3},
+		{"let f = fn(a, b) { a - b }; let g = fn(x) { f(x, 1) }; g(10) * 2", 18},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len([1, 2, 3])`, 3},
+		{`first([1, 2, 3])`, 1},
+		{`last([1, 2, 3])`, 3},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`push([], 1)`, []int{1}},
+		{`assert(true)`, Null},
+		{`assert_eq([1, 2], [1, 2])`, Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestExit(t *testing.T) {
+	bytecode, err := compiler.Compile(parser.New(lexer.New("let f = fn() { exit(3) }; f(); 1")).ParseProgram())
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err = New(bytecode).Run()
+	exit, ok := err.(*ExitError)
+	if !ok {
+		t.Fatalf("expected *ExitError, got=%T (%v)", err, err)
+	}
+	if exit.Code != 3 {
+		t.Errorf("wrong exit code. want=3, got=%d", exit.Code)
+	}
+}
+
+func TestGlobalsStore(t *testing.T) {
+	constants := []object.Object{}
+	globals := make([]object.Object, GlobalSize)
+	symbolTable := compiler.New().SymbolTable()
+
+	var result object.Object
+	for _, line := range []string{"let a = 1;", "let f = fn(x) { x + a };", "f(2)"} {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(parser.New(lexer.New(line)).ParseProgram()); err != nil {
+			t.Fatalf("%q: compiler error: %s", line, err)
+		}
+
+		bytecode := comp.Bytecode()
+		constants = bytecode.Constants
+
+		vm := NewWithGlobalsStore(bytecode, globals)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("%q: vm error: %s", line, err)
+		}
+		result = vm.LastPoppedStackElem()
+	}
+
+	testExpectedObject(t, "f(2)", 3, result)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true;", "1:1: type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "1:1: unknown operator: -BOOLEAN"},
+		{"true + false;", "1:1: unknown operator: BOOLEAN + BOOLEAN"},
+		{`"Hello" - "World"`, "1:1: unknown operator: STRING - STRING"},
+		{"{[1]: 2}", "1:1: unusable as hash key: ARRAY"},
+		{"1[0]", "1:1: index operator not supported: INTEGER"},
+		{"let a = 1;\nlet b = a - 1;\n3 * (a / b)", "3:6: division by zero"},
+		{"1(2)", "1:1: not a function: INTEGER"},
+		{"fn(a) { a }()", "1:1: wrong number of arguments: want=1, got=0"},
+		{"len(1)", "1:1: argument to `len` not supported, got INTEGER"},
+		{"if (false) { let x = 1; }\nx", "2:1: identifier not found: x"},
+		{"assert_eq(1, 2)", "1:1: assertion failed: expected 2, got 1"},
+		{"let f = fn() { 1 + f() }; f()", "1:20: stack overflow at call depth 1024: more than 1023 nested calls"},
+	}
+
+	for _, tt := range tests {
+		bytecode, err := compiler.Compile(parser.New(lexer.New(tt.input)).ParseProgram())
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(bytecode).Run()
+		if err == nil {
+			t.Errorf("%q: expected VM error", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong VM error. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	input := `let add = fn(a, b) { a + b };
+let f = fn(x) { 1 + add(x, "two") };
+f(1)`
+	bytecode, err := compiler.Compile(parser.New(lexer.New(input)).ParseProgram())
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := New(bytecode)
+	if err := machine.Run(); err == nil {
+		t.Fatal("expected VM error")
+	}
+
+	var out strings.Builder
+	machine.Dump(&out)
+
+	// The closures on the stack print their addresses, so only the values
+	// above them are compared.
+	expectedStack := `stack (6 values):
+     5  STRING "two"
+     4  INTEGER 1
+`
+	expectedFrames := `frames (3):
+  #2 constant 0 ip=4 base=4 at 1:22
+     0000 OpGetLocal 0
+     0002 OpGetLocal 1
+  -> 0004 OpAdd
+     0005 OpReturnValue
+  #1 constant 3 ip=12 base=1 at 2:21
+     0000 OpConstant 1
+     0003 OpGetGlobal 0
+     0006 OpGetLocal 0
+     0008 OpConstant 2
+  -> 0011 OpCall 2
+     0013 OpAdd
+     0014 OpReturnValue
+  #0 main ip=21 base=0 at 3:1
+`
+	if !strings.HasPrefix(out.String(), expectedStack) || !strings.Contains(out.String(), expectedFrames) {
+		t.Errorf("wrong dump. got=\n%s", out.String())
+	}
+}
+
+func TestOptions(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-expired.Done()
+
+	tests := []struct {
+		input    string
+		opts     Options
+		expected string
+	}{
+		{"let f = fn(n) { if (n > 0) { 1 + f(n - 1) } }; f(10)", Options{MaxFrames: 5}, "1:34: stack overflow at call depth 5: more than 4 nested calls"},
+		{"[1, 2, 3, 4, 5]", Options{StackSize: 4}, "1:14: stack overflow at call depth 1: more than 4 values on the stack"},
+		{"let f = fn(a, b, c, d) { a }; f(1, 2, 3, 4)", Options{StackSize: 5}, "1:31: stack overflow at call depth 2: more than 5 values on the stack"},
+		{"let a = 1; let b = 2;", Options{GlobalSize: 1}, "1:12: too many globals: the VM has room for 1"},
+		{"let f = fn(n) { if (n > 0) { f(n - 1) } else { 7 } }; f(10)", Options{MaxFrames: 12}, ""},
+		{"while (true) {}", Options{Context: canceled}, "evaluation canceled"},
+		{"while (true) {}", Options{Context: expired}, "timeout exceeded"},
+		{"1 + 1", Options{Context: canceled}, ""},
+	}
+
+	for _, tt := range tests {
+		bytecode, err := compiler.Compile(parser.New(lexer.New(tt.input)).ParseProgram())
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = NewWithOptions(bytecode, tt.opts).Run()
+		switch {
+		case tt.expected == "" && err != nil:
+			t.Errorf("%q: unexpected VM error: %s", tt.input, err)
+		case tt.expected != "" && (err == nil || err.Error() != tt.expected):
+			t.Errorf("%q: wrong VM error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+// TestLoadedFunctions runs loaded programs calling a function that misuses
+// its locals, which the compiler never produces but Load accepts: reading
+// a local before setting it or a local in a cell as a value.
+func TestLoadedFunctions(t *testing.T) {
+	tests := []struct {
+		body     code.Instructions
+		expected string
+	}{
+		{append(code.Make(code.OpGetLocal, 0), code.Make(code.OpReturnValue)...), ""},
+		{append(code.Make(code.OpGetLocalCall, 0, 0), code.Make(code.OpReturnValue)...), "not a function: NULL"},
+		{bytes.Join([][]byte{
+			code.Make(code.OpConstant, 1),
+			code.Make(code.OpSetLocal, 0),
+			code.Make(code.OpCell, 0),
+			code.Make(code.OpGetLocal, 0),
+			code.Make(code.OpConstant, 1),
+			code.Make(code.OpAdd),
+			code.Make(code.OpReturnValue),
+		}, nil), "type mismatch: CELL + INTEGER"},
+		{bytes.Join([][]byte{
+			code.Make(code.OpConstant, 1),
+			code.Make(code.OpSetLocal, 0),
+			code.Make(code.OpCell, 0),
+			code.Make(code.OpGetLocal, 0),
+			code.Make(code.OpMinus),
+			code.Make(code.OpReturnValue),
+		}, nil), "unknown operator: -CELL"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		err := compiler.Save(&buf, &compiler.Bytecode{
+			Instructions: append(append(code.Make(code.OpClosure, 0, 0), code.Make(code.OpCall, 0)...), code.Make(code.OpPop)...),
+			Constants:    []object.Object{&object.CompiledFunction{Instructions: tt.body, NumLocals: 1}, &object.Integer{Value: 1}},
+		})
+		if err != nil {
+			t.Fatalf("Save failed: %s", err)
+		}
+		bytecode, err := compiler.Load(&buf)
+		if err != nil {
+			t.Fatalf("Load failed: %s", err)
+		}
+
+		machine := New(bytecode)
+		err = machine.Run()
+		switch {
+		case tt.expected == "" && err != nil:
+			t.Errorf("unexpected VM error: %s", err)
+		case tt.expected != "" && (err == nil || err.Error() != tt.expected):
+			t.Errorf("wrong VM error. want=%q, got=%v", tt.expected, err)
+		case tt.expected == "" && machine.LastPoppedStackElem() != Null:
+			t.Errorf("unset local is not NULL. got=%v", machine.LastPoppedStackElem())
+		}
+	}
+}
+
+// FuzzLoad runs corrupted .mbc files and fails if the VM panics on one that
+// Load accepts. Run it with
+//
+//	go test ./vm -run '^$' -fuzz FuzzLoad
+func FuzzLoad(f *testing.F) {
+	seeds := []string{
+		"let a = [1, 2.5, \"three\"]; let h = {1: a}; h[1][2]",
+		"let f = fn(n) { let g = fn() { n += 1 }; g(); n * 2 }; f(1)",
+		"let f = fn(x) { fn(y) { if (x > y) { x } else { y } } }; f(1)(2)",
+		"let n = 0; while (n < 10) { n += 1 }; len(\"abc\") + n",
+	}
+	for _, bm := range callBenchmarks {
+		seeds = append(seeds, bm.input)
+	}
+	for _, seed := range seeds {
+		bytecode, err := compiler.Compile(parser.New(lexer.New(seed)).ParseProgram())
+		if err != nil {
+			f.Fatalf("compiler error: %s", err)
+		}
+		var buf bytes.Buffer
+		if err := compiler.Save(&buf, bytecode); err != nil {
+			f.Fatalf("Save failed: %s", err)
+		}
+		f.Add(buf.Bytes())
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		bytecode, err := compiler.Load(bytes.NewReader(data))
+		if err != nil || reachesOutside(bytecode) {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		NewWithOptions(bytecode, Options{Context: ctx}).Run()
+	})
+}
+
+// reachesOutside reports whether the program refers to a builtin that
+// performs I/O or needs a capability, which fuzzing must not call.
+func reachesOutside(bytecode *compiler.Bytecode) bool {
+	all := []code.Instructions{bytecode.Instructions}
+	for _, c := range bytecode.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			all = append(all, fn.Instructions)
+		}
+	}
+
+	builtins := evaluator.Builtins()
+	for _, ins := range all {
+		for i := 0; i < len(ins); {
+			def, _ := code.Lookup(ins[i])
+			operands, read := code.ReadOperands(def, ins[i+1:])
+			switch code.Opcode(ins[i]) {
+			case code.OpGetBuiltin, code.OpCallBuiltin:
+				if b := builtins[operands[0]]; b.IO || b.Capability != "" {
+					return true
+				}
+			}
+			i += 1 + read
+		}
+	}
+	return false
+}
+
+// callBenchmarks are call-heavy programs, where the VM's slot-resolved
+// locals and globals pay off against the evaluator's environment lookups.
+var callBenchmarks = []struct {
+	name  string
+	input string
+}{
+	{"fibonacci", "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(20)"},
+	{"locals", `
+	let f = fn(n) {
+		let a = n + 1;
+		let b = a * 2;
+		let c = b - a;
+		if (c > 0) { f(n - 1) + c } else { 0 }
+	};
+	f(200)`},
+	{"closures", `
+	let adder = fn(x) { fn(y) { x + y } };
+	let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, adder(n)(acc)) } };
+	sum(500, 0)`},
+}
+
+func BenchmarkCalls(b *testing.B) {
+	for _, bm := range callBenchmarks {
+		program := parser.New(lexer.New(bm.input)).ParseProgram()
+
+		b.Run(bm.name+"/eval", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if result := evaluator.Eval(program, object.NewEnvironment()); result.Type() == object.ERROR_OBJ {
+					b.Fatal(result.Inspect())
+				}
+			}
+		})
+
+		b.Run(bm.name+"/eval-resolved", func(b *testing.B) {
+			resolved := parser.New(lexer.New(bm.input)).ParseProgram()
+			resolver.Resolve(resolved)
+			for i := 0; i < b.N; i++ {
+				if result := evaluator.Eval(resolved, object.NewEnvironment()); result.Type() == object.ERROR_OBJ {
+					b.Fatal(result.Inspect())
+				}
+			}
+		})
+
+		b.Run(bm.name+"/vm", func(b *testing.B) {
+			bytecode, err := compiler.Compile(program)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if err := New(bytecode).Run(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+
+		bytecode, err := compiler.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(bytecode)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("%q: vm error: %s", tt.input, err)
+		}
+
+		testExpectedObject(t, tt.input, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{}, actual object.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		integer, ok := actual.(*object.Integer)
+		if !ok || integer.Value != int64(expected) {
+			t.Errorf("%q: wrong result. want=%d, got=%s", input, expected, inspect(actual))
+		}
+
+	case bool:
+		if actual != nativeBoolToBooleanObject(expected) {
+			t.Errorf("%q: wrong result. want=%t, got=%s", input, expected, inspect(actual))
+		}
+
+	case string:
+		str, ok := actual.(*object.String)
+		if !ok || str.Value != expected {
+			t.Errorf("%q: wrong result. want=%q, got=%s", input, expected, inspect(actual))
+		}
+
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok || len(array.Elements) != len(expected) {
+			t.Errorf("%q: wrong result. want=%v, got=%s", input, expected, inspect(actual))
+			return
+		}
+		for i, el := range expected {
+			testExpectedObject(t, input, el, array.Elements[i])
+		}
+
+	case *object.Null:
+		if actual != Null {
+			t.Errorf("%q: wrong result. want=null, got=%s", input, inspect(actual))
+		}
+	}
+}
+
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+	return obj.Inspect()
+}
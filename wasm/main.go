@@ -0,0 +1,106 @@
+//go:build js && wasm
+
+// Command wasm is the Monkey interpreter built for WebAssembly, so a web
+// page can run programs client-side. Build it and copy Go's JavaScript
+// support next to it with
+//
+//	GOOS=js GOARCH=wasm go build -o wasm/monkey.wasm ./wasm
+//	cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" wasm/
+//
+// then serve the wasm directory; index.html is an example page and
+// monkey.js loads the interpreter. Once running, the program defines two
+// functions on the JavaScript global object:
+//
+//	runMonkey(source, options) -> {output, errors, exitCode}
+//	newMonkeyRepl(onOutput, options) -> {eval(line) -> {output, errors, value, exitCode}}
+//
+// runMonkey evaluates a whole program. A REPL keeps its bindings from one
+// line to the next and, if onOutput is a function, calls it with each
+// chunk of output as the program writes it. The optional options object
+// may set maxSteps and maxDepth, which default to 1e8 and 500.
+package main
+
+import (
+	"strings"
+	"syscall/js"
+
+	"github.com/frankie-mur/monkeylang/evaluator"
+)
+
+func main() {
+	js.Global().Set("runMonkey", js.FuncOf(runMonkey))
+	js.Global().Set("newMonkeyRepl", js.FuncOf(newMonkeyRepl))
+	select {}
+}
+
+func runMonkey(this js.Value, args []js.Value) interface{} {
+	if len(args) == 0 || args[0].Type() != js.TypeString {
+		return toJS(result{Errors: []string{"runMonkey: the source must be a string"}}, "")
+	}
+
+	var out strings.Builder
+	r := newSession(limitsOption(args, 1)).eval(args[0].String(), &out)
+	return toJS(r, out.String())
+}
+
+func newMonkeyRepl(this js.Value, args []js.Value) interface{} {
+	var onOutput js.Value
+	if len(args) > 0 && args[0].Type() == js.TypeFunction {
+		onOutput = args[0]
+	}
+	s := newSession(limitsOption(args, 1))
+
+	eval := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) == 0 || args[0].Type() != js.TypeString {
+			return toJS(result{Errors: []string{"eval: the line must be a string"}}, "")
+		}
+		out := &streamWriter{onOutput: onOutput}
+		r := s.eval(args[0].String(), out)
+		return toJS(r, out.buf.String())
+	})
+	return js.ValueOf(map[string]interface{}{"eval": eval})
+}
+
+// streamWriter collects output and passes each write on to onOutput, if
+// it is set.
+type streamWriter struct {
+	buf      strings.Builder
+	onOutput js.Value
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	if w.onOutput.Truthy() {
+		w.onOutput.Invoke(string(p))
+	}
+	return len(p), nil
+}
+
+// limitsOption reads the limits from the options object at args[i], if
+// there is one.
+func limitsOption(args []js.Value, i int) evaluator.Limits {
+	limits := defaultLimits
+	if i >= len(args) || args[i].Type() != js.TypeObject {
+		return limits
+	}
+	if v := args[i].Get("maxSteps"); v.Type() == js.TypeNumber {
+		limits.MaxSteps = int64(v.Float())
+	}
+	if v := args[i].Get("maxDepth"); v.Type() == js.TypeNumber {
+		limits.MaxDepth = v.Int()
+	}
+	return limits
+}
+
+func toJS(r result, output string) js.Value {
+	errors := make([]interface{}, len(r.Errors))
+	for i, err := range r.Errors {
+		errors[i] = err
+	}
+	return js.ValueOf(map[string]interface{}{
+		"output":   output,
+		"errors":   errors,
+		"value":    r.Value,
+		"exitCode": r.ExitCode,
+	})
+}
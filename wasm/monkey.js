@@ -0,0 +1,22 @@
+// monkey.js loads the Monkey interpreter compiled to WebAssembly. The page
+// must load wasm_exec.js from the Go distribution first, which defines Go.
+//
+//	const monkey = await loadMonkey("monkey.wasm");
+//	const { output, errors, exitCode } = monkey.run('puts("hello")');
+//	const repl = monkey.newRepl((text) => console.log(text));
+//	repl.eval("let x = 1;");
+//
+// See main.go for the results these functions return.
+
+export async function loadMonkey(url = "monkey.wasm") {
+  const go = new Go();
+  const { instance } = await WebAssembly.instantiateStreaming(fetch(url), go.importObject);
+  // run resolves only when the Go program exits, which it never does; the
+  // functions are defined by the time it yields.
+  go.run(instance);
+
+  return {
+    run: (source, options) => globalThis.runMonkey(source, options),
+    newRepl: (onOutput, options) => globalThis.newMonkeyRepl(onOutput, options),
+  };
+}
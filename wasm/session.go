@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io"
+
+	"github.com/frankie-mur/monkeylang/evaluator"
+	"github.com/frankie-mur/monkeylang/lexer"
+	"github.com/frankie-mur/monkeylang/object"
+	"github.com/frankie-mur/monkeylang/parser"
+	"github.com/frankie-mur/monkeylang/resolver"
+)
+
+// defaultLimits keep a runaway program from freezing the page, as the
+// evaluator runs on the browser's main thread. The depth is low because
+// WebAssembly calls use the JavaScript engine's stack, which a recursion of
+// about a thousand Monkey calls already exhausts, killing the instance.
+var defaultLimits = evaluator.Limits{MaxSteps: 100_000_000, MaxDepth: 500}
+
+// session evaluates source in an environment that persists between calls,
+// as a REPL does. runMonkey uses a fresh session for every program.
+type session struct {
+	env       *object.Enviroment
+	evaluator *evaluator.Evaluator
+}
+
+// result is what evaluating some source produced.
+type result struct {
+	Errors []string
+	// Value is the inspected value of the last expression, "" if it has
+	// none.
+	Value    string
+	ExitCode int64
+}
+
+func newSession(limits evaluator.Limits) *session {
+	e := evaluator.New()
+	e.SetLimits(limits)
+	return &session{env: object.NewEnvironment(), evaluator: e}
+}
+
+// eval parses and evaluates src, writing the output of puts to out.
+func (s *session) eval(src string, out io.Writer) result {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if errs := p.ParseErrors(); len(errs) != 0 {
+		var r result
+		for _, err := range errs {
+			r.Errors = append(r.Errors, err.Error())
+		}
+		return r
+	}
+
+	resolver.Resolve(program)
+
+	defer func(w io.Writer) { evaluator.Output = w }(evaluator.Output)
+	evaluator.Output = out
+
+	var r result
+	switch obj := s.evaluator.Eval(program, s.env).(type) {
+	case nil:
+	case *object.Error:
+		r.Errors = []string{s.evaluator.Located(obj).Message}
+	case *object.Exit:
+		r.ExitCode = obj.Code
+	case *object.Null:
+	default:
+		r.Value = obj.Inspect()
+	}
+	return r
+}
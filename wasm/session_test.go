@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/frankie-mur/monkeylang/evaluator"
+)
+
+func TestSession(t *testing.T) {
+	s := newSession(defaultLimits)
+
+	tests := []struct {
+		input    string
+		output   string
+		expected result
+	}{
+		{`puts("hi"); 1 + 2`, "\"hi\"\n", result{Value: "3"}},
+		{"let x = 5;", "", result{}},
+		{"puts(x); x * 2", "5\n", result{Value: "10"}},
+		{"let y = ;", "", result{Errors: []string{"1:9: no prefix parse function for token ';' found"}}},
+		{"y", "", result{Errors: []string{"1:1: identifier not found: y"}}},
+		{"puts(x); exit(3); puts(1)", "5\n", result{ExitCode: 3}},
+		{"puts(1); if (false) { 2 }", "1\n", result{}},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		got := s.eval(tt.input, &out)
+		if out.String() != tt.output {
+			t.Errorf("%q: wrong output. want=%q, got=%q", tt.input, tt.output, out.String())
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%q: wrong result. want=%+v, got=%+v", tt.input, tt.expected, got)
+		}
+	}
+
+	if evaluator.Output == nil {
+		t.Errorf("the output of puts should be restored")
+	}
+}
+
+func TestSessionLimits(t *testing.T) {
+	recurse := "let f = fn(n) { 1 + f(n + 1) }; f(0)"
+	got := newSession(defaultLimits).eval(recurse, &strings.Builder{})
+	want := []string{"1:21: maximum call depth of 500 exceeded"}
+	if !reflect.DeepEqual(got.Errors, want) {
+		t.Errorf("wrong errors. want=%q, got=%q", want, got.Errors)
+	}
+
+	got = newSession(evaluator.Limits{MaxSteps: 10}).eval(recurse, &strings.Builder{})
+	want = []string{"1:17: step limit exceeded: evaluated more than 10 nodes"}
+	if !reflect.DeepEqual(got.Errors, want) {
+		t.Errorf("wrong errors. want=%q, got=%q", want, got.Errors)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// clearScreen moves the cursor home and clears an ANSI terminal.
+const clearScreen = "\x1b[H\x1b[2J"
+
+// watch runs the program in file and runs it again every time the file
+// changes, until ctx is done. Changes are detected by polling the file's
+// modification time and size every interval, which works the same on every
+// platform and for editors that save by renaming a new file into place.
+// A change stops the run in progress before starting the next, and so does
+// ctx being done before watch returns.
+//
+// Parse and runtime errors are reported after the program's output and do
+// not stop watching; neither does the file disappearing for a while. A
+// file missing from the start is an error.
+func watch(ctx context.Context, file string, interval time.Duration, opts runOptions, stdout, stderr io.Writer) int {
+	if _, err := os.Stat(file); err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return exitUsage
+	}
+
+	var last os.FileInfo
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// stop stops the run in progress and waits for it to end.
+	stop := func() {}
+	defer func() { stop() }()
+
+	for {
+		info, err := os.Stat(file)
+		switch {
+		case err != nil:
+			if last != nil {
+				fmt.Fprintf(stderr, "monkey: %s\n", err)
+				last = nil
+			}
+		case last == nil || !info.ModTime().Equal(last.ModTime()) || info.Size() != last.Size():
+			last = info
+			stop()
+			stop = start(ctx, func(ctx context.Context) {
+				runWatched(ctx, file, opts, stdout, stderr)
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return exitOK
+		case <-ticker.C:
+		}
+	}
+}
+
+// start calls f on a goroutine of its own with a context derived from ctx.
+// The function it returns cancels that context and waits for f to return.
+func start(ctx context.Context, f func(context.Context)) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f(ctx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// runWatched clears the screen and runs file once, until ctx is done,
+// followed by a status line.
+func runWatched(ctx context.Context, file string, opts runOptions, stdout, stderr io.Writer) {
+	fmt.Fprint(stdout, clearScreen)
+	fmt.Fprintf(stdout, "[%s] running %s\n", time.Now().Format("15:04:05"), file)
+
+	code := exitUsage
+	src, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+	} else {
+		code = run(ctx, string(src), opts, stderr)
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		fmt.Fprintf(stdout, "stopped\n")
+	case code != exitOK:
+		fmt.Fprintf(stdout, "exit status %d; watching for changes\n", code)
+	default:
+		fmt.Fprintf(stdout, "done; watching for changes\n")
+	}
+}